@@ -2,6 +2,7 @@
 package api
 
 import (
+	gocontext "context"
 	"fmt"
 	"net/http"
 	"sort"
@@ -162,7 +163,12 @@ func releaseDatabaseConnection() error {
 
 // runs tasks in background. Acquires database connection first.
 func runTaskInBackground(name string, resources []string, proc task.Process) (task.Task, *task.ResourceConflictError) {
-	return context.TaskList().RunTaskInBackground(name, resources, func(out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+	return runTaskInBackgroundWithOptions(name, resources, proc, task.Options{})
+}
+
+// runs tasks in background with given kind, priority and timeout
+func runTaskInBackgroundWithOptions(name string, resources []string, proc task.Process, options task.Options) (task.Task, *task.ResourceConflictError) {
+	return context.TaskList().RunTaskInBackgroundWithOptions(name, resources, func(ctx gocontext.Context, out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
 		err := acquireDatabaseConnection()
 
 		if err != nil {
@@ -170,8 +176,19 @@ func runTaskInBackground(name string, resources []string, proc task.Process) (ta
 		}
 
 		defer func() { _ = releaseDatabaseConnection() }()
-		return proc(out, detail)
-	})
+		return proc(ctx, out, detail)
+	}, options)
+}
+
+// apiActor returns identity of API client, recorded in published repository history
+//
+// Name of authenticated identity is used if API authentication is enabled.
+func apiActor(c *gin.Context) string {
+	if identity := apiIdentityOf(c); identity != nil {
+		return identity.Name
+	}
+
+	return c.ClientIP()
 }
 
 func truthy(value interface{}) bool {
@@ -195,11 +212,21 @@ func truthy(value interface{}) bool {
 }
 
 func maybeRunTaskInBackground(c *gin.Context, name string, resources []string, proc task.Process) {
+	if identity := apiIdentityOf(c); identity != nil {
+		name = fmt.Sprintf("%s (by %s)", name, identity.Name)
+	}
+
+	options, err := taskOptions(c)
+	if err != nil {
+		AbortWithJSONError(c, 400, err)
+		return
+	}
+
 	// Run this task in background if configured globally or per-request
 	background := truthy(c.DefaultQuery("_async", strconv.FormatBool(context.Config().AsyncAPI)))
 	if background {
 		log.Debug().Msg("Executing task asynchronously")
-		task, conflictErr := runTaskInBackground(name, resources, proc)
+		task, conflictErr := runTaskInBackgroundWithOptions(name, resources, proc, options)
 		if conflictErr != nil {
 			AbortWithJSONError(c, 409, conflictErr)
 			return
@@ -207,7 +234,7 @@ func maybeRunTaskInBackground(c *gin.Context, name string, resources []string, p
 		c.JSON(202, task)
 	} else {
 		log.Debug().Msg("Executing task synchronously")
-		task, conflictErr := runTaskInBackground(name, resources, proc)
+		task, conflictErr := runTaskInBackgroundWithOptions(name, resources, proc, options)
 		if conflictErr != nil {
 			AbortWithJSONError(c, 409, conflictErr)
 			return
@@ -220,7 +247,11 @@ func maybeRunTaskInBackground(c *gin.Context, name string, resources []string, p
 		err, _ := context.TaskList().GetTaskErrorByID(task.ID)
 		_, _ = context.TaskList().DeleteTaskByID(task.ID)
 		if err != nil {
-			AbortWithJSONError(c, retValue.Code, err)
+			code := http.StatusInternalServerError
+			if retValue != nil {
+				code = retValue.Code
+			}
+			AbortWithJSONError(c, code, err)
 			return
 		}
 		if retValue != nil {
@@ -232,22 +263,58 @@ func maybeRunTaskInBackground(c *gin.Context, name string, resources []string, p
 }
 
 // Common piece of code to show list of packages,
-// with searching & details if requested
+// with searching, sorting, pagination & details if requested
 func showPackages(c *gin.Context, reflist *deb.PackageRefList, collectionFactory *deb.CollectionFactory) {
-	result := []*deb.Package{}
+	params, err := parseListParams(c, packageSortKeys)
+	if err != nil {
+		AbortWithJSONError(c, 400, err)
+		return
+	}
 
+	if params.Query != "" || c.Request.URL.Query().Get("maximumVersion") == "1" {
+		reflist = filterPackages(c, reflist, collectionFactory, params.Query)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	page, total, next := pagePackageRefs(reflist, params)
+	setListHeaders(c, total, next)
+
+	if c.Request.URL.Query().Get("format") == "details" {
+		// status can't be changed once streaming has started, so missing packages are reported upfront
+		if err = page.CheckPackages(collectionFactory.PackageCollection()); err != nil {
+			AbortWithJSONError(c, 404, err)
+			return
+		}
+
+		streamJSONArray(c, func(write func(interface{}) error) error {
+			return page.ForEachPackage(collectionFactory.PackageCollection(), func(p *deb.Package) error {
+				return write(p)
+			})
+		})
+	} else {
+		streamJSONArray(c, func(write func(interface{}) error) error {
+			return page.ForEach(func(key []byte) error {
+				return write(string(key))
+			})
+		})
+	}
+}
+
+// filterPackages returns refs of packages matching query q and maximumVersion parameter
+func filterPackages(c *gin.Context, reflist *deb.PackageRefList, collectionFactory *deb.CollectionFactory, queryS string) *deb.PackageRefList {
 	list, err := deb.NewPackageListFromRefList(reflist, collectionFactory.PackageCollection(), nil)
 	if err != nil {
 		AbortWithJSONError(c, 404, err)
-		return
+		return nil
 	}
 
-	queryS := c.Request.URL.Query().Get("q")
 	if queryS != "" {
-		q, err := query.Parse(c.Request.URL.Query().Get("q"))
+		q, err := query.Parse(queryS)
 		if err != nil {
 			AbortWithJSONError(c, 400, err)
-			return
+			return nil
 		}
 
 		withDeps := c.Request.URL.Query().Get("withDeps") == "1"
@@ -264,7 +331,7 @@ func showPackages(c *gin.Context, reflist *deb.PackageRefList, collectionFactory
 
 			if len(architecturesList) == 0 {
 				AbortWithJSONError(c, 400, fmt.Errorf("unable to determine list of architectures, please specify explicitly"))
-				return
+				return nil
 			}
 		}
 
@@ -279,7 +346,7 @@ func showPackages(c *gin.Context, reflist *deb.PackageRefList, collectionFactory
 		})
 		if err != nil {
 			AbortWithJSONError(c, 500, fmt.Errorf("unable to search: %s", err))
-			return
+			return nil
 		}
 	}
 
@@ -314,16 +381,7 @@ func showPackages(c *gin.Context, reflist *deb.PackageRefList, collectionFactory
 		})
 	}
 
-	if c.Request.URL.Query().Get("format") == "details" {
-		_ = list.ForEach(func(p *deb.Package) error {
-			result = append(result, p)
-			return nil
-		})
-
-		c.JSON(200, result)
-	} else {
-		c.JSON(200, list.Strings())
-	}
+	return deb.NewPackageRefListFromPackageList(list)
 }
 
 func AbortWithJSONError(c *gin.Context, code int, err error) {
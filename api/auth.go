@@ -0,0 +1,425 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// apiRole is level of access granted to API client, each role includes all the lower ones
+type apiRole int
+
+const (
+	// rolePublic marks routes available without authentication
+	rolePublic apiRole = iota
+	roleReadOnly
+	roleUploader
+	rolePublisher
+	roleAdmin
+)
+
+var apiRoleNames = map[apiRole]string{
+	rolePublic:    "public",
+	roleReadOnly:  "read-only",
+	roleUploader:  "uploader",
+	rolePublisher: "publisher",
+	roleAdmin:     "admin",
+}
+
+func (role apiRole) String() string {
+	return apiRoleNames[role]
+}
+
+// parseAPIRole converts role name from the configuration
+func parseAPIRole(name string) (apiRole, error) {
+	for role, roleName := range apiRoleNames {
+		if role != rolePublic && roleName == name {
+			return role, nil
+		}
+	}
+
+	return rolePublic, fmt.Errorf("unknown role %q", name)
+}
+
+// Kinds of resources API tokens could be scoped to
+const (
+	scopeRepo    = "repo"
+	scopeMirror  = "mirror"
+	scopePublish = "publish"
+)
+
+// apiIdentity is authenticated API client
+type apiIdentity struct {
+	Name string
+	Role apiRole
+	// Scopes are kind:pattern, empty list grants access to all resources
+	Scopes []string
+}
+
+// allows checks whether identity has access to resource of the kind
+func (identity *apiIdentity) allows(kind, name string) bool {
+	if len(identity.Scopes) == 0 {
+		return true
+	}
+
+	for _, scope := range identity.Scopes {
+		scopeKind, pattern, ok := strings.Cut(scope, ":")
+		if !ok || scopeKind != kind {
+			continue
+		}
+
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateScopes checks that scopes are kind:pattern with known kind
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		kind, pattern, _ := strings.Cut(scope, ":")
+		if kind != scopeRepo && kind != scopeMirror && kind != scopePublish {
+			return fmt.Errorf("invalid scope %q: unknown resource kind", scope)
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid scope %q: %s", scope, err)
+		}
+	}
+
+	return nil
+}
+
+// apiPermission is access required by API route
+type apiPermission struct {
+	role apiRole
+	// kind of resource route operates on and URL parameters naming it
+	kind   string
+	params []string
+}
+
+// apiPermissions lists access required by API routes, routes not listed
+// here are available to admin role only
+var apiPermissions = map[string]apiPermission{
+	"GET /api/metrics": {role: rolePublic},
+	"GET /api/version": {role: rolePublic},
+	"GET /api/ready":   {role: rolePublic},
+	"GET /api/healthy": {role: rolePublic},
+	"GET /api/storage": {role: roleReadOnly},
+
+	"GET /api/repos":                                  {role: roleReadOnly},
+	"GET /api/repos/:name":                            {role: roleReadOnly, kind: scopeRepo, params: []string{"name"}},
+	"GET /api/repos/:name/packages":                   {role: roleReadOnly, kind: scopeRepo, params: []string{"name"}},
+	"POST /api/repos/:name/packages":                  {role: roleUploader, kind: scopeRepo, params: []string{"name"}},
+	"DELETE /api/repos/:name/packages":                {role: roleUploader, kind: scopeRepo, params: []string{"name"}},
+	"POST /api/repos/:name/file/:dir/:file":           {role: roleUploader, kind: scopeRepo, params: []string{"name"}},
+	"POST /api/repos/:name/file/:dir":                 {role: roleUploader, kind: scopeRepo, params: []string{"name"}},
+	"POST /api/repos/:name/copy/:src/:file":           {role: roleUploader, kind: scopeRepo, params: []string{"name", "src"}},
+	"POST /api/repos/:name/include/:dir/:file":        {role: roleUploader, kind: scopeRepo, params: []string{"name"}},
+	"POST /api/repos/:name/include/:dir":              {role: roleUploader, kind: scopeRepo, params: []string{"name"}},
+	"POST /api/repos/:name/snapshots":                 {role: rolePublisher, kind: scopeRepo, params: []string{"name"}},
+	"GET /api/mirrors":                                {role: roleReadOnly},
+	"GET /api/mirrors/:name":                          {role: roleReadOnly, kind: scopeMirror, params: []string{"name"}},
+	"GET /api/mirrors/:name/packages":                 {role: roleReadOnly, kind: scopeMirror, params: []string{"name"}},
+	"PUT /api/mirrors/:name":                          {role: rolePublisher, kind: scopeMirror, params: []string{"name"}},
+	"POST /api/mirrors/:name/snapshots":               {role: rolePublisher, kind: scopeMirror, params: []string{"name"}},
+	"GET /api/s3":                                     {role: roleReadOnly},
+	"GET /api/files":                                  {role: roleReadOnly},
+	"GET /api/files/:dir":                             {role: roleReadOnly},
+	"POST /api/files/:dir":                            {role: roleUploader},
+	"DELETE /api/files/:dir":                          {role: roleUploader},
+	"DELETE /api/files/:dir/:name":                    {role: roleUploader},
+	"GET /api/publish":                                {role: roleReadOnly},
+	"GET /api/publish/:prefix/:distribution":          {role: roleReadOnly, kind: scopePublish, params: []string{"prefix"}},
+	"POST /api/publish":                               {role: rolePublisher, kind: scopePublish},
+	"POST /api/publish/:prefix":                       {role: rolePublisher, kind: scopePublish, params: []string{"prefix"}},
+	"PUT /api/publish/:prefix/:distribution":          {role: rolePublisher, kind: scopePublish, params: []string{"prefix"}},
+	"DELETE /api/publish/:prefix/:distribution":       {role: rolePublisher, kind: scopePublish, params: []string{"prefix"}},
+	"POST /api/publish/:prefix/:distribution/sources": {role: rolePublisher, kind: scopePublish, params: []string{"prefix"}},
+	"GET /api/publish/:prefix/:distribution/sources":  {role: roleReadOnly, kind: scopePublish, params: []string{"prefix"}},
+	"PUT /api/publish/:prefix/:distribution/sources":  {role: rolePublisher, kind: scopePublish, params: []string{"prefix"}},
+	"DELETE /api/publish/:prefix/:distribution/sources": {role: rolePublisher, kind: scopePublish,
+		params: []string{"prefix"}},
+	"PUT /api/publish/:prefix/:distribution/sources/:component": {role: rolePublisher, kind: scopePublish,
+		params: []string{"prefix"}},
+	"DELETE /api/publish/:prefix/:distribution/sources/:component": {role: rolePublisher, kind: scopePublish,
+		params: []string{"prefix"}},
+	"POST /api/publish/:prefix/:distribution/update":   {role: rolePublisher, kind: scopePublish, params: []string{"prefix"}},
+	"GET /api/publish/:prefix/:distribution/history":   {role: roleReadOnly, kind: scopePublish, params: []string{"prefix"}},
+	"POST /api/publish/:prefix/:distribution/rollback": {role: rolePublisher, kind: scopePublish, params: []string{"prefix"}},
+	"GET /api/snapshots":                               {role: roleReadOnly},
+	"POST /api/snapshots":                              {role: rolePublisher},
+	"PUT /api/snapshots/:name":                         {role: rolePublisher},
+	"GET /api/snapshots/:name":                         {role: roleReadOnly},
+	"GET /api/snapshots/:name/packages":                {role: roleReadOnly},
+	"DELETE /api/snapshots/:name":                      {role: rolePublisher},
+	"GET /api/snapshots/:name/diff/:withSnapshot":      {role: roleReadOnly},
+	"POST /api/snapshots/:name/merge":                  {role: rolePublisher},
+	"POST /api/snapshots/:name/pull":                   {role: rolePublisher},
+	"GET /api/packages/:key":                           {role: roleReadOnly},
+	"GET /api/packages":                                {role: roleReadOnly},
+	"GET /api/graph.:ext":                              {role: roleReadOnly},
+	"GET /api/events":                                  {role: roleReadOnly},
+	"GET /api/tasks":                                   {role: roleReadOnly},
+	"POST /api/tasks-clear":                            {role: rolePublisher},
+	"GET /api/tasks-wait":                              {role: roleReadOnly},
+	"GET /api/tasks/:id/wait":                          {role: roleReadOnly},
+	"GET /api/tasks/:id/output":                        {role: roleReadOnly},
+	"GET /api/tasks/:id/detail":                        {role: roleReadOnly},
+	"GET /api/tasks/:id/return_value":                  {role: roleReadOnly},
+	"GET /api/tasks/:id":                               {role: roleReadOnly},
+	"DELETE /api/tasks/:id":                            {role: rolePublisher},
+	"POST /api/tasks/:id/cancel":                       {role: rolePublisher},
+}
+
+// routePermission returns access required by the route
+func routePermission(method, fullPath string) apiPermission {
+	if permission, ok := apiPermissions[method+" "+fullPath]; ok {
+		return permission
+	}
+
+	return apiPermission{role: roleAdmin}
+}
+
+// resourceName returns name of the resource from URL parameter
+func resourceName(c *gin.Context, kind, param string) string {
+	if kind != scopePublish {
+		return c.Params.ByName(param)
+	}
+
+	prefix := "."
+	if param != "" {
+		prefix = slashEscape(c.Params.ByName(param))
+	}
+
+	storage, prefix := deb.ParsePrefix(prefix)
+	if storage != "" {
+		return storage + ":" + prefix
+	}
+
+	return prefix
+}
+
+// apiToken is static API token
+type apiToken struct {
+	hash     []byte
+	identity apiIdentity
+}
+
+// apiAuth authenticates and authorizes API requests
+type apiAuth struct {
+	tokens       []apiToken
+	jwt          *jwtValidator
+	certificates []apiCertificate
+}
+
+// apiCertificate maps TLS client certificate subject to identity
+type apiCertificate struct {
+	subject  string
+	identity apiIdentity
+}
+
+// newAPIAuth builds authenticator from the configuration, nil is returned when
+// authentication is not enabled
+//
+// Invalid tokens are logged and skipped, so that they never grant any access.
+func newAPIAuth(config utils.APIAuthConfig) *apiAuth {
+	if len(config.Tokens) == 0 && config.JWT.JWKS == "" && len(config.Certificates) == 0 {
+		return nil
+	}
+
+	auth := &apiAuth{}
+
+	if config.JWT.JWKS != "" {
+		auth.jwt = newJWTValidator(config.JWT)
+	}
+
+	for _, token := range config.Tokens {
+		hash, err := parseTokenHash(token.Hash)
+		if err == nil {
+			var role apiRole
+			role, err = parseAPIRole(token.Role)
+			if err == nil {
+				err = validateScopes(token.Scopes)
+			}
+
+			if err == nil {
+				auth.tokens = append(auth.tokens, apiToken{
+					hash:     hash,
+					identity: apiIdentity{Name: token.Name, Role: role, Scopes: token.Scopes},
+				})
+				continue
+			}
+		}
+
+		log.Error().Msgf("Ignoring API token %q: %s", token.Name, err)
+	}
+
+	for _, cert := range config.Certificates {
+		role, err := parseAPIRole(cert.Role)
+		if err == nil {
+			err = validateScopes(cert.Scopes)
+		}
+		if err == nil {
+			_, err = path.Match(cert.Subject, "")
+		}
+		if err != nil {
+			log.Error().Msgf("Ignoring API certificate %q: %s", cert.Subject, err)
+			continue
+		}
+
+		auth.certificates = append(auth.certificates, apiCertificate{
+			subject:  cert.Subject,
+			identity: apiIdentity{Name: cert.Name, Role: role, Scopes: cert.Scopes},
+		})
+	}
+
+	return auth
+}
+
+// parseTokenHash decodes "sha256:<hex>" token hash
+func parseTokenHash(value string) ([]byte, error) {
+	hexHash, ok := strings.CutPrefix(value, "sha256:")
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash %q, should be sha256:<hex>", value)
+	}
+
+	hash, err := hex.DecodeString(hexHash)
+	if err != nil || len(hash) != sha256.Size {
+		return nil, fmt.Errorf("invalid sha256 hash %q", value)
+	}
+
+	return hash, nil
+}
+
+// authenticate returns identity of the client presenting bearer token or TLS client
+// certificate, nil if neither is presented
+func (auth *apiAuth) authenticate(c *gin.Context) (*apiIdentity, error) {
+	header := c.GetHeader("Authorization")
+	if header == "" {
+		return auth.authenticateCertificate(c)
+	}
+
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return nil, fmt.Errorf("unsupported authorization scheme")
+	}
+
+	token = strings.TrimSpace(token)
+	if auth.jwt != nil && strings.Count(token, ".") == 2 {
+		return auth.jwt.validate(token)
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	for i := range auth.tokens {
+		if subtle.ConstantTimeCompare(hash[:], auth.tokens[i].hash) == 1 {
+			identity := auth.tokens[i].identity
+			return &identity, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid token")
+}
+
+// authenticateCertificate returns identity of the client presenting verified TLS
+// client certificate, nil if there is no certificate
+func (auth *apiAuth) authenticateCertificate(c *gin.Context) (*apiIdentity, error) {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+
+	subject := state.VerifiedChains[0][0].Subject
+	for i := range auth.certificates {
+		pattern := auth.certificates[i].subject
+
+		value := subject.CommonName
+		if strings.Contains(pattern, "=") {
+			value = subject.String()
+		}
+
+		if matched, _ := path.Match(pattern, value); matched {
+			identity := auth.certificates[i].identity
+			if identity.Name == "" {
+				identity.Name = subject.CommonName
+			}
+			return &identity, nil
+		}
+	}
+
+	return nil, fmt.Errorf("certificate %q is not allowed", subject.String())
+}
+
+// middleware enforces permissions of the routes
+func (auth *apiAuth) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		permission := routePermission(c.Request.Method, c.FullPath())
+		if permission.role == rolePublic {
+			c.Next()
+			return
+		}
+
+		identity, err := auth.authenticate(c)
+		if err == nil && identity == nil {
+			err = fmt.Errorf("authentication required")
+		}
+		if err != nil {
+			log.Warn().Str("remote", c.ClientIP()).Msgf("API authentication failed for %s %s: %s",
+				c.Request.Method, c.Request.URL.Path, err)
+			c.Header("WWW-Authenticate", `Bearer realm="aptly"`)
+			AbortWithJSONError(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		c.Set(identityKey, identity)
+
+		if identity.Role < permission.role {
+			log.Warn().Str("actor", identity.Name).Msgf("API access denied for %s %s: role %s required",
+				c.Request.Method, c.Request.URL.Path, permission.role)
+			AbortWithJSONError(c, http.StatusForbidden, fmt.Errorf("role %s is required", permission.role))
+			return
+		}
+
+		if permission.kind != "" {
+			params := permission.params
+			if len(params) == 0 {
+				params = []string{""}
+			}
+
+			for _, param := range params {
+				name := resourceName(c, permission.kind, param)
+				if !identity.allows(permission.kind, name) {
+					log.Warn().Str("actor", identity.Name).Msgf("API access denied for %s %s: %s %s is out of scope",
+						c.Request.Method, c.Request.URL.Path, permission.kind, name)
+					AbortWithJSONError(c, http.StatusForbidden, fmt.Errorf("access to %s %s is not allowed", permission.kind, name))
+					return
+				}
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// identityKey is the key of authenticated identity in gin context
+const identityKey = "aptly.identity"
+
+// apiIdentityOf returns authenticated identity of API client, nil if authentication is disabled
+func apiIdentityOf(c *gin.Context) *apiIdentity {
+	if value, ok := c.Get(identityKey); ok {
+		return value.(*apiIdentity)
+	}
+
+	return nil
+}
@@ -0,0 +1,355 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// jwksRefreshInterval is how often keys fetched from JWKS URL are refreshed
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefreshInterval limits refetching JWKS when token is signed by unknown key
+	jwksMinRefreshInterval = time.Minute
+)
+
+// jwtSigningMethods are accepted JWT signature algorithms, symmetric ones are never accepted
+var jwtSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// jwtValidator validates JWT bearer tokens against JWKS
+type jwtValidator struct {
+	config utils.APIJWTConfig
+	parser *jwt.Parser
+	client *http.Client
+
+	lock    sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+	// loading is closed when JWKS load in progress is finished
+	loading chan struct{}
+}
+
+// newJWTValidator creates JWT validator, JWKS is loaded on first use
+func newJWTValidator(config utils.APIJWTConfig) *jwtValidator {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtSigningMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+
+	return &jwtValidator{
+		config: config,
+		parser: jwt.NewParser(options...),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// isJWKSURL checks whether JWKS is fetched over HTTP
+func (v *jwtValidator) isJWKSURL() bool {
+	return strings.HasPrefix(v.config.JWKS, "http://") || strings.HasPrefix(v.config.JWKS, "https://")
+}
+
+// loadJWKS reads JWKS from the file or URL
+func (v *jwtValidator) loadJWKS() (map[string]crypto.PublicKey, error) {
+	var data []byte
+	var err error
+
+	if v.isJWKSURL() {
+		var resp *http.Response
+		resp, err = v.client.Get(v.config.JWKS)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status fetching %s: %s", v.config.JWKS, resp.Status)
+		}
+
+		data, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	} else {
+		data, err = os.ReadFile(v.config.JWKS)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJWKS(data)
+}
+
+// needsReload checks whether JWKS should be (re)loaded, lock should be held
+//
+// Failed loads are retried no more often than jwksMinRefreshInterval.
+func (v *jwtValidator) needsReload(found bool) bool {
+	if v.fetched.IsZero() {
+		return true
+	}
+
+	age := time.Since(v.fetched)
+
+	if v.keys == nil || (v.isJWKSURL() && !found) {
+		return age > jwksMinRefreshInterval
+	}
+
+	return v.isJWKSURL() && age > jwksRefreshInterval
+}
+
+// key returns public key by key ID, reloading JWKS when needed
+//
+// JWKS is loaded without holding the lock, concurrent requests wait for the load in progress.
+func (v *jwtValidator) key(kid string) (crypto.PublicKey, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	key, found := v.keys[kid]
+
+	for v.needsReload(found) {
+		if loading := v.loading; loading != nil {
+			v.lock.Unlock()
+			<-loading
+			v.lock.Lock()
+		} else {
+			loading = make(chan struct{})
+			v.loading = loading
+			v.lock.Unlock()
+
+			keys, err := v.loadJWKS()
+
+			v.lock.Lock()
+			v.fetched = time.Now()
+			v.loading = nil
+			close(loading)
+
+			if err != nil {
+				log.Error().Msgf("Unable to load JWKS from %s: %s", v.config.JWKS, err)
+			} else {
+				v.keys = keys
+			}
+		}
+
+		key, found = v.keys[kid]
+	}
+
+	if !found && kid == "" && len(v.keys) == 1 {
+		// token without key ID is accepted if JWKS has single key
+		for _, key = range v.keys {
+			found = true
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	return key, nil
+}
+
+// validate verifies JWT and builds identity from its claims
+func (v *jwtValidator) validate(token string) (*apiIdentity, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.key(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %s", err)
+	}
+
+	return v.identity(claims)
+}
+
+// identity maps JWT claims to identity, role is public if no role is granted by claims
+func (v *jwtValidator) identity(claims jwt.MapClaims) (*apiIdentity, error) {
+	identity := &apiIdentity{Role: rolePublic}
+
+	identity.Name, _ = claims[v.config.UsernameClaim].(string)
+	if identity.Name == "" {
+		identity.Name, _ = claims["sub"].(string)
+	}
+	if identity.Name == "" {
+		return nil, fmt.Errorf("invalid token: missing %s claim", v.config.UsernameClaim)
+	}
+
+	for _, value := range claimStrings(claims[v.config.RoleClaim]) {
+		if len(v.config.RoleMapping) > 0 {
+			var ok bool
+			if value, ok = v.config.RoleMapping[value]; !ok {
+				continue
+			}
+		}
+
+		role, err := parseAPIRole(value)
+		if err != nil {
+			continue
+		}
+
+		if role > identity.Role {
+			identity.Role = role
+		}
+	}
+
+	identity.Scopes = claimStrings(claims[v.config.ScopesClaim])
+	if err := validateScopes(identity.Scopes); err != nil {
+		return nil, fmt.Errorf("invalid token: %s", err)
+	}
+
+	return identity, nil
+}
+
+// claimStrings converts claim value which is either list of strings or space separated string
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+
+	return nil
+}
+
+// jsonWebKey is a public key in JWK format (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS parses JWK set into public keys by key ID, keys not used for signatures are skipped
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("unable to parse JWKS: %s", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse JWKS key %q: %s", jwk.Kid, err)
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// publicKey decodes the public key
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+
+		x, err := decodeJWKInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid EC point")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// decodeJWKInt decodes base64url encoded big-endian integer
+func decodeJWKInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("missing key parameter")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/golang-jwt/jwt/v5"
+
+	. "gopkg.in/check.v1"
+)
+
+type AuthJWTSuite struct {
+	APISuite
+
+	rsaKey     *rsa.PrivateKey
+	ecKey      *ecdsa.PrivateKey
+	edKey      ed25519.PrivateKey
+	jwksFile   string
+	jwksServer *httptest.Server
+	jwksHits   int32
+}
+
+var _ = Suite(&AuthJWTSuite{})
+
+func b64Int(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func (s *AuthJWTSuite) SetUpSuite(c *C) {
+	s.APISuite.SetUpSuite(c)
+
+	var err error
+	s.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+	s.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	_, s.edKey, err = ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, IsNil)
+
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64Int(s.rsaKey.N), "e": b64Int(big.NewInt(int64(s.rsaKey.E)))},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64Int(s.ecKey.X), "y": b64Int(s.ecKey.Y)},
+			{"kty": "OKP", "kid": "ed", "crv": "Ed25519",
+				"x": base64.RawURLEncoding.EncodeToString(s.edKey.Public().(ed25519.PublicKey))},
+			{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		},
+	})
+	c.Assert(err, IsNil)
+
+	s.jwksFile = filepath.Join(c.MkDir(), "jwks.json")
+	c.Assert(os.WriteFile(s.jwksFile, jwks, 0644), IsNil)
+
+	s.jwksServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&s.jwksHits, 1)
+		_, _ = w.Write(jwks)
+	}))
+}
+
+func (s *AuthJWTSuite) TearDownSuite(c *C) {
+	s.jwksServer.Close()
+	s.APISuite.TearDownSuite(c)
+}
+
+func (s *AuthJWTSuite) configure(jwks string, mapping map[string]string) {
+	s.context.Config().APIAuth.JWT = utils.APIJWTConfig{
+		JWKS:          jwks,
+		Issuer:        "https://sso.example.com",
+		Audience:      "aptly",
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "groups",
+		RoleMapping:   mapping,
+		ScopesClaim:   "aptly_scopes",
+	}
+	s.router = Router(s.context)
+}
+
+func (s *AuthJWTSuite) SetUpTest(c *C) {
+	s.configure(s.jwksFile, map[string]string{})
+}
+
+func (s *AuthJWTSuite) TearDownTest(c *C) {
+	s.context.TaskList().Wait()
+	s.context.TaskList().Clear()
+	s.context.Config().APIAuth.JWT = utils.APIJWTConfig{}
+	s.router = Router(s.context)
+}
+
+func (s *AuthJWTSuite) claims(groups ...string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":                "https://sso.example.com",
+		"aud":                "aptly",
+		"sub":                "0123-4567",
+		"preferred_username": "jane",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"groups":             groups,
+	}
+}
+
+func (s *AuthJWTSuite) sign(c *C, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	c.Assert(err, IsNil)
+	return signed
+}
+
+func (s *AuthJWTSuite) request(method, url, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, nil)
+	req.Header.Add("Authorization", "Bearer "+token)
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *AuthJWTSuite) TestValidTokens(c *C) {
+	token := s.sign(c, jwt.SigningMethodRS256, "rsa", s.rsaKey, s.claims("read-only"))
+	c.Check(s.request("GET", "/api/repos", token).Code, Equals, 200)
+	c.Check(s.request("POST", "/api/repos", token).Code, Equals, 403)
+
+	token = s.sign(c, jwt.SigningMethodES256, "ec", s.ecKey, s.claims("read-only", "admin"))
+	c.Check(s.request("GET", "/api/repos/missing", token).Code, Equals, 404)
+
+	token = s.sign(c, jwt.SigningMethodEdDSA, "ed", s.edKey, s.claims("uploader"))
+	c.Check(s.request("DELETE", "/api/files/upload", token).Code, Equals, 200)
+}
+
+func (s *AuthJWTSuite) TestInvalidTokens(c *C) {
+	claims := s.claims("admin")
+	claims["iss"] = "https://evil.example.com"
+	c.Check(s.request("GET", "/api/repos", s.sign(c, jwt.SigningMethodRS256, "rsa", s.rsaKey, claims)).Code, Equals, 401)
+
+	claims = s.claims("admin")
+	claims["aud"] = "other"
+	c.Check(s.request("GET", "/api/repos", s.sign(c, jwt.SigningMethodRS256, "rsa", s.rsaKey, claims)).Code, Equals, 401)
+
+	claims = s.claims("admin")
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	c.Check(s.request("GET", "/api/repos", s.sign(c, jwt.SigningMethodRS256, "rsa", s.rsaKey, claims)).Code, Equals, 401)
+
+	claims = s.claims("admin")
+	delete(claims, "exp")
+	c.Check(s.request("GET", "/api/repos", s.sign(c, jwt.SigningMethodRS256, "rsa", s.rsaKey, claims)).Code, Equals, 401)
+
+	// signed by key from JWKS, but with wrong key ID
+	c.Check(s.request("GET", "/api/repos", s.sign(c, jwt.SigningMethodRS256, "ec", s.rsaKey, s.claims("admin"))).Code, Equals, 401)
+	c.Check(s.request("GET", "/api/repos", s.sign(c, jwt.SigningMethodRS256, "", s.rsaKey, s.claims("admin"))).Code, Equals, 401)
+
+	// signed by unknown key
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+	c.Check(s.request("GET", "/api/repos", s.sign(c, jwt.SigningMethodRS256, "rsa", other, s.claims("admin"))).Code, Equals, 401)
+
+	// symmetric algorithms are not accepted
+	c.Check(s.request("GET", "/api/repos", s.sign(c, jwt.SigningMethodHS256, "rsa", []byte("secret"), s.claims("admin"))).Code, Equals, 401)
+
+	claims = s.claims("admin")
+	claims["aptly_scopes"] = []string{"host:*"}
+	c.Check(s.request("GET", "/api/repos", s.sign(c, jwt.SigningMethodRS256, "rsa", s.rsaKey, claims)).Code, Equals, 401)
+}
+
+func (s *AuthJWTSuite) TestRoleMapping(c *C) {
+	s.configure(s.jwksFile, map[string]string{"developers": "uploader", "ops": "admin"})
+
+	token := s.sign(c, jwt.SigningMethodRS256, "rsa", s.rsaKey, s.claims("developers", "admin"))
+	c.Check(s.request("DELETE", "/api/files/upload", token).Code, Equals, 200)
+	c.Check(s.request("POST", "/api/snapshots", token).Code, Equals, 403)
+
+	token = s.sign(c, jwt.SigningMethodRS256, "rsa", s.rsaKey, s.claims("guests"))
+	response := s.request("GET", "/api/repos", token)
+	c.Check(response.Code, Equals, 403)
+	c.Check(response.Body.String(), Equals, `{"error":"role read-only is required"}`)
+
+	claims := s.claims("ops")
+	claims["groups"] = "guests ops"
+	token = s.sign(c, jwt.SigningMethodRS256, "rsa", s.rsaKey, claims)
+	response = s.request("POST", "/api/db/cleanup?_async=true", token)
+	c.Assert(response.Code, Equals, 202)
+
+	var result map[string]interface{}
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Check(result["Name"], Equals, "Clean up db (by jane)")
+}
+
+func (s *AuthJWTSuite) TestScopes(c *C) {
+	claims := s.claims("publisher")
+	claims["aptly_scopes"] = "repo:stable-* publish:s3:eu:ppa"
+	token := s.sign(c, jwt.SigningMethodRS256, "rsa", s.rsaKey, claims)
+
+	c.Check(s.request("GET", "/api/repos/testing", token).Code, Equals, 403)
+	c.Check(s.request("GET", "/api/repos/stable-main", token).Code, Equals, 404)
+	c.Check(s.request("DELETE", "/api/publish/s3:eu:ppa/bookworm", token).Code, Equals, 404)
+	c.Check(s.request("DELETE", "/api/publish/ppa/bookworm", token).Code, Equals, 403)
+}
+
+func (s *AuthJWTSuite) TestJWKSURL(c *C) {
+	s.configure(s.jwksServer.URL, map[string]string{})
+	hits := atomic.LoadInt32(&s.jwksHits)
+
+	token := s.sign(c, jwt.SigningMethodES256, "ec", s.ecKey, s.claims("read-only"))
+	c.Check(s.request("GET", "/api/repos", token).Code, Equals, 200)
+	c.Check(s.request("GET", "/api/repos", token).Code, Equals, 200)
+	c.Check(atomic.LoadInt32(&s.jwksHits), Equals, hits+1)
+
+	// unknown key doesn't cause refetch right away
+	token = s.sign(c, jwt.SigningMethodES256, "missing", s.ecKey, s.claims("read-only"))
+	c.Check(s.request("GET", "/api/repos", token).Code, Equals, 401)
+	c.Check(atomic.LoadInt32(&s.jwksHits), Equals, hits+1)
+}
+
+func (s *AuthJWTSuite) TestJWKSURLFailing(c *C) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	v := newJWTValidator(utils.APIJWTConfig{JWKS: server.URL})
+
+	// concurrent requests share single fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := v.key("ec")
+			c.Check(err, ErrorMatches, `unknown signing key "ec"`)
+		}()
+	}
+	wg.Wait()
+	c.Check(atomic.LoadInt32(&hits), Equals, int32(1))
+
+	// failed load isn't retried right away
+	_, err := v.key("ec")
+	c.Check(err, NotNil)
+	c.Check(atomic.LoadInt32(&hits), Equals, int32(1))
+
+	v.lock.Lock()
+	v.fetched = time.Now().Add(-2 * jwksMinRefreshInterval)
+	v.lock.Unlock()
+
+	_, err = v.key("ec")
+	c.Check(err, NotNil)
+	c.Check(atomic.LoadInt32(&hits), Equals, int32(2))
+}
+
+func (s *AuthJWTSuite) TestStaticTokensWithJWT(c *C) {
+	s.context.Config().APIAuth.Tokens = []utils.APITokenConfig{
+		{Name: "ci", Hash: tokenHash("ci-token"), Role: "uploader"},
+	}
+	s.router = Router(s.context)
+	defer func() { s.context.Config().APIAuth.Tokens = []utils.APITokenConfig{} }()
+
+	c.Check(s.request("DELETE", "/api/files/upload", "ci-token").Code, Equals, 200)
+	c.Check(s.request("DELETE", "/api/files/upload", "a.b.c").Code, Equals, 401)
+}
+
+func (s *AuthJWTSuite) TestParseJWKS(c *C) {
+	_, err := parseJWKS([]byte("{"))
+	c.Check(err, ErrorMatches, "unable to parse JWKS: .*")
+
+	_, err = parseJWKS([]byte(`{"keys": [{"kty": "oct", "kid": "x"}]}`))
+	c.Check(err, ErrorMatches, "unable to parse JWKS key \"x\": unsupported key type \"oct\"")
+
+	_, err = parseJWKS([]byte(`{"keys": [{"kty": "EC", "kid": "x", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`))
+	c.Check(err, ErrorMatches, "unable to parse JWKS key \"x\": invalid EC point")
+
+	keys, err := parseJWKS([]byte(`{"keys": []}`))
+	c.Check(err, IsNil)
+	c.Check(keys, HasLen, 0)
+}
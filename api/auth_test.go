@@ -0,0 +1,207 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+
+	. "gopkg.in/check.v1"
+)
+
+type AuthSuite struct {
+	APISuite
+}
+
+var _ = Suite(&AuthSuite{})
+
+func tokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+func (s *AuthSuite) SetUpTest(c *C) {
+	s.context.Config().APIAuth.Tokens = []utils.APITokenConfig{
+		{Name: "reader", Hash: tokenHash("reader-token"), Role: "read-only"},
+		{Name: "ci", Hash: tokenHash("ci-token"), Role: "uploader", Scopes: []string{"repo:stable-*"}},
+		{Name: "release", Hash: tokenHash("release-token"), Role: "publisher", Scopes: []string{"publish:s3:eu:ppa", "publish:."}},
+		{Name: "root", Hash: tokenHash("root-token"), Role: "admin"},
+		{Name: "broken", Hash: "md5:0123", Role: "admin"},
+		{Name: "unknown", Hash: tokenHash("unknown-token"), Role: "superuser"},
+	}
+	s.router = Router(s.context)
+}
+
+func (s *AuthSuite) TearDownTest(c *C) {
+	s.context.TaskList().Wait()
+	s.context.TaskList().Clear()
+	s.context.Config().APIAuth.Tokens = []utils.APITokenConfig{}
+	s.router = Router(s.context)
+}
+
+func (s *AuthSuite) authRequest(method, url, token string, body io.Reader) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, body)
+	req.Header.Add("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *AuthSuite) TestPublicRoutes(c *C) {
+	c.Check(s.authRequest("GET", "/api/version", "", nil).Code, Equals, 200)
+	c.Check(s.authRequest("GET", "/api/healthy", "", nil).Code, Equals, 200)
+}
+
+func (s *AuthSuite) TestUnauthenticated(c *C) {
+	response := s.authRequest("GET", "/api/repos", "", nil)
+	c.Check(response.Code, Equals, 401)
+	c.Check(response.Header().Get("WWW-Authenticate"), Equals, `Bearer realm="aptly"`)
+
+	c.Check(s.authRequest("GET", "/api/repos", "wrong-token", nil).Code, Equals, 401)
+	c.Check(s.authRequest("GET", "/api/repos", "unknown-token", nil).Code, Equals, 401)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/repos", nil)
+	req.SetBasicAuth("reader", "reader-token")
+	s.router.ServeHTTP(w, req)
+	c.Check(w.Code, Equals, 401)
+}
+
+func (s *AuthSuite) TestRoles(c *C) {
+	c.Check(s.authRequest("GET", "/api/repos", "reader-token", nil).Code, Equals, 200)
+	c.Check(s.authRequest("GET", "/api/tasks", "reader-token", nil).Code, Equals, 200)
+	c.Check(s.authRequest("GET", "/api/events?type=unknown", "reader-token", nil).Code, Equals, 400)
+	c.Check(s.authRequest("GET", "/api/events?type=unknown", "", nil).Code, Equals, 401)
+
+	response := s.authRequest("POST", "/api/repos", "reader-token", nil)
+	c.Check(response.Code, Equals, 403)
+	c.Check(response.Body.String(), Equals, `{"error":"role admin is required"}`)
+
+	c.Check(s.authRequest("POST", "/api/snapshots", "ci-token", nil).Code, Equals, 403)
+	c.Check(s.authRequest("DELETE", "/api/files/upload", "reader-token", nil).Code, Equals, 403)
+	c.Check(s.authRequest("DELETE", "/api/files/upload", "ci-token", nil).Code, Equals, 200)
+
+	// higher roles include lower ones
+	c.Check(s.authRequest("GET", "/api/repos", "root-token", nil).Code, Equals, 200)
+	c.Check(s.authRequest("POST", "/api/db/cleanup", "release-token", nil).Code, Equals, 403)
+}
+
+func (s *AuthSuite) TestScopes(c *C) {
+	c.Check(s.authRequest("GET", "/api/repos/testing", "ci-token", nil).Code, Equals, 403)
+	c.Check(s.authRequest("GET", "/api/repos/stable-main", "ci-token", nil).Code, Equals, 404)
+	c.Check(s.authRequest("POST", "/api/repos/testing/file/upload", "ci-token", nil).Code, Equals, 403)
+	c.Check(s.authRequest("POST", "/api/repos/stable-main/copy/testing/pkg", "ci-token", nil).Code, Equals, 403)
+
+	// token scoped to repos has no access to mirrors
+	c.Check(s.authRequest("GET", "/api/mirrors/debian", "ci-token", nil).Code, Equals, 403)
+	c.Check(s.authRequest("GET", "/api/mirrors/debian", "reader-token", nil).Code, Equals, 404)
+
+	c.Check(s.authRequest("DELETE", "/api/publish/s3:eu:ppa/bookworm", "release-token", nil).Code, Equals, 404)
+	c.Check(s.authRequest("DELETE", "/api/publish/s3:us:ppa/bookworm", "release-token", nil).Code, Equals, 403)
+	c.Check(s.authRequest("DELETE", "/api/publish/ppa/bookworm", "release-token", nil).Code, Equals, 403)
+	c.Check(s.authRequest("DELETE", "/api/publish/:./bookworm", "release-token", nil).Code, Equals, 404)
+	c.Check(s.authRequest("POST", "/api/publish", "release-token", nil).Code, Equals, 400)
+}
+
+func (s *AuthSuite) TestActor(c *C) {
+	response := s.authRequest("POST", "/api/db/cleanup?_async=true", "root-token", nil)
+	c.Assert(response.Code, Equals, 202)
+
+	var result map[string]interface{}
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Check(result["Name"], Equals, "Clean up db (by root)")
+}
+
+func (s *AuthSuite) TestNewAPIAuth(c *C) {
+	c.Check(newAPIAuth(utils.APIAuthConfig{}), IsNil)
+
+	auth := newAPIAuth(s.context.Config().APIAuth)
+	c.Assert(auth, NotNil)
+	c.Check(auth.tokens, HasLen, 4)
+
+	auth = newAPIAuth(utils.APIAuthConfig{Tokens: []utils.APITokenConfig{
+		{Name: "bad", Hash: tokenHash("x"), Role: "admin", Scopes: []string{"host:*"}},
+	}})
+	c.Assert(auth, NotNil)
+	c.Check(auth.tokens, HasLen, 0)
+}
+
+func (s *AuthSuite) TestIdentityAllows(c *C) {
+	identity := &apiIdentity{Name: "any", Role: roleAdmin}
+	c.Check(identity.allows(scopeRepo, "whatever"), Equals, true)
+
+	identity.Scopes = []string{"repo:stable-*", "mirror:debian"}
+	c.Check(identity.allows(scopeRepo, "stable-main"), Equals, true)
+	c.Check(identity.allows(scopeRepo, "testing"), Equals, false)
+	c.Check(identity.allows(scopeMirror, "debian"), Equals, true)
+	c.Check(identity.allows(scopePublish, "debian"), Equals, false)
+}
+
+func (s *AuthSuite) certRequest(method, url, token string, subject *pkix.Name) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, nil)
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+	if subject != nil {
+		cert := &x509.Certificate{Subject: *subject}
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *AuthSuite) TestCertificates(c *C) {
+	s.context.Config().APIAuth.Certificates = []utils.APICertificateConfig{
+		{Subject: "CN=deploy-*,O=Example", Role: "publisher"},
+		{Subject: "monitoring", Name: "prometheus", Role: "read-only"},
+	}
+	s.router = Router(s.context)
+	defer func() { s.context.Config().APIAuth.Certificates = []utils.APICertificateConfig{} }()
+
+	deploy := &pkix.Name{CommonName: "deploy-eu", Organization: []string{"Example"}}
+	monitoring := &pkix.Name{CommonName: "monitoring", Organization: []string{"Other"}}
+	unknown := &pkix.Name{CommonName: "deploy-eu", Organization: []string{"Other"}}
+
+	c.Check(s.certRequest("GET", "/api/repos", "", monitoring).Code, Equals, 200)
+	c.Check(s.certRequest("POST", "/api/snapshots", "", monitoring).Code, Equals, 403)
+	c.Check(s.certRequest("GET", "/api/repos", "", unknown).Code, Equals, 401)
+	c.Check(s.certRequest("GET", "/api/repos", "", nil).Code, Equals, 401)
+
+	// bearer token takes precedence over certificate
+	c.Check(s.certRequest("POST", "/api/snapshots", "reader-token", deploy).Code, Equals, 403)
+
+	c.Check(s.certRequest("POST", "/api/db/cleanup", "", deploy).Code, Equals, 403)
+
+	// name defaults to common name of the certificate
+	identity, err := newAPIAuth(s.context.Config().APIAuth).authenticateCertificate(ginContextWithTLS(deploy))
+	c.Assert(err, IsNil)
+	c.Check(identity.Name, Equals, "deploy-eu")
+	c.Check(identity.Role, Equals, rolePublisher)
+
+	// unverified certificates are ignored
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/repos", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: *monitoring}}}
+	s.router.ServeHTTP(w, req)
+	c.Check(w.Code, Equals, 401)
+}
+
+func ginContextWithTLS(subject *pkix.Name) *gin.Context {
+	cert := &x509.Certificate{Subject: *subject}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/api/repos", nil)
+	c.Request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return c
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	gocontext "context"
 	"fmt"
 	"sort"
 
@@ -11,6 +12,42 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// phases of db cleanup reported in task detail
+const (
+	dbCleanupPhaseLoad          = "loading"
+	dbCleanupPhaseDeletePackage = "deleting packages"
+	dbCleanupPhaseListFiles     = "listing files"
+	dbCleanupPhaseDeleteFiles   = "deleting files"
+	dbCleanupPhaseCompact       = "compacting"
+)
+
+var dbCleanupPhases = map[aptly.BarType]string{
+	aptly.BarGeneralBuildFileList: dbCleanupPhaseListFiles,
+}
+
+// dbCleanupDetail is detail of db cleanup task
+//
+// Counters of deleted files precede phases and are kept for compatibility.
+type dbCleanupDetail struct {
+	task.ProgressDetail
+	TotalNumberOfPackagesToDelete     int
+	RemainingNumberOfPackagesToDelete int
+}
+
+// newDBCleanupDetail returns task.ProgressOutput extension filling counters of deleted files
+func newDBCleanupDetail() func(task.ProgressDetail) interface{} {
+	var detail dbCleanupDetail
+
+	return func(progress task.ProgressDetail) interface{} {
+		if progress.Phase == dbCleanupPhaseDeleteFiles {
+			detail.TotalNumberOfPackagesToDelete = int(progress.TotalFiles)
+			detail.RemainingNumberOfPackagesToDelete = int(progress.TotalFiles - progress.DoneFiles)
+		}
+		detail.ProgressDetail = progress
+		return detail
+	}
+}
+
 // @Summary DB Cleanup
 // @Description **Cleanup Aptly DB**
 // @Description Database cleanup removes information about unreferenced packages and deletes files in the package pool that aren’t used by packages anymore.
@@ -18,14 +55,20 @@ import (
 // @Tags Database
 // @Produce json
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Success 200 {object} string "Output"
 // @Failure 404 {object} Error "Not Found"
 // @Router /api/db/cleanup [post]
 func apiDBCleanup(c *gin.Context) {
 	resources := []string{string(task.AllResourcesKey)}
-	maybeRunTaskInBackground(c, "Clean up db", resources, func(out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, "Clean up db", resources, func(_ gocontext.Context, progress aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
 		var err error
 
+		out := task.NewProgressOutput(progress, detail, dbCleanupPhases)
+		out.Extend = newDBCleanupDetail()
+		out.SetPhase(dbCleanupPhaseLoad, 0, 0)
+
 		collectionFactory := context.NewCollectionFactory()
 
 		// collect information about referenced packages...
@@ -103,6 +146,7 @@ func apiDBCleanup(c *gin.Context) {
 
 		// delete packages that are no longer referenced
 		out.Printf("Deleting unreferenced packages (%d)...", toDelete.Len())
+		out.SetPhase(dbCleanupPhaseDeletePackage, int64(toDelete.Len()), 0)
 
 		// database can't err as collection factory already constructed
 		db, _ := context.Database()
@@ -111,6 +155,7 @@ func apiDBCleanup(c *gin.Context) {
 			batch := db.CreateBatch()
 			_ = toDelete.ForEach(func(ref []byte) error {
 				_ = collectionFactory.PackageCollection().DeleteByKey(ref, batch)
+				out.AddFiles(1)
 				return nil
 			})
 
@@ -122,6 +167,7 @@ func apiDBCleanup(c *gin.Context) {
 
 		// now, build a list of files that should be present in Repository (package pool)
 		out.Printf("Building list of files referenced by packages...")
+		out.SetPhase(dbCleanupPhaseListFiles, 0, 0)
 		referencedFiles := make([]string, 0, existingPackageRefs.Len())
 
 		err = existingPackageRefs.ForEach(func(key []byte) error {
@@ -158,13 +204,7 @@ func apiDBCleanup(c *gin.Context) {
 		out.Printf("Deleting unreferenced files (%d)...", len(filesToDelete))
 
 		countFilesToDelete := len(filesToDelete)
-		taskDetail := struct {
-			TotalNumberOfPackagesToDelete     int
-			RemainingNumberOfPackagesToDelete int
-		}{
-			countFilesToDelete, countFilesToDelete,
-		}
-		detail.Store(taskDetail)
+		out.SetPhase(dbCleanupPhaseDeleteFiles, int64(countFilesToDelete), 0)
 
 		if countFilesToDelete > 0 {
 			var size, totalSize int64
@@ -174,8 +214,7 @@ func apiDBCleanup(c *gin.Context) {
 					return nil, err
 				}
 
-				taskDetail.RemainingNumberOfPackagesToDelete--
-				detail.Store(taskDetail)
+				out.AddFiles(1)
 				totalSize += size
 			}
 
@@ -183,6 +222,7 @@ func apiDBCleanup(c *gin.Context) {
 		}
 
 		out.Printf("Compacting database...")
+		out.SetPhase(dbCleanupPhaseCompact, 0, 0)
 		return nil, db.CompactDB()
 	})
 }
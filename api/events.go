@@ -0,0 +1,286 @@
+package api
+
+import (
+	gocontext "context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// Types of resources events are reported for
+const (
+	eventTask     = "task"
+	eventRepo     = "repo"
+	eventSnapshot = "snapshot"
+	eventMirror   = "mirror"
+	eventPublish  = "publish"
+)
+
+// Actions performed on resources, task events report task state instead
+const (
+	eventCreated = "created"
+	eventUpdated = "updated"
+	eventDropped = "dropped"
+	// published snapshots switched to other snapshots
+	eventSwitched = "switched"
+)
+
+const (
+	// eventHistorySize is number of recent events kept to be replayed on reconnect
+	eventHistorySize = 256
+	// eventBufferSize is number of events buffered for each stream, slow streams are closed
+	eventBufferSize = 64
+	// eventKeepAlive is interval of keep-alive comments sent over idle streams
+	eventKeepAlive = 30 * time.Second
+)
+
+// Event is a change of task state or of a repository, snapshot, mirror or publish
+type Event struct {
+	// Sequential number of the event
+	ID int64
+	// Type of resource: task, repo, snapshot, mirror or publish
+	Type string
+	// Action is created, updated, switched or dropped, for tasks it is task state (IDLE, RUNNING, SUCCEEDED, FAILED)
+	Action string
+	// Name of the resource, for published repositories it is "prefix/distribution"
+	Name string
+	// Storage prefix and distribution of published repository
+	Prefix       string `json:",omitempty"`
+	Distribution string `json:",omitempty"`
+	// ID of the task which caused the event, 0 if it was not caused by a task
+	TaskID int `json:",omitempty"`
+	Time   time.Time
+}
+
+// publishedEvent builds event for published repository
+func publishedEvent(action string, published *deb.PublishedRepo) Event {
+	return Event{
+		Type:         eventPublish,
+		Action:       action,
+		Name:         published.StoragePrefix() + "/" + published.Distribution,
+		Prefix:       published.StoragePrefix(),
+		Distribution: published.Distribution,
+	}
+}
+
+// visibleTo checks whether identity has access to the resource event is reported for
+func (event *Event) visibleTo(identity *apiIdentity) bool {
+	if identity == nil {
+		return true
+	}
+
+	switch event.Type {
+	case eventRepo:
+		return identity.allows(scopeRepo, event.Name)
+	case eventMirror:
+		return identity.allows(scopeMirror, event.Name)
+	case eventPublish:
+		return identity.allows(scopePublish, event.Prefix)
+	}
+
+	return true
+}
+
+// eventStream is a subscription to the events
+type eventStream struct {
+	types  map[string]bool
+	events chan Event
+}
+
+// eventBroker fans out events to the streams
+type eventBroker struct {
+	sync.Mutex
+	lastID  int64
+	history []Event
+	streams map[*eventStream]struct{}
+}
+
+var events = newEventBroker()
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{streams: make(map[*eventStream]struct{})}
+}
+
+// publish sends event to all the matching streams, it never blocks
+func (b *eventBroker) publish(event Event) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.lastID++
+	event.ID = b.lastID
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > eventHistorySize {
+		b.history = b.history[len(b.history)-eventHistorySize:]
+	}
+
+	for stream := range b.streams {
+		if !stream.matches(event) {
+			continue
+		}
+
+		select {
+		case stream.events <- event:
+		default:
+			// stream is too slow, client would reconnect and replay missed events
+			delete(b.streams, stream)
+			close(stream.events)
+		}
+	}
+}
+
+// subscribe creates stream of events of given types (all types if empty),
+// events after lastID are replayed from history
+func (b *eventBroker) subscribe(types []string, lastID int64) *eventStream {
+	stream := &eventStream{events: make(chan Event, eventBufferSize+eventHistorySize)}
+	if len(types) > 0 {
+		stream.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			stream.types[t] = true
+		}
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if lastID > 0 {
+		for _, event := range b.history {
+			if event.ID > lastID && stream.matches(event) {
+				stream.events <- event
+			}
+		}
+	}
+
+	b.streams[stream] = struct{}{}
+
+	return stream
+}
+
+// unsubscribe stops delivering events to the stream
+func (b *eventBroker) unsubscribe(stream *eventStream) {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.streams[stream]; ok {
+		delete(b.streams, stream)
+		close(stream.events)
+	}
+}
+
+// closeAll closes all the streams
+func (b *eventBroker) closeAll() {
+	b.Lock()
+	defer b.Unlock()
+
+	for stream := range b.streams {
+		delete(b.streams, stream)
+		close(stream.events)
+	}
+}
+
+func (stream *eventStream) matches(event Event) bool {
+	return stream.types == nil || stream.types[event.Type]
+}
+
+// publishTaskEvent reports change of task state
+func publishTaskEvent(t task.Task) {
+	events.publish(Event{Type: eventTask, Action: t.State.String(), Name: t.Name, TaskID: t.ID})
+}
+
+// withEvent wraps task process to report the event once process succeeds
+func withEvent(event Event, proc task.Process) task.Process {
+	return func(ctx gocontext.Context, out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+		retValue, err := proc(ctx, out, detail)
+		if err == nil {
+			event.TaskID = detail.TaskID()
+			events.publish(event)
+		}
+
+		return retValue, err
+	}
+}
+
+// CloseEventStreams terminates all the event streams, so that HTTP server could shut down
+func CloseEventStreams() {
+	events.closeAll()
+}
+
+// @Summary Event Stream
+// @Description **Stream of server-sent events**
+// @Description
+// @Description Events are reported when task changes its state and when local repos, snapshots, mirrors or
+// @Description published repositories are created, updated or dropped. Each event is JSON object with
+// @Description resource type, action, name and task ID.
+// @Description
+// @Description Event types could be limited with `type` parameter, e.g. `?type=task,publish`. Events missed
+// @Description since `Last-Event-ID` are replayed on reconnect, if still available.
+// @Tags Events
+// @Produce text/event-stream
+// @Param type query string false "comma separated list of event types: task, repo, snapshot, mirror, publish"
+// @Success 200 {object} Event
+// @Failure 400 {object} Error "Invalid event type"
+// @Router /api/events [get]
+func apiEvents(c *gin.Context) {
+	var types []string
+	for _, value := range c.QueryArray("type") {
+		for _, t := range strings.Split(value, ",") {
+			t = strings.TrimSpace(t)
+			switch t {
+			case "":
+			case eventTask, eventRepo, eventSnapshot, eventMirror, eventPublish:
+				types = append(types, t)
+			default:
+				AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("unknown event type %q", t))
+				return
+			}
+		}
+	}
+
+	lastID, _ := strconv.ParseInt(c.GetHeader("Last-Event-ID"), 10, 64)
+	identity := apiIdentityOf(c)
+
+	stream := events.subscribe(types, lastID)
+	defer events.unsubscribe(stream)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-stream.events:
+			if !ok {
+				return false
+			}
+			if !event.visibleTo(identity) {
+				return true
+			}
+
+			c.Render(-1, sse.Event{Id: strconv.FormatInt(event.ID, 10), Event: event.Type, Data: event})
+			return true
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
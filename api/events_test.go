@@ -0,0 +1,229 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	gocontext "context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/task"
+
+	. "gopkg.in/check.v1"
+)
+
+type EventsSuite struct {
+	APISuite
+}
+
+var _ = Suite(&EventsSuite{})
+
+func (s *EventsSuite) TearDownTest(c *C) {
+	s.context.TaskList().Wait()
+	s.context.TaskList().Clear()
+}
+
+func (s *EventsSuite) TestBroker(c *C) {
+	broker := newEventBroker()
+
+	all := broker.subscribe(nil, 0)
+	repos := broker.subscribe([]string{eventRepo}, 0)
+
+	broker.publish(Event{Type: eventTask, Action: "RUNNING", Name: "Update mirror", TaskID: 1})
+	broker.publish(Event{Type: eventRepo, Action: eventCreated, Name: "stable"})
+
+	event := <-all.events
+	c.Check(event.ID, Equals, int64(1))
+	c.Check(event.Type, Equals, eventTask)
+	c.Check(event.Time.IsZero(), Equals, false)
+	c.Check((<-all.events).ID, Equals, int64(2))
+
+	event = <-repos.events
+	c.Check(event.ID, Equals, int64(2))
+	c.Check(event.Name, Equals, "stable")
+	c.Check(repos.events, HasLen, 0)
+
+	// missed events are replayed
+	replay := broker.subscribe(nil, 1)
+	c.Assert(replay.events, HasLen, 1)
+	c.Check((<-replay.events).ID, Equals, int64(2))
+
+	broker.unsubscribe(repos)
+	_, ok := <-repos.events
+	c.Check(ok, Equals, false)
+	broker.unsubscribe(repos)
+
+	broker.closeAll()
+	_, ok = <-all.events
+	c.Check(ok, Equals, false)
+	c.Check(broker.streams, HasLen, 0)
+}
+
+func (s *EventsSuite) TestBrokerHistory(c *C) {
+	broker := newEventBroker()
+
+	for i := 0; i < eventHistorySize+10; i++ {
+		broker.publish(Event{Type: eventTask})
+	}
+
+	c.Check(broker.history, HasLen, eventHistorySize)
+	c.Check(broker.history[0].ID, Equals, int64(11))
+}
+
+func (s *EventsSuite) TestBrokerSlowStream(c *C) {
+	broker := newEventBroker()
+	stream := broker.subscribe(nil, 0)
+
+	for i := 0; i < cap(stream.events)+1; i++ {
+		broker.publish(Event{Type: eventTask})
+	}
+
+	c.Check(broker.streams, HasLen, 0)
+	for range stream.events {
+	}
+}
+
+func (s *EventsSuite) TestWithEvent(c *C) {
+	stream := events.subscribe([]string{eventSnapshot}, 0)
+	defer events.unsubscribe(stream)
+
+	list := task.NewList()
+	defer list.Stop()
+
+	failed, _ := list.RunTaskInBackground("fail", nil, withEvent(Event{Type: eventSnapshot, Action: eventDropped, Name: "broken"},
+		func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+			return nil, errors.New("failed")
+		}))
+	_, _ = list.WaitForTaskByID(failed.ID)
+	t, _ := list.RunTaskInBackground("drop", nil, withEvent(Event{Type: eventSnapshot, Action: eventDropped, Name: "old"},
+		func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+			return nil, nil
+		}))
+	list.Wait()
+
+	c.Assert(stream.events, HasLen, 1)
+	event := <-stream.events
+	c.Check(event.Name, Equals, "old")
+	c.Check(event.Action, Equals, eventDropped)
+	c.Check(event.TaskID, Equals, t.ID)
+}
+
+func (s *EventsSuite) TestVisibleTo(c *C) {
+	identity := &apiIdentity{Name: "ci", Role: roleUploader, Scopes: []string{"repo:stable-*", "publish:s3:eu:ppa"}}
+
+	c.Check((&Event{Type: eventRepo, Name: "stable-main"}).visibleTo(identity), Equals, true)
+	c.Check((&Event{Type: eventRepo, Name: "testing"}).visibleTo(identity), Equals, false)
+	c.Check((&Event{Type: eventMirror, Name: "debian"}).visibleTo(identity), Equals, false)
+	c.Check((&Event{Type: eventPublish, Name: "s3:eu:ppa/bookworm", Prefix: "s3:eu:ppa"}).visibleTo(identity), Equals, true)
+	c.Check((&Event{Type: eventPublish, Name: "./bookworm", Prefix: "."}).visibleTo(identity), Equals, false)
+	c.Check((&Event{Type: eventTask, Name: "Update mirror debian"}).visibleTo(identity), Equals, true)
+	c.Check((&Event{Type: eventRepo, Name: "testing"}).visibleTo(nil), Equals, true)
+}
+
+func (s *EventsSuite) TestInvalidType(c *C) {
+	response, _ := s.HTTPRequest("GET", "/api/events?type=task,package", nil)
+	c.Check(response.Code, Equals, 400)
+	c.Check(response.Body.String(), Equals, `{"error":"unknown event type \"package\""}`)
+}
+
+// readEvent reads next event from SSE stream skipping comments
+func readEvent(c *C, reader *bufio.Reader) (string, Event) {
+	var (
+		id    string
+		event Event
+	)
+
+	for {
+		line, err := reader.ReadString('\n')
+		c.Assert(err, IsNil)
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case line == "":
+			if id != "" {
+				return id, event
+			}
+		case strings.HasPrefix(line, "id:"):
+			id = line[3:]
+		case strings.HasPrefix(line, "data:"):
+			c.Assert(json.Unmarshal([]byte(line[5:]), &event), IsNil)
+		}
+	}
+}
+
+func (s *EventsSuite) TestStream(c *C) {
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+	defer CloseEventStreams()
+
+	response, err := http.Get(server.URL + "/api/events?type=repo&type=task")
+	c.Assert(err, IsNil)
+	defer func() { _ = response.Body.Close() }()
+
+	c.Check(response.StatusCode, Equals, 200)
+	c.Check(response.Header.Get("Content-Type"), Equals, "text/event-stream")
+	reader := bufio.NewReader(response.Body)
+
+	body, _ := json.Marshal(map[string]string{"Name": "events-stream"})
+	created, err := s.HTTPRequest("POST", "/api/repos", bytes.NewReader(body))
+	c.Assert(err, IsNil)
+	c.Assert(created.Code, Equals, 201)
+
+	id, event := readEvent(c, reader)
+	c.Check(id, Not(Equals), "")
+	c.Check(event.Type, Equals, eventRepo)
+	c.Check(event.Action, Equals, eventCreated)
+	c.Check(event.Name, Equals, "events-stream")
+
+	dropped, err := s.HTTPRequest("DELETE", "/api/repos/events-stream", nil)
+	c.Assert(err, IsNil)
+	c.Assert(dropped.Code, Equals, 200)
+
+	_, event = readEvent(c, reader)
+	c.Check(event.Action, Equals, "IDLE")
+	c.Check(event.Name, Equals, "Delete repo events-stream")
+	_, event = readEvent(c, reader)
+	c.Check(event.Action, Equals, "RUNNING")
+	taskID := event.TaskID
+
+	// repo event is reported by the task before it completes
+	_, event = readEvent(c, reader)
+	c.Check(event.Type, Equals, eventRepo)
+	c.Check(event.Action, Equals, eventDropped)
+	c.Check(event.TaskID, Equals, taskID)
+
+	_, event = readEvent(c, reader)
+	c.Check(event.Type, Equals, eventTask)
+	c.Check(event.Action, Equals, "SUCCEEDED")
+	c.Check(event.TaskID, Equals, taskID)
+
+	// missed events are replayed with Last-Event-ID
+	request, _ := http.NewRequest("GET", server.URL+"/api/events?type=repo", nil)
+	request.Header.Set("Last-Event-ID", id)
+	replay, err := http.DefaultClient.Do(request)
+	c.Assert(err, IsNil)
+	defer func() { _ = replay.Body.Close() }()
+
+	_, event = readEvent(c, bufio.NewReader(replay.Body))
+	c.Check(event.Action, Equals, eventDropped)
+	c.Check(event.Name, Equals, "events-stream")
+
+	// closing streams lets the server shut down
+	done := make(chan struct{})
+	go func() {
+		_, _ = reader.ReadString(0)
+		close(done)
+	}()
+	CloseEventStreams()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("event stream was not closed")
+	}
+}
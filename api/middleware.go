@@ -105,6 +105,10 @@ func JSONLogger() gin.HandlerFunc {
 			With().Str("latency", ts.Sub(start).String()).Logger().
 			With().Str("agent", c.Request.UserAgent()).Logger()
 
+		if identity := apiIdentityOf(c); identity != nil {
+			l = l.With().Str("actor", identity.Name).Logger()
+		}
+
 		if c.Writer.Status() >= 400 && c.Writer.Status() < 500 {
 			l.Warn().Msg(errorMessage)
 		} else if c.Writer.Status() >= 500 {
@@ -1,6 +1,7 @@
 package api
 
 import (
+	gocontext "context"
 	"fmt"
 	"net/http"
 	"os"
@@ -144,7 +145,7 @@ func apiMirrorsCreate(c *gin.Context) {
 	}
 
 	downloader := context.NewDownloader(nil)
-	err = repo.Fetch(downloader, verifier, b.IgnoreSignatures)
+	err = repo.Fetch(c.Request.Context(), downloader, verifier, b.IgnoreSignatures)
 	if err != nil {
 		AbortWithJSONError(c, 400, fmt.Errorf("unable to fetch mirror: %s", err))
 		return
@@ -156,6 +157,8 @@ func apiMirrorsCreate(c *gin.Context) {
 		return
 	}
 
+	events.publish(Event{Type: eventMirror, Action: eventCreated, Name: repo.Name})
+
 	c.JSON(201, repo)
 }
 
@@ -165,6 +168,8 @@ func apiMirrorsCreate(c *gin.Context) {
 // @Param name path string true "mirror name"
 // @Param force query int true "force: 1 to enable"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Produce json
 // @Success 200 {object} task.ProcessReturnValue
 // @Failure 404 {object} Error "Mirror not found"
@@ -187,7 +192,7 @@ func apiMirrorsDrop(c *gin.Context) {
 
 	resources := []string{string(repo.Key())}
 	taskName := fmt.Sprintf("Delete mirror %s", name)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(Event{Type: eventMirror, Action: eventDropped, Name: name}, func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err := repo.CheckLock()
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to drop: %v", err)
@@ -206,7 +211,7 @@ func apiMirrorsDrop(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to drop: %v", err)
 		}
 		return &task.ProcessReturnValue{Code: http.StatusNoContent, Value: nil}, nil
-	})
+	}))
 }
 
 // @Summary Get Mirror Info
@@ -363,6 +368,48 @@ type mirrorUpdateParams struct {
 	SkipExistingPackages bool `   json:"SkipExistingPackages"`
 }
 
+// phases of mirror update reported in task detail
+const (
+	mirrorUpdatePhaseIndexes  = "indexes"
+	mirrorUpdatePhaseQueue    = "building queue"
+	mirrorUpdatePhaseDownload = "downloading"
+	mirrorUpdatePhaseImport   = "importing"
+)
+
+var mirrorUpdatePhases = map[aptly.BarType]string{
+	aptly.BarMirrorUpdateDownloadIndexes:  mirrorUpdatePhaseIndexes,
+	aptly.BarMirrorUpdateBuildPackageList: mirrorUpdatePhaseIndexes,
+	aptly.BarMirrorUpdateDownloadPackages: mirrorUpdatePhaseDownload,
+	aptly.BarMirrorUpdateFinalizeDownload: mirrorUpdatePhaseImport,
+}
+
+// mirrorUpdateDetail is detail of mirror update task
+//
+// Download counters precede phases and are kept for compatibility.
+type mirrorUpdateDetail struct {
+	task.ProgressDetail
+	TotalDownloadSize         int64
+	RemainingDownloadSize     int64
+	TotalNumberOfPackages     int
+	RemainingNumberOfPackages int
+}
+
+// newMirrorUpdateDetail returns task.ProgressOutput extension filling download counters
+func newMirrorUpdateDetail() func(task.ProgressDetail) interface{} {
+	var detail mirrorUpdateDetail
+
+	return func(progress task.ProgressDetail) interface{} {
+		if progress.Phase == mirrorUpdatePhaseDownload {
+			detail.TotalDownloadSize = progress.TotalBytes
+			detail.RemainingDownloadSize = max(progress.TotalBytes-progress.DoneBytes, 0)
+			detail.TotalNumberOfPackages = int(progress.TotalFiles)
+			detail.RemainingNumberOfPackages = int(progress.TotalFiles - progress.DoneFiles)
+		}
+		detail.ProgressDetail = progress
+		return detail
+	}
+}
+
 // @Summary Update Mirror
 // @Description **Update Mirror and download packages**
 // @Tags Mirrors
@@ -370,6 +417,8 @@ type mirrorUpdateParams struct {
 // @Consume json
 // @Param request body mirrorUpdateParams true "Parameters"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Produce json
 // @Success 200 {object} task.ProcessReturnValue "Mirror was updated successfully"
 // @Success 202 {object} task.Task "Mirror is being updated"
@@ -446,10 +495,13 @@ func apiMirrorsUpdate(c *gin.Context) {
 	}
 
 	resources := []string{string(remote.Key())}
-	maybeRunTaskInBackground(c, "Update mirror "+b.Name, resources, func(out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, "Update mirror "+b.Name, resources, withEvent(Event{Type: eventMirror, Action: eventUpdated, Name: b.Name}, func(ctx gocontext.Context, progress aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+		out := task.NewProgressOutput(progress, detail, mirrorUpdatePhases)
+		out.Extend = newMirrorUpdateDetail()
+		out.SetPhase(mirrorUpdatePhaseIndexes, 0, 0)
 
 		downloader := context.NewDownloader(out)
-		err := remote.Fetch(downloader, verifier, b.IgnoreSignatures)
+		err := remote.Fetch(ctx, downloader, verifier, b.IgnoreSignatures)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 		}
@@ -461,11 +513,13 @@ func apiMirrorsUpdate(c *gin.Context) {
 			}
 		}
 
-		err = remote.DownloadPackageIndexes(out, downloader, verifier, collectionFactory, b.IgnoreSignatures, b.SkipComponentCheck)
+		err = remote.DownloadPackageIndexes(ctx, out, downloader, verifier, collectionFactory, b.IgnoreSignatures, b.SkipComponentCheck)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 		}
 
+		out.SetPhase(mirrorUpdatePhaseQueue, 0, 0)
+
 		if remote.Filter != "" {
 			var filterQuery deb.PackageQuery
 
@@ -503,16 +557,13 @@ func apiMirrorsUpdate(c *gin.Context) {
 
 		context.GoContextHandleSignals()
 
-		count := len(queue)
-		taskDetail := struct {
-			TotalDownloadSize         int64
-			RemainingDownloadSize     int64
-			TotalNumberOfPackages     int
-			RemainingNumberOfPackages int
-		}{
-			downloadSize, downloadSize, count, count,
-		}
-		detail.Store(taskDetail)
+		// downloads are stopped on signal as well as on task cancellation
+		ctx, cancel := gocontext.WithCancel(ctx)
+		defer cancel()
+		defer gocontext.AfterFunc(context, cancel)()
+
+		out.SetPhase(mirrorUpdatePhaseDownload, int64(len(queue)), downloadSize)
+		out.InitBar(downloadSize, true, aptly.BarMirrorUpdateDownloadPackages)
 
 		downloadQueue := make(chan int)
 		taskFinished := make(chan *deb.PackageDownloadTask)
@@ -532,7 +583,7 @@ func apiMirrorsUpdate(c *gin.Context) {
 			for idx := range queue {
 				select {
 				case downloadQueue <- idx:
-				case <-context.Done():
+				case <-ctx.Done():
 					return
 				}
 			}
@@ -540,17 +591,9 @@ func apiMirrorsUpdate(c *gin.Context) {
 			close(downloadQueue)
 		}()
 
-		// update of task details need to be done in order
 		go func() {
-			for {
-				task, ok := <-taskFinished
-				if !ok {
-					return
-				}
-
-				taskDetail.RemainingDownloadSize -= task.File.Checksums.Size
-				taskDetail.RemainingNumberOfPackages--
-				detail.Store(taskDetail)
+			for range taskFinished {
+				out.AddFiles(1)
 			}
 		}()
 
@@ -588,8 +631,8 @@ func apiMirrorsUpdate(c *gin.Context) {
 						}
 
 						// download file...
-						e = context.Downloader().DownloadWithChecksum(
-							context,
+						e = downloader.DownloadWithChecksum(
+							ctx,
 							remote.PackageURL(task.File.DownloadURL()).String(),
 							task.TempDownPath,
 							&task.File.Checksums,
@@ -615,7 +658,7 @@ func apiMirrorsUpdate(c *gin.Context) {
 
 						task.Done = true
 						taskFinished <- task
-					case <-context.Done():
+					case <-ctx.Done():
 						return
 					}
 
@@ -628,6 +671,7 @@ func apiMirrorsUpdate(c *gin.Context) {
 		wg.Wait()
 		log.Info().Msgf("%s: Background processes finished", b.Name)
 		close(taskFinished)
+		out.ShutdownBar()
 
 		defer func() {
 			for _, task := range queue {
@@ -642,7 +686,7 @@ func apiMirrorsUpdate(c *gin.Context) {
 		}()
 
 		select {
-		case <-context.Done():
+		case <-ctx.Done():
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: interrupted")
 		default:
 		}
@@ -661,5 +705,5 @@ func apiMirrorsUpdate(c *gin.Context) {
 
 		log.Info().Msgf("%s: Mirror updated successfully", b.Name)
 		return &task.ProcessReturnValue{Code: http.StatusNoContent, Value: nil}, nil
-	})
+	}))
 }
@@ -27,11 +27,16 @@ func apiPackagesShow(c *gin.Context) {
 
 // @Summary List Packages
 // @Description **Get list of packages**
+// @Description With `limit`, packages are returned in pages, `X-Next-Cursor` header holds `cursor` of the next page.
+// @Description Total number of packages is returned in `X-Total-Count` header.
 // @Tags Packages
 // @Consume  json
 // @Produce  json
 // @Param q query string false "search query"
 // @Param format query string false "format: `details` for more detailed information"
+// @Param sort query string false "Sort key: `key` or `name`, prefixed with `-` for descending order"
+// @Param limit query int false "Maximum number of packages returned"
+// @Param cursor query string false "Cursor of the page, as returned in `X-Next-Cursor` header"
 // @Success 200 {array} string "List of packages"
 // @Router /api/packages [get]
 func apiPackages(c *gin.Context) {
@@ -1,6 +1,14 @@
 package api
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/aptly-dev/aptly/deb"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -16,3 +24,130 @@ func (s *PackagesSuite) TestPackagesGetMaximumVersion(c *C) {
 	c.Check(response.Code, Equals, 200)
 	c.Check(response.Body.String(), Equals, "[]")
 }
+
+func (s *PackagesSuite) createPagerRepo(c *C) {
+	collectionFactory := s.context.NewCollectionFactory()
+	list := deb.NewPackageList()
+	for _, p := range [][3]string{
+		{"pager-b", "1.0", "amd64"},
+		{"pager-a", "2.0", "amd64"},
+		{"pager-a", "1.10", "amd64"},
+		{"pager-a", "1.9", "i386"},
+		{"pager-c", "1.0", "all"},
+	} {
+		pkg := deb.NewPackageFromControlFile(deb.Stanza{"Package": p[0], "Version": p[1], "Architecture": p[2],
+			"Filename": fmt.Sprintf("pool/%s_%s_%s.deb", p[0], p[1], p[2]), "Size": "1", "MD5sum": "1e8cba92c41420aa7baa8a5718d67122"})
+		c.Assert(collectionFactory.PackageCollection().Update(pkg), IsNil)
+		c.Assert(list.Add(pkg), IsNil)
+	}
+
+	repo := deb.NewLocalRepo("pager", "")
+	repo.UpdateRefList(deb.NewPackageRefListFromPackageList(list))
+	c.Assert(collectionFactory.LocalRepoCollection().Add(repo), IsNil)
+}
+
+func (s *PackagesSuite) dropPagerRepo() {
+	collectionFactory := s.context.NewCollectionFactory()
+	collection := collectionFactory.LocalRepoCollection()
+	if repo, err := collection.ByName("pager"); err == nil {
+		_ = collection.Drop(repo)
+	}
+
+	// packages would be checked by other suites sharing the database
+	db, _ := s.context.Database()
+	batch := db.CreateBatch()
+	_ = collectionFactory.PackageCollection().AllPackageRefs().ForEach(func(key []byte) error {
+		if bytes.Contains(key, []byte(" pager-")) {
+			_ = collectionFactory.PackageCollection().DeleteByKey(key, batch)
+		}
+		return nil
+	})
+	_ = batch.Write()
+}
+
+// listPages follows cursors and returns all pages
+func (s *PackagesSuite) listPages(c *C, path string) (pages [][]string) {
+	cursor := ""
+	for {
+		response, _ := s.HTTPRequest("GET", path+"&cursor="+cursor, nil)
+		c.Assert(response.Code, Equals, 200)
+		var page []string
+		c.Assert(json.Unmarshal(response.Body.Bytes(), &page), IsNil)
+		pages = append(pages, page)
+
+		cursor = response.Header().Get("X-Next-Cursor")
+		if cursor == "" {
+			return
+		}
+		c.Assert(len(pages) < 10, Equals, true)
+	}
+}
+
+func (s *PackagesSuite) TestPackagesPagination(c *C) {
+	s.dropPagerRepo()
+	s.createPagerRepo(c)
+	defer s.dropPagerRepo()
+
+	response, _ := s.HTTPRequest("GET", "/api/repos/pager/packages", nil)
+	c.Assert(response.Code, Equals, 200)
+	c.Check(response.Header().Get("X-Total-Count"), Equals, "5")
+	c.Check(response.Header().Get("X-Next-Cursor"), Equals, "")
+	var all []string
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &all), IsNil)
+	c.Check(all, HasLen, 5)
+	c.Check(all[0], Matches, "Pall pager-c 1.0 .*")
+
+	c.Check(s.listPages(c, "/api/repos/pager/packages?limit=2"), DeepEquals, [][]string{all[0:2], all[2:4], all[4:5]})
+
+	pages := s.listPages(c, "/api/repos/pager/packages?limit=3&sort=name")
+	c.Assert(pages, HasLen, 2)
+	c.Check(pages[0][0], Matches, "Pi386 pager-a 1.9 .*")
+	c.Check(pages[0][1], Matches, "Pamd64 pager-a 1.10 .*")
+	c.Check(pages[0][2], Matches, "Pamd64 pager-a 2.0 .*")
+	c.Check(pages[1][0], Matches, "Pamd64 pager-b 1.0 .*")
+	c.Check(pages[1][1], Matches, "Pall pager-c 1.0 .*")
+
+	pages = s.listPages(c, "/api/repos/pager/packages?limit=4&sort=-name")
+	c.Assert(pages, HasLen, 2)
+	c.Check(pages[0][0], Matches, "Pall pager-c 1.0 .*")
+	c.Check(pages[1], HasLen, 1)
+	c.Check(pages[1][0], Matches, "Pi386 pager-a 1.9 .*")
+
+	// cursor stays valid when the package is gone
+	cursor := base64.RawURLEncoding.EncodeToString([]byte("Pamd64 pager-a 1.9.5 00000000"))
+	response, _ = s.HTTPRequest("GET", "/api/repos/pager/packages?sort=name&cursor="+cursor, nil)
+	c.Check(response.Header().Get("X-Total-Count"), Equals, "5")
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &all), IsNil)
+	c.Check(all, HasLen, 4)
+
+	response, _ = s.HTTPRequest("GET", "/api/repos/pager/packages?format=details&limit=2&q="+url.QueryEscape("Name (pager-a)"), nil)
+	c.Assert(response.Code, Equals, 200)
+	c.Check(response.Header().Get("X-Total-Count"), Equals, "3")
+	c.Check(response.Header().Get("X-Next-Cursor"), Not(Equals), "")
+	var details []map[string]string
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &details), IsNil)
+	c.Assert(details, HasLen, 2)
+	c.Check(details[0]["Package"], Equals, "pager-a")
+	c.Check(details[0]["Version"], Equals, "1.10")
+
+	response, _ = s.HTTPRequest("GET", "/api/packages?limit=1&q="+url.QueryEscape("Name (% pager-*)"), nil)
+	c.Assert(response.Code, Equals, 200)
+	c.Check(response.Header().Get("X-Total-Count"), Equals, "5")
+	c.Check(response.Body.String(), Matches, `\["Pall pager-c 1.0 [0-9a-f]+"\]`)
+
+	for _, query := range []string{"limit=0", "limit=x", "sort=size", "cursor=!!"} {
+		response, _ = s.HTTPRequest("GET", "/api/repos/pager/packages?"+query, nil)
+		c.Check(response.Code, Equals, 400, Commentf("query: %s", query))
+	}
+
+	// package referenced by the repo is missing
+	db, _ := s.context.Database()
+	key := []byte(all[len(all)-1])
+	c.Assert(s.context.NewCollectionFactory().PackageCollection().DeleteByKey(key, db), IsNil)
+
+	for _, query := range []string{"format=details", "format=details&limit=2&sort=-name"} {
+		response, _ = s.HTTPRequest("GET", "/api/repos/pager/packages?"+query, nil)
+		c.Check(response.Code, Equals, 404, Commentf("query: %s", query))
+		c.Check(response.Body.String(), Matches, `\{"error":"unable to load package with key .*"\}`)
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// listParams are pagination, sorting and filtering parameters of list endpoints
+type listParams struct {
+	// Limit is the maximum number of items returned, 0 returns all items
+	Limit int
+	// Cursor is the key of the last item of the previous page
+	Cursor string
+	// Sort is the sort key, Desc reverses the order
+	Sort string
+	Desc bool
+	// Query filters the list
+	Query string
+}
+
+// parseListParams parses `limit`, `cursor`, `sort` and `q` query parameters,
+// first of sortKeys is the default one
+func parseListParams(c *gin.Context, sortKeys []string) (params listParams, err error) {
+	query := c.Request.URL.Query()
+
+	if value := query.Get("limit"); value != "" {
+		params.Limit, err = strconv.Atoi(value)
+		if err != nil || params.Limit < 1 {
+			return params, fmt.Errorf("invalid limit: %q", value)
+		}
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, e := base64.RawURLEncoding.DecodeString(value)
+		if e != nil || len(cursor) == 0 {
+			return params, fmt.Errorf("invalid cursor: %q", value)
+		}
+		params.Cursor = string(cursor)
+	}
+
+	params.Sort = sortKeys[0]
+	if value := query.Get("sort"); value != "" {
+		params.Desc = strings.HasPrefix(value, "-")
+		params.Sort = strings.TrimPrefix(value, "-")
+		if !utils.StrSliceHasItem(sortKeys, params.Sort) {
+			return params, fmt.Errorf("invalid sort key: %q, expected one of: %s", value, strings.Join(sortKeys, ", "))
+		}
+	}
+
+	params.Query = query.Get("q")
+
+	return params, nil
+}
+
+// page returns end of the page starting at start out of total items
+func (params listParams) page(start, total int) int {
+	if params.Limit > 0 && start+params.Limit < total {
+		return start + params.Limit
+	}
+	return total
+}
+
+// setListHeaders sets total number of items and cursor of the next page, if any
+func setListHeaders(c *gin.Context, total int, next string) {
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	if next != "" {
+		c.Header("X-Next-Cursor", base64.RawURLEncoding.EncodeToString([]byte(next)))
+	}
+}
+
+// streamJSONArray writes items passed to write as JSON array without building it in memory
+//
+// Once streaming has started, status can't be changed, so on error the array is left
+// unterminated and the error is recorded in the context.
+func streamJSONArray(c *gin.Context, forEach func(write func(item interface{}) error) error) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	separator := "["
+	err := forEach(func(item interface{}) error {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if _, err = c.Writer.WriteString(separator); err != nil {
+			return err
+		}
+		separator = ","
+		_, err = c.Writer.Write(data)
+		return err
+	})
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if separator == "[" {
+		_, _ = c.Writer.WriteString("[]")
+	} else {
+		_, _ = c.Writer.WriteString("]")
+	}
+}
+
+// package lists could be sorted by key (architecture, name, version) or name (name, version, architecture)
+var packageSortKeys = []string{"key", "name"}
+
+// packageRefLess returns comparison of package refs for sort key
+//
+// Name and version are parsed from the ref, so packages aren't loaded for sorting.
+func packageRefLess(params listParams) func(a, b []byte) bool {
+	less := func(a, b []byte) bool {
+		return bytes.Compare(a, b) < 0
+	}
+
+	if params.Sort == "name" {
+		less = func(a, b []byte) bool {
+			fa, fb := bytes.SplitN(a, []byte(" "), 4), bytes.SplitN(b, []byte(" "), 4)
+			if len(fa) < 3 || len(fb) < 3 {
+				return bytes.Compare(a, b) < 0
+			}
+			if cmp := bytes.Compare(fa[1], fb[1]); cmp != 0 {
+				return cmp < 0
+			}
+			if cmp := deb.CompareVersions(string(fa[2]), string(fb[2])); cmp != 0 {
+				return cmp < 0
+			}
+			return bytes.Compare(a, b) < 0
+		}
+	}
+
+	if params.Desc {
+		return func(a, b []byte) bool {
+			return less(b, a)
+		}
+	}
+	return less
+}
+
+// pagePackageRefs sorts refs and returns the page following the cursor
+// together with cursor of the next page
+func pagePackageRefs(reflist *deb.PackageRefList, params listParams) (page *deb.PackageRefList, total int, next string) {
+	refs := [][]byte{}
+	if reflist != nil {
+		// refs are shared with the repo or snapshot, so sort a copy
+		refs = append(refs, reflist.Refs...)
+	}
+
+	less := packageRefLess(params)
+	if params.Sort != packageSortKeys[0] || params.Desc {
+		sort.Slice(refs, func(i, j int) bool { return less(refs[i], refs[j]) })
+	}
+
+	start := 0
+	if params.Cursor != "" {
+		cursor := []byte(params.Cursor)
+		start = sort.Search(len(refs), func(i int) bool { return less(cursor, refs[i]) })
+	}
+
+	end := params.page(start, len(refs))
+	if end < len(refs) {
+		next = string(refs[end-1])
+	}
+
+	return &deb.PackageRefList{Refs: refs[start:end]}, len(refs), next
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	gocontext "context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// poolResourceKey is task resource of the package pool, it prevents concurrent scrubbing
+const poolResourceKey = "__pool__"
+
+type poolScrubParams struct {
+	// Re-download missing or corrupted files from the mirrors
+	Redownload bool `json:"Redownload"`
+	// Limit speed of reading files from the pool (kbytes/sec), 0 means no limit
+	RateLimit int64 `json:"RateLimit"`
+}
+
+// poolScrub returns task verifying files in the package pool
+func poolScrub(params poolScrubParams) task.Process {
+	return func(ctx gocontext.Context, out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+		collectionFactory := context.NewCollectionFactory()
+
+		scrub := &deb.PoolScrub{
+			Pool:              context.PackagePool(),
+			ChecksumStorage:   collectionFactory.ChecksumCollection(nil),
+			CollectionFactory: collectionFactory,
+			RateLimit:         params.RateLimit * 1024,
+			Progress:          out,
+		}
+
+		if params.Redownload {
+			scrub.Downloader = context.NewDownloader(out)
+		}
+
+		out.Printf("Verifying files in package pool %s...\n", scrub.Pool)
+
+		result, err := scrub.Run(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scrub package pool: %s", err)
+		}
+
+		detail.Store(result)
+		out.Printf("Files verified: %d, missing: %d, corrupted: %d, re-downloaded: %d, failed: %d\n",
+			result.Checked, len(result.Missing), len(result.Corrupted), len(result.Repaired), len(result.Failed))
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: result}, nil
+	}
+}
+
+// poolScrubResources returns resources locked by pool scrubbing task
+func poolScrubResources(params poolScrubParams) []string {
+	if params.Redownload {
+		return []string{task.AllResourcesKey}
+	}
+
+	return []string{poolResourceKey}
+}
+
+// @Summary Scrub Package Pool
+// @Description **Verify checksums of files in the package pool**
+// @Description Every file referenced by packages is read back from the pool and compared with package metadata and checksums stored in the database.
+// @Description Missing or corrupted files are reported and optionally re-downloaded from the mirrors. Defaults are taken from `poolScrub` configuration.
+// @Tags Database
+// @Consume json
+// @Param request body poolScrubParams false "Parameters"
+// @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
+// @Produce json
+// @Success 200 {object} deb.PoolScrubResult
+// @Failure 400 {object} Error "Bad Request"
+// @Router /api/pool/scrub [post]
+func apiPoolScrub(c *gin.Context) {
+	b := poolScrubParams{
+		Redownload: context.Config().PoolScrub.Redownload,
+		RateLimit:  context.Config().PoolScrub.RateLimit,
+	}
+
+	if c.Request.ContentLength != 0 && c.Bind(&b) != nil {
+		return
+	}
+
+	maybeRunTaskInBackground(c, "Scrub package pool", poolScrubResources(b), poolScrub(b))
+}
+
+// SchedulePoolScrub starts periodic pool scrubbing as configured by poolScrub.interval
+//
+// Returned function stops scheduling and returns once no more scrubs are started,
+// scrubbing is skipped if previous run is still in progress. Router should be
+// initialized before.
+func SchedulePoolScrub() (func(), error) {
+	config := context.Config().PoolScrub
+	if config.Interval == "" {
+		return func() {}, nil
+	}
+
+	interval, err := time.ParseDuration(config.Interval)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid pool scrub interval: %q", config.Interval)
+	}
+
+	params := poolScrubParams{Redownload: config.Redownload, RateLimit: config.RateLimit}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				t, conflictErr := runTaskInBackground("Scrub package pool (scheduled)", poolScrubResources(params), poolScrub(params))
+				if conflictErr != nil {
+					log.Warn().Msgf("Skipping scheduled pool scrub: %s", conflictErr)
+				} else {
+					log.Info().Msgf("Started scheduled pool scrub, task %d", t.ID)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}, nil
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+type PoolSuite struct {
+	APISuite
+}
+
+var _ = Suite(&PoolSuite{})
+
+func (s *PoolSuite) TearDownTest(c *C) {
+	s.context.Config().PoolScrub = utils.PoolScrubConfig{}
+	s.context.TaskList().Wait()
+	s.context.TaskList().Clear()
+}
+
+func (s *PoolSuite) TestScrub(c *C) {
+	response, err := s.HTTPRequest("POST", "/api/pool/scrub", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 200)
+
+	var result deb.PoolScrubResult
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Check(result.Checked, Equals, 0)
+	c.Check(result.Broken(), Equals, 0)
+
+	response, err = s.HTTPRequest("POST", "/api/pool/scrub", strings.NewReader(`{"Redownload": true, "RateLimit": 1024}`))
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 200)
+
+	response, err = s.HTTPRequest("POST", "/api/pool/scrub", strings.NewReader(`{"RateLimit": "fast"}`))
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 400)
+}
+
+func (s *PoolSuite) TestSchedulePoolScrub(c *C) {
+	stop, err := SchedulePoolScrub()
+	c.Assert(err, IsNil)
+	stop()
+
+	s.context.Config().PoolScrub.Interval = "daily"
+	_, err = SchedulePoolScrub()
+	c.Check(err, ErrorMatches, "invalid pool scrub interval: \"daily\"")
+
+	s.context.Config().PoolScrub.Interval = "10ms"
+	stop, err = SchedulePoolScrub()
+	c.Assert(err, IsNil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.context.TaskList().GetTasks()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+
+	tasks := s.context.TaskList().GetTasks()
+	c.Assert(len(tasks) > 0, Equals, true)
+	c.Check(tasks[0].Name, Equals, "Scrub package pool (scheduled)")
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	gocontext "context"
 	"fmt"
 	"net/http"
 	"strings"
@@ -18,6 +19,8 @@ type signingParams struct {
 	Skip bool `                json:"Skip"           example:"false"`
 	// GPG key ID to use when signing the release, if not specified default key is used
 	GpgKey string `            json:"GpgKey"         example:"A0546A43624A8331"`
+	// Additional GPG key IDs, release is signed by every key (e.g. during key rotation)
+	GpgKeys []string `          json:"GpgKeys"        example:"A0546A43624A8331,8B48AD6246925553"`
 	// GPG keyring to use (instead of default)
 	Keyring string `           json:"Keyring"        example:"trustedkeys.gpg"`
 	// GPG secret keyring to use (instead of default) Note: depreciated with gpg2
@@ -35,13 +38,42 @@ type sourceParams struct {
 	Name string `binding:"required"        json:"Name"       example:"snap1"`
 }
 
-func getSigner(options *signingParams) (pgp.Signer, error) {
+// keys returns list of all GPG keys to sign with
+func (options *signingParams) keys() []string {
+	keys := []string{}
+	if options.GpgKey != "" {
+		keys = append(keys, options.GpgKey)
+	}
+
+	for _, key := range options.GpgKeys {
+		if key != "" && !utils.StrSliceHasItem(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// getSigner initializes signer
+//
+// If published repository is given, keys from options replace keys stored in it,
+// and when no keys are specified, stored keys are used
+func getSigner(options *signingParams, published *deb.PublishedRepo) (pgp.Signer, error) {
 	if options.Skip {
 		return nil, nil
 	}
 
+	keys := options.keys()
+	if published != nil {
+		if len(keys) > 0 {
+			published.SigningKeys = keys
+		} else {
+			keys = published.SigningKeys
+		}
+	}
+
 	signer := context.GetSigner()
-	signer.SetKey(options.GpgKey)
+	signer.SetKeys(keys)
 	signer.SetKeyRing(options.Keyring, options.SecretKeyring)
 	signer.SetPassphrase(options.Passphrase, options.PassphraseFile)
 
@@ -56,6 +88,16 @@ func getSigner(options *signingParams) (pgp.Signer, error) {
 	return signer, nil
 }
 
+// publishPlanReturnValue builds task result out of dry-run publish plan
+func publishPlanReturnValue(plan *deb.PublishPlan) (*task.ProcessReturnValue, error) {
+	changes, err := plan.Changes()
+	if err != nil {
+		return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to build publish plan: %s", err)
+	}
+
+	return &task.ProcessReturnValue{Code: http.StatusOK, Value: changes}, nil
+}
+
 // Replace '_' with '/' and double '__' with single '_', SanitizePath
 func slashEscape(path string) string {
 	result := strings.Replace(strings.Replace(path, "_", "/", -1), "//", "_", -1)
@@ -170,6 +212,8 @@ type publishedRepoCreateParams struct {
 	AcquireByHash *bool `                         json:"AcquireByHash"         example:"false"`
 	// Enable multiple packages with the same filename in different distributions
 	MultiDist *bool `                             json:"MultiDist"             example:"false"`
+	// Don't publish, return changes to published storage instead
+	DryRun bool `                                 json:"DryRun"                example:"false"`
 }
 
 // @Summary Create Published Repository
@@ -189,6 +233,8 @@ type publishedRepoCreateParams struct {
 // @Tags Publish
 // @Param prefix path string true "publishing prefix"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Consume json
 // @Param request body publishedRepoCreateParams true "Parameters"
 // @Produce json
@@ -221,7 +267,7 @@ func apiPublishRepoOrSnapshot(c *gin.Context) {
 	}
 	b.Architectures = archs
 
-	signer, err := getSigner(&b.Signing)
+	signer, err := getSigner(&b.Signing, nil)
 	if err != nil {
 		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
 		return
@@ -284,7 +330,7 @@ func apiPublishRepoOrSnapshot(c *gin.Context) {
 
 	taskName := fmt.Sprintf("Publish %s repository %s/%s with components \"%s\" and sources \"%s\"",
 		b.SourceKind, param, b.Distribution, strings.Join(components, `", "`), strings.Join(names, `", "`))
-	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, func(ctx gocontext.Context, out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
 		taskDetail := task.PublishDetail{
 			Detail: detail,
 		}
@@ -316,6 +362,10 @@ func apiPublishRepoOrSnapshot(c *gin.Context) {
 
 		resources = append(resources, string(published.Key()))
 
+		if !b.Signing.Skip {
+			published.SigningKeys = b.Signing.keys()
+		}
+
 		if b.Origin != "" {
 			published.Origin = b.Origin
 		}
@@ -347,7 +397,17 @@ func apiPublishRepoOrSnapshot(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, fmt.Errorf("prefix/distribution already used by another published repo: %s", duplicate)
 		}
 
-		err = published.Publish(context.PackagePool(), context, collectionFactory, signer, publishOutput, b.ForceOverwrite, context.SkelPath())
+		if b.DryRun {
+			plan := deb.NewPublishPlan(context)
+			err = published.Publish(ctx, context.PackagePool(), plan, collectionFactory, signer, publishOutput, b.ForceOverwrite, context.SkelPath())
+			if err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to publish: %s", err)
+			}
+
+			return publishPlanReturnValue(plan)
+		}
+
+		err = published.Publish(ctx, context.PackagePool(), context, collectionFactory, signer, publishOutput, b.ForceOverwrite, context.SkelPath())
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to publish: %s", err)
 		}
@@ -357,6 +417,10 @@ func apiPublishRepoOrSnapshot(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
 		}
 
+		event := publishedEvent(eventCreated, published)
+		event.TaskID = detail.TaskID()
+		events.publish(event)
+
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: published}, nil
 	})
 }
@@ -378,6 +442,8 @@ type publishedRepoUpdateSwitchParams struct {
 	AcquireByHash *bool `                         json:"AcquireByHash"  example:"false"`
 	// Enable multiple packages with the same filename in different distributions
 	MultiDist *bool `                             json:"MultiDist"      example:"false"`
+	// Don't publish, return changes to published storage instead
+	DryRun bool `                                 json:"DryRun"         example:"false"`
 }
 
 // @Summary Update Published Repository
@@ -397,6 +463,8 @@ type publishedRepoUpdateSwitchParams struct {
 // @Param prefix path string true "publishing prefix"
 // @Param distribution path string true "distribution name"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Consume json
 // @Param request body publishedRepoUpdateSwitchParams true "Parameters"
 // @Produce json
@@ -416,12 +484,6 @@ func apiPublishUpdateSwitch(c *gin.Context) {
 		return
 	}
 
-	signer, err := getSigner(&b.Signing)
-	if err != nil {
-		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
-		return
-	}
-
 	collectionFactory := context.NewCollectionFactory()
 	collection := collectionFactory.PublishedRepoCollection()
 	snapshotCollection := collectionFactory.SnapshotCollection()
@@ -432,6 +494,12 @@ func apiPublishUpdateSwitch(c *gin.Context) {
 		return
 	}
 
+	signer, err := getSigner(&b.Signing, published)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
+		return
+	}
+
 	if published.SourceKind == deb.SourceLocalRepo {
 		if len(b.Snapshots) > 0 {
 			AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("snapshots shouldn't be given when updating local repo"))
@@ -466,9 +534,15 @@ func apiPublishUpdateSwitch(c *gin.Context) {
 		published.MultiDist = *b.MultiDist
 	}
 
+	actor := apiActor(c)
 	resources := []string{string(published.Key())}
 	taskName := fmt.Sprintf("Update published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
-	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	event := publishedEvent(eventUpdated, published)
+	if published.SourceKind == deb.SourceSnapshot && len(b.Snapshots) > 0 {
+		event.Action = eventSwitched
+	}
+
+	var proc task.Process = func(ctx gocontext.Context, out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err = collection.LoadComplete(published, collectionFactory)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
@@ -490,27 +564,46 @@ func apiPublishUpdateSwitch(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 		}
 
-		err = published.Publish(context.PackagePool(), context, collectionFactory, signer, out, b.ForceOverwrite, context.SkelPath())
+		var provider aptly.PublishedStorageProvider = context
+		if b.DryRun {
+			provider = deb.NewPublishPlan(context)
+		}
+
+		err = published.Publish(ctx, context.PackagePool(), provider, collectionFactory, signer, out, b.ForceOverwrite, context.SkelPath())
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 		}
 
-		err = collection.Update(published)
-		if err != nil {
-			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+		if !b.DryRun {
+			published.RecordHistory(actor)
+			err = collection.Update(published)
+			if err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+			}
 		}
 
 		if b.SkipCleanup == nil || !*b.SkipCleanup {
 			cleanComponents := make([]string, 0, len(result.UpdatedSources)+len(result.RemovedSources))
 			cleanComponents = append(append(cleanComponents, result.UpdatedComponents()...), result.RemovedComponents()...)
-			err = collection.CleanupPrefixComponentFiles(context, published, cleanComponents, collectionFactory, out)
+			err = collection.CleanupPrefixComponentFiles(provider, published, cleanComponents, collectionFactory, out)
 			if err != nil {
 				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 			}
 		}
 
+		if b.DryRun {
+			return publishPlanReturnValue(provider.(*deb.PublishPlan))
+		}
+
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: published}, nil
-	})
+	}
+
+	// dry run doesn't change published repository
+	if !b.DryRun {
+		proc = withEvent(event, proc)
+	}
+
+	maybeRunTaskInBackground(c, taskName, resources, proc)
 }
 
 // @Summary Delete Published Repository
@@ -528,6 +621,8 @@ func apiPublishUpdateSwitch(c *gin.Context) {
 // @Param force query int true "force: 1 to enable"
 // @Param skipCleanup query int true "skipCleanup: 1 to enable"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Success 200
 // @Failure 400 {object} Error "Bad Request"
 // @Failure 404 {object} Error "Published repository not found"
@@ -552,7 +647,7 @@ func apiPublishDrop(c *gin.Context) {
 
 	resources := []string{string(published.Key())}
 	taskName := fmt.Sprintf("Delete published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
-	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(publishedEvent(eventDropped, published), func(_ gocontext.Context, out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err := collection.Remove(context, storage, prefix, distribution,
 			collectionFactory, out, force, skipCleanup)
 		if err != nil {
@@ -560,7 +655,7 @@ func apiPublishDrop(c *gin.Context) {
 		}
 
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: gin.H{}}, nil
-	})
+	}))
 }
 
 // @Summary Add Source Component
@@ -575,6 +670,8 @@ func apiPublishDrop(c *gin.Context) {
 // @Param prefix path string true "publishing prefix"
 // @Param distribution path string true "distribution name"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Consume json
 // @Param request body sourceParams true "Parameters"
 // @Produce json
@@ -625,14 +722,14 @@ func apiPublishAddSource(c *gin.Context) {
 
 	resources := []string{string(published.Key())}
 	taskName := fmt.Sprintf("Update published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(publishedEvent(eventUpdated, published), func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err = collection.Update(published)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
 		}
 
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: gin.H{}}, nil
-	})
+	}))
 }
 
 // @Summary List Pending Changes
@@ -693,6 +790,8 @@ func apiPublishListChanges(c *gin.Context) {
 // @Param prefix path string true "publishing prefix"
 // @Param distribution path string true "distribution name"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Consume json
 // @Param request body []sourceParams true "Parameters"
 // @Produce json
@@ -739,14 +838,14 @@ func apiPublishSetSources(c *gin.Context) {
 
 	resources := []string{string(published.Key())}
 	taskName := fmt.Sprintf("Update published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(publishedEvent(eventUpdated, published), func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err = collection.Update(published)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
 		}
 
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: revision.SourceList()}, nil
-	})
+	}))
 }
 
 // @Summary Discard Pending Changes
@@ -759,6 +858,8 @@ func apiPublishSetSources(c *gin.Context) {
 // @Param prefix path string true "publishing prefix"
 // @Param distribution path string true "distribution name"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Produce json
 // @Success 200
 // @Failure 400 {object} Error "Bad Request"
@@ -789,14 +890,14 @@ func apiPublishDropChanges(c *gin.Context) {
 
 	resources := []string{string(published.Key())}
 	taskName := fmt.Sprintf("Update published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(publishedEvent(eventUpdated, published), func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err = collection.Update(published)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
 		}
 
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: gin.H{}}, nil
-	})
+	}))
 }
 
 // @Summary Update Source Component
@@ -812,6 +913,8 @@ func apiPublishDropChanges(c *gin.Context) {
 // @Param distribution path string true "distribution name"
 // @Param component path string true "component name"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Consume json
 // @Param request body sourceParams true "Parameters"
 // @Produce json
@@ -869,14 +972,14 @@ func apiPublishUpdateSource(c *gin.Context) {
 
 	resources := []string{string(published.Key())}
 	taskName := fmt.Sprintf("Update published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(publishedEvent(eventUpdated, published), func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err = collection.Update(published)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
 		}
 
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: gin.H{}}, nil
-	})
+	}))
 }
 
 // @Summary Remove Source Component
@@ -892,6 +995,8 @@ func apiPublishUpdateSource(c *gin.Context) {
 // @Param distribution path string true "distribution name"
 // @Param component path string true "component name"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Produce json
 // @Success 200
 // @Failure 400 {object} Error "Bad Request"
@@ -932,14 +1037,14 @@ func apiPublishRemoveSource(c *gin.Context) {
 
 	resources := []string{string(published.Key())}
 	taskName := fmt.Sprintf("Update published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(publishedEvent(eventUpdated, published), func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err = collection.Update(published)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
 		}
 
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: gin.H{}}, nil
-	})
+	}))
 }
 
 type publishedRepoUpdateParams struct {
@@ -957,6 +1062,8 @@ type publishedRepoUpdateParams struct {
 	AcquireByHash *bool `                         json:"AcquireByHash"   example:"false"`
 	// Enable multiple packages with the same filename in different distributions
 	MultiDist *bool `                             json:"MultiDist"       example:"false"`
+	// Don't publish, return changes to published storage instead
+	DryRun bool `                                 json:"DryRun"          example:"false"`
 }
 
 // @Summary Update Published Repository
@@ -969,6 +1076,8 @@ type publishedRepoUpdateParams struct {
 // @Param prefix path string true "publishing prefix"
 // @Param distribution path string true "distribution name"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Consume json
 // @Param request body publishedRepoUpdateParams true "Parameters"
 // @Produce json
@@ -988,12 +1097,6 @@ func apiPublishUpdate(c *gin.Context) {
 		return
 	}
 
-	signer, err := getSigner(&b.Signing)
-	if err != nil {
-		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
-		return
-	}
-
 	collectionFactory := context.NewCollectionFactory()
 	collection := collectionFactory.PublishedRepoCollection()
 
@@ -1003,6 +1106,12 @@ func apiPublishUpdate(c *gin.Context) {
 		return
 	}
 
+	signer, err := getSigner(&b.Signing, published)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
+		return
+	}
+
 	err = collection.LoadComplete(published, collectionFactory)
 	if err != nil {
 		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to update: %s", err))
@@ -1025,33 +1134,214 @@ func apiPublishUpdate(c *gin.Context) {
 		published.MultiDist = *b.MultiDist
 	}
 
+	actor := apiActor(c)
 	resources := []string{string(published.Key())}
 	taskName := fmt.Sprintf("Update published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
-	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	var proc task.Process = func(ctx gocontext.Context, out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		result, err := published.Update(collectionFactory, out)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 		}
 
-		err = published.Publish(context.PackagePool(), context, collectionFactory, signer, out, b.ForceOverwrite, context.SkelPath())
+		var provider aptly.PublishedStorageProvider = context
+		if b.DryRun {
+			provider = deb.NewPublishPlan(context)
+		}
+
+		err = published.Publish(ctx, context.PackagePool(), provider, collectionFactory, signer, out, b.ForceOverwrite, context.SkelPath())
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 		}
 
-		err = collection.Update(published)
-		if err != nil {
-			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+		if !b.DryRun {
+			published.RecordHistory(actor)
+			err = collection.Update(published)
+			if err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+			}
 		}
 
 		if b.SkipCleanup == nil || !*b.SkipCleanup {
 			cleanComponents := make([]string, 0, len(result.UpdatedSources)+len(result.RemovedSources))
 			cleanComponents = append(append(cleanComponents, result.UpdatedComponents()...), result.RemovedComponents()...)
-			err = collection.CleanupPrefixComponentFiles(context, published, cleanComponents, collectionFactory, out)
+			err = collection.CleanupPrefixComponentFiles(provider, published, cleanComponents, collectionFactory, out)
 			if err != nil {
 				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 			}
 		}
 
+		if b.DryRun {
+			return publishPlanReturnValue(provider.(*deb.PublishPlan))
+		}
+
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: published}, nil
-	})
+	}
+
+	// dry run doesn't change published repository
+	if !b.DryRun {
+		proc = withEvent(publishedEvent(eventUpdated, published), proc)
+	}
+
+	maybeRunTaskInBackground(c, taskName, resources, proc)
+}
+
+// @Summary Published Repository History
+// @Description **List previous sources of a published repository**
+// @Description
+// @Description Most recent entry comes first, `Step` is the value to pass to rollback.
+// @Description
+// @Description See also: `aptly publish show`
+// @Tags Publish
+// @Param prefix path string true "publishing prefix"
+// @Param distribution path string true "distribution name"
+// @Produce json
+// @Success 200 {array} deb.PublishedRepoHistoryItem
+// @Failure 404 {object} Error "Published repository not found"
+// @Router /api/publish/{prefix}/{distribution}/history [get]
+func apiPublishHistory(c *gin.Context) {
+	param := slashEscape(c.Params.ByName("prefix"))
+	storage, prefix := deb.ParsePrefix(param)
+	distribution := slashEscape(c.Params.ByName("distribution"))
+
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.PublishedRepoCollection()
+
+	published, err := collection.ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, fmt.Errorf("unable to show: %s", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, published.HistoryItems(collectionFactory))
+}
+
+type publishedRepoRollbackParams struct {
+	// Number of steps back in the history to restore
+	To int `                                      json:"To"              example:"1"`
+	// when publishing, overwrite files in pool/ directory without notice
+	ForceOverwrite bool `                         json:"ForceOverwrite"  example:"false"`
+	// GPG options
+	Signing signingParams `                       json:"Signing"`
+	// Don't remove unreferenced files in prefix/component
+	SkipCleanup *bool `                           json:"SkipCleanup"     example:"false"`
+	// Don't publish, return changes to published storage instead
+	DryRun bool `                                 json:"DryRun"          example:"false"`
+}
+
+// @Summary Rollback Published Repository
+// @Description **Restore previous sources of a published repository and re-publish it**
+// @Description
+// @Description By default sources published right before the current ones are restored.
+// @Description
+// @Description See also: `aptly publish rollback`
+// @Tags Publish
+// @Param prefix path string true "publishing prefix"
+// @Param distribution path string true "distribution name"
+// @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
+// @Consume json
+// @Param request body publishedRepoRollbackParams true "Parameters"
+// @Produce json
+// @Success 200 {object} deb.PublishedRepo
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 404 {object} Error "Published repository not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/publish/{prefix}/{distribution}/rollback [post]
+func apiPublishRollback(c *gin.Context) {
+	var b publishedRepoRollbackParams
+
+	param := slashEscape(c.Params.ByName("prefix"))
+	storage, prefix := deb.ParsePrefix(param)
+	distribution := slashEscape(c.Params.ByName("distribution"))
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	if b.To == 0 {
+		b.To = 1
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.PublishedRepoCollection()
+
+	published, err := collection.ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, fmt.Errorf("unable to rollback: %s", err))
+		return
+	}
+
+	signer, err := getSigner(&b.Signing, published)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
+		return
+	}
+
+	err = collection.LoadComplete(published, collectionFactory)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to rollback: %s", err))
+		return
+	}
+
+	if published.Revision != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("unable to rollback: published repository has pending source changes"))
+		return
+	}
+
+	_, err = published.Rollback(b.To, collectionFactory)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("unable to rollback: %s", err))
+		return
+	}
+
+	actor := apiActor(c)
+	resources := []string{string(published.Key())}
+	taskName := fmt.Sprintf("Rollback published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
+	var proc task.Process = func(ctx gocontext.Context, out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		result, err := published.Update(collectionFactory, out)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to rollback: %s", err)
+		}
+
+		var provider aptly.PublishedStorageProvider = context
+		if b.DryRun {
+			provider = deb.NewPublishPlan(context)
+		}
+
+		err = published.Publish(ctx, context.PackagePool(), provider, collectionFactory, signer, out, b.ForceOverwrite, context.SkelPath())
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to rollback: %s", err)
+		}
+
+		if !b.DryRun {
+			published.RecordHistory(actor)
+			err = collection.Update(published)
+			if err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+			}
+		}
+
+		if b.SkipCleanup == nil || !*b.SkipCleanup {
+			cleanComponents := make([]string, 0, len(result.UpdatedSources)+len(result.RemovedSources))
+			cleanComponents = append(append(cleanComponents, result.UpdatedComponents()...), result.RemovedComponents()...)
+			err = collection.CleanupPrefixComponentFiles(provider, published, cleanComponents, collectionFactory, out)
+			if err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to rollback: %s", err)
+			}
+		}
+
+		if b.DryRun {
+			return publishPlanReturnValue(provider.(*deb.PublishPlan))
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: published}, nil
+	}
+
+	// dry run doesn't change published repository
+	if !b.DryRun {
+		proc = withEvent(publishedEvent(eventUpdated, published), proc)
+	}
+
+	maybeRunTaskInBackground(c, taskName, resources, proc)
 }
@@ -1,6 +1,7 @@
 package api
 
 import (
+	gocontext "context"
 	"fmt"
 	"net/http"
 	"os"
@@ -161,6 +162,8 @@ func apiReposCreate(c *gin.Context) {
 		return
 	}
 
+	events.publish(Event{Type: eventRepo, Action: eventCreated, Name: repo.Name})
+
 	c.JSON(http.StatusCreated, repo)
 }
 
@@ -224,6 +227,8 @@ func apiReposEdit(c *gin.Context) {
 		return
 	}
 
+	events.publish(Event{Type: eventRepo, Action: eventUpdated, Name: repo.Name})
+
 	c.JSON(200, repo)
 }
 
@@ -256,6 +261,8 @@ func apiReposShow(c *gin.Context) {
 // @Tags Repos
 // @Produce json
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Param force query int false "force: 1 to enable"
 // @Success 200 {object} task.ProcessReturnValue "Repo object"
 // @Failure 404 {object} Error "Not Found"
@@ -278,7 +285,7 @@ func apiReposDrop(c *gin.Context) {
 
 	resources := []string{string(repo.Key())}
 	taskName := fmt.Sprintf("Delete repo %s", name)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(Event{Type: eventRepo, Action: eventDropped, Name: name}, func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		published := publishedCollection.ByLocalRepo(repo)
 		if len(published) > 0 {
 			return &task.ProcessReturnValue{Code: http.StatusConflict, Value: nil}, fmt.Errorf("unable to drop, local repo is published")
@@ -292,7 +299,7 @@ func apiReposDrop(c *gin.Context) {
 		}
 
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: gin.H{}}, collection.Drop(repo)
-	})
+	}))
 }
 
 // @Summary List Repo Packages
@@ -300,6 +307,9 @@ func apiReposDrop(c *gin.Context) {
 // @Description
 // @Description If `q` query parameter is missing, return all packages, otherwise return packages that match q
 // @Description
+// @Description With `limit`, packages are returned in pages, `X-Next-Cursor` header holds `cursor` of the next page.
+// @Description Total number of packages is returned in `X-Total-Count` header.
+// @Description
 // @Description **Example:**
 // @Description ```
 // @Description $ curl http://localhost:8080/api/repos/aptly-repo/packages
@@ -312,6 +322,9 @@ func apiReposDrop(c *gin.Context) {
 // @Param withDeps query string true "Set to 1 to include dependencies when evaluating package query"
 // @Param format query string true "Set to 'details' to return extra info about each package"
 // @Param maximumVersion query string true "Set to 1 to only return the highest version for each package name"
+// @Param sort query string false "Sort key: `key` or `name`, prefixed with `-` for descending order"
+// @Param limit query int false "Maximum number of packages returned"
+// @Param cursor query string false "Cursor of the page, as returned in `X-Next-Cursor` header"
 // @Success 200 {object} string "msg"
 // @Failure 404 {object} Error "Not Found"
 // @Failure 404 {object} Error "Internal Server Error"
@@ -359,7 +372,7 @@ func apiReposPackagesAddDelete(c *gin.Context, taskNamePrefix string, cb func(li
 
 	resources := []string{string(repo.Key())}
 
-	maybeRunTaskInBackground(c, taskNamePrefix+repo.Name, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskNamePrefix+repo.Name, resources, withEvent(Event{Type: eventRepo, Action: eventUpdated, Name: repo.Name}, func(_ gocontext.Context, out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err = collection.LoadComplete(repo)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
@@ -396,7 +409,7 @@ func apiReposPackagesAddDelete(c *gin.Context, taskNamePrefix string, cb func(li
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save: %s", err)
 		}
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: repo}, nil
-	})
+	}))
 }
 
 // @Summary Add Packages by Key
@@ -409,6 +422,8 @@ func apiReposPackagesAddDelete(c *gin.Context, taskNamePrefix string, cb func(li
 // @Produce json
 // @Param request body reposPackagesAddDeleteParams true "Parameters"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Success 200 {object} string "msg"
 // @Failure 400 {object} Error "Bad Request"
 // @Failure 404 {object} Error "Not Found"
@@ -429,6 +444,8 @@ func apiReposPackagesAdd(c *gin.Context) {
 // @Produce json
 // @Param request body reposPackagesAddDeleteParams true "Parameters"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Success 200 {object} string "msg"
 // @Failure 400 {object} Error "Bad Request"
 // @Failure 404 {object} Error "Not Found"
@@ -451,6 +468,8 @@ func apiReposPackagesDelete(c *gin.Context) {
 // @Param dir path string true "Directory of packages"
 // @Param file path string false "Filename (optional)"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Produce json
 // @Success 200 {string} string "OK"
 // @Failure 400 {object} Error "wrong file"
@@ -473,6 +492,8 @@ func apiReposPackageFromFile(c *gin.Context) {
 // @Param noRemove query string false "when value is set to 1, don’t remove any files"
 // @Param forceReplace query string false "when value is set to 1, remove packages conflicting with package being added (in local repository)"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Produce  json
 // @Success 200 {string} string "OK"
 // @Failure 400 {object} Error "wrong file"
@@ -516,7 +537,7 @@ func apiReposPackageFromDir(c *gin.Context) {
 
 	resources := []string{string(repo.Key())}
 	resources = append(resources, sources...)
-	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(Event{Type: eventRepo, Action: eventUpdated, Name: name}, func(ctx gocontext.Context, out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err = collection.LoadComplete(repo)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
@@ -543,7 +564,7 @@ func apiReposPackageFromDir(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to load packages: %s", err)
 		}
 
-		processedFiles, failedFiles2, err = deb.ImportPackageFiles(list, packageFiles, forceReplace, verifier, context.PackagePool(),
+		processedFiles, failedFiles2, err = deb.ImportPackageFiles(ctx, list, packageFiles, forceReplace, verifier, context.PackagePool(),
 			collectionFactory.PackageCollection(), reporter, nil, collectionFactory.ChecksumCollection)
 		failedFiles = append(failedFiles, failedFiles2...)
 		processedFiles = append(processedFiles, otherFiles...)
@@ -594,7 +615,7 @@ func apiReposPackageFromDir(c *gin.Context) {
 			"Report":      reporter,
 			"FailedFiles": failedFiles,
 		}}, nil
-	})
+	}))
 }
 
 type reposCopyPackageParams struct {
@@ -612,6 +633,8 @@ type reposCopyPackageParams struct {
 // @Param src path string true "Destination repo"
 // @Param file path string true "File/packages to copy"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Success 200 {object} task.ProcessReturnValue "msg"
 // @Failure 400 {object} Error "Bad Request"
 // @Failure 404 {object} Error "Not Found"
@@ -655,7 +678,7 @@ func apiReposCopyPackage(c *gin.Context) {
 	taskName := fmt.Sprintf("Copy packages from repo %s to repo %s", srcRepoName, dstRepoName)
 	resources := []string{string(dstRepo.Key()), string(srcRepo.Key())}
 
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(Event{Type: eventRepo, Action: eventUpdated, Name: dstRepoName}, func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err = collectionFactory.LocalRepoCollection().LoadComplete(dstRepo)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, fmt.Errorf("dest repo error: %s", err)
@@ -756,7 +779,7 @@ func apiReposCopyPackage(c *gin.Context) {
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: gin.H{
 			"Report": reporter,
 		}}, nil
-	})
+	}))
 }
 
 // @Summary Include File from Directory
@@ -768,6 +791,8 @@ func apiReposCopyPackage(c *gin.Context) {
 // @Param acceptUnsigned query int false "when value is set to 1, accept unsigned .changes files"
 // @Param ignoreSignature query int false "when value is set to 1 disable verification of .changes file signature"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Success 200 {object} string "msg"
 // @Failure 404 {object} Error "Not Found"
 // @Router /api/repos/{name}/include/{dir}/{file} [post]
@@ -790,6 +815,8 @@ type reposIncludePackageFromDirResponse struct {
 // @Param acceptUnsigned query int false "when value is set to 1, accept unsigned .changes files"
 // @Param ignoreSignature query int false "when value is set to 1 disable verification of .changes file signature"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Success 200 {object} reposIncludePackageFromDirResponse "Response"
 // @Failure 404 {object} Error "Not Found"
 // @Router /api/repos/{name}/include/{dir} [post]
@@ -844,7 +871,7 @@ func apiReposIncludePackageFromDir(c *gin.Context) {
 	}
 	resources = append(resources, sources...)
 
-	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	var proc task.Process = func(ctx gocontext.Context, out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		var (
 			err                       error
 			verifier                  = context.GetVerifier()
@@ -859,7 +886,7 @@ func apiReposIncludePackageFromDir(c *gin.Context) {
 
 		changesFiles, failedFiles = deb.CollectChangesFiles(sources, reporter)
 		_, failedFiles2, err = deb.ImportChangesFiles(
-			changesFiles, reporter, acceptUnsigned, ignoreSignature, forceReplace, noRemoveFiles, verifier,
+			ctx, changesFiles, reporter, acceptUnsigned, ignoreSignature, forceReplace, noRemoveFiles, verifier,
 			repoTemplate, context.Progress(), collectionFactory.LocalRepoCollection(), collectionFactory.PackageCollection(),
 			context.PackagePool(), collectionFactory.ChecksumCollection, nil, query.Parse)
 		failedFiles = append(failedFiles, failedFiles2...)
@@ -895,5 +922,12 @@ func apiReposIncludePackageFromDir(c *gin.Context) {
 			FailedFiles: failedFiles,
                     }
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: ret}, nil
-	})
+	}
+
+	// packages are included into single repository only if template is plain name
+	if len(repoTemplate.Root.Nodes) <= 1 {
+		proc = withEvent(Event{Type: eventRepo, Action: eventUpdated, Name: repoTemplateString}, proc)
+	}
+
+	maybeRunTaskInBackground(c, taskName, resources, proc)
 }
@@ -81,7 +81,24 @@ func Router(c *ctx.AptlyContext) http.Handler {
 		router.GET("/repos/:storage/*pkgPath", reposServeInAPIMode)
 	}
 
+	auth := newAPIAuth(c.Config().APIAuth)
+
+	c.TaskList().SetObserver(publishTaskEvent)
+	c.TaskList().SetConcurrencyLimits(taskConcurrencyLimits(c.Config().TaskConcurrency))
+
+	{
+		// event stream is long-lived, so it doesn't acquire database in no-lock mode
+		eventsAPI := router.Group("/api")
+		if auth != nil {
+			eventsAPI.Use(auth.middleware())
+		}
+		eventsAPI.GET("/events", apiEvents)
+	}
+
 	api := router.Group("/api")
+	if auth != nil {
+		api.Use(auth.middleware())
+	}
 	if context.Flags().Lookup("no-lock").Value.Get().(bool) {
 		// We use a goroutine to count the number of
 		// concurrent requests. When no more requests are
@@ -192,6 +209,8 @@ func Router(c *ctx.AptlyContext) http.Handler {
 		api.PUT("/publish/:prefix/:distribution/sources/:component", apiPublishUpdateSource)
 		api.DELETE("/publish/:prefix/:distribution/sources/:component", apiPublishRemoveSource)
 		api.POST("/publish/:prefix/:distribution/update", apiPublishUpdate)
+		api.GET("/publish/:prefix/:distribution/history", apiPublishHistory)
+		api.POST("/publish/:prefix/:distribution/rollback", apiPublishRollback)
 	}
 
 	{
@@ -216,6 +235,15 @@ func Router(c *ctx.AptlyContext) http.Handler {
 	}
 	{
 		api.POST("/db/cleanup", apiDBCleanup)
+		api.POST("/pool/scrub", apiPoolScrub)
+	}
+	{
+		api.GET("/webhooks", apiWebhooksList)
+		api.POST("/webhooks", apiWebhooksCreate)
+		api.GET("/webhooks/:name", apiWebhooksShow)
+		api.PUT("/webhooks/:name", apiWebhooksEdit)
+		api.DELETE("/webhooks/:name", apiWebhooksDrop)
+		api.GET("/webhooks/:name/deliveries", apiWebhooksDeliveries)
 	}
 	{
 		api.GET("/tasks", apiTasksList)
@@ -227,6 +255,7 @@ func Router(c *ctx.AptlyContext) http.Handler {
 		api.GET("/tasks/:id/return_value", apiTasksReturnValueShow)
 		api.GET("/tasks/:id", apiTasksShow)
 		api.DELETE("/tasks/:id", apiTasksDelete)
+		api.POST("/tasks/:id/cancel", apiTasksCancel)
 	}
 
 	return router
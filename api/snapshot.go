@@ -1,6 +1,7 @@
 package api
 
 import (
+	gocontext "context"
 	"fmt"
 	"net/http"
 	"sort"
@@ -14,6 +15,19 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// phases of snapshot merge and pull reported in task detail
+const (
+	snapshotPhaseMerge        = "merging"
+	snapshotPhaseLoad         = "loading packages"
+	snapshotPhaseDependencies = "resolving dependencies"
+	snapshotPhasePull         = "pulling"
+)
+
+var snapshotPullPhases = map[aptly.BarType]string{
+	aptly.BarGeneralBuildPackageList:   snapshotPhaseLoad,
+	aptly.BarGeneralVerifyDependencies: snapshotPhaseDependencies,
+}
+
 // @Summary List Snapshots
 // @Description **Get list of snapshots**
 // @Description
@@ -55,6 +69,8 @@ type snapshotsCreateFromMirrorParams struct {
 // @Param request body snapshotsCreateFromMirrorParams true "Parameters"
 // @Param name path string true "Mirror name"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Success 201 {object} deb.Snapshot "Created Snapshot"
 // @Failure 400 {object} Error "Bad Request"
 // @Failure 404 {object} Error "Mirror Not Found"
@@ -87,7 +103,7 @@ func apiSnapshotsCreateFromMirror(c *gin.Context) {
 	// including snapshot resource key
 	resources := []string{string(repo.Key()), "S" + b.Name}
 	taskName := fmt.Sprintf("Create snapshot of mirror %s", name)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(Event{Type: eventSnapshot, Action: eventCreated, Name: b.Name}, func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err := repo.CheckLock()
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusConflict, Value: nil}, err
@@ -112,7 +128,7 @@ func apiSnapshotsCreateFromMirror(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, err
 		}
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: snapshot}, nil
-	})
+	}))
 }
 
 type snapshotsCreateParams struct {
@@ -133,6 +149,8 @@ type snapshotsCreateParams struct {
 // @Tags Snapshots
 // @Param request body snapshotsCreateParams true "Parameters"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Produce json
 // @Success 201 {object} deb.Snapshot "Created snapshot"
 // @Failure 400 {object} Error "Bad Request"
@@ -172,7 +190,7 @@ func apiSnapshotsCreate(c *gin.Context) {
 		resources = append(resources, string(sources[i].ResourceKey()))
 	}
 
-	maybeRunTaskInBackground(c, "Create snapshot "+b.Name, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, "Create snapshot "+b.Name, resources, withEvent(Event{Type: eventSnapshot, Action: eventCreated, Name: b.Name}, func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		for i := range sources {
 			err = snapshotCollection.LoadComplete(sources[i])
 			if err != nil {
@@ -204,7 +222,7 @@ func apiSnapshotsCreate(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, err
 		}
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: snapshot}, nil
-	})
+	}))
 }
 
 type snapshotsCreateFromRepositoryParams struct {
@@ -222,6 +240,8 @@ type snapshotsCreateFromRepositoryParams struct {
 // @Param request body snapshotsCreateFromRepositoryParams true "Parameters"
 // @Param name path string true "Name of the snapshot"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Produce json
 // @Success 201 {object} deb.Snapshot "Created snapshot object"
 // @Failure 400 {object} Error "Bad Request"
@@ -254,7 +274,7 @@ func apiSnapshotsCreateFromRepository(c *gin.Context) {
 	// including snapshot resource key
 	resources := []string{string(repo.Key()), "S" + b.Name}
 	taskName := fmt.Sprintf("Create snapshot of repo %s", name)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(Event{Type: eventSnapshot, Action: eventCreated, Name: b.Name}, func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err := collection.LoadComplete(repo)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
@@ -274,7 +294,7 @@ func apiSnapshotsCreateFromRepository(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, err
 		}
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: snapshot}, nil
-	})
+	}))
 }
 
 type snapshotsUpdateParams struct {
@@ -290,6 +310,8 @@ type snapshotsUpdateParams struct {
 // @Param request body snapshotsUpdateParams true "Parameters"
 // @Param name path string true "Snapshot name"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Produce json
 // @Success 200 {object} deb.Snapshot "Updated snapshot object"
 // @Failure 404 {object} Error "Snapshot Not Found"
@@ -319,7 +341,7 @@ func apiSnapshotsUpdate(c *gin.Context) {
 
 	resources := []string{string(snapshot.ResourceKey()), "S" + b.Name}
 	taskName := fmt.Sprintf("Update snapshot %s", name)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, func(_ gocontext.Context, _ aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
 		_, err := collection.ByName(b.Name)
 		if err == nil {
 			return &task.ProcessReturnValue{Code: http.StatusConflict, Value: nil}, fmt.Errorf("unable to rename: snapshot %s already exists", b.Name)
@@ -337,6 +359,9 @@ func apiSnapshotsUpdate(c *gin.Context) {
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
 		}
+
+		// snapshot could have been renamed, so event is reported with the new name
+		events.publish(Event{Type: eventSnapshot, Action: eventUpdated, Name: snapshot.Name, TaskID: detail.TaskID()})
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: snapshot}, nil
 	})
 }
@@ -377,6 +402,8 @@ func apiSnapshotsShow(c *gin.Context) {
 // @Param name path string true "Snapshot name"
 // @Param force query string false "Force operation"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Produce json
 // @Success 200 ""
 // @Failure 404 {object} Error "Snapshot Not Found"
@@ -399,7 +426,7 @@ func apiSnapshotsDrop(c *gin.Context) {
 
 	resources := []string{string(snapshot.ResourceKey())}
 	taskName := fmt.Sprintf("Delete snapshot %s", name)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(Event{Type: eventSnapshot, Action: eventDropped, Name: name}, func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		published := publishedCollection.BySnapshot(snapshot)
 
 		if len(published) > 0 {
@@ -418,7 +445,7 @@ func apiSnapshotsDrop(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
 		}
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: gin.H{}}, nil
-	})
+	}))
 }
 
 // @Summary Snapshot diff
@@ -487,6 +514,9 @@ func apiSnapshotsDiff(c *gin.Context) {
 // @Summary List Snapshot Packages
 // @Description **List all packages in snapshot or perform search on snapshot contents and return results**
 // @Description If `q` query parameter is missing, return all packages, otherwise return packages that match q
+// @Description
+// @Description With `limit`, packages are returned in pages, `X-Next-Cursor` header holds `cursor` of the next page.
+// @Description Total number of packages is returned in `X-Total-Count` header.
 // @Tags Snapshots
 // @Produce json
 // @Param name path string true "Snapshot to search"
@@ -494,6 +524,9 @@ func apiSnapshotsDiff(c *gin.Context) {
 // @Param withDeps query string false "Set to 1 to include dependencies when evaluating package query"
 // @Param format query string false "Set to 'details' to return extra info about each package"
 // @Param maximumVersion query string false "Set to 1 to only return the highest version for each package name"
+// @Param sort query string false "Sort key: `key` or `name`, prefixed with `-` for descending order"
+// @Param limit query int false "Maximum number of packages returned"
+// @Param cursor query string false "Cursor of the page, as returned in `X-Next-Cursor` header"
 // @Success 200 {array} string "Package info"
 // @Failure 404 {object} Error "Snapshot Not Found"
 // @Failure 500 {object} Error "Internal Server Error"
@@ -536,6 +569,8 @@ type snapshotsMergeParams struct {
 // @Param no-remove query int false "all versions of packages are preserved during merge"
 // @Param request body snapshotsMergeParams true "Parameters"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Success 201 {object} deb.Snapshot "Resulting snapshot object"
 // @Failure 400 {object} Error "Bad Request"
 // @Failure 404 {object} Error "Not Found"
@@ -583,18 +618,23 @@ func apiSnapshotsMerge(c *gin.Context) {
 		resources[i] = string(sources[i].ResourceKey())
 	}
 
-	maybeRunTaskInBackground(c, "Merge snapshot "+name, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, "Merge snapshot "+name, resources, withEvent(Event{Type: eventSnapshot, Action: eventCreated, Name: name}, func(_ gocontext.Context, progress aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+		out := task.NewProgressOutput(progress, detail, nil)
+		out.SetPhase(snapshotPhaseMerge, int64(len(sources)), 0)
+
 		err = snapshotCollection.LoadComplete(sources[0])
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
 		}
 		result := sources[0].RefList()
+		out.AddFiles(1)
 		for i := 1; i < len(sources); i++ {
 			err = snapshotCollection.LoadComplete(sources[i])
 			if err != nil {
 				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
 			}
 			result = result.Merge(sources[i].RefList(), overrideMatching, false)
+			out.AddFiles(1)
 		}
 
 		if latest {
@@ -615,7 +655,7 @@ func apiSnapshotsMerge(c *gin.Context) {
 		}
 
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: snapshot}, nil
-	})
+	}))
 }
 
 type snapshotsPullParams struct {
@@ -648,6 +688,8 @@ type snapshotsPullParams struct {
 // @Param no-deps query int false "don’t process dependencies, just pull listed packages: 1 to enable"
 // @Param no-remove query int false "don’t remove other package versions when pulling package: 1 to enable"
 // @Param _async query bool false "Run in background and return task object"
+// @Param _priority query int false "Priority of the task, queued tasks with higher priority are started first"
+// @Param _timeout query string false "Timeout of the task (e.g. `30m`), task fails once it runs longer"
 // @Consume json
 // @Produce json
 // @Success 200 {object} deb.Snapshot "Resulting Snapshot object"
@@ -692,7 +734,9 @@ func apiSnapshotsPull(c *gin.Context) {
 
 	resources := []string{string(sourceSnapshot.ResourceKey()), string(toSnapshot.ResourceKey())}
 	taskName := fmt.Sprintf("Pull snapshot %s into %s and save as %s", body.Source, name, body.Destination)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, withEvent(Event{Type: eventSnapshot, Action: eventCreated, Name: body.Destination}, func(_ gocontext.Context, progress aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+		out := task.NewProgressOutput(progress, detail, snapshotPullPhases)
+
 		err = collectionFactory.SnapshotCollection().LoadComplete(toSnapshot)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
@@ -703,11 +747,11 @@ func apiSnapshotsPull(c *gin.Context) {
 		}
 
 		// convert snapshots to package list
-		toPackageList, err := deb.NewPackageListFromRefList(toSnapshot.RefList(), collectionFactory.PackageCollection(), context.Progress())
+		toPackageList, err := deb.NewPackageListFromRefList(toSnapshot.RefList(), collectionFactory.PackageCollection(), out)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
 		}
-		sourcePackageList, err := deb.NewPackageListFromRefList(sourceSnapshot.RefList(), collectionFactory.PackageCollection(), context.Progress())
+		sourcePackageList, err := deb.NewPackageListFromRefList(sourceSnapshot.RefList(), collectionFactory.PackageCollection(), out)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
 		}
@@ -754,12 +798,13 @@ func apiSnapshotsPull(c *gin.Context) {
 			Source:            toPackageList,
 			DependencyOptions: context.DependencyOptions(),
 			Architectures:     architecturesList,
-			Progress:          context.Progress(),
+			Progress:          out,
 		})
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
 		}
 		destinationPackageList.PrepareIndex()
+		out.SetPhase(snapshotPhasePull, int64(destinationPackageList.Len()), 0)
 
 		removedPackages := []string{}
 		addedPackages := []string{}
@@ -786,6 +831,7 @@ func apiSnapshotsPull(c *gin.Context) {
 			}
 
 			alreadySeen[key] = true
+			out.AddFiles(1)
 
 			return nil
 		})
@@ -813,5 +859,5 @@ func apiSnapshotsPull(c *gin.Context) {
 		}
 
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: destinationSnapshot}, nil
-	})
+	}))
 }
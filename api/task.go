@@ -1,21 +1,161 @@
 package api
 
 import (
+	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aptly-dev/aptly/task"
+	"github.com/aptly-dev/aptly/utils"
 	"github.com/gin-gonic/gin"
 )
 
+// Kinds of tasks with configurable concurrency
+const (
+	taskKindMirrorUpdate = "mirror-update"
+	taskKindPublish      = "publish"
+	taskKindDBCleanup    = "db-cleanup"
+)
+
+// apiTaskKinds maps API routes to the kind of task they run
+var apiTaskKinds = map[string]string{
+	"PUT /api/mirrors/:name":                           taskKindMirrorUpdate,
+	"POST /api/publish":                                taskKindPublish,
+	"POST /api/publish/:prefix":                        taskKindPublish,
+	"PUT /api/publish/:prefix/:distribution":           taskKindPublish,
+	"POST /api/publish/:prefix/:distribution/update":   taskKindPublish,
+	"POST /api/publish/:prefix/:distribution/rollback": taskKindPublish,
+	"POST /api/db/cleanup":                             taskKindDBCleanup,
+}
+
+// taskConcurrencyLimits converts configuration to limits of task list
+func taskConcurrencyLimits(config utils.TaskConcurrencyConfig) map[string]int {
+	return map[string]int{
+		taskKindMirrorUpdate: config.MirrorUpdate,
+		taskKindPublish:      config.Publish,
+		taskKindDBCleanup:    config.DBCleanup,
+	}
+}
+
+// taskOptions returns scheduling options of the task run by API request,
+// priority and timeout are set by `_priority` and `_timeout` query parameters
+func taskOptions(c *gin.Context) (task.Options, error) {
+	options := task.Options{Kind: apiTaskKinds[c.Request.Method+" "+c.FullPath()]}
+
+	if value := c.Query("_priority"); value != "" {
+		priority, err := strconv.Atoi(value)
+		if err != nil {
+			return options, fmt.Errorf("invalid task priority: %q", value)
+		}
+		options.Priority = priority
+	}
+
+	if value := c.Query("_timeout"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return options, fmt.Errorf("invalid task timeout: %q", value)
+		}
+		options.Timeout = timeout
+	}
+
+	return options, nil
+}
+
+// task lists could be sorted by these keys, tasks with equal keys are ordered by ID
+var taskSortKeys = []string{"id", "name", "state", "priority"}
+
+// taskLess returns comparison of tasks for sort key
+func taskLess(params listParams) func(a, b *task.Task) bool {
+	less := func(a, b *task.Task) bool {
+		switch params.Sort {
+		case "name":
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+		case "state":
+			if a.State != b.State {
+				return a.State < b.State
+			}
+		case "priority":
+			if a.Priority != b.Priority {
+				return a.Priority < b.Priority
+			}
+		}
+		return a.ID < b.ID
+	}
+
+	if params.Desc {
+		return func(a, b *task.Task) bool {
+			return less(b, a)
+		}
+	}
+	return less
+}
+
 // @Summary List Tasks
 // @Description **Get list of available tasks. Each task is returned as in “show” API**
+// @Description
+// @Description With `limit`, tasks are returned in pages, `X-Next-Cursor` header holds `cursor` of the next page.
+// @Description Total number of tasks is returned in `X-Total-Count` header.
 // @Tags Tasks
 // @Produce json
+// @Param q query string false "Return only tasks with name containing q"
+// @Param sort query string false "Sort key: `id`, `name`, `state` or `priority`, prefixed with `-` for descending order"
+// @Param limit query int false "Maximum number of tasks returned"
+// @Param cursor query string false "Cursor of the page, as returned in `X-Next-Cursor` header"
 // @Success 200 {array} task.Task
+// @Failure 400 {object} Error "Bad Request"
 // @Router /api/tasks [get]
 func apiTasksList(c *gin.Context) {
+	params, err := parseListParams(c, taskSortKeys)
+	if err != nil {
+		AbortWithJSONError(c, 400, err)
+		return
+	}
+
 	list := context.TaskList()
-	c.JSON(200, list.GetTasks())
+	all := list.GetTasks()
+
+	var cursor *task.Task
+	if params.Cursor != "" {
+		id, _ := strconv.Atoi(params.Cursor)
+		for i := range all {
+			if all[i].ID == id {
+				cursor = &all[i]
+				break
+			}
+		}
+		if cursor == nil {
+			AbortWithJSONError(c, 400, fmt.Errorf("invalid cursor: task %s not found", params.Cursor))
+			return
+		}
+	}
+
+	tasks := []task.Task{}
+	for _, t := range all {
+		if params.Query == "" || strings.Contains(strings.ToLower(t.Name), strings.ToLower(params.Query)) {
+			tasks = append(tasks, t)
+		}
+	}
+
+	less := taskLess(params)
+	sort.Slice(tasks, func(i, j int) bool { return less(&tasks[i], &tasks[j]) })
+
+	start := 0
+	if cursor != nil {
+		start = sort.Search(len(tasks), func(i int) bool { return less(cursor, &tasks[i]) })
+	}
+
+	end := params.page(start, len(tasks))
+	next := ""
+	if end < len(tasks) {
+		next = strconv.Itoa(tasks[end-1].ID)
+	}
+
+	setListHeaders(c, len(tasks), next)
+	c.JSON(200, tasks[start:end])
 }
 
 // @Summary Clear Tasks
@@ -176,7 +316,7 @@ func apiTasksReturnValueShow(c *gin.Context) {
 }
 
 // @Summary Delete Task
-// @Description **Delete completed task by given ID. Does not stop task execution**
+// @Description **Delete completed task by given ID. Does not stop task execution, use cancel to stop the task**
 // @Tags Tasks
 // @Produce json
 // @Param id path int true "Task ID"
@@ -201,3 +341,93 @@ func apiTasksDelete(c *gin.Context) {
 
 	c.JSON(200, delTask)
 }
+
+// @Summary Cancel Task
+// @Description **Cancel queued or running task by given ID**
+// @Description
+// @Description Queued task is cancelled immediately, running task is asked to stop and gets `CANCELLED` state
+// @Description once it has stopped (poll the task or use `/api/tasks/{id}/wait`). Resources of the task are released then.
+// @Tags Tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 202 {object} task.Task
+// @Failure 500 {object} Error "invalid syntax, bad ID?"
+// @Failure 404 {object} Error "Task Not Found"
+// @Failure 409 {object} Error "Task already finished"
+// @Router /api/tasks/{id}/cancel [post]
+func apiTasksCancel(c *gin.Context) {
+	list := context.TaskList()
+	id, err := strconv.ParseInt(c.Params.ByName("id"), 10, 0)
+	if err != nil {
+		AbortWithJSONError(c, 500, err)
+		return
+	}
+
+	if _, err = list.GetTaskByID(int(id)); err != nil {
+		AbortWithJSONError(c, 404, err)
+		return
+	}
+
+	var cancelTask task.Task
+	cancelTask, err = list.CancelTaskByID(int(id))
+	if err != nil {
+		AbortWithJSONError(c, 409, err)
+		return
+	}
+
+	c.JSON(202, cancelTask)
+}
+
+// taskStore persists tasks in aptly database, acquiring connection for each operation
+type taskStore struct{}
+
+func (taskStore) withStore(f func(store *task.DatabaseStore) error) error {
+	if err := acquireDatabaseConnection(); err != nil {
+		return err
+	}
+	defer func() { _ = releaseDatabaseConnection() }()
+
+	db, err := context.Database()
+	if err != nil {
+		return err
+	}
+
+	return f(task.NewDatabaseStore(db))
+}
+
+func (s taskStore) SaveTask(record *task.Record) error {
+	return s.withStore(func(store *task.DatabaseStore) error {
+		return store.SaveTask(record)
+	})
+}
+
+func (s taskStore) DeleteTask(ID int) error {
+	return s.withStore(func(store *task.DatabaseStore) error {
+		return store.DeleteTask(ID)
+	})
+}
+
+func (s taskStore) LoadTasks() (records []*task.Record, err error) {
+	err = s.withStore(func(store *task.DatabaseStore) error {
+		records, err = store.LoadTasks()
+		return err
+	})
+	return
+}
+
+// RestoreTasks loads tasks persisted by previous runs and enables task persistence
+//
+// Tasks which were queued or running are marked as interrupted, finished tasks are
+// removed after taskRetention. Router should be initialized before.
+func RestoreTasks() error {
+	var retention time.Duration
+	if value := context.Config().TaskRetention; value != "" {
+		var err error
+		retention, err = time.ParseDuration(value)
+		if err != nil || retention <= 0 {
+			return fmt.Errorf("invalid task retention: %q", value)
+		}
+	}
+
+	return context.TaskList().Restore(taskStore{}, retention)
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"bytes"
+	gocontext "context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+
+	. "gopkg.in/check.v1"
+)
+
+type TaskSuite struct {
+	APISuite
+}
+
+var _ = Suite(&TaskSuite{})
+
+func (s *TaskSuite) TearDownTest(c *C) {
+	s.context.TaskList().Wait()
+	s.context.TaskList().Clear()
+	s.context.Config().TaskRetention = ""
+	s.context.Config().TaskConcurrency = utils.TaskConcurrencyConfig{}
+	s.router = Router(s.context)
+}
+
+func (s *TaskSuite) TestRestoreTasks(c *C) {
+	db, err := s.context.Database()
+	c.Assert(err, IsNil)
+	store := task.NewDatabaseStore(db)
+
+	c.Assert(store.SaveTask(&task.Record{ID: 1000, Name: "Update mirror", State: task.RUNNING, Output: "Downloading",
+		CreatedAt: time.Now(), StartedAt: time.Now()}), IsNil)
+
+	s.context.Config().TaskRetention = "forever"
+	c.Check(RestoreTasks(), ErrorMatches, "invalid task retention: \"forever\"")
+
+	s.context.Config().TaskRetention = "168h"
+	c.Assert(RestoreTasks(), IsNil)
+
+	response, _ := s.HTTPRequest("GET", "/api/tasks/1000", nil)
+	c.Assert(response.Code, Equals, 200)
+	var restored task.Task
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &restored), IsNil)
+	c.Check(restored.Name, Equals, "Update mirror")
+	c.Check(restored.State, Equals, task.INTERRUPTED)
+	c.Check(restored.FinishedAt.IsZero(), Equals, false)
+
+	response, _ = s.HTTPRequest("GET", "/api/tasks/1000/output", nil)
+	c.Check(response.Body.String(), Equals, `"Downloading\nTask interrupted by restart of API server"`)
+
+	// new tasks are persisted
+	response, _ = s.HTTPRequest("POST", "/api/db/cleanup?_async=true", nil)
+	c.Assert(response.Code, Equals, 202)
+	var created task.Task
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &created), IsNil)
+	c.Check(created.ID > 1000, Equals, true)
+	_, _ = s.context.TaskList().WaitForTaskByID(created.ID)
+
+	records, err := store.LoadTasks()
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Check(records[0].State, Equals, task.INTERRUPTED)
+	c.Check(records[1].ID, Equals, created.ID)
+	c.Check(records[1].State, Equals, task.SUCCEEDED)
+	c.Check(records[1].Output, Matches, "(?s)Loading mirrors.*")
+	c.Check(records[1].FinishedAt.IsZero(), Equals, false)
+}
+
+func (s *TaskSuite) TestCancel(c *C) {
+	started := make(chan struct{})
+	running, _ := runTaskInBackground("Update mirror", []string{"Rdebian"}, func(ctx gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	<-started
+
+	response, _ := s.HTTPRequest("POST", "/api/tasks/9999/cancel", nil)
+	c.Check(response.Code, Equals, 404)
+
+	response, _ = s.HTTPRequest("POST", "/api/tasks/"+strconv.Itoa(running.ID)+"/cancel", nil)
+	c.Assert(response.Code, Equals, 202)
+
+	response, _ = s.HTTPRequest("GET", "/api/tasks/"+strconv.Itoa(running.ID)+"/wait", nil)
+	c.Assert(response.Code, Equals, 200)
+	var cancelled task.Task
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &cancelled), IsNil)
+	c.Check(cancelled.State, Equals, task.CANCELLED)
+
+	response, _ = s.HTTPRequest("POST", "/api/tasks/"+strconv.Itoa(running.ID)+"/cancel", nil)
+	c.Check(response.Code, Equals, 409)
+
+	// resources are released
+	next, conflictErr := runTaskInBackground("Update mirror", []string{"Rdebian"}, func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		return nil, nil
+	})
+	c.Assert(conflictErr, IsNil)
+	done, _ := s.context.TaskList().WaitForTaskByID(next.ID)
+	c.Check(done.State, Equals, task.SUCCEEDED)
+}
+
+func (s *TaskSuite) TestSchedulingOptions(c *C) {
+	response, _ := s.HTTPRequest("POST", "/api/db/cleanup?_async=true&_priority=high", nil)
+	c.Check(response.Code, Equals, 400)
+	c.Check(response.Body.String(), Matches, ".*invalid task priority: .*high.*")
+	response, _ = s.HTTPRequest("POST", "/api/db/cleanup?_async=true&_timeout=-1s", nil)
+	c.Check(response.Code, Equals, 400)
+
+	release := make(chan struct{})
+	blocker, _ := runTaskInBackground("Blocker", []string{task.AllResourcesKey}, func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		<-release
+		return nil, nil
+	})
+
+	response, _ = s.HTTPRequest("POST", "/api/db/cleanup?_async=true&_priority=5&_timeout=1h", nil)
+	c.Assert(response.Code, Equals, 202)
+	var cleanup task.Task
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &cleanup), IsNil)
+	c.Check(cleanup.State, Equals, task.IDLE)
+	c.Check(cleanup.Kind, Equals, taskKindDBCleanup)
+	c.Check(cleanup.Priority, Equals, 5)
+	c.Check(cleanup.Timeout, Equals, "1h0m0s")
+	c.Check(cleanup.QueuePosition, Equals, 1)
+	c.Check(cleanup.BlockedBy, DeepEquals, []int{blocker.ID})
+
+	response, _ = s.HTTPRequest("GET", "/api/tasks", nil)
+	c.Assert(response.Code, Equals, 200)
+	var tasks []task.Task
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &tasks), IsNil)
+	c.Assert(tasks, HasLen, 2)
+	c.Check(tasks[1].BlockedBy, DeepEquals, []int{blocker.ID})
+
+	close(release)
+	done, _ := s.context.TaskList().WaitForTaskByID(cleanup.ID)
+	c.Check(done.State, Equals, task.SUCCEEDED)
+}
+
+func (s *TaskSuite) TestConcurrencyLimits(c *C) {
+	s.context.Config().TaskConcurrency.MirrorUpdate = 1
+	s.router = Router(s.context)
+
+	release := make(chan struct{})
+	update := func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		<-release
+		return nil, nil
+	}
+	options := task.Options{Kind: taskKindMirrorUpdate}
+
+	first, _ := runTaskInBackgroundWithOptions("Update mirror debian", []string{"Rdebian"}, update, options)
+	second, _ := runTaskInBackgroundWithOptions("Update mirror ubuntu", []string{"Rubuntu"}, update, options)
+	c.Check(first.State, Equals, task.RUNNING)
+	c.Check(second.State, Equals, task.IDLE)
+	c.Check(second.BlockedBy, DeepEquals, []int{first.ID})
+
+	close(release)
+	done, _ := s.context.TaskList().WaitForTaskByID(second.ID)
+	c.Check(done.State, Equals, task.SUCCEEDED)
+}
+
+func (s *TaskSuite) TestProgressDetail(c *C) {
+	response, _ := s.HTTPRequest("POST", "/api/db/cleanup?_async=true", nil)
+	c.Assert(response.Code, Equals, 202)
+	var cleanup task.Task
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &cleanup), IsNil)
+	_, _ = s.context.TaskList().WaitForTaskByID(cleanup.ID)
+
+	response, _ = s.HTTPRequest("GET", "/api/tasks/"+strconv.Itoa(cleanup.ID)+"/detail", nil)
+	c.Assert(response.Code, Equals, 200)
+	var cleanupDetail dbCleanupDetail
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &cleanupDetail), IsNil)
+	c.Check(cleanupDetail.Phase, Equals, dbCleanupPhaseCompact)
+	c.Check(response.Body.String(), Matches, `.*"RemainingNumberOfPackagesToDelete":0.*`)
+
+	snapshots := []string{"progress-merged", "progress-a", "progress-b"}
+	deleteSnapshots := func() {
+		for _, name := range snapshots {
+			_, _ = s.HTTPRequest("DELETE", "/api/snapshots/"+name+"?force=1", nil)
+		}
+	}
+	deleteSnapshots()
+	defer deleteSnapshots()
+
+	for _, name := range snapshots[1:] {
+		body, _ := json.Marshal(gin.H{"Name": name})
+		response, _ = s.HTTPRequest("POST", "/api/snapshots", bytes.NewReader(body))
+		c.Assert(response.Code, Equals, 201)
+	}
+
+	body, _ := json.Marshal(gin.H{"Sources": []string{"progress-a", "progress-b"}})
+	response, _ = s.HTTPRequest("POST", "/api/snapshots/progress-merged/merge?_async=true", bytes.NewReader(body))
+	c.Assert(response.Code, Equals, 202)
+	var merge task.Task
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &merge), IsNil)
+	done, _ := s.context.TaskList().WaitForTaskByID(merge.ID)
+	c.Check(done.State, Equals, task.SUCCEEDED)
+
+	response, _ = s.HTTPRequest("GET", "/api/tasks/"+strconv.Itoa(merge.ID)+"/detail", nil)
+	c.Assert(response.Code, Equals, 200)
+	var mergeDetail task.ProgressDetail
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &mergeDetail), IsNil)
+	c.Check(mergeDetail, DeepEquals, task.ProgressDetail{Phase: snapshotPhaseMerge, TotalFiles: 2, DoneFiles: 2})
+}
+
+func (s *TaskSuite) TestMirrorUpdateDetail(c *C) {
+	extend := newMirrorUpdateDetail()
+
+	detail := extend(task.ProgressDetail{Phase: mirrorUpdatePhaseDownload, TotalFiles: 4, DoneFiles: 1,
+		TotalBytes: 4000, DoneBytes: 4500}).(mirrorUpdateDetail)
+	c.Check(detail.TotalNumberOfPackages, Equals, 4)
+	c.Check(detail.RemainingNumberOfPackages, Equals, 3)
+	c.Check(detail.TotalDownloadSize, Equals, int64(4000))
+	c.Check(detail.RemainingDownloadSize, Equals, int64(0))
+
+	// download counters are kept once download finished
+	detail = extend(task.ProgressDetail{Phase: mirrorUpdatePhaseImport, TotalFiles: 10}).(mirrorUpdateDetail)
+	c.Check(detail.Phase, Equals, mirrorUpdatePhaseImport)
+	c.Check(detail.TotalNumberOfPackages, Equals, 4)
+	c.Check(detail.TotalDownloadSize, Equals, int64(4000))
+}
+
+func (s *TaskSuite) TestListPagination(c *C) {
+	ids := []int{}
+	for _, name := range []string{"Update mirror b", "Update mirror a", "Clean up db"} {
+		t, _ := runTaskInBackground(name, nil, func(_ gocontext.Context, _ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+			return nil, nil
+		})
+		ids = append(ids, t.ID)
+	}
+	s.context.TaskList().Wait()
+
+	list := func(query string) ([]task.Task, string) {
+		response, _ := s.HTTPRequest("GET", "/api/tasks?"+query, nil)
+		c.Assert(response.Code, Equals, 200)
+		var tasks []task.Task
+		c.Assert(json.Unmarshal(response.Body.Bytes(), &tasks), IsNil)
+		c.Check(response.Header().Get("X-Total-Count"), Not(Equals), "")
+		return tasks, response.Header().Get("X-Next-Cursor")
+	}
+
+	tasks, next := list("limit=2&sort=-id")
+	c.Assert(tasks, HasLen, 2)
+	c.Check(tasks[0].ID, Equals, ids[2])
+	c.Check(tasks[1].ID, Equals, ids[1])
+	tasks, next = list("limit=2&sort=-id&cursor=" + next)
+	c.Assert(tasks, HasLen, 1)
+	c.Check(tasks[0].ID, Equals, ids[0])
+	c.Check(next, Equals, "")
+
+	tasks, _ = list("sort=name&q=mirror")
+	c.Assert(tasks, HasLen, 2)
+	c.Check(tasks[0].Name, Equals, "Update mirror a")
+	c.Check(tasks[1].Name, Equals, "Update mirror b")
+
+	response, _ := s.HTTPRequest("GET", "/api/tasks?cursor="+base64.RawURLEncoding.EncodeToString([]byte("9999")), nil)
+	c.Check(response.Code, Equals, 400)
+	response, _ = s.HTTPRequest("GET", "/api/tasks?sort=size", nil)
+	c.Check(response.Code, Equals, 400)
+}
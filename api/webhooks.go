@@ -0,0 +1,456 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// webhookAttempts is number of attempts to deliver each payload
+	webhookAttempts = 5
+	// webhookBackoff is delay before the second attempt, it is doubled for every next attempt
+	webhookBackoff = 2 * time.Second
+	// webhookTimeout is timeout of single delivery attempt
+	webhookTimeout = 10 * time.Second
+)
+
+// webhookPayload is JSON posted to webhook URL
+type webhookPayload struct {
+	// Event name, "type.action", e.g. "mirror.updated" or "task.failed"
+	Event string
+	// Delivery ID, same for all attempts
+	Delivery string
+	// Name of the webhook
+	Webhook string
+	// Event details
+	Data Event
+}
+
+// webhookEventName returns name of the event webhooks subscribe to, "type.action"
+func webhookEventName(event Event) string {
+	return event.Type + "." + strings.ToLower(event.Action)
+}
+
+// webhookSignature is HMAC-SHA256 of the payload, as sent in X-Aptly-Signature header
+func webhookSignature(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhook makes single delivery attempt, returns HTTP status (0 if there was no response)
+func postWebhook(webhook *deb.Webhook, delivery *deb.WebhookDelivery, payload []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "aptly/"+aptly.Version)
+	req.Header.Set("X-Aptly-Event", delivery.Event)
+	req.Header.Set("X-Aptly-Delivery", delivery.ID)
+	if webhook.Secret != "" {
+		req.Header.Set("X-Aptly-Signature", webhookSignature(webhook.Secret, payload))
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("%s returned %s: %s", webhook.URL, resp.Status, bytes.TrimSpace(message))
+	}
+
+	return resp.StatusCode, nil
+}
+
+// webhookRetriable checks whether delivery should be retried after response with given status
+func webhookRetriable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// webhookDispatcher delivers events from the event broker to the webhooks stored in the DB
+type webhookDispatcher struct {
+	sync.Mutex
+	stream *eventStream
+	done   chan struct{}
+	// in-flight deliveries
+	wg sync.WaitGroup
+	// serializes updates of delivery logs
+	logLock sync.Mutex
+}
+
+// StartWebhooks starts delivering events to webhooks, returned function stops delivery
+// and waits for in-flight deliveries to finish
+func StartWebhooks() func() {
+	d := &webhookDispatcher{
+		stream: events.subscribe(nil, 0),
+		done:   make(chan struct{}),
+	}
+
+	go d.run()
+
+	return func() {
+		d.Lock()
+		close(d.done)
+		events.unsubscribe(d.stream)
+		d.Unlock()
+
+		d.wg.Wait()
+	}
+}
+
+func (d *webhookDispatcher) run() {
+	var lastID int64
+
+	for {
+		d.Lock()
+		stream := d.stream
+		d.Unlock()
+
+		for event := range stream.events {
+			lastID = event.ID
+			d.dispatch(event)
+		}
+
+		d.Lock()
+		select {
+		case <-d.done:
+			d.Unlock()
+			return
+		default:
+		}
+
+		// stream was closed by the broker, missed events are replayed on resubscribe
+		d.stream = events.subscribe(nil, lastID)
+		d.Unlock()
+	}
+}
+
+// dispatch looks up webhooks subscribed to the event and starts delivery
+func (d *webhookDispatcher) dispatch(event Event) {
+	name := webhookEventName(event)
+
+	if err := acquireDatabaseConnection(); err != nil {
+		log.Error().Msgf("Unable to dispatch event %s to webhooks: %s", name, err)
+		return
+	}
+
+	var webhooks []*deb.Webhook
+	_ = context.NewCollectionFactory().WebhookCollection().ForEach(func(webhook *deb.Webhook) error {
+		if webhook.Matches(name) {
+			webhooks = append(webhooks, webhook)
+		}
+		return nil
+	})
+
+	_ = releaseDatabaseConnection()
+
+	// deliveries are not started once stopped, so that wg.Add doesn't race with wg.Wait
+	d.Lock()
+	defer d.Unlock()
+
+	select {
+	case <-d.done:
+		return
+	default:
+	}
+
+	for _, webhook := range webhooks {
+		d.wg.Add(1)
+		go func(webhook *deb.Webhook) {
+			defer d.wg.Done()
+			d.deliver(webhook, name, event)
+		}(webhook)
+	}
+}
+
+// deliver posts event to the webhook retrying with exponential backoff, result is recorded in the delivery log
+func (d *webhookDispatcher) deliver(webhook *deb.Webhook, name string, event Event) {
+	delivery := deb.WebhookDelivery{
+		ID:      uuid.NewString(),
+		Event:   name,
+		EventID: event.ID,
+		Time:    time.Now(),
+	}
+
+	payload, err := json.Marshal(webhookPayload{Event: name, Delivery: delivery.ID, Webhook: webhook.Name, Data: event})
+	if err != nil {
+		log.Error().Msgf("Unable to encode webhook %s payload: %s", webhook.Name, err)
+		return
+	}
+
+	backoff := webhookBackoff
+attempts:
+	for {
+		delivery.Attempts++
+		delivery.StatusCode, err = postWebhook(webhook, &delivery, payload)
+		if err == nil {
+			delivery.Delivered = true
+			delivery.Error = ""
+			break
+		}
+
+		delivery.Error = err.Error()
+		if delivery.Attempts >= webhookAttempts || !webhookRetriable(delivery.StatusCode) {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-d.done:
+			break attempts
+		}
+	}
+
+	if !delivery.Delivered {
+		log.Warn().Msgf("Webhook %s: delivery of %s failed after %d attempt(s): %s", webhook.Name, name, delivery.Attempts, delivery.Error)
+	}
+
+	d.record(webhook, delivery)
+}
+
+// record saves delivery to the webhook log
+func (d *webhookDispatcher) record(webhook *deb.Webhook, delivery deb.WebhookDelivery) {
+	d.logLock.Lock()
+	defer d.logLock.Unlock()
+
+	if err := acquireDatabaseConnection(); err != nil {
+		log.Error().Msgf("Unable to record webhook %s delivery: %s", webhook.Name, err)
+		return
+	}
+	defer func() { _ = releaseDatabaseConnection() }()
+
+	if err := context.NewCollectionFactory().WebhookCollection().AddDelivery(webhook, delivery); err != nil {
+		log.Warn().Msgf("Unable to record webhook %s delivery: %s", webhook.Name, err)
+	}
+}
+
+// @Summary List Webhooks
+// @Description **Show list of webhooks**
+// @Description Secrets are never returned.
+// @Tags Webhooks
+// @Produce json
+// @Success 200 {array} deb.Webhook
+// @Router /api/webhooks [get]
+func apiWebhooksList(c *gin.Context) {
+	collection := context.NewCollectionFactory().WebhookCollection()
+
+	result := []*deb.Webhook{}
+	_ = collection.ForEach(func(webhook *deb.Webhook) error {
+		result = append(result, webhook)
+		return nil
+	})
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	c.JSON(200, result)
+}
+
+type webhookCreateParams struct {
+	// Name of webhook to create
+	Name string `binding:"required"    json:"Name"      example:"ci"`
+	// URL payloads are posted to
+	URL string `binding:"required"     json:"URL"       example:"https://ci.example.com/aptly"`
+	// Secret to sign payloads with HMAC-SHA256, signature is sent in X-Aptly-Signature header
+	Secret string `                    json:"Secret"    example:"s3cr3t"`
+	// Events to deliver, "type.action" patterns: types are task, repo, snapshot, mirror, publish
+	Events []string `binding:"required" json:"Events"    example:"mirror.updated,snapshot.created,publish.switched,task.failed"`
+	// Set "true" to create disabled webhook
+	Disabled bool `                     json:"Disabled"`
+}
+
+// @Summary Create Webhook
+// @Description **Create webhook subscribed to aptly events**
+// @Description
+// @Description Events are posted as JSON with `X-Aptly-Event` and `X-Aptly-Delivery` headers. If secret is set,
+// @Description payload is signed with HMAC-SHA256, signature is sent as `X-Aptly-Signature: sha256=<hex>`.
+// @Description Failed deliveries are retried with exponential backoff.
+// @Tags Webhooks
+// @Consume json
+// @Param request body webhookCreateParams true "Parameters"
+// @Produce json
+// @Success 201 {object} deb.Webhook
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 409 {object} Error "Webhook already exists"
+// @Router /api/webhooks [post]
+func apiWebhooksCreate(c *gin.Context) {
+	var b webhookCreateParams
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	webhook := deb.NewWebhook(b.Name, b.URL, b.Secret, b.Events)
+	webhook.Disabled = b.Disabled
+
+	if err := webhook.Validate(); err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	collection := context.NewCollectionFactory().WebhookCollection()
+	if _, err := collection.ByName(b.Name); err == nil {
+		AbortWithJSONError(c, http.StatusConflict, fmt.Errorf("webhook with name %s already exists", b.Name))
+		return
+	}
+
+	if err := collection.Add(webhook); err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+type webhookEditParams struct {
+	// Change URL payloads are posted to
+	URL *string `      json:"URL"       example:"https://ci.example.com/aptly"`
+	// Change secret, empty string disables signing
+	Secret *string `   json:"Secret"    example:"s3cr3t"`
+	// Change events webhook is subscribed to
+	Events *[]string ` json:"Events"    example:"publish.*"`
+	// Disable or enable webhook
+	Disabled *bool `   json:"Disabled"`
+}
+
+// @Summary Update Webhook
+// @Description **Update webhook URL, secret, events or enable/disable it**
+// @Tags Webhooks
+// @Consume json
+// @Param name path string true "Webhook name"
+// @Param request body webhookEditParams true "Parameters"
+// @Produce json
+// @Success 200 {object} deb.Webhook
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 404 {object} Error "Webhook not found"
+// @Router /api/webhooks/{name} [put]
+func apiWebhooksEdit(c *gin.Context) {
+	var b webhookEditParams
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	collection := context.NewCollectionFactory().WebhookCollection()
+	webhook, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	if b.URL != nil {
+		webhook.URL = *b.URL
+	}
+	if b.Secret != nil {
+		webhook.Secret = *b.Secret
+	}
+	if b.Events != nil {
+		webhook.Events = *b.Events
+	}
+	if b.Disabled != nil {
+		webhook.Disabled = *b.Disabled
+	}
+
+	if err = webhook.Validate(); err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = collection.Update(webhook); err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(200, webhook)
+}
+
+// @Summary Get Webhook
+// @Description **Get webhook by name**
+// @Tags Webhooks
+// @Param name path string true "Webhook name"
+// @Produce json
+// @Success 200 {object} deb.Webhook
+// @Failure 404 {object} Error "Webhook not found"
+// @Router /api/webhooks/{name} [get]
+func apiWebhooksShow(c *gin.Context) {
+	webhook, err := context.NewCollectionFactory().WebhookCollection().ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(200, webhook)
+}
+
+// @Summary Delete Webhook
+// @Description **Delete webhook and its delivery log**
+// @Tags Webhooks
+// @Param name path string true "Webhook name"
+// @Produce json
+// @Success 200 ""
+// @Failure 404 {object} Error "Webhook not found"
+// @Router /api/webhooks/{name} [delete]
+func apiWebhooksDrop(c *gin.Context) {
+	collection := context.NewCollectionFactory().WebhookCollection()
+	webhook, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	if err = collection.Drop(webhook); err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(200, gin.H{})
+}
+
+// @Summary Webhook Deliveries
+// @Description **Get delivery log of the webhook, most recent delivery first**
+// @Description Up to 100 recent deliveries are kept.
+// @Tags Webhooks
+// @Param name path string true "Webhook name"
+// @Produce json
+// @Success 200 {array} deb.WebhookDelivery
+// @Failure 404 {object} Error "Webhook not found"
+// @Router /api/webhooks/{name}/deliveries [get]
+func apiWebhooksDeliveries(c *gin.Context) {
+	collection := context.NewCollectionFactory().WebhookCollection()
+	webhook, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	deliveries, err := collection.Deliveries(webhook)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(200, deliveries)
+}
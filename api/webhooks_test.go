@@ -0,0 +1,257 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/aptly-dev/aptly/deb"
+
+	. "gopkg.in/check.v1"
+)
+
+type WebhooksSuite struct {
+	APISuite
+
+	receiver *httptest.Server
+	requests chan *http.Request
+	bodies   chan []byte
+	statuses []int
+}
+
+var _ = Suite(&WebhooksSuite{})
+
+func (s *WebhooksSuite) SetUpTest(c *C) {
+	s.requests = make(chan *http.Request, 10)
+	s.bodies = make(chan []byte, 10)
+	s.statuses = nil
+
+	s.receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		w.WriteHeader(status)
+
+		s.requests <- r
+		s.bodies <- body
+	}))
+
+	webhookBackoff = 10 * time.Millisecond
+}
+
+func (s *WebhooksSuite) TearDownTest(c *C) {
+	s.receiver.Close()
+	webhookBackoff = 2 * time.Second
+
+	collection := s.context.NewCollectionFactory().WebhookCollection()
+	_ = collection.ForEach(func(webhook *deb.Webhook) error {
+		return collection.Drop(webhook)
+	})
+
+	s.context.TaskList().Wait()
+	s.context.TaskList().Clear()
+}
+
+func (s *WebhooksSuite) createWebhook(c *C, params map[string]interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(params)
+	response, err := s.HTTPRequest("POST", "/api/webhooks", bytes.NewReader(body))
+	c.Assert(err, IsNil)
+	return response
+}
+
+func (s *WebhooksSuite) deliveries(c *C, name string) []deb.WebhookDelivery {
+	response, err := s.HTTPRequest("GET", "/api/webhooks/"+name+"/deliveries", nil)
+	c.Assert(err, IsNil)
+	c.Assert(response.Code, Equals, 200)
+
+	var deliveries []deb.WebhookDelivery
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &deliveries), IsNil)
+	return deliveries
+}
+
+func (s *WebhooksSuite) TestEventName(c *C) {
+	c.Check(webhookEventName(Event{Type: eventMirror, Action: eventUpdated}), Equals, "mirror.updated")
+	c.Check(webhookEventName(Event{Type: eventTask, Action: "FAILED"}), Equals, "task.failed")
+}
+
+func (s *WebhooksSuite) TestCRUD(c *C) {
+	response := s.createWebhook(c, map[string]interface{}{"Name": "ci", "URL": s.receiver.URL, "Secret": "s3cr3t", "Events": []string{"mirror.updated"}})
+	c.Assert(response.Code, Equals, 201)
+	c.Check(response.Body.String(), Not(Matches), ".*s3cr3t.*")
+
+	response = s.createWebhook(c, map[string]interface{}{"Name": "ci", "URL": s.receiver.URL, "Events": []string{"*"}})
+	c.Check(response.Code, Equals, 409)
+
+	response = s.createWebhook(c, map[string]interface{}{"Name": "bad", "URL": "ftp://example.com", "Events": []string{"*"}})
+	c.Check(response.Code, Equals, 400)
+
+	response = s.createWebhook(c, map[string]interface{}{"Name": "release", "URL": s.receiver.URL, "Events": []string{"publish.*"}})
+	c.Assert(response.Code, Equals, 201)
+
+	response, _ = s.HTTPRequest("GET", "/api/webhooks", nil)
+	c.Assert(response.Code, Equals, 200)
+	var webhooks []deb.Webhook
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &webhooks), IsNil)
+	c.Assert(webhooks, HasLen, 2)
+	c.Check(webhooks[0].Name, Equals, "ci")
+	c.Check(webhooks[0].Secret, Equals, "")
+	c.Check(webhooks[1].Name, Equals, "release")
+
+	response, _ = s.HTTPRequest("PUT", "/api/webhooks/ci", bytes.NewBufferString(`{"Disabled": true, "Events": ["mirror.*"]}`))
+	c.Assert(response.Code, Equals, 200)
+
+	response, _ = s.HTTPRequest("GET", "/api/webhooks/ci", nil)
+	c.Assert(response.Code, Equals, 200)
+	var webhook deb.Webhook
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &webhook), IsNil)
+	c.Check(webhook.Disabled, Equals, true)
+	c.Check(webhook.Events, DeepEquals, []string{"mirror.*"})
+
+	stored, err := s.context.NewCollectionFactory().WebhookCollection().ByName("ci")
+	c.Assert(err, IsNil)
+	c.Check(stored.Secret, Equals, "s3cr3t")
+
+	response, _ = s.HTTPRequest("PUT", "/api/webhooks/ci", bytes.NewBufferString(`{"Events": []}`))
+	c.Check(response.Code, Equals, 400)
+	response, _ = s.HTTPRequest("PUT", "/api/webhooks/none", bytes.NewBufferString(`{}`))
+	c.Check(response.Code, Equals, 404)
+
+	c.Check(s.deliveries(c, "ci"), HasLen, 0)
+
+	response, _ = s.HTTPRequest("DELETE", "/api/webhooks/ci", nil)
+	c.Check(response.Code, Equals, 200)
+	response, _ = s.HTTPRequest("DELETE", "/api/webhooks/ci", nil)
+	c.Check(response.Code, Equals, 404)
+	response, _ = s.HTTPRequest("GET", "/api/webhooks/ci/deliveries", nil)
+	c.Check(response.Code, Equals, 404)
+}
+
+func (s *WebhooksSuite) TestDelivery(c *C) {
+	response := s.createWebhook(c, map[string]interface{}{"Name": "ci", "URL": s.receiver.URL, "Secret": "s3cr3t", "Events": []string{"repo.created", "task.failed"}})
+	c.Assert(response.Code, Equals, 201)
+
+	// first attempt fails, delivery is retried
+	s.statuses = []int{http.StatusServiceUnavailable}
+
+	stop := StartWebhooks()
+
+	response, _ = s.HTTPRequest("POST", "/api/repos", bytes.NewBufferString(`{"Name": "webhook-repo"}`))
+	c.Assert(response.Code, Equals, 201)
+
+	var bodies [][]byte
+	var request *http.Request
+	for i := 0; i < 2; i++ {
+		select {
+		case request = <-s.requests:
+			bodies = append(bodies, <-s.bodies)
+		case <-time.After(5 * time.Second):
+			c.Fatal("webhook was not delivered")
+		}
+	}
+
+	// event not matching webhook is not delivered
+	response, _ = s.HTTPRequest("DELETE", "/api/repos/webhook-repo", nil)
+	c.Assert(response.Code, Equals, 200)
+
+	stop()
+
+	c.Check(s.requests, HasLen, 0)
+	c.Check(bodies[0], DeepEquals, bodies[1])
+	c.Check(request.Header.Get("Content-Type"), Equals, "application/json")
+	c.Check(request.Header.Get("X-Aptly-Event"), Equals, "repo.created")
+	c.Check(request.Header.Get("X-Aptly-Signature"), Equals, webhookSignature("s3cr3t", bodies[1]))
+
+	var payload webhookPayload
+	c.Assert(json.Unmarshal(bodies[1], &payload), IsNil)
+	c.Check(payload.Event, Equals, "repo.created")
+	c.Check(payload.Webhook, Equals, "ci")
+	c.Check(payload.Delivery, Equals, request.Header.Get("X-Aptly-Delivery"))
+	c.Check(payload.Data.Name, Equals, "webhook-repo")
+
+	deliveries := s.deliveries(c, "ci")
+	c.Assert(deliveries, HasLen, 1)
+	c.Check(deliveries[0].ID, Equals, payload.Delivery)
+	c.Check(deliveries[0].Event, Equals, "repo.created")
+	c.Check(deliveries[0].Attempts, Equals, 2)
+	c.Check(deliveries[0].StatusCode, Equals, 200)
+	c.Check(deliveries[0].Delivered, Equals, true)
+	c.Check(deliveries[0].Error, Equals, "")
+}
+
+func (s *WebhooksSuite) TestDeliveryFailure(c *C) {
+	response := s.createWebhook(c, map[string]interface{}{"Name": "ci", "URL": s.receiver.URL, "Events": []string{"task.failed"}})
+	c.Assert(response.Code, Equals, 201)
+
+	// client errors are not retried
+	s.statuses = []int{http.StatusBadRequest, http.StatusBadRequest}
+
+	stop := StartWebhooks()
+	events.publish(Event{Type: eventTask, Action: "FAILED", Name: "Update mirror", TaskID: 7})
+
+	select {
+	case request := <-s.requests:
+		c.Check(request.Header.Get("X-Aptly-Signature"), Equals, "")
+	case <-time.After(5 * time.Second):
+		c.Fatal("webhook was not delivered")
+	}
+
+	stop()
+
+	deliveries := s.deliveries(c, "ci")
+	c.Assert(deliveries, HasLen, 1)
+	c.Check(deliveries[0].Event, Equals, "task.failed")
+	c.Check(deliveries[0].Attempts, Equals, 1)
+	c.Check(deliveries[0].StatusCode, Equals, 400)
+	c.Check(deliveries[0].Delivered, Equals, false)
+	c.Check(deliveries[0].Error, Matches, ".* returned 400 Bad Request.*")
+}
+
+func (s *WebhooksSuite) TestDispatchAfterStop(c *C) {
+	response := s.createWebhook(c, map[string]interface{}{"Name": "ci", "URL": s.receiver.URL, "Events": []string{"task.failed"}})
+	c.Assert(response.Code, Equals, 201)
+
+	d := &webhookDispatcher{done: make(chan struct{})}
+	close(d.done)
+
+	// event dispatched while stopping is not delivered
+	d.dispatch(Event{Type: eventTask, Action: "FAILED", Name: "Update mirror", TaskID: 7})
+	d.wg.Wait()
+
+	c.Check(s.requests, HasLen, 0)
+	c.Check(s.deliveries(c, "ci"), HasLen, 0)
+}
+
+func (s *WebhooksSuite) TestDeliveryRetriesExhausted(c *C) {
+	response := s.createWebhook(c, map[string]interface{}{"Name": "ci", "URL": s.receiver.URL, "Events": []string{"snapshot.*"}})
+	c.Assert(response.Code, Equals, 201)
+
+	attempts := webhookAttempts
+	webhookAttempts = 3
+	defer func() { webhookAttempts = attempts }()
+	s.statuses = []int{500, 502, 503, 200}
+
+	stop := StartWebhooks()
+	events.publish(Event{Type: eventSnapshot, Action: eventCreated, Name: "snap"})
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-s.requests:
+		case <-time.After(5 * time.Second):
+			c.Fatal("webhook was not delivered")
+		}
+	}
+
+	stop()
+
+	deliveries := s.deliveries(c, "ci")
+	c.Assert(deliveries, HasLen, 1)
+	c.Check(deliveries[0].Attempts, Equals, 3)
+	c.Check(deliveries[0].StatusCode, Equals, 503)
+	c.Check(deliveries[0].Delivered, Equals, false)
+}
@@ -43,6 +43,8 @@ type PackagePool interface {
 	FilepathList(progress Progress) ([]string, error)
 	// Remove deletes file in package pool returns its size
 	Remove(path string) (size int64, err error)
+	// String returns the pool as string
+	String() string
 }
 
 // LocalPackagePool is implemented by PackagePools residing on the same filesystem
@@ -61,6 +63,16 @@ type LocalPackagePool interface {
 	FullPath(path string) string
 }
 
+// LegacyPackagePool is a package pool which might keep files at legacy (pre 1.1) paths
+type LegacyPackagePool interface {
+	// PlanRelocation verifies file stored at legacy path and returns its path in current pool layout,
+	// duplicate is set if the file is already present at new path; checksums are filled back
+	PlanRelocation(legacyPath, basename string, checksums *utils.ChecksumInfo) (newPath string, duplicate bool, err error)
+	// RelocateLegacy moves file from legacy path to new path (or removes it, if it's a duplicate)
+	// returning number of bytes reclaimed
+	RelocateLegacy(legacyPath, newPath string, checksums *utils.ChecksumInfo, checksumStorage ChecksumStorage) (int64, error)
+}
+
 // PublishedStorage is abstraction of filesystem storing all published repositories
 type PublishedStorage interface {
 	// MkDir creates directory recursively under public path
@@ -93,6 +105,22 @@ type FileSystemPublishedStorage interface {
 	PublicPath() string
 }
 
+// ChecksumPublishedStorage is implemented by published storages which are
+// able to report checksums of already published files
+type ChecksumPublishedStorage interface {
+	// FileMD5 returns MD5 checksum of the file under public path
+	FileMD5(path string) (string, error)
+}
+
+// ParallelPublishedStorage is implemented by published storages which are able
+// to link files from the pool in the background
+type ParallelPublishedStorage interface {
+	// LinkFromPoolAsync schedules linking package file from pool, errors are reported by Flush
+	LinkFromPoolAsync(publishedPrefix, publishedRelPath, fileName string, sourcePool PackagePool, sourcePath string, sourceChecksums utils.ChecksumInfo, force bool)
+	// Flush waits for scheduled operations to complete, returning first error
+	Flush() error
+}
+
 // PublishedStorageProvider is a thing that returns PublishedStorage by name
 type PublishedStorageProvider interface {
 	// GetPublishedStorage returns PublishedStorage by name
@@ -127,6 +155,12 @@ const (
 	BarPublishGeneratePackageFiles
 	// BarPublishFinalizeIndexes identifies bar for finalizing index files
 	BarPublishFinalizeIndexes
+	// BarPoolMigrateFiles identifies bar for migrating files between package pools
+	BarPoolMigrateFiles
+	// BarPoolScrubFiles identifies bar for verifying files in package pool
+	BarPoolScrubFiles
+	// BarPoolRelayoutPackages identifies bar for moving package files to current pool layout
+	BarPoolRelayoutPackages
 )
 
 // Progress is a progress displaying entity, it allows progress bars & simple prints
@@ -2,9 +2,11 @@ package azure
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
@@ -19,13 +21,17 @@ import (
 // PublishedStorage abstract file system with published files (actually hosted on Azure)
 type PublishedStorage struct {
 	// FIXME: unused ???? prefix    string
-	az        *azContext
-	pathCache map[string]map[string]string
+	az *azContext
+
+	// files are linked from pool by several components in parallel
+	pathCache     map[string]map[string]string
+	pathCacheLock sync.Mutex
 }
 
 // Check interface
 var (
-	_ aptly.PublishedStorage = (*PublishedStorage)(nil)
+	_ aptly.PublishedStorage         = (*PublishedStorage)(nil)
+	_ aptly.ChecksumPublishedStorage = (*PublishedStorage)(nil)
 )
 
 // NewPublishedStorage creates published storage from Azure storage credentials
@@ -119,25 +125,10 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 	prefixRelFilePath := filepath.Join(publishedPrefix, relFilePath)
 	poolPath := storage.az.blobPath(prefixRelFilePath)
 
-	if storage.pathCache == nil {
-		storage.pathCache = make(map[string]map[string]string)
-	}
-	pathCache := storage.pathCache[publishedPrefix]
-	if pathCache == nil {
-		paths, md5s, err := storage.az.internalFilelist(publishedPrefix, nil)
-		if err != nil {
-			return fmt.Errorf("error caching paths under prefix: %s", err)
-		}
-
-		pathCache = make(map[string]string, len(paths))
-
-		for i := range paths {
-			pathCache[paths[i]] = md5s[i]
-		}
-		storage.pathCache[publishedPrefix] = pathCache
+	destinationMD5, exists, err := storage.cachedMD5(publishedPrefix, relFilePath)
+	if err != nil {
+		return err
 	}
-
-	destinationMD5, exists := pathCache[relFilePath]
 	sourceMD5 := sourceChecksums.MD5
 
 	if exists {
@@ -162,7 +153,7 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 
 	err = storage.az.putFile(relFilePath, source, sourceMD5)
 	if err == nil {
-		pathCache[relFilePath] = sourceMD5
+		storage.setCachedMD5(publishedPrefix, relFilePath, sourceMD5)
 	} else {
 		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s: %s", sourcePath, storage, poolPath))
 	}
@@ -170,6 +161,44 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 	return err
 }
 
+// cachedMD5 looks up MD5 of the published file in the path cache, filling it
+// on the first call for publishedPrefix by listing files under it
+func (storage *PublishedStorage) cachedMD5(publishedPrefix, relFilePath string) (string, bool, error) {
+	storage.pathCacheLock.Lock()
+	defer storage.pathCacheLock.Unlock()
+
+	if storage.pathCache == nil {
+		storage.pathCache = make(map[string]map[string]string)
+	}
+	pathCache := storage.pathCache[publishedPrefix]
+	if pathCache == nil {
+		paths, md5s, err := storage.az.internalFilelist(publishedPrefix, nil)
+		if err != nil {
+			return "", false, fmt.Errorf("error caching paths under prefix: %s", err)
+		}
+
+		pathCache = make(map[string]string, len(paths))
+
+		for i := range paths {
+			pathCache[paths[i]] = md5s[i]
+		}
+		storage.pathCache[publishedPrefix] = pathCache
+	}
+
+	md5, exists := pathCache[relFilePath]
+	return md5, exists, nil
+}
+
+// setCachedMD5 updates MD5 of the published file in the path cache
+func (storage *PublishedStorage) setCachedMD5(publishedPrefix, relFilePath, md5 string) {
+	storage.pathCacheLock.Lock()
+	defer storage.pathCacheLock.Unlock()
+
+	if pathCache := storage.pathCache[publishedPrefix]; pathCache != nil {
+		pathCache[relFilePath] = md5
+	}
+}
+
 // Filelist returns list of files under prefix
 func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
 	paths, _, err := storage.az.internalFilelist(prefix, nil)
@@ -287,3 +316,16 @@ func (storage *PublishedStorage) ReadLink(path string) (string, error) {
 	}
 	return "", fmt.Errorf("error reading link %s: %v", path, err)
 }
+
+// FileMD5 returns MD5 checksum of the published file (as stored in blob properties)
+func (storage *PublishedStorage) FileMD5(path string) (string, error) {
+	serviceClient := storage.az.client.ServiceClient()
+	containerClient := serviceClient.NewContainerClient(storage.az.container)
+	blobClient := containerClient.NewBlobClient(storage.az.blobPath(path))
+	props, err := blobClient.GetProperties(context.Background(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get blob properties: %v", err)
+	}
+
+	return hex.EncodeToString(props.ContentMD5), nil
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	stdcontext "context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -39,6 +40,33 @@ func aptlyAPIServe(cmd *commander.Command, args []string) error {
 		return err
 	}
 
+	router := api.Router(context)
+
+	err = api.RestoreTasks()
+	if err != nil {
+		return err
+	}
+
+	stopScrub, err := api.SchedulePoolScrub()
+	if err != nil {
+		return err
+	}
+	defer stopScrub()
+
+	stopWebhooks := api.StartWebhooks()
+	defer stopWebhooks()
+
+	tlsConfig, stopTLS, err := serveTLSConfig()
+	if err != nil {
+		return err
+	}
+	defer stopTLS()
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+
 	// Try to recycle systemd fds for listening
 	listeners, err := activation.Listeners(true)
 	if len(listeners) > 1 {
@@ -47,8 +75,11 @@ func aptlyAPIServe(cmd *commander.Command, args []string) error {
 	if err == nil && len(listeners) == 1 {
 		listener := listeners[0]
 		defer func() { _ = listener.Close() }()
-		fmt.Printf("\nTaking over web server at: %s (press Ctrl+C to quit)...\n", listener.Addr().String())
-		err = http.Serve(listener, api.Router(context))
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
+		fmt.Printf("\nTaking over web server at: %s (%s, press Ctrl+C to quit)...\n", listener.Addr().String(), scheme)
+		err = http.Serve(listener, router)
 		if err != nil {
 			return fmt.Errorf("unable to serve: %s", err)
 		}
@@ -57,9 +88,10 @@ func aptlyAPIServe(cmd *commander.Command, args []string) error {
 
 	// If there are none: use the listen argument.
 	listen := context.Flags().Lookup("listen").Value.String()
-	fmt.Printf("\nStarting web server at: %s (press Ctrl+C to quit)...\n", listen)
+	fmt.Printf("\nStarting web server at: %s (%s, press Ctrl+C to quit)...\n", listen, scheme)
 
-	server := http.Server{Handler: api.Router(context)}
+	server := http.Server{Handler: router}
+	server.RegisterOnShutdown(api.CloseEventStreams)
 
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
@@ -72,24 +104,31 @@ func aptlyAPIServe(cmd *commander.Command, args []string) error {
 	})()
 	defer close(sigchan)
 
+	var listener net.Listener
+
 	listenURL, err := url.Parse(listen)
 	if err == nil && listenURL.Scheme == "unix" {
 		file := listenURL.Path
 		_ = os.Remove(file)
 
-		var listener net.Listener
 		listener, err = net.Listen("unix", file)
 		if err != nil {
 			return fmt.Errorf("failed to listen on: %s\n%s", file, err)
 		}
-		defer func() { _ = listener.Close() }()
-
-		err = server.Serve(listener)
 	} else {
-		server.Addr = listen
-		err = server.ListenAndServe()
+		listener, err = net.Listen("tcp", listen)
+		if err != nil {
+			return fmt.Errorf("unable to serve: %s", err)
+		}
+	}
+	defer func() { _ = listener.Close() }()
+
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
 	}
 
+	err = server.Serve(listener)
+
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("unable to serve: %s", err)
 	}
@@ -108,16 +147,22 @@ or Unix domain socket. When using a socket, Aptly will fully manage the socket
 file. This command also supports taking over from a systemd file descriptors to
 enable systemd socket activation.
 
+HTTPS is enabled when TLS certificate and key are configured (or passed with
+flags). When client CA is set, client certificates are verified and could be
+used to authenticate API clients. Certificates are reloaded on SIGHUP.
+
 Example:
 
   $ aptly api serve -listen=:8080
   $ aptly api serve -listen=unix:///tmp/aptly.sock
+  $ aptly api serve -listen=:8443 -tls-cert=server.crt -tls-key=server.key -tls-client-ca=ca.crt
 `,
 		Flag: *flag.NewFlagSet("aptly-serve", flag.ExitOnError),
 	}
 
 	cmd.Flag.String("listen", ":8080", "host:port for HTTP listening or unix://path to listen on a Unix domain socket")
 	cmd.Flag.Bool("no-lock", false, "don't lock the database")
+	addTLSFlags(&cmd.Flag)
 
 	return cmd
 
@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"github.com/smira/commander"
+)
+
+func makeCmdPool() *commander.Command {
+	return &commander.Command{
+		UsageLine: "pool",
+		Short:     "manage package pool storage",
+		Subcommands: []*commander.Command{
+			makeCmdPoolMigrate(),
+			makeCmdPoolRelayout(),
+			makeCmdPoolScrub(),
+		},
+	}
+}
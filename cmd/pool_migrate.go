@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/DisposaBoy/JsonConfigReader"
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/smira/commander"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// parsePoolStorage parses package pool configuration in JSON or YAML format
+func parsePoolStorage(value string) (utils.PackagePoolStorage, error) {
+	var storage utils.PackagePoolStorage
+
+	err := json.Unmarshal([]byte(value), &storage)
+	if err != nil {
+		storage = utils.PackagePoolStorage{}
+		if err2 := yaml.Unmarshal([]byte(value), &storage); err2 != nil {
+			return storage, fmt.Errorf("unable to parse pool configuration: invalid yaml (%s) or json (%s)", err2, err)
+		}
+	}
+
+	return storage, nil
+}
+
+// formatPoolStorage formats packagePoolStorage setting in the format (JSON or YAML) of configuration file
+//
+// Configuration file is not rewritten, as that would drop comments and ordering of the hand-written file
+func formatPoolStorage(configPath string, storage utils.PackagePoolStorage) (string, error) {
+	setting := struct {
+		PackagePoolStorage *utils.PackagePoolStorage `json:"packagePoolStorage" yaml:"packagepool_storage"`
+	}{&storage}
+
+	var probe map[string]interface{}
+	original, err := os.ReadFile(configPath)
+	if err == nil && json.NewDecoder(JsonConfigReader.New(bytes.NewReader(original))).Decode(&probe) != nil {
+		encoded, err := yaml.Marshal(&setting)
+		return strings.TrimSpace(string(encoded)), err
+	}
+
+	encoded, err := json.MarshalIndent(&setting, "", "  ")
+	return string(encoded), err
+}
+
+// aptly pool migrate
+func aptlyPoolMigrate(cmd *commander.Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	to, err := GetStringOrFileContent(context.Flags().Lookup("to").Value.String())
+	if err != nil {
+		return err
+	}
+	if to == "" {
+		return fmt.Errorf("destination pool configuration should be specified with -to")
+	}
+
+	storage, err := parsePoolStorage(to)
+	if err != nil {
+		return err
+	}
+
+	source := context.PackagePool()
+	destination, err := context.NewPackagePool(storage)
+	if err != nil {
+		return fmt.Errorf("unable to initialize destination pool: %s", err)
+	}
+
+	if source.String() == destination.String() {
+		return fmt.Errorf("destination pool %s is the same as current pool", destination)
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	statePath := filepath.Join(context.Config().GetRootDir(), "pool-migrate.state")
+
+	context.Progress().ColoredPrintf("@{w!}Migrating package pool %s to %s...@|", source, destination)
+
+	migration := &files.PoolMigration{
+		Source:          source,
+		Destination:     destination,
+		ChecksumStorage: collectionFactory.ChecksumCollection(nil),
+		StatePath:       statePath,
+		Progress:        context.Progress(),
+	}
+
+	result, err := migration.Run()
+	if err != nil {
+		return err
+	}
+
+	context.Progress().Printf("Files migrated: %d (%s), migrated earlier: %d\n", result.Migrated, utils.HumanBytes(result.Bytes), result.Resumed)
+
+	if len(result.Failed) > 0 {
+		paths := make([]string, 0, len(result.Failed))
+		for path := range result.Failed {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			context.Progress().ColoredPrintf("@{r}Failed to migrate %s:@| %s", path, result.Failed[path])
+		}
+
+		return fmt.Errorf("unable to migrate %d files, configuration hasn't been changed, re-run to resume migration", len(result.Failed))
+	}
+
+	snippet, err := formatPoolStorage(context.ConfigPath(), storage)
+	if err != nil {
+		return err
+	}
+
+	_ = os.Remove(statePath)
+
+	context.Progress().ColoredPrintf("@{g!}Package pool migrated, update configuration %s to use new pool:@|", context.ConfigPath())
+	context.Progress().Printf("\n%s\n\n", snippet)
+	context.Progress().Printf("Files in old pool %s are kept, remove them manually when no longer needed.\n", source)
+
+	return nil
+}
+
+func makeCmdPoolMigrate() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPoolMigrate,
+		UsageLine: "migrate -to=<pool config>",
+		Short:     "migrate package pool to another storage",
+		Long: `
+Command migrate copies all the files from current package pool to the pool
+described by -to (same format as packagePoolStorage in the configuration file,
+JSON or YAML, @file to read it from the file). Every file is verified after copying
+and checksums in aptly's database are updated.
+
+When all the files are migrated, packagePoolStorage setting for the new pool
+is printed, configuration file should be updated with it to start using new pool.
+Interrupted or failed migration could be resumed by running the command again.
+
+Example:
+
+  $ aptly pool migrate -to='{"type": "s3", "bucket": "aptly-pool", "region": "us-east-1"}'
+`,
+	}
+
+	cmd.Flag.String("to", "", "destination pool configuration (@file to read from file)")
+
+	return cmd
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/smira/commander"
+)
+
+// aptly pool relayout
+func aptlyPoolRelayout(cmd *commander.Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	dryRun := context.Flags().Lookup("dry-run").Value.Get().(bool)
+	collectionFactory := context.NewCollectionFactory()
+
+	relayout := &deb.PoolRelayout{
+		Pool:              context.PackagePool(),
+		ChecksumStorage:   collectionFactory.ChecksumCollection(nil),
+		CollectionFactory: collectionFactory,
+		DryRun:            dryRun,
+		Progress:          context.Progress(),
+	}
+
+	context.Progress().ColoredPrintf("@{w!}Moving files at legacy paths to current layout of package pool %s...@|", relayout.Pool)
+
+	result, err := relayout.Run()
+	if err != nil {
+		return fmt.Errorf("unable to relayout package pool: %s", err)
+	}
+
+	context.Progress().Printf("Files moved: %d, duplicates removed: %d, packages updated: %d\n",
+		result.Moved, result.Duplicates, result.Packages)
+	context.Progress().ColoredPrintf("@{w!}Disk space reclaimed: %s@|", utils.HumanBytes(result.Reclaimed))
+
+	if len(result.Failed) > 0 {
+		paths := make([]string, 0, len(result.Failed))
+		for path := range result.Failed {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			context.Progress().ColoredPrintf("@{r}Failed to relocate %s:@| %s", path, result.Failed[path])
+		}
+
+		return fmt.Errorf("unable to relocate %d files", len(result.Failed))
+	}
+
+	if dryRun {
+		context.Progress().ColoredPrintf("@{y!}Pool and database weren't changed, as -dry-run has been requested.@|")
+	} else {
+		context.Progress().ColoredPrintf("@{g!}Packages don't reference legacy paths anymore, legacy pool support could be disabled with skipLegacyPool option.@|")
+	}
+
+	return nil
+}
+
+func makeCmdPoolRelayout() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPoolRelayout,
+		UsageLine: "relayout",
+		Short:     "move files at legacy paths to current package pool layout",
+		Long: `
+Command relayout finds package files stored in the package pool at legacy
+(pre 1.1, MD5-based) paths, moves them to current (SHA256-based) layout and
+updates packages to reference new location. If the file is already present
+at new location, legacy copy is removed as a duplicate.
+
+Published repositories using symlinks to the pool should be updated
+after running this command.
+
+Example:
+
+  $ aptly pool relayout -dry-run
+`,
+	}
+
+	cmd.Flag.Bool("dry-run", false, "don't change anything, just show what would be done")
+
+	return cmd
+}
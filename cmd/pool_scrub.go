@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/smira/commander"
+)
+
+// aptly pool scrub
+func aptlyPoolScrub(cmd *commander.Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+
+	scrub := &deb.PoolScrub{
+		Pool:              context.PackagePool(),
+		ChecksumStorage:   collectionFactory.ChecksumCollection(nil),
+		CollectionFactory: collectionFactory,
+		RateLimit:         context.Flags().Lookup("rate-limit").Value.Get().(int64) * 1024,
+		Progress:          context.Progress(),
+	}
+
+	if context.Flags().Lookup("redownload").Value.Get().(bool) {
+		scrub.Downloader = context.Downloader()
+	}
+
+	context.Progress().ColoredPrintf("@{w!}Verifying files in package pool %s...@|", scrub.Pool)
+
+	result, err := scrub.Run(context)
+	if err != nil {
+		return fmt.Errorf("unable to scrub package pool: %s", err)
+	}
+
+	context.Progress().Printf("Files verified: %d (%s), missing: %d, corrupted: %d, re-downloaded: %d\n",
+		result.Checked, utils.HumanBytes(result.Bytes), len(result.Missing), len(result.Corrupted), len(result.Repaired))
+
+	for _, path := range result.Missing {
+		context.Progress().ColoredPrintf("@{r}Missing:@| %s", path)
+	}
+	for _, path := range result.Corrupted {
+		context.Progress().ColoredPrintf("@{r}Corrupted:@| %s", path)
+	}
+	for _, path := range result.Repaired {
+		context.Progress().ColoredPrintf("@{g}Re-downloaded:@| %s", path)
+	}
+
+	paths := make([]string, 0, len(result.Failed))
+	for path := range result.Failed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		context.Progress().ColoredPrintf("@{r}Failed %s:@| %s", path, result.Failed[path])
+	}
+
+	if result.Broken() > 0 || len(result.Failed) > 0 {
+		return fmt.Errorf("package pool has %d broken files, %d files failed", result.Broken(), len(result.Failed))
+	}
+
+	context.Progress().ColoredPrintf("@{g!}Package pool is consistent.@|")
+
+	return nil
+}
+
+func makeCmdPoolScrub() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPoolScrub,
+		UsageLine: "scrub",
+		Short:     "verify checksums of files in package pool",
+		Long: `
+Command scrub reads back every file referenced by packages in aptly's database
+from the package pool and compares its checksums with package metadata and
+checksums stored in the database. Missing or corrupted files are reported,
+with -redownload they are downloaded again from the mirrors containing the package.
+
+Example:
+
+  $ aptly pool scrub -rate-limit=10240
+`,
+	}
+
+	cmd.Flag.Bool("redownload", false, "re-download missing or corrupted files from the mirrors")
+	cmd.Flag.Int64("rate-limit", 0, "limit speed of reading files from the pool (kbytes/sec)")
+
+	return cmd
+}
@@ -1,18 +1,51 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
+	"os/user"
+	"strings"
+
+	"github.com/aptly-dev/aptly/deb"
 	"github.com/aptly-dev/aptly/pgp"
 	"github.com/smira/commander"
 	"github.com/smira/flag"
 )
 
-func getSigner(flags *flag.FlagSet) (pgp.Signer, error) {
+// gpgKeysFlag collects GPG key IDs, flag could be specified multiple times
+type gpgKeysFlag struct {
+	keys []string
+}
+
+func (k *gpgKeysFlag) Set(value string) error {
+	k.keys = append(k.keys, value)
+	return nil
+}
+
+func (k *gpgKeysFlag) Get() interface{} {
+	return k.keys
+}
+
+func (k *gpgKeysFlag) String() string {
+	return strings.Join(k.keys, ",")
+}
+
+// getSigner initializes signer for published repository
+//
+// Keys given with -gpg-key replace keys stored in published repository,
+// and when no keys are specified, stored keys are used
+func getSigner(flags *flag.FlagSet, published *deb.PublishedRepo) (pgp.Signer, error) {
 	if LookupOption(context.Config().GpgDisableSign, flags, "skip-signing") {
 		return nil, nil
 	}
 
+	keys := flags.Lookup("gpg-key").Value.Get().([]string)
+	if len(keys) > 0 {
+		published.SigningKeys = keys
+	}
+
 	signer := context.GetSigner()
-	signer.SetKey(flags.Lookup("gpg-key").Value.String())
+	signer.SetKeys(published.SigningKeys)
 	signer.SetKeyRing(flags.Lookup("keyring").Value.String(), flags.Lookup("secret-keyring").Value.String())
 	signer.SetPassphrase(flags.Lookup("passphrase").Value.String(), flags.Lookup("passphrase-file").Value.String())
 	signer.SetBatch(flags.Lookup("batch").Value.Get().(bool))
@@ -26,6 +59,31 @@ func getSigner(flags *flag.FlagSet) (pgp.Signer, error) {
 
 }
 
+// printPublishPlan displays changes recorded while doing dry-run publishing
+func printPublishPlan(plan *deb.PublishPlan) error {
+	changes, err := plan.Changes()
+	if err != nil {
+		return fmt.Errorf("unable to build publish plan: %s", err)
+	}
+
+	var output []byte
+	if output, err = json.MarshalIndent(changes, "", "  "); err == nil {
+		fmt.Println(string(output))
+	}
+
+	return err
+}
+
+// publishActor returns name of the user running the command, recorded in publish history
+func publishActor() string {
+	current, err := user.Current()
+	if err != nil {
+		return ""
+	}
+
+	return current.Username
+}
+
 func makeCmdPublish() *commander.Command {
 	return &commander.Command{
 		UsageLine: "publish",
@@ -33,7 +91,9 @@ func makeCmdPublish() *commander.Command {
 		Subcommands: []*commander.Command{
 			makeCmdPublishDrop(),
 			makeCmdPublishList(),
+			makeCmdPublishRepair(),
 			makeCmdPublishRepo(),
+			makeCmdPublishRollback(),
 			makeCmdPublishShow(),
 			makeCmdPublishSnapshot(),
 			makeCmdPublishSource(),
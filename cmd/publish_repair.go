@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/composite"
+	ctx "github.com/aptly-dev/aptly/context"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+// repairProvider replaces composite storage with subset of its members being re-synced
+//
+// Context is not embedded, so that repair doesn't run publish hooks
+type repairProvider struct {
+	context *ctx.AptlyContext
+	name    string
+	storage aptly.PublishedStorage
+}
+
+func (provider *repairProvider) GetPublishedStorage(name string) aptly.PublishedStorage {
+	if name == provider.name {
+		return provider.storage
+	}
+
+	return provider.context.GetPublishedStorage(name)
+}
+
+// laggingMembers returns members of composite storage missing files of the published repository
+// or holding stale copies of its indexes
+func laggingMembers(storage *composite.PublishedStorage, published *deb.PublishedRepo) ([]string, error) {
+	root := published.Prefix
+	if root == "." {
+		root = ""
+	}
+
+	// indexes are overwritten in place, so their checksums are compared as well
+	paths := map[string]bool{filepath.Join(root, "dists", published.Distribution): true}
+	for _, component := range published.Components() {
+		paths[filepath.Join(root, "pool", component)] = false
+	}
+
+	seen := map[string]bool{}
+	for path, checksums := range paths {
+		lagging, err := storage.Lagging(path, checksums)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range lagging {
+			seen[member] = true
+		}
+	}
+
+	result := []string{}
+	for _, member := range storage.MemberNames() {
+		if seen[member] {
+			result = append(result, member)
+		}
+	}
+
+	return result, nil
+}
+
+func aptlyPublishRepair(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) < 1 || len(args) > 2 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	distribution := args[0]
+	param := "."
+
+	if len(args) == 2 {
+		param = args[1]
+	}
+	storage, prefix := deb.ParsePrefix(param)
+
+	var published *deb.PublishedRepo
+
+	collectionFactory := context.NewCollectionFactory()
+	published, err = collectionFactory.PublishedRepoCollection().ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		return fmt.Errorf("unable to repair: %s", err)
+	}
+
+	err = collectionFactory.PublishedRepoCollection().LoadComplete(published, collectionFactory)
+	if err != nil {
+		return fmt.Errorf("unable to repair: %s", err)
+	}
+
+	compositeStorage, ok := context.GetPublishedStorage(published.Storage).(*composite.PublishedStorage)
+	if !ok {
+		return fmt.Errorf("unable to repair: %s is not published to composite endpoint", published.String())
+	}
+
+	var members []string
+	if value := context.Flags().Lookup("members").Value.String(); value != "" {
+		members = strings.Split(value, ",")
+	} else {
+		members, err = laggingMembers(compositeStorage, published)
+		if err != nil {
+			return fmt.Errorf("unable to repair: %s", err)
+		}
+
+		if len(members) == 0 {
+			context.Progress().Printf("All members of %s are in sync, nothing to repair.\n", compositeStorage)
+			return nil
+		}
+	}
+
+	selected, err := compositeStorage.Select(members)
+	if err != nil {
+		return fmt.Errorf("unable to repair: %s", err)
+	}
+
+	context.Progress().Printf("Re-syncing members: %s...\n", strings.Join(members, ", "))
+
+	signer, err := getSigner(context.Flags(), published)
+	if err != nil {
+		return fmt.Errorf("unable to initialize GPG signer: %s", err)
+	}
+
+	forceOverwrite := context.Flags().Lookup("force-overwrite").Value.Get().(bool)
+	if forceOverwrite {
+		context.Progress().ColoredPrintf("@rWARNING@|: force overwrite mode enabled, aptly might corrupt other published repositories sharing " +
+			"the same package pool.\n")
+	}
+
+	dryRun := context.Flags().Lookup("dry-run").Value.Get().(bool)
+
+	var provider aptly.PublishedStorageProvider = &repairProvider{context: context, name: published.Storage, storage: selected}
+	if dryRun {
+		provider = deb.NewPublishPlan(provider)
+	}
+
+	err = published.Publish(context, context.PackagePool(), provider, collectionFactory, signer, context.Progress(), forceOverwrite, context.SkelPath())
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
+	skipCleanup := context.Flags().Lookup("skip-cleanup").Value.Get().(bool)
+	if !skipCleanup {
+		err = collectionFactory.PublishedRepoCollection().CleanupPrefixComponentFiles(provider, published, published.Components(), collectionFactory, context.Progress())
+		if err != nil {
+			return fmt.Errorf("unable to repair: %s", err)
+		}
+	}
+
+	if dryRun {
+		return printPublishPlan(provider.(*deb.PublishPlan))
+	}
+
+	context.Progress().Printf("\nPublished %s repository %s has been repaired successfully.\n", published.SourceKind, published.String())
+
+	return err
+}
+
+func makeCmdPublishRepair() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPublishRepair,
+		UsageLine: "repair <distribution> [[<endpoint>:]<prefix>]",
+		Short:     "re-sync lagging members of composite endpoint",
+		Long: `
+Command repair re-publishes repository published to composite endpoint
+to members which are lagging behind, e.g. because some of the uploads
+failed during last publishing.
+
+By default members which miss files of the published repository or hold
+stale copies of its indexes are detected automatically, flag -members allows to re-sync specific members
+(comma-separated). Files which are already up to date are not uploaded
+again, indexes are regenerated and signed.
+
+Example:
+
+    $ aptly publish repair wheezy composite:mirrors:ppa
+`,
+		Flag: *flag.NewFlagSet("aptly-publish-repair", flag.ExitOnError),
+	}
+	cmd.Flag.String("members", "", "comma-separated list of members to re-sync (default: lagging members)")
+	cmd.Flag.Var(&gpgKeysFlag{}, "gpg-key", "GPG key ID to use when signing the release, could be specified multiple times")
+	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "GPG keyring to use (instead of default)")
+	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
+	cmd.Flag.String("passphrase", "", "GPG passphrase for the key (warning: could be insecure)")
+	cmd.Flag.String("passphrase-file", "", "GPG passphrase-file for the key (warning: could be insecure)")
+	cmd.Flag.Bool("batch", false, "run GPG with detached tty")
+	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
+	cmd.Flag.Bool("force-overwrite", false, "overwrite files in package pool in case of mismatch")
+	cmd.Flag.Bool("skip-cleanup", false, "don't remove unreferenced files in prefix/component")
+	cmd.Flag.Bool("dry-run", false, "don't publish, display changes to published storage in JSON format")
+
+	return cmd
+}
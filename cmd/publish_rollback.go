@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+func aptlyPublishRollback(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) < 1 || len(args) > 2 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	steps, err := strconv.Atoi(context.Flags().Lookup("to").Value.String())
+	if err != nil || steps < 1 {
+		return fmt.Errorf("unable to rollback: -to should be a positive number of steps")
+	}
+
+	distribution := args[0]
+	param := "."
+
+	if len(args) == 2 {
+		param = args[1]
+	}
+	storage, prefix := deb.ParsePrefix(param)
+
+	var published *deb.PublishedRepo
+
+	collectionFactory := context.NewCollectionFactory()
+	published, err = collectionFactory.PublishedRepoCollection().ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		return fmt.Errorf("unable to rollback: %s", err)
+	}
+
+	err = collectionFactory.PublishedRepoCollection().LoadComplete(published, collectionFactory)
+	if err != nil {
+		return fmt.Errorf("unable to rollback: %s", err)
+	}
+
+	if published.Revision != nil {
+		return fmt.Errorf("unable to rollback: published repository has pending source changes, drop them first")
+	}
+
+	_, err = published.Rollback(steps, collectionFactory)
+	if err != nil {
+		return fmt.Errorf("unable to rollback: %s", err)
+	}
+
+	result, err := published.Update(collectionFactory, context.Progress())
+	if err != nil {
+		return fmt.Errorf("unable to rollback: %s", err)
+	}
+
+	signer, err := getSigner(context.Flags(), published)
+	if err != nil {
+		return fmt.Errorf("unable to initialize GPG signer: %s", err)
+	}
+
+	forceOverwrite := context.Flags().Lookup("force-overwrite").Value.Get().(bool)
+	if forceOverwrite {
+		context.Progress().ColoredPrintf("@rWARNING@|: force overwrite mode enabled, aptly might corrupt other published repositories sharing " +
+			"the same package pool.\n")
+	}
+
+	dryRun := context.Flags().Lookup("dry-run").Value.Get().(bool)
+
+	var provider aptly.PublishedStorageProvider = context
+	if dryRun {
+		provider = deb.NewPublishPlan(context)
+	}
+
+	err = published.Publish(context, context.PackagePool(), provider, collectionFactory, signer, context.Progress(), forceOverwrite, context.SkelPath())
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
+	if !dryRun {
+		published.RecordHistory(publishActor())
+		err = collectionFactory.PublishedRepoCollection().Update(published)
+		if err != nil {
+			return fmt.Errorf("unable to save to DB: %s", err)
+		}
+	}
+
+	skipCleanup := context.Flags().Lookup("skip-cleanup").Value.Get().(bool)
+	if !skipCleanup {
+		cleanComponents := make([]string, 0, len(result.UpdatedSources)+len(result.RemovedSources))
+		cleanComponents = append(append(cleanComponents, result.UpdatedComponents()...), result.RemovedComponents()...)
+		err = collectionFactory.PublishedRepoCollection().CleanupPrefixComponentFiles(provider, published, cleanComponents, collectionFactory, context.Progress())
+		if err != nil {
+			return fmt.Errorf("unable to rollback: %s", err)
+		}
+	}
+
+	if dryRun {
+		return printPublishPlan(provider.(*deb.PublishPlan))
+	}
+
+	context.Progress().Printf("\nPublished %s repository %s has been rolled back successfully.\n", published.SourceKind, published.String())
+
+	return err
+}
+
+func makeCmdPublishRollback() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPublishRollback,
+		UsageLine: "rollback <distribution> [[<endpoint>:]<prefix>]",
+		Short:     "restore previous sources of published repository",
+		Long: `
+Command rollback restores sources (snapshots or local repositories) which
+were published before and re-publishes the repository.
+
+aptly keeps a limited history of sources for each published repository,
+it is displayed by 'aptly publish show'. Flag -to selects how many steps
+back to go, by default the sources published right before the current ones
+are restored. Rollback is recorded in the history as well, so it could be
+undone with another rollback.
+
+Example:
+
+    $ aptly publish rollback wheezy ppa
+`,
+		Flag: *flag.NewFlagSet("aptly-publish-rollback", flag.ExitOnError),
+	}
+	// -to is shared with other commands as a string flag
+	cmd.Flag.String("to", "1", "number of steps back in the history to restore")
+	cmd.Flag.Var(&gpgKeysFlag{}, "gpg-key", "GPG key ID to use when signing the release, could be specified multiple times")
+	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "GPG keyring to use (instead of default)")
+	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
+	cmd.Flag.String("passphrase", "", "GPG passphrase for the key (warning: could be insecure)")
+	cmd.Flag.String("passphrase-file", "", "GPG passphrase-file for the key (warning: could be insecure)")
+	cmd.Flag.Bool("batch", false, "run GPG with detached tty")
+	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
+	cmd.Flag.Bool("force-overwrite", false, "overwrite files in package pool in case of mismatch")
+	cmd.Flag.Bool("skip-cleanup", false, "don't remove unreferenced files in prefix/component")
+	cmd.Flag.Bool("dry-run", false, "don't publish, display changes to published storage in JSON format")
+
+	return cmd
+}
@@ -50,6 +50,9 @@ func aptlyPublishShowTxt(_ *commander.Command, args []string) error {
 		fmt.Printf("Distribution: %s\n", repo.Distribution)
 	}
 	fmt.Printf("Architectures: %s\n", strings.Join(repo.Architectures, " "))
+	if len(repo.SigningKeys) > 0 {
+		fmt.Printf("Signing Keys: %s\n", strings.Join(repo.SigningKeys, " "))
+	}
 
 	fmt.Printf("Sources:\n")
 	for _, component := range repo.Components() {
@@ -74,6 +77,23 @@ func aptlyPublishShowTxt(_ *commander.Command, args []string) error {
 		}
 	}
 
+	history := repo.HistoryItems(collectionFactory)
+	if len(history) > 0 {
+		fmt.Printf("History:\n")
+		for _, item := range history {
+			sources := make([]string, 0, len(item.Sources))
+			for _, source := range item.Sources {
+				name := source.Name
+				if name == "" {
+					name = "<removed>"
+				}
+				sources = append(sources, fmt.Sprintf("%s: %s", source.Component, name))
+			}
+			fmt.Printf("  %d. {%s} replaced at %s by %s\n", item.Step, strings.Join(sources, ", "),
+				item.ReplacedAt.Format("2006-01-02 15:04:05 MST"), item.ReplacedBy)
+		}
+	}
+
 	return err
 }
 
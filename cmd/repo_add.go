@@ -48,7 +48,7 @@ func aptlyRepoAdd(cmd *commander.Command, args []string) error {
 
 	var processedFiles, failedFiles2 []string
 
-	processedFiles, failedFiles2, err = deb.ImportPackageFiles(list, packageFiles, forceReplace, verifier, context.PackagePool(),
+	processedFiles, failedFiles2, err = deb.ImportPackageFiles(context, list, packageFiles, forceReplace, verifier, context.PackagePool(),
 		collectionFactory.PackageCollection(), &aptly.ConsoleResultReporter{Progress: context.Progress()}, nil,
 		collectionFactory.ChecksumCollection)
 	failedFiles = append(failedFiles, failedFiles2...)
@@ -55,6 +55,17 @@ func aptlyServe(cmd *commander.Command, args []string) error {
 		}
 	}
 
+	tlsConfig, stopTLS, err := serveTLSConfig()
+	if err != nil {
+		return err
+	}
+	defer stopTLS()
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+
 	fmt.Printf("Serving published repositories, recommended apt sources list:\n\n")
 
 	sources := make(sort.StringSlice, 0, collectionFactory.PublishedRepoCollection().Len())
@@ -88,12 +99,12 @@ func aptlyServe(cmd *commander.Command, args []string) error {
 			prefix += "/"
 		}
 
-		fmt.Printf("# %s\ndeb http://%s:%s/%s %s %s\n",
-			repo, listenHost, listenPort, prefix, repo.Distribution, strings.Join(repo.Components(), " "))
+		fmt.Printf("# %s\ndeb %s://%s:%s/%s %s %s\n",
+			repo, scheme, listenHost, listenPort, prefix, repo.Distribution, strings.Join(repo.Components(), " "))
 
 		if utils.StrSliceHasItem(repo.Architectures, deb.ArchitectureSource) {
-			fmt.Printf("deb-src http://%s:%s/%s %s %s\n",
-				listenHost, listenPort, prefix, repo.Distribution, strings.Join(repo.Components(), " "))
+			fmt.Printf("deb-src %s://%s:%s/%s %s %s\n",
+				scheme, listenHost, listenPort, prefix, repo.Distribution, strings.Join(repo.Components(), " "))
 		}
 	}
 
@@ -102,7 +113,12 @@ func aptlyServe(cmd *commander.Command, args []string) error {
 
 	fmt.Printf("\nStarting web server at: %s (press Ctrl+C to quit)...\n", listen)
 
-	err = http.ListenAndServe(listen, http.FileServer(http.Dir(publicPath)))
+	server := &http.Server{Addr: listen, Handler: http.FileServer(http.Dir(publicPath)), TLSConfig: tlsConfig}
+	if tlsConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
 	if err != nil {
 		return fmt.Errorf("unable to serve: %s", err)
 	}
@@ -118,14 +134,19 @@ func makeCmdServe() *commander.Command {
 Command serve starts embedded HTTP server (not suitable for real production usage) to serve
 contents of public/ subdirectory of aptly's root that contains published repositories.
 
+HTTPS is enabled when TLS certificate and key are configured (or passed with
+flags), certificates are reloaded on SIGHUP.
+
 Example:
 
   $ aptly serve -listen=:8080
+  $ aptly serve -listen=:8443 -tls-cert=server.crt -tls-key=server.key
 `,
 		Flag: *flag.NewFlagSet("aptly-serve", flag.ExitOnError),
 	}
 
 	cmd.Flag.String("listen", ":8080", "host:port for HTTP listening")
+	addTLSFlags(&cmd.Flag)
 
 	return cmd
 }
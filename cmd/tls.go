@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/smira/flag"
+)
+
+// addTLSFlags adds flags overriding TLS configuration of HTTP servers
+func addTLSFlags(flags *flag.FlagSet) {
+	flags.String("tls-cert", "", "path to TLS certificate (PEM) to serve HTTPS")
+	flags.String("tls-key", "", "path to TLS private key (PEM)")
+	flags.String("tls-client-ca", "", "path to CA certificates (PEM) to verify TLS client certificates")
+}
+
+// serveTLSConfig builds TLS configuration for HTTP server from config and flags, nil is
+// returned if TLS is not enabled
+//
+// Certificates are reloaded on SIGHUP until stop is called.
+func serveTLSConfig() (config *tls.Config, stop func(), err error) {
+	tlsConfig := context.Config().TLS
+
+	for name, value := range map[string]*string{
+		"tls-cert":      &tlsConfig.CertFile,
+		"tls-key":       &tlsConfig.KeyFile,
+		"tls-client-ca": &tlsConfig.ClientCAFile,
+	} {
+		if f := context.Flags().Lookup(name); f != nil && f.Value.String() != "" {
+			*value = f.Value.String()
+		}
+	}
+
+	if tlsConfig.CertFile == "" && tlsConfig.KeyFile == "" && tlsConfig.ClientCAFile == "" {
+		return nil, func() {}, nil
+	}
+
+	reloader, err := utils.NewTLSReloader(tlsConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			if e := reloader.Reload(); e != nil {
+				fmt.Fprintf(os.Stderr, "Unable to reload TLS certificates: %s\n", e)
+			} else {
+				fmt.Printf("TLS certificates reloaded\n")
+			}
+		}
+	}()
+
+	return reloader.Config(), func() {
+		signal.Stop(sighup)
+		close(sighup)
+	}, nil
+}
@@ -0,0 +1,2 @@
+// Package composite implements published storage which applies every operation to several storages
+package composite
@@ -0,0 +1,422 @@
+package composite
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// Member is a single storage of composite storage
+type Member struct {
+	// Name of the storage, e.g. s3:eu
+	Name    string
+	Storage aptly.PublishedStorage
+}
+
+// MemberError is a failure of operation on single member
+type MemberError struct {
+	Member string
+	Err    error
+}
+
+// PartialError is returned when operation failed on some (or all) members
+//
+// Members listed in Succeeded have been updated, failed members are lagging behind
+// and could be brought in sync with 'aptly publish repair'.
+type PartialError struct {
+	Op        string
+	Succeeded []string
+	Failed    []MemberError
+}
+
+func (e *PartialError) Error() string {
+	failures := make([]string, len(e.Failed))
+	for i := range e.Failed {
+		failures[i] = fmt.Sprintf("%s: %s", e.Failed[i].Member, e.Failed[i].Err)
+	}
+
+	return fmt.Sprintf("%s failed on %d of %d members: %s", e.Op, len(e.Failed), len(e.Failed)+len(e.Succeeded),
+		strings.Join(failures, "; "))
+}
+
+// FailedMembers returns names of members operation failed on
+func (e *PartialError) FailedMembers() []string {
+	result := make([]string, len(e.Failed))
+	for i := range e.Failed {
+		result[i] = e.Failed[i].Member
+	}
+	return result
+}
+
+// PublishedStorage is a group of published storages updated together
+type PublishedStorage struct {
+	name    string
+	members []Member
+}
+
+// Check interface
+var (
+	_ aptly.PublishedStorage         = (*PublishedStorage)(nil)
+	_ aptly.ChecksumPublishedStorage = (*PublishedStorage)(nil)
+)
+
+// NewPublishedStorage creates composite storage out of members
+func NewPublishedStorage(name string, members []Member) *PublishedStorage {
+	return &PublishedStorage{
+		name:    name,
+		members: members,
+	}
+}
+
+// String returns the storage as string
+func (storage *PublishedStorage) String() string {
+	return fmt.Sprintf("Composite: %s [%s]", storage.name, strings.Join(storage.MemberNames(), ", "))
+}
+
+// MemberNames returns names of members in configuration order
+func (storage *PublishedStorage) MemberNames() []string {
+	result := make([]string, len(storage.members))
+	for i := range storage.members {
+		result[i] = storage.members[i].Name
+	}
+	return result
+}
+
+// Select returns composite storage limited to the specified members
+func (storage *PublishedStorage) Select(names []string) (*PublishedStorage, error) {
+	result := &PublishedStorage{name: storage.name}
+
+	for _, name := range names {
+		found := false
+		for _, member := range storage.members {
+			if member.Name == name {
+				result.members = append(result.members, member)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("storage %s is not a member of composite storage %s", name, storage.name)
+		}
+	}
+
+	return result, nil
+}
+
+// apply runs fn for every member concurrently and collects failures
+func (storage *PublishedStorage) apply(op string, fn func(member Member) error) error {
+	errs := make([]error, len(storage.members))
+
+	var wg sync.WaitGroup
+	for i := range storage.members {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(storage.members[i])
+		}(i)
+	}
+	wg.Wait()
+
+	partial := &PartialError{Op: op}
+	for i, err := range errs {
+		if err != nil {
+			partial.Failed = append(partial.Failed, MemberError{Member: storage.members[i].Name, Err: err})
+		} else {
+			partial.Succeeded = append(partial.Succeeded, storage.members[i].Name)
+		}
+	}
+
+	if len(partial.Failed) > 0 {
+		return partial
+	}
+
+	return nil
+}
+
+// MkDir creates directory recursively under public path
+func (storage *PublishedStorage) MkDir(path string) error {
+	return storage.apply(fmt.Sprintf("MkDir %s", path), func(member Member) error {
+		return member.Storage.MkDir(path)
+	})
+}
+
+// PutFile puts file into published storage at specified path
+func (storage *PublishedStorage) PutFile(path string, sourceFilename string) error {
+	return storage.apply(fmt.Sprintf("PutFile %s", path), func(member Member) error {
+		return member.Storage.PutFile(path, sourceFilename)
+	})
+}
+
+// RemoveDirs removes directory structure under public path
+func (storage *PublishedStorage) RemoveDirs(path string, progress aptly.Progress) error {
+	return storage.apply(fmt.Sprintf("RemoveDirs %s", path), func(member Member) error {
+		return member.Storage.RemoveDirs(path, progress)
+	})
+}
+
+// Remove removes single file under public path
+//
+// File which is already missing in a member is not an error, as lagging
+// members might not have it at all
+func (storage *PublishedStorage) Remove(path string) error {
+	return storage.apply(fmt.Sprintf("Remove %s", path), func(member Member) error {
+		err := member.Storage.Remove(path)
+		if err != nil {
+			if exists, e := member.Storage.FileExists(path); e == nil && !exists {
+				return nil
+			}
+		}
+		return err
+	})
+}
+
+// LinkFromPool links package file from pool to dist's pool location
+func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath, fileName string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo, force bool) error {
+	return storage.apply(fmt.Sprintf("LinkFromPool %s", fileName), func(member Member) error {
+		return member.Storage.LinkFromPool(publishedPrefix, publishedRelPath, fileName, sourcePool, sourcePath, sourceChecksums, force)
+	})
+}
+
+// RenameFile renames (moves) file
+func (storage *PublishedStorage) RenameFile(oldName, newName string) error {
+	return storage.apply(fmt.Sprintf("RenameFile %s -> %s", oldName, newName), func(member Member) error {
+		return member.Storage.RenameFile(oldName, newName)
+	})
+}
+
+// SymLink creates a symbolic link, which can be read with ReadLink
+func (storage *PublishedStorage) SymLink(src string, dst string) error {
+	return storage.apply(fmt.Sprintf("SymLink %s -> %s", src, dst), func(member Member) error {
+		return member.Storage.SymLink(src, dst)
+	})
+}
+
+// HardLink creates a hardlink of a file
+func (storage *PublishedStorage) HardLink(src string, dst string) error {
+	return storage.apply(fmt.Sprintf("HardLink %s -> %s", src, dst), func(member Member) error {
+		return member.Storage.HardLink(src, dst)
+	})
+}
+
+// filelists returns file lists of all the members
+func (storage *PublishedStorage) filelists(prefix string) ([][]string, error) {
+	lists := make([][]string, len(storage.members))
+
+	err := storage.apply(fmt.Sprintf("Filelist %s", prefix), func(member Member) error {
+		list, err := member.Storage.Filelist(prefix)
+		if err != nil {
+			return err
+		}
+
+		for i := range storage.members {
+			if storage.members[i].Name == member.Name {
+				lists[i] = list
+			}
+		}
+		return nil
+	})
+
+	return lists, err
+}
+
+// Filelist returns list of files under prefix, which exist in any of the members
+func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
+	lists, err := storage.filelists(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	result := []string{}
+	for _, list := range lists {
+		for _, file := range list {
+			if !seen[file] {
+				seen[file] = true
+				result = append(result, file)
+			}
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// Lagging returns members which miss some of the files under prefix present in other members
+//
+// With checksums set, files present in all the members are compared by MD5 checksum as well:
+// indexes are overwritten in place, so a failed upload leaves the stale copy behind. Members
+// which disagree with the majority are lagging, all the members are if there is no majority.
+func (storage *PublishedStorage) Lagging(prefix string, checksums bool) ([]string, error) {
+	lists, err := storage.filelists(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	union := map[string]int{}
+	for _, list := range lists {
+		for _, file := range list {
+			union[file]++
+		}
+	}
+
+	lagging := make([]bool, len(storage.members))
+	for i, list := range lists {
+		lagging[i] = len(list) < len(union)
+	}
+
+	if checksums {
+		for file, count := range union {
+			if count < len(storage.members) {
+				continue
+			}
+
+			md5s, err := storage.fileMD5s(filepath.Join(prefix, file))
+			if err != nil {
+				return nil, err
+			}
+
+			for i, stale := range staleChecksums(md5s) {
+				lagging[i] = lagging[i] || stale
+			}
+		}
+	}
+
+	result := []string{}
+	for i := range storage.members {
+		if lagging[i] {
+			result = append(result, storage.members[i].Name)
+		}
+	}
+
+	return result, nil
+}
+
+// fileMD5s returns MD5 checksums of the file in all the members, empty for members
+// which don't support checksums
+func (storage *PublishedStorage) fileMD5s(path string) ([]string, error) {
+	md5s := make([]string, len(storage.members))
+
+	err := storage.apply(fmt.Sprintf("FileMD5 %s", path), func(member Member) error {
+		checksumStorage, ok := member.Storage.(aptly.ChecksumPublishedStorage)
+		if !ok {
+			return nil
+		}
+
+		md5, err := checksumStorage.FileMD5(path)
+		if err != nil {
+			return err
+		}
+
+		for i := range storage.members {
+			if storage.members[i].Name == member.Name {
+				md5s[i] = md5
+			}
+		}
+		return nil
+	})
+
+	return md5s, err
+}
+
+// staleChecksums marks checksums which differ from the one most of the members agree on,
+// all of them if there is no such checksum; empty (unknown) checksums are never stale
+func staleChecksums(md5s []string) []bool {
+	counts := map[string]int{}
+	for _, md5 := range md5s {
+		if md5 != "" {
+			counts[md5]++
+		}
+	}
+
+	majority, best, tie := "", 0, false
+	for md5, count := range counts {
+		if count > best {
+			majority, best, tie = md5, count, false
+		} else if count == best {
+			tie = true
+		}
+	}
+
+	stale := make([]bool, len(md5s))
+	if len(counts) < 2 {
+		return stale
+	}
+
+	for i, md5 := range md5s {
+		stale[i] = md5 != "" && (tie || md5 != majority)
+	}
+
+	return stale
+}
+
+// FileExists returns true if path exists in all the members
+func (storage *PublishedStorage) FileExists(path string) (bool, error) {
+	existsAll := true
+	var mu sync.Mutex
+
+	err := storage.apply(fmt.Sprintf("FileExists %s", path), func(member Member) error {
+		exists, err := member.Storage.FileExists(path)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		existsAll = existsAll && exists
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return existsAll, nil
+}
+
+// ReadLink returns the symbolic link pointed to by path, as read from the first member which has it
+func (storage *PublishedStorage) ReadLink(path string) (string, error) {
+	var err error
+
+	for _, member := range storage.members {
+		var target string
+		target, err = member.Storage.ReadLink(path)
+		if err == nil {
+			return target, nil
+		}
+	}
+
+	return "", err
+}
+
+// FileMD5 returns MD5 checksum of the file, if it is the same in all the members
+//
+// Empty checksum is returned if members disagree or don't support checksums
+func (storage *PublishedStorage) FileMD5(path string) (string, error) {
+	result := ""
+
+	for i, member := range storage.members {
+		checksumStorage, ok := member.Storage.(aptly.ChecksumPublishedStorage)
+		if !ok {
+			return "", nil
+		}
+
+		md5, err := checksumStorage.FileMD5(path)
+		if err != nil {
+			return "", err
+		}
+
+		if i == 0 {
+			result = md5
+		} else if md5 != result {
+			return "", nil
+		}
+	}
+
+	return result, nil
+}
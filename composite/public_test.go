@@ -0,0 +1,250 @@
+package composite
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// failingStorage fails write operations while broken is set
+type failingStorage struct {
+	aptly.PublishedStorage
+	broken bool
+}
+
+func (f *failingStorage) PutFile(path string, sourceFilename string) error {
+	if f.broken {
+		return errors.New("connection refused")
+	}
+	return f.PublishedStorage.PutFile(path, sourceFilename)
+}
+
+func (f *failingStorage) LinkFromPool(publishedPrefix, publishedRelPath, fileName string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo, force bool) error {
+	if f.broken {
+		return errors.New("connection refused")
+	}
+	return f.PublishedStorage.LinkFromPool(publishedPrefix, publishedRelPath, fileName, sourcePool, sourcePath, sourceChecksums, force)
+}
+
+func (f *failingStorage) FileMD5(path string) (string, error) {
+	return f.PublishedStorage.(aptly.ChecksumPublishedStorage).FileMD5(path)
+}
+
+type PublishedStorageSuite struct {
+	roots   []string
+	broken  *failingStorage
+	storage *PublishedStorage
+}
+
+var _ = Suite(&PublishedStorageSuite{})
+
+func (s *PublishedStorageSuite) SetUpTest(c *C) {
+	s.roots = []string{c.MkDir(), c.MkDir(), c.MkDir()}
+	s.broken = &failingStorage{PublishedStorage: files.NewPublishedStorage(s.roots[2], "copy", "")}
+
+	s.storage = NewPublishedStorage("mirrors", []Member{
+		{Name: "filesystem:local", Storage: files.NewPublishedStorage(s.roots[0], "", "")},
+		{Name: "filesystem:eu", Storage: files.NewPublishedStorage(s.roots[1], "copy", "")},
+		{Name: "filesystem:us", Storage: s.broken},
+	})
+}
+
+func (s *PublishedStorageSuite) localFile(c *C, contents string) string {
+	path := filepath.Join(c.MkDir(), "file")
+	c.Assert(os.WriteFile(path, []byte(contents), 0644), IsNil)
+	return path
+}
+
+func (s *PublishedStorageSuite) GetFile(c *C, member int, path string) []byte {
+	data, err := os.ReadFile(filepath.Join(s.roots[member], path))
+	c.Assert(err, IsNil)
+	return data
+}
+
+func (s *PublishedStorageSuite) AssertNoFile(c *C, member int, path string) {
+	_, err := os.Lstat(filepath.Join(s.roots[member], path))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *PublishedStorageSuite) TestString(c *C) {
+	c.Check(s.storage.String(), Equals, "Composite: mirrors [filesystem:local, filesystem:eu, filesystem:us]")
+}
+
+func (s *PublishedStorageSuite) TestPutFile(c *C) {
+	c.Assert(s.storage.MkDir("dists/squeeze"), IsNil)
+	c.Assert(s.storage.PutFile("dists/squeeze/Release", s.localFile(c, "Origin: aptly\n")), IsNil)
+
+	for i := range s.roots {
+		c.Check(s.GetFile(c, i, "dists/squeeze/Release"), DeepEquals, []byte("Origin: aptly\n"))
+	}
+
+	md5, err := s.storage.FileMD5("dists/squeeze/Release")
+	c.Check(err, IsNil)
+	c.Check(md5, Equals, "7f9c5b8df62b933d72ba8bd4246b87ba")
+
+	exists, err := s.storage.FileExists("dists/squeeze/Release")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, true)
+}
+
+func (s *PublishedStorageSuite) TestPartialFailure(c *C) {
+	c.Assert(s.storage.MkDir("dists/squeeze"), IsNil)
+	c.Assert(s.storage.PutFile("dists/squeeze/Release", s.localFile(c, "Origin: aptly\n")), IsNil)
+
+	s.broken.broken = true
+	err := s.storage.PutFile("dists/squeeze/Release", s.localFile(c, "Origin: other\n"))
+	c.Check(err, ErrorMatches, "PutFile dists/squeeze/Release failed on 1 of 3 members: filesystem:us: connection refused")
+
+	partial, ok := err.(*PartialError)
+	c.Assert(ok, Equals, true)
+	c.Check(partial.Succeeded, DeepEquals, []string{"filesystem:local", "filesystem:eu"})
+	c.Check(partial.FailedMembers(), DeepEquals, []string{"filesystem:us"})
+
+	c.Check(s.GetFile(c, 0, "dists/squeeze/Release"), DeepEquals, []byte("Origin: other\n"))
+	c.Check(s.GetFile(c, 1, "dists/squeeze/Release"), DeepEquals, []byte("Origin: other\n"))
+	c.Check(s.GetFile(c, 2, "dists/squeeze/Release"), DeepEquals, []byte("Origin: aptly\n"))
+
+	// members disagree
+	md5, err := s.storage.FileMD5("dists/squeeze/Release")
+	c.Check(err, IsNil)
+	c.Check(md5, Equals, "")
+}
+
+func (s *PublishedStorageSuite) TestFilelistLagging(c *C) {
+	c.Assert(s.storage.MkDir("pool/main/a"), IsNil)
+	c.Assert(s.storage.PutFile("pool/main/a/a.deb", s.localFile(c, "a")), IsNil)
+
+	s.broken.broken = true
+	c.Check(s.storage.PutFile("pool/main/a/b.deb", s.localFile(c, "b")), NotNil)
+
+	list, err := s.storage.Filelist("pool")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"main/a/a.deb", "main/a/b.deb"})
+
+	exists, err := s.storage.FileExists("pool/main/a/b.deb")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, false)
+
+	lagging, err := s.storage.Lagging("pool", false)
+	c.Check(err, IsNil)
+	c.Check(lagging, DeepEquals, []string{"filesystem:us"})
+
+	// file missing in lagging member is removed without errors
+	c.Check(s.storage.Remove("pool/main/a/b.deb"), IsNil)
+	for i := range s.roots {
+		s.AssertNoFile(c, i, "pool/main/a/b.deb")
+	}
+
+	lagging, err = s.storage.Lagging("pool", false)
+	c.Check(err, IsNil)
+	c.Check(lagging, DeepEquals, []string{})
+}
+
+func (s *PublishedStorageSuite) TestLaggingChecksums(c *C) {
+	c.Assert(s.storage.MkDir("dists/squeeze"), IsNil)
+	c.Assert(s.storage.PutFile("dists/squeeze/Release", s.localFile(c, "Origin: aptly\n")), IsNil)
+
+	// failed in-place overwrite leaves stale copy behind
+	s.broken.broken = true
+	c.Check(s.storage.PutFile("dists/squeeze/Release", s.localFile(c, "Origin: other\n")), NotNil)
+
+	lagging, err := s.storage.Lagging("dists/squeeze", false)
+	c.Check(err, IsNil)
+	c.Check(lagging, DeepEquals, []string{})
+
+	lagging, err = s.storage.Lagging("dists/squeeze", true)
+	c.Check(err, IsNil)
+	c.Check(lagging, DeepEquals, []string{"filesystem:us"})
+
+	s.broken.broken = false
+	c.Assert(s.storage.PutFile("dists/squeeze/Release", s.localFile(c, "Origin: other\n")), IsNil)
+
+	lagging, err = s.storage.Lagging("dists/squeeze", true)
+	c.Check(err, IsNil)
+	c.Check(lagging, DeepEquals, []string{})
+}
+
+func (s *PublishedStorageSuite) TestStaleChecksums(c *C) {
+	c.Check(staleChecksums([]string{"a", "a", "b"}), DeepEquals, []bool{false, false, true})
+	c.Check(staleChecksums([]string{"a", "b"}), DeepEquals, []bool{true, true})
+	c.Check(staleChecksums([]string{"a", "", "a"}), DeepEquals, []bool{false, false, false})
+	c.Check(staleChecksums([]string{"a", "", "b"}), DeepEquals, []bool{true, false, true})
+}
+
+func (s *PublishedStorageSuite) TestSelect(c *C) {
+	selected, err := s.storage.Select([]string{"filesystem:us"})
+	c.Assert(err, IsNil)
+	c.Check(selected.MemberNames(), DeepEquals, []string{"filesystem:us"})
+
+	c.Assert(selected.MkDir("a"), IsNil)
+	c.Assert(selected.PutFile("a/b", s.localFile(c, "b")), IsNil)
+	c.Check(s.GetFile(c, 2, "a/b"), DeepEquals, []byte("b"))
+	s.AssertNoFile(c, 0, "a/b")
+
+	_, err = s.storage.Select([]string{"s3:eu"})
+	c.Check(err, ErrorMatches, "storage s3:eu is not a member of composite storage mirrors")
+}
+
+func (s *PublishedStorageSuite) TestLinks(c *C) {
+	c.Assert(s.storage.MkDir("dists/squeeze/by-hash"), IsNil)
+	c.Assert(s.storage.PutFile("dists/squeeze/Packages", s.localFile(c, "Package: a\n")), IsNil)
+
+	c.Assert(s.storage.HardLink("dists/squeeze/Packages", "dists/squeeze/by-hash/abc"), IsNil)
+	c.Assert(s.storage.SymLink("dists/squeeze/by-hash/abc", "dists/squeeze/by-hash/Packages"), IsNil)
+
+	for i := range s.roots {
+		c.Check(s.GetFile(c, i, "dists/squeeze/by-hash/Packages"), DeepEquals, []byte("Package: a\n"))
+	}
+
+	_, err := s.storage.ReadLink("dists/squeeze/by-hash/Packages")
+	c.Check(err, IsNil)
+
+	c.Assert(s.storage.RenameFile("dists/squeeze/Packages", "dists/squeeze/Packages.old"), IsNil)
+	for i := range s.roots {
+		s.AssertNoFile(c, i, "dists/squeeze/Packages")
+	}
+
+	c.Assert(s.storage.RemoveDirs("dists", nil), IsNil)
+	for i := range s.roots {
+		s.AssertNoFile(c, i, "dists")
+	}
+}
+
+func (s *PublishedStorageSuite) TestLinkFromPool(c *C) {
+	pool := files.NewPackagePool(c.MkDir(), false)
+	cs := files.NewMockChecksumStorage()
+
+	tmpFile := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	c.Assert(os.WriteFile(tmpFile, []byte("Contents"), 0644), IsNil)
+	cksum := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	src, err := pool.Import(tmpFile, "mars-invaders_1.03.deb", &cksum, true, cs)
+	c.Assert(err, IsNil)
+
+	s.broken.broken = true
+	err = s.storage.LinkFromPool("", "pool/main/m/mars-invaders", "mars-invaders_1.03.deb", pool, src, cksum, false)
+	c.Check(err, ErrorMatches, "LinkFromPool mars-invaders_1.03.deb failed on 1 of 3 members: filesystem:us: connection refused")
+
+	// repair: re-sync lagging member only
+	lagging, err := s.storage.Lagging("pool", false)
+	c.Assert(err, IsNil)
+	c.Check(lagging, DeepEquals, []string{"filesystem:us"})
+
+	s.broken.broken = false
+	selected, err := s.storage.Select(lagging)
+	c.Assert(err, IsNil)
+
+	err = selected.LinkFromPool("", "pool/main/m/mars-invaders", "mars-invaders_1.03.deb", pool, src, cksum, false)
+	c.Check(err, IsNil)
+
+	for i := range s.roots {
+		c.Check(s.GetFile(c, i, "pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contents"))
+	}
+}
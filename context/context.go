@@ -17,18 +17,22 @@ import (
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/azure"
+	"github.com/aptly-dev/aptly/composite"
 	"github.com/aptly-dev/aptly/console"
 	"github.com/aptly-dev/aptly/database"
 	"github.com/aptly-dev/aptly/database/etcddb"
 	"github.com/aptly-dev/aptly/database/goleveldb"
 	"github.com/aptly-dev/aptly/deb"
 	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/gcs"
 	"github.com/aptly-dev/aptly/http"
 	"github.com/aptly-dev/aptly/pgp"
 	"github.com/aptly-dev/aptly/s3"
+	"github.com/aptly-dev/aptly/sftp"
 	"github.com/aptly-dev/aptly/swift"
 	"github.com/aptly-dev/aptly/task"
 	"github.com/aptly-dev/aptly/utils"
+	"github.com/aptly-dev/aptly/webdav"
 	"github.com/smira/commander"
 	"github.com/smira/flag"
 )
@@ -41,6 +45,7 @@ type AptlyContext struct {
 
 	flags, globalFlags *flag.FlagSet
 	configLoaded       bool
+	configPath         string
 
 	progress          aptly.Progress
 	downloader        aptly.Downloader
@@ -95,6 +100,7 @@ func (context *AptlyContext) config() *utils.ConfigStructure {
 			if err != nil {
 				Fatal(err)
 			}
+			context.configPath = configLocation
 		} else {
 			homeLocation := filepath.Join(os.Getenv("HOME"), ".aptly.conf")
 			configLocations := []string{homeLocation, "/usr/local/etc/aptly.conf", "/etc/aptly.conf"}
@@ -105,6 +111,7 @@ func (context *AptlyContext) config() *utils.ConfigStructure {
 					continue
 				}
 				if err == nil {
+					context.configPath = configLocation
 					break
 				}
 				if !os.IsNotExist(err) {
@@ -120,6 +127,7 @@ func (context *AptlyContext) config() *utils.ConfigStructure {
 				if err != nil {
 					Fatal(fmt.Errorf("error loading config file %s: %s", homeLocation, err))
 				}
+				context.configPath = homeLocation
 			}
 		}
 
@@ -137,6 +145,15 @@ func (context *AptlyContext) config() *utils.ConfigStructure {
 	return &utils.Config
 }
 
+// ConfigPath returns location of the loaded configuration file
+func (context *AptlyContext) ConfigPath() string {
+	context.Lock()
+	defer context.Unlock()
+
+	context.config()
+	return context.configPath
+}
+
 // LookupOption checks boolean flag with default (usually config) and command-line
 // setting
 func (context *AptlyContext) LookupOption(defaultValue bool, name string) (result bool) {
@@ -381,36 +398,69 @@ func (context *AptlyContext) PackagePool() aptly.PackagePool {
 	defer context.Unlock()
 
 	if context.packagePool == nil {
-		storageConfig := context.config().PackagePoolStorage
-		if storageConfig.Azure != nil {
-			var err error
-			context.packagePool, err = azure.NewPackagePool(
-				storageConfig.Azure.AccountName,
-				storageConfig.Azure.AccountKey,
-				storageConfig.Azure.Container,
-				storageConfig.Azure.Prefix,
-				storageConfig.Azure.Endpoint)
-			if err != nil {
-				Fatal(err)
-			}
-		} else {
-			poolRoot := context.config().PackagePoolStorage.Local.Path
-			if poolRoot == "" {
-				poolRoot = filepath.Join(context.config().GetRootDir(), "pool")
-			}
-
-			context.packagePool = files.NewPackagePool(poolRoot, !context.config().SkipLegacyPool)
+		var err error
+		context.packagePool, err = context.newPackagePool(context.config().PackagePoolStorage, !context.config().SkipLegacyPool)
+		if err != nil {
+			Fatal(err)
 		}
 	}
 
 	return context.packagePool
 }
 
+// NewPackagePool creates package pool described by storageConfig, which is
+// not necessarily the configured one (e.g. while migrating the pool)
+func (context *AptlyContext) NewPackagePool(storageConfig utils.PackagePoolStorage) (aptly.PackagePool, error) {
+	context.Lock()
+	defer context.Unlock()
+
+	return context.newPackagePool(storageConfig, false)
+}
+
+func (context *AptlyContext) newPackagePool(storageConfig utils.PackagePoolStorage, supportLegacyPaths bool) (aptly.PackagePool, error) {
+	if storageConfig.Azure != nil {
+		return azure.NewPackagePool(
+			storageConfig.Azure.AccountName,
+			storageConfig.Azure.AccountKey,
+			storageConfig.Azure.Container,
+			storageConfig.Azure.Prefix,
+			storageConfig.Azure.Endpoint)
+	} else if storageConfig.S3 != nil {
+		return s3.NewPackagePool(
+			storageConfig.S3.AccessKeyID,
+			storageConfig.S3.SecretAccessKey,
+			storageConfig.S3.SessionToken,
+			storageConfig.S3.Region,
+			storageConfig.S3.Endpoint,
+			storageConfig.S3.Bucket,
+			storageConfig.S3.Prefix,
+			storageConfig.S3.StorageClass,
+			storageConfig.S3.EncryptionMethod,
+			storageConfig.S3.ForceVirtualHostedStyle,
+			storageConfig.S3.Debug)
+	}
+
+	poolRoot := ""
+	if storageConfig.Local != nil {
+		poolRoot = storageConfig.Local.Path
+	}
+	if poolRoot == "" {
+		poolRoot = filepath.Join(context.config().GetRootDir(), "pool")
+	}
+
+	return files.NewPackagePool(poolRoot, supportLegacyPaths), nil
+}
+
 // GetPublishedStorage returns instance of PublishedStorage
 func (context *AptlyContext) GetPublishedStorage(name string) aptly.PublishedStorage {
 	context.Lock()
 	defer context.Unlock()
 
+	return context.getPublishedStorage(name)
+}
+
+// getPublishedStorage returns instance of PublishedStorage, context should be locked
+func (context *AptlyContext) getPublishedStorage(name string) aptly.PublishedStorage {
 	publishedStorage, ok := context.publishedStorages[name]
 	if !ok {
 		if name == "" {
@@ -428,8 +478,7 @@ func (context *AptlyContext) GetPublishedStorage(name string) aptly.PublishedSto
 				Fatal(fmt.Errorf("published S3 storage %v not configured", name[3:]))
 			}
 
-			var err error
-			publishedStorage, err = s3.NewPublishedStorage(
+			s3Storage, err := s3.NewPublishedStorage(
 				params.AccessKeyID, params.SecretAccessKey, params.SessionToken,
 				params.Region, params.Endpoint, params.Bucket, params.ACL, params.Prefix, params.StorageClass,
 				params.EncryptionMethod, params.PlusWorkaround, params.DisableMultiDel,
@@ -437,6 +486,8 @@ func (context *AptlyContext) GetPublishedStorage(name string) aptly.PublishedSto
 			if err != nil {
 				Fatal(err)
 			}
+			s3Storage.SetUploadLimits(params.UploadConcurrency, params.MultipartThreshold)
+			publishedStorage = s3Storage
 		} else if strings.HasPrefix(name, "swift:") {
 			params, ok := context.config().SwiftPublishRoots[name[6:]]
 			if !ok {
@@ -461,6 +512,61 @@ func (context *AptlyContext) GetPublishedStorage(name string) aptly.PublishedSto
 			if err != nil {
 				Fatal(err)
 			}
+		} else if strings.HasPrefix(name, "sftp:") {
+			params, ok := context.config().SFTPPublishRoots[name[5:]]
+			if !ok {
+				Fatal(fmt.Errorf("published SFTP storage %v not configured", name[5:]))
+			}
+
+			var err error
+			publishedStorage, err = sftp.NewPublishedStorage(params.Host, params.Port, params.User, params.Password,
+				params.PrivateKey, params.KnownHosts, params.RootDir, params.VerifyMethod)
+			if err != nil {
+				Fatal(err)
+			}
+		} else if strings.HasPrefix(name, "gcs:") {
+			params, ok := context.config().GCSPublishRoots[name[4:]]
+			if !ok {
+				Fatal(fmt.Errorf("published GCS storage %v not configured", name[4:]))
+			}
+
+			var err error
+			publishedStorage, err = gcs.NewPublishedStorage(params.Bucket, params.ACL, params.Prefix,
+				params.CredentialsFile, params.Endpoint)
+			if err != nil {
+				Fatal(err)
+			}
+		} else if strings.HasPrefix(name, "webdav:") {
+			params, ok := context.config().WebDAVPublishRoots[name[7:]]
+			if !ok {
+				Fatal(fmt.Errorf("published WebDAV storage %v not configured", name[7:]))
+			}
+
+			var err error
+			publishedStorage, err = webdav.NewPublishedStorage(params.URL, params.User, params.Password, params.VerifyMethod)
+			if err != nil {
+				Fatal(err)
+			}
+		} else if strings.HasPrefix(name, "composite:") {
+			params, ok := context.config().CompositePublishRoots[name[10:]]
+			if !ok {
+				Fatal(fmt.Errorf("published composite storage %v not configured", name[10:]))
+			}
+
+			if len(params.Members) == 0 {
+				Fatal(fmt.Errorf("published composite storage %v has no members", name[10:]))
+			}
+
+			members := make([]composite.Member, len(params.Members))
+			for i, member := range params.Members {
+				if strings.HasPrefix(member, "composite:") {
+					Fatal(fmt.Errorf("published composite storage %v: nested composite storage %v is not supported", name[10:], member))
+				}
+
+				members[i] = composite.Member{Name: member, Storage: context.getPublishedStorage(member)}
+			}
+
+			publishedStorage = composite.NewPublishedStorage(name[10:], members)
 		} else {
 			Fatal(fmt.Errorf("unknown published storage format: %v", name))
 		}
@@ -470,6 +576,15 @@ func (context *AptlyContext) GetPublishedStorage(name string) aptly.PublishedSto
 	return publishedStorage
 }
 
+// RunPublishHook runs configured publish hooks for the event
+func (context *AptlyContext) RunPublishHook(event *deb.PublishHookEvent) error {
+	context.Lock()
+	hooks := context.config().PublishHooks
+	context.Unlock()
+
+	return deb.NewPublishHooks(hooks).RunPublishHook(event)
+}
+
 // UploadPath builds path to upload storage
 func (context *AptlyContext) UploadPath() string {
 	return filepath.Join(context.Config().GetRootDir(), "upload")
@@ -489,6 +604,7 @@ func (context *AptlyContext) pgpProvider() string {
 	case "gpg1": // nolint: goconst
 	case "gpg2": // nolint: goconst
 	case "internal": // nolint: goconst
+	case "remote": // nolint: goconst
 	default:
 		Fatal(fmt.Errorf("unknown gpg provider: %v", provider))
 	}
@@ -519,6 +635,16 @@ func (context *AptlyContext) GetSigner() pgp.Signer {
 		return &pgp.GoSigner{}
 	}
 
+	if provider == "remote" { // nolint: goconst
+		remote := context.config().GpgRemoteSigner
+		timeout := time.Duration(remote.Timeout) * time.Second
+		if timeout == 0 {
+			timeout = time.Minute
+		}
+
+		return pgp.NewRemoteSigner(remote.URL, remote.Token, remote.Keyring, timeout)
+	}
+
 	return pgp.NewGpgSigner(context.getGPGFinder())
 }
 
@@ -528,7 +654,7 @@ func (context *AptlyContext) GetVerifier() pgp.Verifier {
 	defer context.Unlock()
 
 	provider := context.pgpProvider()
-	if provider == "internal" { // nolint: goconst
+	if provider == "internal" || provider == "remote" { // nolint: goconst
 		return &pgp.GoVerifier{}
 	}
 
@@ -3,9 +3,12 @@ package context
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/aptly-dev/aptly/composite"
+	"github.com/aptly-dev/aptly/utils"
 	"github.com/smira/flag"
 
 	. "gopkg.in/check.v1"
@@ -87,3 +90,62 @@ func (s *AptlyContextSuite) TestGetPublishedStorageBadFS(c *C) {
 		&FatalError{ReturnCode: 1, Message: fmt.Sprintf("error loading config file %s/.aptly.conf: invalid yaml (EOF) or json (EOF)",
 			os.Getenv("HOME"))})
 }
+
+func (s *AptlyContextSuite) TestGetPublishedStorageComposite(c *C) {
+	saved := utils.Config
+	defer func() { utils.Config = saved }()
+
+	root := c.MkDir()
+	s.context.configLoaded = true
+	utils.Config.FileSystemPublishRoots = map[string]utils.FileSystemPublishRoot{
+		"a": {RootDir: filepath.Join(root, "a")},
+		"b": {RootDir: filepath.Join(root, "b")},
+	}
+	utils.Config.CompositePublishRoots = map[string]utils.CompositePublishRoot{
+		"mirrors": {Members: []string{"filesystem:a", "filesystem:b"}},
+		"nested":  {Members: []string{"filesystem:a", "composite:mirrors"}},
+	}
+
+	storage, ok := s.context.GetPublishedStorage("composite:mirrors").(*composite.PublishedStorage)
+	c.Assert(ok, Equals, true)
+	c.Check(storage.MemberNames(), DeepEquals, []string{"filesystem:a", "filesystem:b"})
+
+	c.Assert(storage.MkDir("dists"), IsNil)
+	for _, member := range []string{"a", "b"} {
+		_, err := os.Stat(filepath.Join(root, member, "dists"))
+		c.Check(err, IsNil)
+	}
+
+	c.Assert(func() { s.context.GetPublishedStorage("composite:nested") },
+		FatalErrorPanicMatches,
+		&FatalError{ReturnCode: 1, Message: "published composite storage nested: nested composite storage composite:mirrors is not supported"})
+}
+
+func (s *AptlyContextSuite) TestNewPackagePool(c *C) {
+	saved := utils.Config
+	defer func() { utils.Config = saved }()
+
+	root := c.MkDir()
+	s.context.configLoaded = true
+	utils.Config.RootDir = root
+
+	pool, err := s.context.NewPackagePool(utils.PackagePoolStorage{})
+	c.Assert(err, IsNil)
+	c.Check(pool.String(), Equals, filepath.Join(root, "pool"))
+
+	pool, err = s.context.NewPackagePool(utils.PackagePoolStorage{Local: &utils.LocalPoolStorage{Path: filepath.Join(root, "new-pool")}})
+	c.Assert(err, IsNil)
+	c.Check(pool.String(), Equals, filepath.Join(root, "new-pool"))
+}
+
+func (s *AptlyContextSuite) TestConfigPath(c *C) {
+	saved := utils.Config
+	defer func() { utils.Config = saved }()
+
+	configPath := filepath.Join(c.MkDir(), "aptly.conf")
+	c.Assert(os.WriteFile(configPath, []byte(`{"rootDir": "/srv/aptly"}`), 0644), IsNil)
+	c.Assert(s.context.globalFlags.Set("config", configPath), IsNil)
+
+	c.Check(s.context.ConfigPath(), Equals, configPath)
+	c.Check(s.context.Config().RootDir, Equals, "/srv/aptly")
+}
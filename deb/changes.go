@@ -2,6 +2,7 @@ package deb
 
 import (
 	"bytes"
+	gocontext "context"
 	"fmt"
 	"io"
 	"os"
@@ -289,7 +290,7 @@ func CollectChangesFiles(locations []string, reporter aptly.ResultReporter) (cha
 }
 
 // ImportChangesFiles imports referenced files in changes files into local repository
-func ImportChangesFiles(changesFiles []string, reporter aptly.ResultReporter, acceptUnsigned, ignoreSignatures, forceReplace, noRemoveFiles bool,
+func ImportChangesFiles(ctx gocontext.Context, changesFiles []string, reporter aptly.ResultReporter, acceptUnsigned, ignoreSignatures, forceReplace, noRemoveFiles bool,
 	verifier pgp.Verifier, repoTemplate *template.Template, progress aptly.Progress, localRepoCollection *LocalRepoCollection, packageCollection *PackageCollection,
 	pool aptly.PackagePool, checksumStorageProvider aptly.ChecksumStorageProvider, uploaders *Uploaders, parseQuery parseQuery) (processedFiles []string, failedFiles []string, err error) {
 
@@ -375,7 +376,7 @@ func ImportChangesFiles(changesFiles []string, reporter aptly.ResultReporter, ac
 		restriction := changes.PackageQuery()
 		var processedFiles2, failedFiles2 []string
 
-		processedFiles2, failedFiles2, err = ImportPackageFiles(list, packageFiles, forceReplace, verifier, pool,
+		processedFiles2, failedFiles2, err = ImportPackageFiles(ctx, list, packageFiles, forceReplace, verifier, pool,
 			packageCollection, reporter, restriction, checksumStorageProvider)
 
 		if err != nil {
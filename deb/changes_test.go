@@ -1,6 +1,7 @@
 package deb
 
 import (
+	gocontext "context"
 	"os"
 	"path/filepath"
 	"text/template"
@@ -122,7 +123,7 @@ func (s *ChangesSuite) TestImportChangesFiles(c *C) {
 	c.Check(failedFiles, HasLen, 0)
 
 	processedFiles, failedFiles, err := ImportChangesFiles(
-		append(changesFiles, "testdata/changes/notexistent.changes"),
+		gocontext.Background(), append(changesFiles, "testdata/changes/notexistent.changes"),
 		s.Reporter, true, true, false, false, &NullVerifier{},
 		template.Must(template.New("test").Parse("test")), s.progress, s.localRepoCollection, s.packageCollection, s.packagePool, func(database.ReaderWriter) aptly.ChecksumStorage { return s.checksumStorage },
 		nil, nil)
@@ -141,13 +142,30 @@ func (s *ChangesSuite) TestImportDbgsymWithVersionedSourceField(c *C) {
 	c.Check(failedFiles, HasLen, 0)
 
 	_, failedFiles, err := ImportChangesFiles(
-		changesFiles, s.Reporter, true, true, false, true, &NullVerifier{},
+		gocontext.Background(), changesFiles, s.Reporter, true, true, false, true, &NullVerifier{},
 		template.Must(template.New("test").Parse("test")), s.progress, s.localRepoCollection, s.packageCollection, s.packagePool, func(database.ReaderWriter) aptly.ChecksumStorage { return s.checksumStorage },
 		nil, nil)
 	c.Assert(err, IsNil)
 	c.Check(failedFiles, IsNil)
 }
 
+func (s *ChangesSuite) TestImportCancelled(c *C) {
+	repo := NewLocalRepo("test", "Test Comment")
+	c.Assert(s.localRepoCollection.Add(repo), IsNil)
+
+	changesFiles, _ := CollectChangesFiles(
+		[]string{"testdata/dbgsym-with-source-version"}, s.Reporter)
+
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+
+	_, _, err := ImportChangesFiles(
+		ctx, changesFiles, s.Reporter, true, true, false, true, &NullVerifier{},
+		template.Must(template.New("test").Parse("test")), s.progress, s.localRepoCollection, s.packageCollection, s.packagePool, func(database.ReaderWriter) aptly.ChecksumStorage { return s.checksumStorage },
+		nil, nil)
+	c.Check(err, ErrorMatches, ".*context canceled")
+}
+
 func (s *ChangesSuite) TestPrepare(c *C) {
 	changes, err := NewChanges("testdata/changes/hardlink_0.2.1_amd64.changes")
 	c.Assert(err, IsNil)
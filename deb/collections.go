@@ -17,6 +17,7 @@ type CollectionFactory struct {
 	localRepos     *LocalRepoCollection
 	publishedRepos *PublishedRepoCollection
 	checksums      *ChecksumCollection
+	webhooks       *WebhookCollection
 }
 
 // NewCollectionFactory creates new factory
@@ -91,6 +92,18 @@ func (factory *CollectionFactory) PublishedRepoCollection() *PublishedRepoCollec
 	return factory.publishedRepos
 }
 
+// WebhookCollection returns (or creates) new WebhookCollection
+func (factory *CollectionFactory) WebhookCollection() *WebhookCollection {
+	factory.Lock()
+	defer factory.Unlock()
+
+	if factory.webhooks == nil {
+		factory.webhooks = NewWebhookCollection(factory.db)
+	}
+
+	return factory.webhooks
+}
+
 // ChecksumCollection returns (or creates) new ChecksumCollection
 func (factory *CollectionFactory) ChecksumCollection(db database.ReaderWriter) aptly.ChecksumStorage {
 	factory.Lock()
@@ -118,4 +131,5 @@ func (factory *CollectionFactory) Flush() {
 	factory.publishedRepos = nil
 	factory.packages = nil
 	factory.checksums = nil
+	factory.webhooks = nil
 }
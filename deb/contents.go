@@ -29,7 +29,10 @@ func (index *ContentsIndex) Push(qualifiedName []byte, contents []string, dbw da
 	for _, path := range contents {
 		// for performance reasons we only write to leveldb during push.
 		// merging of qualified names per path will be done in WriteTo
-		err := dbw.Put(append(append(append(index.prefix, []byte(path)...), byte(0)), qualifiedName...), nil)
+		// key is built in a fresh slice, as index is pushed to from several goroutines
+		key := make([]byte, 0, len(index.prefix)+len(path)+1+len(qualifiedName))
+		key = append(append(append(append(key, index.prefix...), path...), 0), qualifiedName...)
+		err := dbw.Put(key, nil)
 		if err != nil {
 			return err
 		}
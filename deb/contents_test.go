@@ -0,0 +1,49 @@
+package deb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aptly-dev/aptly/database/goleveldb"
+
+	. "gopkg.in/check.v1"
+)
+
+type ContentsIndexSuite struct{}
+
+var _ = Suite(&ContentsIndexSuite{})
+
+func (s *ContentsIndexSuite) TestPushParallel(c *C) {
+	db, _ := goleveldb.NewOpenDB(c.MkDir())
+	defer func() { _ = db.Close() }()
+
+	index := NewContentsIndex(db)
+	// prefix with spare capacity shouldn't be shared by keys
+	index.prefix = append(make([]byte, 0, 64), index.prefix...)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			batch := db.CreateBatch()
+			for j := 0; j < 50; j++ {
+				c.Check(index.Push([]byte(fmt.Sprintf("pkg%d", i)), []string{fmt.Sprintf("f%02d", j)}, batch), IsNil)
+			}
+			c.Check(batch.Write(), IsNil)
+		}(i)
+	}
+	wg.Wait()
+
+	var buf bytes.Buffer
+	_, err := index.WriteTo(&buf)
+	c.Assert(err, IsNil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	c.Assert(lines, HasLen, 51)
+	c.Check(lines[1], Matches, "f00 +pkg0,pkg1,pkg2,pkg3")
+	c.Check(lines[50], Matches, "f49 +pkg0,pkg1,pkg2,pkg3")
+}
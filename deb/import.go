@@ -1,6 +1,7 @@
 package deb
 
 import (
+	gocontext "context"
 	"os"
 	"path/filepath"
 	"sort"
@@ -69,8 +70,8 @@ func CollectPackageFiles(locations []string, reporter aptly.ResultReporter) (pac
 	return
 }
 
-// ImportPackageFiles imports files into local repository
-func ImportPackageFiles(list *PackageList, packageFiles []string, forceReplace bool, verifier pgp.Verifier,
+// ImportPackageFiles imports files into local repository, import stops with error once ctx is cancelled
+func ImportPackageFiles(ctx gocontext.Context, list *PackageList, packageFiles []string, forceReplace bool, verifier pgp.Verifier,
 	pool aptly.PackagePool, collection *PackageCollection, reporter aptly.ResultReporter, restriction PackageQuery,
 	checksumStorageProvider aptly.ChecksumStorageProvider) (processedFiles []string, failedFiles []string, err error) {
 	if forceReplace {
@@ -80,6 +81,10 @@ func ImportPackageFiles(list *PackageList, packageFiles []string, forceReplace b
 	checksumStorage := checksumStorageProvider(collection.db)
 
 	for _, file := range packageFiles {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
 		var (
 			stanza Stanza
 			p      *Package
@@ -6,7 +6,9 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/pgp"
@@ -14,6 +16,12 @@ import (
 )
 
 type indexFiles struct {
+	// protects indexes, generatedFiles and renameMap, as files are
+	// generated and finalized in parallel
+	sync.Mutex
+	// signer might ask for passphrase, so signing is never done in parallel
+	signLock sync.Mutex
+
 	publishedStorage aptly.PublishedStorage
 	basePath         string
 	renameMap        map[string]string
@@ -100,7 +108,7 @@ func (file *indexFile) Finalize(signer pgp.Signer) error {
 		if err != nil {
 			return fmt.Errorf("unable to collect checksums: %s", err)
 		}
-		file.parent.generatedFiles[file.relativePath+ext] = checksumInfo
+		file.parent.setGenerated(file.relativePath+ext, checksumInfo)
 	}
 
 	filedir := filepath.Dir(filepath.Join(file.parent.basePath, file.relativePath))
@@ -127,12 +135,12 @@ func (file *indexFile) Finalize(signer pgp.Signer) error {
 		}
 
 		if file.parent.suffix != "" {
-			file.parent.renameMap[filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+ext)] =
-				filepath.Join(file.parent.basePath, file.relativePath+ext)
+			file.parent.addRename(filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+ext),
+				filepath.Join(file.parent.basePath, file.relativePath+ext))
 		}
 
 		if file.acquireByHash {
-			sums := file.parent.generatedFiles[file.relativePath+ext]
+			sums := file.parent.generated(file.relativePath + ext)
 			for hash, sum := range map[string]string{"SHA512": sums.SHA512, "SHA256": sums.SHA256, "SHA1": sums.SHA1, "MD5Sum": sums.MD5} {
 				err = packageIndexByHash(file, ext, hash, sum)
 				if err != nil {
@@ -143,6 +151,9 @@ func (file *indexFile) Finalize(signer pgp.Signer) error {
 	}
 
 	if signer != nil {
+		file.parent.signLock.Lock()
+		defer file.parent.signLock.Unlock()
+
 		gpgExt := ".gpg"
 		if file.detachedSign {
 			err = signer.DetachedSign(file.tempFilename, file.tempFilename+gpgExt)
@@ -151,8 +162,8 @@ func (file *indexFile) Finalize(signer pgp.Signer) error {
 			}
 
 			if file.parent.suffix != "" {
-				file.parent.renameMap[filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+gpgExt)] =
-					filepath.Join(file.parent.basePath, file.relativePath+gpgExt)
+				file.parent.addRename(filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+gpgExt),
+					filepath.Join(file.parent.basePath, file.relativePath+gpgExt))
 			}
 
 			err = file.parent.publishedStorage.PutFile(filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+gpgExt),
@@ -170,8 +181,8 @@ func (file *indexFile) Finalize(signer pgp.Signer) error {
 			}
 
 			if file.parent.suffix != "" {
-				file.parent.renameMap[filepath.Join(file.parent.basePath, "In"+file.relativePath+file.parent.suffix)] =
-					filepath.Join(file.parent.basePath, "In"+file.relativePath)
+				file.parent.addRename(filepath.Join(file.parent.basePath, "In"+file.relativePath+file.parent.suffix),
+					filepath.Join(file.parent.basePath, "In"+file.relativePath))
 			}
 
 			err = file.parent.publishedStorage.PutFile(filepath.Join(file.parent.basePath, "In"+file.relativePath+file.parent.suffix),
@@ -249,11 +260,36 @@ func newIndexFiles(publishedStorage aptly.PublishedStorage, basePath, tempDir, s
 	}
 }
 
+func (files *indexFiles) setGenerated(path string, checksums utils.ChecksumInfo) {
+	files.Lock()
+	defer files.Unlock()
+
+	files.generatedFiles[path] = checksums
+}
+
+func (files *indexFiles) generated(path string) utils.ChecksumInfo {
+	files.Lock()
+	defer files.Unlock()
+
+	return files.generatedFiles[path]
+}
+
+func (files *indexFiles) addRename(oldName, newName string) {
+	files.Lock()
+	defer files.Unlock()
+
+	files.renameMap[oldName] = newName
+}
+
 func (files *indexFiles) PackageIndex(component, arch string, udeb bool, installer bool, distribution string) *indexFile {
 	if arch == ArchitectureSource {
 		udeb = false
 	}
 	key := fmt.Sprintf("pi-%s-%s-%v-%v", component, arch, udeb, installer)
+
+	files.Lock()
+	defer files.Unlock()
+
 	file, ok := files.indexes[key]
 	if !ok {
 		var relativePath string
@@ -295,6 +331,10 @@ func (files *indexFiles) ReleaseIndex(component, arch string, udeb bool) *indexF
 		udeb = false
 	}
 	key := fmt.Sprintf("ri-%s-%s-%v", component, arch, udeb)
+
+	files.Lock()
+	defer files.Unlock()
+
 	file, ok := files.indexes[key]
 	if !ok {
 		var relativePath string
@@ -330,6 +370,10 @@ func (files *indexFiles) ContentsIndex(component, arch string, udeb bool) *index
 		udeb = false
 	}
 	key := fmt.Sprintf("ci-%s-%s-%v", component, arch, udeb)
+
+	files.Lock()
+	defer files.Unlock()
+
 	file, ok := files.indexes[key]
 	if !ok {
 		var relativePath string
@@ -362,6 +406,10 @@ func (files *indexFiles) LegacyContentsIndex(arch string, udeb bool) *indexFile
 		udeb = false
 	}
 	key := fmt.Sprintf("lci-%s-%v", arch, udeb)
+
+	files.Lock()
+	defer files.Unlock()
+
 	file, ok := files.indexes[key]
 	if !ok {
 		var relativePath string
@@ -391,6 +439,10 @@ func (files *indexFiles) LegacyContentsIndex(arch string, udeb bool) *indexFile
 
 func (files *indexFiles) SkelIndex(component, path string) *indexFile {
 	key := fmt.Sprintf("si-%s-%s", component, path)
+
+	files.Lock()
+	defer files.Unlock()
+
 	file, ok := files.indexes[key]
 
 	if !ok {
@@ -427,14 +479,22 @@ func (files *indexFiles) FinalizeAll(progress aptly.Progress, signer pgp.Signer)
 		defer progress.ShutdownBar()
 	}
 
-	for _, file := range files.indexes {
-		err = file.Finalize(signer)
-		if err != nil {
-			return
-		}
-		if progress != nil {
+	keys := make([]string, 0, len(files.indexes))
+	for key := range files.indexes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// compression and upload of index files are done in parallel
+	err = runParallel(len(keys), func(i int) error {
+		e := files.indexes[keys[i]].Finalize(signer)
+		if e == nil && progress != nil {
 			progress.AddBar(1)
 		}
+		return e
+	})
+	if err != nil {
+		return
 	}
 
 	files.indexes = make(map[string]*indexFile)
@@ -686,6 +686,9 @@ func (p *Package) Equals(p2 *Package) bool {
 }
 
 // LinkFromPool links package file from pool to dist's pool location
+//
+// If published storage supports linking in the background, files are only scheduled
+// to be linked, and caller should Flush the storage.
 func (p *Package) LinkFromPool(publishedStorage aptly.PublishedStorage, packagePool aptly.PackagePool,
 	prefix, relPath string, force bool) error {
 
@@ -695,9 +698,13 @@ func (p *Package) LinkFromPool(publishedStorage aptly.PublishedStorage, packageP
 			return err
 		}
 
-		err = publishedStorage.LinkFromPool(prefix, relPath, f.Filename, packagePool, sourcePoolPath, f.Checksums, force)
-		if err != nil {
-			return err
+		if parallelStorage, ok := publishedStorage.(aptly.ParallelPublishedStorage); ok {
+			parallelStorage.LinkFromPoolAsync(prefix, relPath, f.Filename, packagePool, sourcePoolPath, f.Checksums, force)
+		} else {
+			err = publishedStorage.LinkFromPool(prefix, relPath, f.Filename, packagePool, sourcePoolPath, f.Checksums, force)
+			if err != nil {
+				return err
+			}
 		}
 
 		if p.IsSource {
@@ -0,0 +1,179 @@
+package deb
+
+import (
+	"fmt"
+
+	"github.com/aptly-dev/aptly/aptly"
+)
+
+// PoolRelayout moves package files stored at legacy (pre 1.1) paths to current pool layout
+//
+// Packages referencing legacy paths are updated to point to the new location. When
+// the file is already present at new location, legacy copy is removed as a duplicate.
+type PoolRelayout struct {
+	Pool              aptly.PackagePool
+	ChecksumStorage   aptly.ChecksumStorage
+	CollectionFactory *CollectionFactory
+	// DryRun only reports what would be done
+	DryRun   bool
+	Progress aptly.Progress
+}
+
+// PoolRelayoutResult summarizes pool relayout
+type PoolRelayoutResult struct {
+	// Moved is number of files moved to current pool layout
+	Moved int
+	// Duplicates is number of legacy files removed, as they're present at new path
+	Duplicates int
+	// Reclaimed is disk space freed by removing duplicates
+	Reclaimed int64
+	// Packages is number of packages updated to reference new paths
+	Packages int
+	// Failed lists legacy files which couldn't be relocated with the reason
+	Failed map[string]string
+}
+
+// Run relocates all the files
+func (r *PoolRelayout) Run() (*PoolRelayoutResult, error) {
+	legacyPool, ok := r.Pool.(aptly.LegacyPackagePool)
+	if !ok {
+		return nil, fmt.Errorf("package pool %s doesn't support legacy paths", r.Pool)
+	}
+
+	result := &PoolRelayoutResult{Failed: map[string]string{}}
+	packageCollection := r.CollectionFactory.PackageCollection()
+	refs := packageCollection.AllPackageRefs()
+
+	if r.Progress != nil {
+		r.Progress.InitBar(int64(refs.Len()), false, aptly.BarPoolRelayoutPackages)
+		defer r.Progress.ShutdownBar()
+	}
+
+	// legacy path -> new path, for files already relocated
+	relocated := map[string]string{}
+
+	err := refs.ForEach(func(key []byte) error {
+		if r.Progress != nil {
+			r.Progress.AddBar(1)
+		}
+
+		p, err := packageCollection.ByKey(key)
+		if err != nil {
+			return fmt.Errorf("unable to load package %s: %s", key, err)
+		}
+
+		files := p.Files()
+		changed := false
+
+		for i := range files {
+			newPath, err := r.relocateFile(legacyPool, &files[i], relocated, result)
+			if err != nil {
+				return err
+			}
+
+			if newPath != "" {
+				files[i].PoolPath = newPath
+				changed = true
+			}
+		}
+
+		if !changed {
+			return nil
+		}
+
+		result.Packages++
+		if r.DryRun {
+			return nil
+		}
+
+		p.UpdateFiles(files)
+		return packageCollection.Update(p)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// relocateFile moves single package file if it's stored at legacy path, returning new path
+func (r *PoolRelayout) relocateFile(legacyPool aptly.LegacyPackagePool, f *PackageFile, relocated map[string]string,
+	result *PoolRelayoutResult) (string, error) {
+	if f.Checksums.MD5 == "" {
+		// legacy paths are built from MD5
+		return "", nil
+	}
+
+	legacyPath, err := r.Pool.LegacyPath(f.Filename, &f.Checksums)
+	if err != nil {
+		return "", err
+	}
+
+	if f.PoolPath != "" && f.PoolPath != legacyPath {
+		return "", nil
+	}
+
+	if newPath, ok := relocated[legacyPath]; ok {
+		return newPath, nil
+	}
+
+	if _, err = r.Pool.Size(legacyPath); err != nil {
+		// legacy file is gone, file might be already stored at new path; if relayout
+		// was interrupted, complete checksums to find it are stored for legacy path
+		checksums := f.Checksums
+		if stored, e := r.ChecksumStorage.Get(legacyPath); e == nil && stored != nil && checksums.Matches(stored) {
+			checksums = *stored
+		}
+		newPath, exists, err := r.Pool.Verify("", f.Filename, &checksums, r.ChecksumStorage)
+		if err != nil {
+			return "", err
+		}
+
+		if exists && newPath != legacyPath {
+			return newPath, nil
+		}
+
+		result.Failed[legacyPath] = "file is missing from the pool"
+		return "", nil
+	}
+
+	if _, failed := result.Failed[legacyPath]; failed {
+		return "", nil
+	}
+
+	checksums := f.Checksums
+	newPath, duplicate, err := legacyPool.PlanRelocation(legacyPath, f.Filename, &checksums)
+	if err != nil {
+		result.Failed[legacyPath] = err.Error()
+		return "", nil
+	}
+
+	var reclaimed int64
+	if r.DryRun {
+		if duplicate {
+			reclaimed = checksums.Size
+		}
+	} else {
+		// package keys depend on checksums, so complete checksums can't be stored with the package,
+		// they're kept for legacy path to find the file if packages are not updated
+		if err = r.ChecksumStorage.Update(legacyPath, &checksums); err != nil {
+			return "", err
+		}
+
+		reclaimed, err = legacyPool.RelocateLegacy(legacyPath, newPath, &checksums, r.ChecksumStorage)
+		if err != nil {
+			result.Failed[legacyPath] = err.Error()
+			return "", nil
+		}
+	}
+
+	if duplicate {
+		result.Duplicates++
+		result.Reclaimed += reclaimed
+	} else {
+		result.Moved++
+	}
+
+	relocated[legacyPath] = newPath
+	return newPath, nil
+}
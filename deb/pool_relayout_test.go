@@ -0,0 +1,192 @@
+package deb
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+type PoolRelayoutSuite struct {
+	db                database.Storage
+	collectionFactory *CollectionFactory
+	pool              *files.PackagePool
+	debFile           string
+	p1, p2            *Package
+	relayout          *PoolRelayout
+}
+
+var _ = Suite(&PoolRelayoutSuite{})
+
+const (
+	relayoutLegacyPath = "00/35/libboost-program-options-dev_1.49.0.1_i386.deb"
+	relayoutModernPath = "c7/6b/4bd12fd92e4dfe1b55b18a67a669_libboost-program-options-dev_1.49.0.1_i386.deb"
+)
+
+func (s *PoolRelayoutSuite) SetUpTest(c *C) {
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+	s.collectionFactory = NewCollectionFactory(s.db)
+	s.pool = files.NewPackagePool(c.MkDir(), true)
+
+	_, _File, _, _ := runtime.Caller(0)
+	s.debFile = filepath.Join(filepath.Dir(_File), "../system/files/libboost-program-options-dev_1.49.0.1_i386.deb")
+
+	checksums := utils.ChecksumInfo{Size: 2738, MD5: "0035d7822b2f8f0ec4013f270fd650c2"}
+
+	// package from pre-1.1 aptly doesn't have pool path
+	s.p1 = NewPackageFromControlFile(packageStanza.Copy())
+	s.p1.UpdateFiles(PackageFiles{PackageFile{Filename: filepath.Base(s.debFile), Checksums: checksums}})
+	c.Assert(s.collectionFactory.PackageCollection().Update(s.p1), IsNil)
+
+	// package with pool path pointing to legacy location
+	s.p2 = NewPackageFromControlFile(packageStanza.Copy())
+	s.p2.Version = "7.40-3"
+	s.p2.UpdateFiles(PackageFiles{PackageFile{Filename: filepath.Base(s.debFile), Checksums: checksums, PoolPath: relayoutLegacyPath}})
+	c.Assert(s.collectionFactory.PackageCollection().Update(s.p2), IsNil)
+
+	s.relayout = &PoolRelayout{
+		Pool:              s.pool,
+		ChecksumStorage:   files.NewMockChecksumStorage(),
+		CollectionFactory: s.collectionFactory,
+	}
+}
+
+func (s *PoolRelayoutSuite) TearDownTest(c *C) {
+	_ = s.db.Close()
+}
+
+func (s *PoolRelayoutSuite) putFile(c *C, path string) {
+	c.Assert(os.MkdirAll(filepath.Dir(s.pool.FullPath(path)), 0755), IsNil)
+	c.Assert(utils.CopyFile(s.debFile, s.pool.FullPath(path)), IsNil)
+}
+
+func (s *PoolRelayoutSuite) poolPaths(c *C) []string {
+	result := []string{}
+	for _, p := range []*Package{s.p1, s.p2} {
+		loaded, err := s.collectionFactory.PackageCollection().ByKey(p.Key(""))
+		c.Assert(err, IsNil)
+		result = append(result, loaded.Files()[0].PoolPath)
+	}
+	return result
+}
+
+func (s *PoolRelayoutSuite) TestRelayout(c *C) {
+	s.putFile(c, relayoutLegacyPath)
+
+	result, err := s.relayout.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Moved, Equals, 1)
+	c.Check(result.Duplicates, Equals, 0)
+	c.Check(result.Reclaimed, Equals, int64(0))
+	c.Check(result.Packages, Equals, 2)
+	c.Check(result.Failed, HasLen, 0)
+
+	c.Check(s.poolPaths(c), DeepEquals, []string{relayoutModernPath, relayoutModernPath})
+
+	list, err := s.pool.FilepathList(nil)
+	c.Assert(err, IsNil)
+	c.Check(list, DeepEquals, []string{relayoutModernPath})
+
+	// nothing left to do
+	result, err = s.relayout.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Moved, Equals, 0)
+	c.Check(result.Packages, Equals, 0)
+}
+
+func (s *PoolRelayoutSuite) TestRelayoutDuplicate(c *C) {
+	s.putFile(c, relayoutLegacyPath)
+	s.putFile(c, relayoutModernPath)
+
+	s.relayout.DryRun = true
+
+	result, err := s.relayout.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Duplicates, Equals, 1)
+	c.Check(result.Reclaimed, Equals, int64(2738))
+	c.Check(result.Packages, Equals, 2)
+
+	// nothing changed
+	c.Check(s.poolPaths(c), DeepEquals, []string{"", relayoutLegacyPath})
+	list, err := s.pool.FilepathList(nil)
+	c.Assert(err, IsNil)
+	c.Check(list, DeepEquals, []string{relayoutLegacyPath, relayoutModernPath})
+
+	s.relayout.DryRun = false
+
+	result, err = s.relayout.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Moved, Equals, 0)
+	c.Check(result.Duplicates, Equals, 1)
+	c.Check(result.Reclaimed, Equals, int64(2738))
+	c.Check(result.Packages, Equals, 2)
+
+	c.Check(s.poolPaths(c), DeepEquals, []string{relayoutModernPath, relayoutModernPath})
+	list, err = s.pool.FilepathList(nil)
+	c.Assert(err, IsNil)
+	c.Check(list, DeepEquals, []string{relayoutModernPath})
+}
+
+func (s *PoolRelayoutSuite) TestRelayoutMissing(c *C) {
+	result, err := s.relayout.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Packages, Equals, 0)
+	c.Check(result.Failed, DeepEquals, map[string]string{relayoutLegacyPath: "file is missing from the pool"})
+}
+
+func (s *PoolRelayoutSuite) TestRelayoutAlreadyMoved(c *C) {
+	s.putFile(c, relayoutModernPath)
+
+	// package knows SHA256, so file could be found at new location
+	c.Assert(s.collectionFactory.PackageCollection().DeleteByKey(s.p1.Key(""), s.db), IsNil)
+	s.p1.Files()[0].Checksums.SHA256 = "c76b4bd12fd92e4dfe1b55b18a67a669d92f62985d6a96c8a21d96120982cf12"
+	s.p1.UpdateFiles(s.p1.Files())
+	c.Assert(s.collectionFactory.PackageCollection().Update(s.p1), IsNil)
+
+	result, err := s.relayout.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Moved, Equals, 0)
+	c.Check(result.Packages, Equals, 1)
+	// second package doesn't have SHA256 to find the file
+	c.Check(result.Failed, HasLen, 1)
+
+	loaded, err := s.collectionFactory.PackageCollection().ByKey(s.p1.Key(""))
+	c.Assert(err, IsNil)
+	c.Check(loaded.Files()[0].PoolPath, Equals, relayoutModernPath)
+}
+
+func (s *PoolRelayoutSuite) TestRelayoutInterrupted(c *C) {
+	s.putFile(c, relayoutLegacyPath)
+
+	// file is moved, but packages are not updated
+	files := s.p1.Files()
+	newPath, err := s.relayout.relocateFile(s.pool, &files[0], map[string]string{}, &PoolRelayoutResult{Failed: map[string]string{}})
+	c.Assert(err, IsNil)
+	c.Check(newPath, Equals, relayoutModernPath)
+
+	list, err := s.pool.FilepathList(nil)
+	c.Assert(err, IsNil)
+	c.Check(list, DeepEquals, []string{relayoutModernPath})
+
+	result, err := s.relayout.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Moved, Equals, 0)
+	c.Check(result.Packages, Equals, 2)
+	c.Check(result.Failed, HasLen, 0)
+
+	c.Check(s.poolPaths(c), DeepEquals, []string{relayoutModernPath, relayoutModernPath})
+}
+
+func (s *PoolRelayoutSuite) TestRelayoutUnsupportedPool(c *C) {
+	s.relayout.Pool = struct{ aptly.PackagePool }{s.pool}
+
+	_, err := s.relayout.Run()
+	c.Check(err, ErrorMatches, "package pool .* doesn't support legacy paths")
+}
@@ -0,0 +1,306 @@
+package deb
+
+import (
+	gocontext "context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/mxk/go-flowrate/flowrate"
+)
+
+// PoolScrub re-verifies package files stored in the package pool
+//
+// Every file referenced by packages in the database is read back from the pool,
+// checksummed and compared with checksums recorded in package metadata and in
+// checksum storage. Corrupted or missing files could be re-downloaded from the
+// mirrors which contain the package.
+type PoolScrub struct {
+	Pool              aptly.PackagePool
+	ChecksumStorage   aptly.ChecksumStorage
+	CollectionFactory *CollectionFactory
+	// Downloader is used to re-download broken files, if nil broken files are only reported
+	Downloader aptly.Downloader
+	// RateLimit limits speed of reading files from the pool (bytes/sec), 0 means no limit
+	RateLimit int64
+	Progress  aptly.Progress
+}
+
+// PoolScrubResult summarizes pool scrubbing
+type PoolScrubResult struct {
+	// Checked is number of files verified
+	Checked int
+	// Bytes is total size of files read from the pool
+	Bytes int64
+	// Missing lists files which couldn't be read from the pool
+	Missing []string
+	// Corrupted lists files which don't match checksums
+	Corrupted []string
+	// Repaired lists broken files which were re-downloaded from the mirrors
+	Repaired []string
+	// Failed lists files which couldn't be verified or repaired with the reason
+	Failed map[string]string
+}
+
+// Broken returns number of missing or corrupted files which haven't been repaired
+func (result *PoolScrubResult) Broken() int {
+	return len(result.Missing) + len(result.Corrupted) - len(result.Repaired)
+}
+
+// poolScrubFile is a file in the pool with the package it belongs to
+type poolScrubFile struct {
+	packageKey []byte
+	pkg        *Package
+	file       PackageFile
+	legacy     bool
+}
+
+// Run verifies all the files, it stops when ctx is cancelled
+func (s *PoolScrub) Run(ctx gocontext.Context) (*PoolScrubResult, error) {
+	result := &PoolScrubResult{Failed: map[string]string{}}
+
+	files, err := s.buildFileList(result)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	if s.Progress != nil {
+		s.Progress.InitBar(int64(len(paths)), false, aptly.BarPoolScrubFiles)
+		defer s.Progress.ShutdownBar()
+	}
+
+	var mirrors map[string][]*RemoteRepo
+
+	for _, path := range paths {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if s.Progress != nil {
+			s.Progress.AddBar(1)
+		}
+
+		broken, err := s.verifyFile(path, &files[path].file.Checksums, result)
+		if err != nil {
+			result.Failed[path] = err.Error()
+			continue
+		}
+
+		result.Checked++
+
+		if !broken || s.Downloader == nil {
+			continue
+		}
+
+		if mirrors == nil {
+			mirrors, err = s.loadMirrors()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = s.redownload(ctx, path, files[path], mirrors[string(files[path].packageKey)])
+		if err != nil {
+			result.Failed[path] = err.Error()
+			continue
+		}
+
+		result.Repaired = append(result.Repaired, path)
+	}
+
+	return result, nil
+}
+
+// buildFileList collects pool paths of files of all the packages in the database
+func (s *PoolScrub) buildFileList(result *PoolScrubResult) (map[string]*poolScrubFile, error) {
+	packageCollection := s.CollectionFactory.PackageCollection()
+	files := map[string]*poolScrubFile{}
+
+	err := packageCollection.AllPackageRefs().ForEach(func(key []byte) error {
+		pkg, err := packageCollection.ByKey(key)
+		if err != nil {
+			return fmt.Errorf("unable to load package %s: %s", key, err)
+		}
+
+		for _, f := range pkg.Files() {
+			legacy := f.PoolPath == ""
+
+			path, err := f.GetPoolPath(s.Pool)
+			if err != nil {
+				result.Failed[f.Filename] = err.Error()
+				continue
+			}
+
+			if _, exists := files[path]; !exists {
+				files[path] = &poolScrubFile{packageKey: key, pkg: pkg, file: f, legacy: legacy}
+			}
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+// verifyFile re-hashes the file, reporting whether it is broken (missing or corrupted)
+func (s *PoolScrub) verifyFile(path string, expected *utils.ChecksumInfo, result *PoolScrubResult) (bool, error) {
+	file, err := s.Pool.Open(path)
+	if err != nil {
+		result.Missing = append(result.Missing, path)
+		return true, nil
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var reader io.Reader = file
+	if s.RateLimit > 0 {
+		reader = flowrate.NewReader(file, s.RateLimit)
+	}
+
+	actual, err := utils.ChecksumsForReader(reader)
+	if err != nil {
+		return false, fmt.Errorf("error reading %s from %s: %s", path, s.Pool, err)
+	}
+	result.Bytes += actual.Size
+
+	stored, err := s.ChecksumStorage.Get(path)
+	if err != nil {
+		return false, err
+	}
+
+	if !expected.Matches(&actual) || stored != nil && !stored.Matches(&actual) {
+		result.Corrupted = append(result.Corrupted, path)
+		return true, nil
+	}
+
+	if stored == nil || !stored.Complete() {
+		err = s.ChecksumStorage.Update(path, &actual)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// loadMirrors builds map of package keys to mirrors which contain the package
+func (s *PoolScrub) loadMirrors() (map[string][]*RemoteRepo, error) {
+	mirrors := map[string][]*RemoteRepo{}
+	collection := s.CollectionFactory.RemoteRepoCollection()
+
+	err := collection.ForEach(func(repo *RemoteRepo) error {
+		if err := collection.LoadComplete(repo); err != nil {
+			return err
+		}
+
+		if repo.RefList() == nil {
+			return nil
+		}
+
+		return repo.RefList().ForEach(func(key []byte) error {
+			mirrors[string(key)] = append(mirrors[string(key)], repo)
+			return nil
+		})
+	})
+
+	return mirrors, err
+}
+
+// downloadPaths returns possible locations of the package file relative to mirror's archive root
+//
+// Location of the file on the mirror is not persisted in the database, so it is
+// restored following pool layout of Debian archives.
+func downloadPaths(repo *RemoteRepo, pkg *Package, file *PackageFile) []string {
+	if pkg.IsSource {
+		if directory, ok := pkg.Extra()["Directory"]; ok {
+			return []string{filepath.Join(directory, file.Filename)}
+		}
+	}
+
+	if repo.IsFlat() {
+		return []string{file.Filename}
+	}
+
+	poolDirectory, err := pkg.PoolDirectory()
+	if err != nil {
+		return nil
+	}
+
+	result := make([]string, 0, len(repo.Components))
+	for _, component := range repo.Components {
+		result = append(result, filepath.Join("pool", component, poolDirectory, file.Filename))
+	}
+
+	return result
+}
+
+// redownload fetches broken file from the mirrors and puts it back into the pool
+func (s *PoolScrub) redownload(ctx gocontext.Context, path string, f *poolScrubFile, mirrors []*RemoteRepo) error {
+	if f.legacy {
+		return fmt.Errorf("file %s is stored at legacy location, it can't be re-downloaded", path)
+	}
+
+	if len(mirrors) == 0 {
+		return fmt.Errorf("file %s is broken, no mirror contains package %s", path, f.pkg)
+	}
+
+	tempDir, err := os.MkdirTemp("", "aptly-pool-scrub")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(tempDir)
+	}()
+
+	tempPath := filepath.Join(tempDir, f.file.Filename)
+
+	var lastErr error
+	for _, repo := range mirrors {
+		for _, downloadPath := range downloadPaths(repo, f.pkg, &f.file) {
+			url := repo.PackageURL(downloadPath).String()
+
+			lastErr = s.Downloader.DownloadWithChecksum(ctx, url, tempPath, &f.file.Checksums, false)
+			if lastErr == nil {
+				return s.replaceFile(path, tempPath, &f.file)
+			}
+		}
+	}
+
+	if lastErr == nil {
+		return fmt.Errorf("file %s is broken, download location on mirrors is unknown", path)
+	}
+
+	return fmt.Errorf("file %s is broken, unable to re-download: %s", path, lastErr)
+}
+
+// replaceFile replaces broken file in the pool with re-downloaded one
+func (s *PoolScrub) replaceFile(path, tempPath string, file *PackageFile) error {
+	if _, err := s.Pool.Size(path); err == nil {
+		if _, err = s.Pool.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	checksums := file.Checksums
+	newPath, err := s.Pool.Import(tempPath, file.Filename, &checksums, true, s.ChecksumStorage)
+	if err != nil {
+		return err
+	}
+
+	if newPath != path {
+		return fmt.Errorf("re-downloaded file %s was imported at unexpected location %s", path, newPath)
+	}
+
+	return nil
+}
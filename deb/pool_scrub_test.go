@@ -0,0 +1,188 @@
+package deb
+
+import (
+	gocontext "context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/http"
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+type PoolScrubSuite struct {
+	db                database.Storage
+	collectionFactory *CollectionFactory
+	pool              *files.PackagePool
+	cs                aptly.ChecksumStorage
+	path              string
+	scrub             *PoolScrub
+}
+
+var _ = Suite(&PoolScrubSuite{})
+
+const poolScrubURL = "http://mirror.yandex.ru/debian/pool/contrib/a/alien-arena/alien-arena-common_7.40-2_i386.deb"
+
+func (s *PoolScrubSuite) SetUpTest(c *C) {
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+	s.collectionFactory = NewCollectionFactory(s.db)
+	s.pool = files.NewPackagePool(c.MkDir(), false)
+	s.cs = files.NewMockChecksumStorage()
+
+	tmpFilepath := filepath.Join(c.MkDir(), "file")
+	c.Assert(os.WriteFile(tmpFilepath, []byte("abcde"), 0644), IsNil)
+
+	checksums, err := utils.ChecksumsForFile(tmpFilepath)
+	c.Assert(err, IsNil)
+	checksums.SHA512 = ""
+
+	p := NewPackageFromControlFile(packageStanza.Copy())
+	p.UpdateFiles(PackageFiles{PackageFile{Filename: "alien-arena-common_7.40-2_i386.deb", Checksums: checksums}})
+
+	s.path, err = s.pool.Import(tmpFilepath, p.Files()[0].Filename, &p.Files()[0].Checksums, false, files.NewMockChecksumStorage())
+	c.Assert(err, IsNil)
+	p.Files()[0].PoolPath = s.path
+	p.Files()[0].Checksums = checksums
+	c.Assert(s.collectionFactory.PackageCollection().Update(p), IsNil)
+
+	repo, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"contrib"}, []string{}, false, false, false)
+	list := NewPackageList()
+	c.Assert(list.Add(p), IsNil)
+	repo.packageRefs = NewPackageRefListFromPackageList(list)
+	c.Assert(s.collectionFactory.RemoteRepoCollection().Add(repo), IsNil)
+
+	s.scrub = &PoolScrub{
+		Pool:              s.pool,
+		ChecksumStorage:   s.cs,
+		CollectionFactory: s.collectionFactory,
+	}
+}
+
+func (s *PoolScrubSuite) TearDownTest(c *C) {
+	_ = s.db.Close()
+}
+
+func (s *PoolScrubSuite) corrupt(c *C) {
+	c.Assert(os.WriteFile(s.pool.FullPath(s.path), []byte("xxxxx"), 0644), IsNil)
+}
+
+func (s *PoolScrubSuite) TestScrub(c *C) {
+	result, err := s.scrub.Run(gocontext.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.Checked, Equals, 1)
+	c.Check(result.Bytes, Equals, int64(5))
+	c.Check(result.Broken(), Equals, 0)
+	c.Check(result.Failed, HasLen, 0)
+
+	// missing checksums are filled in
+	c.Check(s.cs.(*files.MockChecksumStorage).Store[s.path].SHA512, Not(Equals), "")
+}
+
+func (s *PoolScrubSuite) TestScrubRateLimit(c *C) {
+	s.scrub.RateLimit = 1024
+
+	result, err := s.scrub.Run(gocontext.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.Checked, Equals, 1)
+	c.Check(result.Broken(), Equals, 0)
+}
+
+func (s *PoolScrubSuite) TestScrubCancelled(c *C) {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+
+	_, err := s.scrub.Run(ctx)
+	c.Check(err, Equals, gocontext.Canceled)
+}
+
+func (s *PoolScrubSuite) TestScrubCorrupted(c *C) {
+	s.corrupt(c)
+
+	result, err := s.scrub.Run(gocontext.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.Corrupted, DeepEquals, []string{s.path})
+	c.Check(result.Missing, HasLen, 0)
+	c.Check(result.Broken(), Equals, 1)
+}
+
+func (s *PoolScrubSuite) TestScrubChecksumStorageMismatch(c *C) {
+	s.cs.(*files.MockChecksumStorage).Store[s.path] = utils.ChecksumInfo{Size: 5, MD5: "00000000000000000000000000000000"}
+
+	result, err := s.scrub.Run(gocontext.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.Corrupted, DeepEquals, []string{s.path})
+}
+
+func (s *PoolScrubSuite) TestScrubMissing(c *C) {
+	_, err := s.pool.Remove(s.path)
+	c.Assert(err, IsNil)
+
+	result, err := s.scrub.Run(gocontext.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.Missing, DeepEquals, []string{s.path})
+	c.Check(result.Corrupted, HasLen, 0)
+	c.Check(result.Broken(), Equals, 1)
+}
+
+func (s *PoolScrubSuite) TestScrubRedownload(c *C) {
+	s.corrupt(c)
+	s.scrub.Downloader = http.NewFakeDownloader().ExpectResponse(poolScrubURL, "abcde")
+
+	result, err := s.scrub.Run(gocontext.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.Corrupted, DeepEquals, []string{s.path})
+	c.Check(result.Repaired, DeepEquals, []string{s.path})
+	c.Check(result.Failed, HasLen, 0)
+	c.Check(result.Broken(), Equals, 0)
+	c.Check(s.scrub.Downloader.(*http.FakeDownloader).Empty(), Equals, true)
+
+	content, err := os.ReadFile(s.pool.FullPath(s.path))
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "abcde")
+}
+
+func (s *PoolScrubSuite) TestScrubRedownloadMissing(c *C) {
+	_, err := s.pool.Remove(s.path)
+	c.Assert(err, IsNil)
+	s.scrub.Downloader = http.NewFakeDownloader().ExpectResponse(poolScrubURL, "abcde")
+
+	result, err := s.scrub.Run(gocontext.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.Repaired, DeepEquals, []string{s.path})
+	c.Check(result.Broken(), Equals, 0)
+}
+
+func (s *PoolScrubSuite) TestScrubRedownloadFailed(c *C) {
+	s.corrupt(c)
+	s.scrub.Downloader = http.NewFakeDownloader().ExpectError(poolScrubURL, errors.New("HTTP 404"))
+
+	result, err := s.scrub.Run(gocontext.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.Repaired, HasLen, 0)
+	c.Check(result.Broken(), Equals, 1)
+	c.Check(result.Failed[s.path], Matches, ".* is broken, unable to re-download: HTTP 404")
+
+	// broken file is kept
+	content, err := os.ReadFile(s.pool.FullPath(s.path))
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "xxxxx")
+}
+
+func (s *PoolScrubSuite) TestScrubRedownloadNoMirror(c *C) {
+	s.corrupt(c)
+	s.scrub.Downloader = http.NewFakeDownloader()
+
+	repo, err := s.collectionFactory.RemoteRepoCollection().ByName("yandex")
+	c.Assert(err, IsNil)
+	c.Assert(s.collectionFactory.RemoteRepoCollection().Drop(repo), IsNil)
+
+	result, err := s.scrub.Run(gocontext.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.Failed[s.path], Matches, ".* is broken, no mirror contains package .*")
+}
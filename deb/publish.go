@@ -3,6 +3,7 @@ package deb
 import (
 	"bufio"
 	"bytes"
+	gocontext "context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -84,8 +85,16 @@ type PublishedRepo struct {
 	// Support multiple distributions
 	MultiDist bool
 
+	// GPG keys used to sign Release files, empty for default key
+	SigningKeys []string
+
 	// Revision
 	Revision *PublishedRepoRevision
+
+	// History of previous sources, oldest first
+	History []PublishedRepoHistoryEntry
+	// Sources as they were stored last time, used to record history
+	savedSources map[string]string
 }
 
 type PublishedRepoRevision struct {
@@ -450,6 +459,7 @@ func NewPublishedRepo(storage, prefix, distribution string, architectures []stri
 	}
 
 	result.Prefix = prefix
+	result.savedSources = copySources(result.Sources)
 
 	// guessing distribution
 	if distribution == "" {
@@ -513,7 +523,7 @@ func (p *PublishedRepo) MarshalJSON() ([]byte, error) {
 		})
 	}
 
-	return json.Marshal(map[string]interface{}{
+	result := map[string]interface{}{
 		"Architectures":        p.Architectures,
 		"Distribution":         p.Distribution,
 		"Label":                p.Label,
@@ -530,7 +540,13 @@ func (p *PublishedRepo) MarshalJSON() ([]byte, error) {
 		"SkipContents":         p.SkipContents,
 		"AcquireByHash":        p.AcquireByHash,
 		"MultiDist":            p.MultiDist,
-	})
+	}
+
+	if len(p.SigningKeys) > 0 {
+		result["SigningKeys"] = p.SigningKeys
+	}
+
+	return json.Marshal(result)
 }
 
 // String returns human-readable representation of PublishedRepo
@@ -727,6 +743,8 @@ func (p *PublishedRepo) Decode(input []byte) error {
 		p.SourceUUID = ""
 	}
 
+	p.savedSources = copySources(p.Sources)
+
 	return nil
 }
 
@@ -812,7 +830,9 @@ func (p *PublishedRepo) GetSkelFiles(skelDir string, component string) (map[stri
 }
 
 // Publish publishes snapshot (repository) contents, links package files, generates Packages & Release files, signs them
-func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageProvider aptly.PublishedStorageProvider,
+//
+// Publishing stops with error once ctx is cancelled
+func (p *PublishedRepo) Publish(ctx gocontext.Context, packagePool aptly.PackagePool, publishedStorageProvider aptly.PublishedStorageProvider,
 	collectionFactory *CollectionFactory, signer pgp.Signer, progress aptly.Progress, forceOverwrite bool, skelDir string) error {
 	publishedStorage := publishedStorageProvider.GetPublishedStorage(p.Storage)
 
@@ -855,6 +875,11 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageP
 		}
 	}
 
+	err = p.runPublishHook(publishedStorageProvider, PublishHookPrePublish, lists)
+	if err != nil {
+		return err
+	}
+
 	if !p.rePublishing {
 		if len(p.Architectures) == 0 {
 			for _, list := range lists {
@@ -888,6 +913,12 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageP
 
 	indexes := newIndexFiles(publishedStorage, basePath, tempDir, suffix, p.AcquireByHash, p.SkipBz2)
 
+	parallelStorage, _ := publishedStorage.(aptly.ParallelPublishedStorage)
+	if parallelStorage != nil {
+		// background uploads should be complete even if publishing fails
+		defer func() { _ = parallelStorage.Flush() }()
+	}
+
 	legacyContentIndexes := map[string]*ContentsIndex{}
 	var count int64
 	for _, list := range lists {
@@ -898,189 +929,53 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageP
 		progress.InitBar(count, false, aptly.BarPublishGeneratePackageFiles)
 	}
 
-	for component, list := range lists {
-		hadUdebs := false
-
-		// For all architectures, pregenerate packages/sources files
-		for _, arch := range p.Architectures {
-			indexes.PackageIndex(component, arch, false, false, p.Distribution)
-		}
-
-		list.PrepareIndex()
-
-		contentIndexes := map[string]*ContentsIndex{}
-
-		err = list.ForEachIndexed(func(pkg *Package) error {
-			if progress != nil {
-				progress.AddBar(1)
-			}
-
-			for _, arch := range p.Architectures {
-				if pkg.MatchesArchitecture(arch) {
-					hadUdebs = hadUdebs || pkg.IsUdeb
-
-					var relPath string
-					if !pkg.IsInstaller {
-						poolDir, err2 := pkg.PoolDirectory()
-						if err2 != nil {
-							return err2
-						}
-						if p.MultiDist {
-							relPath = filepath.Join("pool", p.Distribution, component, poolDir)
-						} else {
-							relPath = filepath.Join("pool", component, poolDir)
-						}
-
-					} else {
-						if p.Distribution == aptly.DistributionFocal {
-							relPath = filepath.Join("dists", p.Distribution, component, fmt.Sprintf("%s-%s", pkg.Name, arch), "current", "legacy-images")
-						} else {
-							relPath = filepath.Join("dists", p.Distribution, component, fmt.Sprintf("%s-%s", pkg.Name, arch), "current", "images")
-						}
-					}
-
-					err = pkg.LinkFromPool(publishedStorage, packagePool, p.Prefix, relPath, forceOverwrite)
-					if err != nil {
-						return err
-					}
-					break
-				}
-			}
-
-			// Start a db batch. If we fill contents data we'll need
-			// to push each path of the package into the database.
-			// We'll want this batched so as to avoid an excessive
-			// amount of write() calls.
-			batch := tempDB.CreateBatch()
-
-			for _, arch := range p.Architectures {
-				if pkg.MatchesArchitecture(arch) {
-					var bufWriter *bufio.Writer
-
-					if !p.SkipContents && !pkg.IsInstaller {
-						key := fmt.Sprintf("%s-%v", arch, pkg.IsUdeb)
-						qualifiedName := []byte(pkg.QualifiedName())
-						contents := pkg.Contents(packagePool, progress)
-
-						for _, contentIndexesMap := range []map[string]*ContentsIndex{contentIndexes, legacyContentIndexes} {
-							contentIndex := contentIndexesMap[key]
-
-							if contentIndex == nil {
-								contentIndex = NewContentsIndex(tempDB)
-								contentIndexesMap[key] = contentIndex
-							}
-
-							_ = contentIndex.Push(qualifiedName, contents, batch)
-						}
-					}
-
-					bufWriter, err = indexes.PackageIndex(component, arch, pkg.IsUdeb, pkg.IsInstaller, p.Distribution).BufWriter()
-					if err != nil {
-						return err
-					}
-
-					err = pkg.Stanza().WriteTo(bufWriter, pkg.IsSource, false, pkg.IsInstaller)
-					if err != nil {
-						return err
-					}
-					err = bufWriter.WriteByte('\n')
-					if err != nil {
-						return err
-					}
-				}
-			}
-
-			pkg.files = nil
-			pkg.deps = nil
-			pkg.extra = nil
-			pkg.contents = nil
+	components := make([]string, 0, len(lists))
+	for component := range lists {
+		components = append(components, component)
+	}
+	sort.Strings(components)
 
-			return batch.Write()
-		})
+	generator := &indexGenerator{
+		ctx:                  ctx,
+		repo:                 p,
+		publishedStorage:     publishedStorage,
+		packagePool:          packagePool,
+		tempDB:               tempDB,
+		indexes:              indexes,
+		progress:             progress,
+		forceOverwrite:       forceOverwrite,
+		legacyContentIndexes: legacyContentIndexes,
+	}
+
+	// components are processed in parallel, each one produces its own set of index files
+	err = runParallel(len(components), func(i int) error {
+		return generator.generateComponent(components[i], lists[components[i]])
+	})
+	if err != nil {
+		return err
+	}
 
+	for component := range p.sourceItems {
+		skelFiles, err := p.GetSkelFiles(skelDir, component)
 		if err != nil {
-			return fmt.Errorf("unable to process packages: %s", err)
-		}
-
-		for _, arch := range p.Architectures {
-			for _, udeb := range []bool{true, false} {
-				index := contentIndexes[fmt.Sprintf("%s-%v", arch, udeb)]
-				if index == nil || index.Empty() {
-					continue
-				}
-
-				var bufWriter *bufio.Writer
-				bufWriter, err = indexes.ContentsIndex(component, arch, udeb).BufWriter()
-				if err != nil {
-					return fmt.Errorf("unable to generate contents index: %v", err)
-				}
-
-				_, err = index.WriteTo(bufWriter)
-				if err != nil {
-					return fmt.Errorf("unable to generate contents index: %v", err)
-				}
-			}
+			return fmt.Errorf("unable to get skeleton files: %v", err)
 		}
 
-		for component := range p.sourceItems {
-			skelFiles, err := p.GetSkelFiles(skelDir, component)
+		for relPath, absPath := range skelFiles {
+			bufWriter, err := indexes.SkelIndex(component, relPath).BufWriter()
 			if err != nil {
-				return fmt.Errorf("unable to get skeleton files: %v", err)
+				return fmt.Errorf("unable to generate skeleton index: %v", err)
 			}
 
-			for relPath, absPath := range skelFiles {
-				bufWriter, err := indexes.SkelIndex(component, relPath).BufWriter()
-				if err != nil {
-					return fmt.Errorf("unable to generate skeleton index: %v", err)
-				}
-
-				file, err := os.Open(absPath)
-				if err != nil {
-					return fmt.Errorf("unable to read skeleton file: %v", err)
-				}
-
-				_, err = bufio.NewReader(file).WriteTo(bufWriter)
-				if err != nil {
-					return fmt.Errorf("unable to write skeleton file: %v", err)
-				}
-			}
-		}
-
-		udebs := []bool{false}
-		if hadUdebs {
-			udebs = append(udebs, true)
-
-			// For all architectures, pregenerate .udeb indexes
-			for _, arch := range p.Architectures {
-				indexes.PackageIndex(component, arch, true, false, p.Distribution)
+			file, err := os.Open(absPath)
+			if err != nil {
+				return fmt.Errorf("unable to read skeleton file: %v", err)
 			}
-		}
 
-		// For all architectures, generate Release files
-		for _, arch := range p.Architectures {
-			for _, udeb := range udebs {
-				release := make(Stanza)
-				release["Archive"] = p.Distribution
-				release["Architecture"] = arch
-				release["Component"] = component
-				release["Origin"] = p.GetOrigin()
-				release["Label"] = p.GetLabel()
-				release["Suite"] = p.GetSuite()
-				release["Codename"] = p.GetCodename()
-				if p.AcquireByHash {
-					release["Acquire-By-Hash"] = "yes"
-				}
-
-				var bufWriter *bufio.Writer
-				bufWriter, err = indexes.ReleaseIndex(component, arch, udeb).BufWriter()
-				if err != nil {
-					return fmt.Errorf("unable to get ReleaseIndex writer: %s", err)
-				}
-
-				err = release.WriteTo(bufWriter, false, true, false)
-				if err != nil {
-					return fmt.Errorf("unable to create Release file: %s", err)
-				}
+			_, err = bufio.NewReader(file).WriteTo(bufWriter)
+			_ = file.Close()
+			if err != nil {
+				return fmt.Errorf("unable to write skeleton file: %v", err)
 			}
 		}
 	}
@@ -1105,6 +1000,13 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageP
 		}
 	}
 
+	if parallelStorage != nil {
+		err = parallelStorage.Flush()
+		if err != nil {
+			return fmt.Errorf("unable to process packages: %s", err)
+		}
+	}
+
 	if progress != nil {
 		progress.ShutdownBar()
 		progress.Printf("Finalizing metadata files...\n")
@@ -1174,7 +1076,18 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageP
 		return err
 	}
 
-	return indexes.RenameFiles()
+	err = indexes.RenameFiles()
+	if err != nil {
+		return err
+	}
+
+	// files are already published, so failing post-publish hook is reported, but not returned
+	err = p.runPublishHook(publishedStorageProvider, PublishHookPostPublish, lists)
+	if err != nil && progress != nil {
+		progress.ColoredPrintf("@y[!]@| @!%s@|", err)
+	}
+
+	return nil
 }
 
 // RemoveFiles removes files that were created by Publish
@@ -1182,8 +1095,26 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageP
 // It can remove prefix fully, and part of pool (for specific component)
 func (p *PublishedRepo) RemoveFiles(publishedStorageProvider aptly.PublishedStorageProvider, removePrefix bool,
 	removePoolComponents []string, progress aptly.Progress) error {
-	publishedStorage := publishedStorageProvider.GetPublishedStorage(p.Storage)
+	err := p.runPublishHook(publishedStorageProvider, PublishHookPreRemove, nil)
+	if err != nil {
+		return err
+	}
 
+	err = p.removeFiles(publishedStorageProvider.GetPublishedStorage(p.Storage), removePrefix, removePoolComponents, progress)
+	if err != nil {
+		return err
+	}
+
+	err = p.runPublishHook(publishedStorageProvider, PublishHookPostRemove, nil)
+	if err != nil && progress != nil {
+		progress.ColoredPrintf("@y[!]@| @!%s@|", err)
+	}
+
+	return nil
+}
+
+func (p *PublishedRepo) removeFiles(publishedStorage aptly.PublishedStorage, removePrefix bool,
+	removePoolComponents []string, progress aptly.Progress) error {
 	// I. Easy: remove whole prefix (meta+packages)
 	if removePrefix {
 		err := publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "dists"), progress)
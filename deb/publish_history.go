@@ -0,0 +1,155 @@
+package deb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxPublishedRepoHistory is a number of previous source mappings kept for published repository
+const MaxPublishedRepoHistory = 10
+
+// PublishedRepoHistoryEntry is a previous state of published repository sources
+type PublishedRepoHistoryEntry struct {
+	// Map of sources by each component: component name -> source UUID
+	Sources map[string]string
+	// Time when sources were replaced
+	ReplacedAt time.Time
+	// User (or API client) who replaced sources
+	ReplacedBy string
+}
+
+// PublishedRepoHistoryItem is a human-readable history entry
+type PublishedRepoHistoryItem struct {
+	// Number of steps back to reach this state (1 is the most recent one)
+	Step int
+	// List of sources, removed snapshots/local repos have empty name
+	Sources []SourceEntry
+	// Time when sources were replaced
+	ReplacedAt time.Time
+	// User (or API client) who replaced sources
+	ReplacedBy string
+}
+
+func copySources(sources map[string]string) map[string]string {
+	result := make(map[string]string, len(sources))
+	for component, uuid := range sources {
+		result[component] = uuid
+	}
+
+	return result
+}
+
+func sameSources(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for component, uuid := range a {
+		if other, exists := b[component]; !exists || other != uuid {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RecordHistory saves sources stored previously to the history if they have changed
+//
+// It should be called right before saving published repository to the database,
+// history is trimmed to MaxPublishedRepoHistory entries
+func (p *PublishedRepo) RecordHistory(actor string) {
+	if p.savedSources != nil && !sameSources(p.savedSources, p.Sources) {
+		p.History = append(p.History, PublishedRepoHistoryEntry{
+			Sources:    p.savedSources,
+			ReplacedAt: time.Now(),
+			ReplacedBy: actor,
+		})
+
+		if len(p.History) > MaxPublishedRepoHistory {
+			p.History = append([]PublishedRepoHistoryEntry(nil), p.History[len(p.History)-MaxPublishedRepoHistory:]...)
+		}
+	}
+
+	p.savedSources = copySources(p.Sources)
+}
+
+// sourceName looks up name of snapshot or local repo by UUID
+func (p *PublishedRepo) sourceName(uuid string, collectionFactory *CollectionFactory) (string, error) {
+	if p.SourceKind == SourceSnapshot {
+		snapshot, err := collectionFactory.SnapshotCollection().ByUUID(uuid)
+		if err != nil {
+			return "", err
+		}
+		return snapshot.Name, nil
+	} else if p.SourceKind == SourceLocalRepo {
+		localRepo, err := collectionFactory.LocalRepoCollection().ByUUID(uuid)
+		if err != nil {
+			return "", err
+		}
+		return localRepo.Name, nil
+	}
+
+	return "", fmt.Errorf("unknown published repository type")
+}
+
+// HistoryItems returns history with source names resolved, most recent entry first
+func (p *PublishedRepo) HistoryItems(collectionFactory *CollectionFactory) []PublishedRepoHistoryItem {
+	result := make([]PublishedRepoHistoryItem, 0, len(p.History))
+
+	for i := len(p.History) - 1; i >= 0; i-- {
+		entry := p.History[i]
+
+		components := make([]string, 0, len(entry.Sources))
+		for component := range entry.Sources {
+			components = append(components, component)
+		}
+		sort.Strings(components)
+
+		sources := make([]SourceEntry, 0, len(components))
+		for _, component := range components {
+			name, _ := p.sourceName(entry.Sources[component], collectionFactory)
+			sources = append(sources, SourceEntry{Component: component, Name: name})
+		}
+
+		result = append(result, PublishedRepoHistoryItem{
+			Step:       len(p.History) - i,
+			Sources:    sources,
+			ReplacedAt: entry.ReplacedAt,
+			ReplacedBy: entry.ReplacedBy,
+		})
+	}
+
+	return result
+}
+
+// Rollback prepares revision which restores sources from the history
+//
+// steps is the number of entries to go back (1 is the most recent one),
+// revision should be applied with Update
+func (p *PublishedRepo) Rollback(steps int, collectionFactory *CollectionFactory) (*PublishedRepoRevision, error) {
+	if len(p.History) == 0 {
+		return nil, fmt.Errorf("no history recorded for published repository %s/%s", p.StoragePrefix(), p.Distribution)
+	}
+
+	if steps < 1 || steps > len(p.History) {
+		return nil, fmt.Errorf("invalid history step %d, should be between 1 and %d", steps, len(p.History))
+	}
+
+	entry := p.History[len(p.History)-steps]
+
+	sources := make(map[string]string, len(entry.Sources))
+	for component, uuid := range entry.Sources {
+		name, err := p.sourceName(uuid, collectionFactory)
+		if err != nil {
+			return nil, fmt.Errorf("source of component %s is not available anymore: %s", component, err)
+		}
+		sources[component] = name
+	}
+
+	p.Revision = &PublishedRepoRevision{
+		Sources: sources,
+	}
+
+	return p.Revision, nil
+}
@@ -0,0 +1,135 @@
+package deb
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *PublishedRepoSuite) historySnapshots(c *C) (*Snapshot, *Snapshot) {
+	snapA := NewSnapshotFromRefList("snap-a", nil, s.reflist, "A")
+	c.Assert(s.factory.SnapshotCollection().Add(snapA), IsNil)
+
+	snapB := NewSnapshotFromRefList("snap-b", nil, s.reflist, "B")
+	c.Assert(s.factory.SnapshotCollection().Add(snapB), IsNil)
+
+	return snapA, snapB
+}
+
+func (s *PublishedRepoSuite) TestRecordHistory(c *C) {
+	snapA, snapB := s.historySnapshots(c)
+
+	repo, err := NewPublishedRepo("", "ppa", "wheezy", nil, []string{"main"}, []interface{}{snapA}, s.factory, false)
+	c.Assert(err, IsNil)
+
+	repo.RecordHistory("alice")
+	c.Check(repo.History, HasLen, 0)
+
+	repo.UpdateSnapshot("main", snapB)
+	repo.RecordHistory("bob")
+	c.Assert(repo.History, HasLen, 1)
+	c.Check(repo.History[0].Sources, DeepEquals, map[string]string{"main": snapA.UUID})
+	c.Check(repo.History[0].ReplacedBy, Equals, "bob")
+	c.Check(repo.History[0].ReplacedAt.IsZero(), Equals, false)
+
+	// nothing changed since last record
+	repo.RecordHistory("bob")
+	c.Check(repo.History, HasLen, 1)
+
+	decoded := &PublishedRepo{}
+	c.Assert(decoded.Decode(repo.Encode()), IsNil)
+	c.Assert(decoded.History, HasLen, 1)
+	c.Check(decoded.History[0].Sources, DeepEquals, map[string]string{"main": snapA.UUID})
+	c.Check(decoded.History[0].ReplacedBy, Equals, "bob")
+
+	decoded.RecordHistory("bob")
+	c.Check(decoded.History, HasLen, 1)
+}
+
+func (s *PublishedRepoSuite) TestRecordHistoryBounded(c *C) {
+	snapA, snapB := s.historySnapshots(c)
+
+	repo, err := NewPublishedRepo("", "ppa", "wheezy", nil, []string{"main"}, []interface{}{snapA}, s.factory, false)
+	c.Assert(err, IsNil)
+
+	for i := 0; i < MaxPublishedRepoHistory+5; i++ {
+		if i%2 == 0 {
+			repo.UpdateSnapshot("main", snapB)
+		} else {
+			repo.UpdateSnapshot("main", snapA)
+		}
+		repo.RecordHistory("")
+	}
+
+	c.Check(repo.History, HasLen, MaxPublishedRepoHistory)
+	c.Check(repo.History[MaxPublishedRepoHistory-1].Sources["main"], Equals, snapA.UUID)
+}
+
+func (s *PublishedRepoSuite) TestHistoryItems(c *C) {
+	snapA, snapB := s.historySnapshots(c)
+
+	repo, err := NewPublishedRepo("", "ppa", "wheezy", nil, []string{"main"}, []interface{}{snapA}, s.factory, false)
+	c.Assert(err, IsNil)
+
+	repo.UpdateSnapshot("main", snapB)
+	repo.RecordHistory("alice")
+	repo.UpdateSnapshot("main", snapA)
+	repo.RecordHistory("bob")
+
+	items := repo.HistoryItems(s.factory)
+	c.Assert(items, HasLen, 2)
+	c.Check(items[0].Step, Equals, 1)
+	c.Check(items[0].Sources, DeepEquals, []SourceEntry{{Component: "main", Name: "snap-b"}})
+	c.Check(items[0].ReplacedBy, Equals, "bob")
+	c.Check(items[1].Step, Equals, 2)
+	c.Check(items[1].Sources, DeepEquals, []SourceEntry{{Component: "main", Name: "snap-a"}})
+
+	c.Assert(s.factory.SnapshotCollection().Drop(snapB), IsNil)
+	items = repo.HistoryItems(s.factory)
+	c.Check(items[0].Sources, DeepEquals, []SourceEntry{{Component: "main", Name: ""}})
+}
+
+func (s *PublishedRepoSuite) TestRollback(c *C) {
+	snapA, snapB := s.historySnapshots(c)
+
+	repo, err := NewPublishedRepo("", "ppa", "wheezy", nil, []string{"main"}, []interface{}{snapA}, s.factory, false)
+	c.Assert(err, IsNil)
+
+	_, err = repo.Rollback(1, s.factory)
+	c.Check(err, ErrorMatches, "no history recorded for published repository ppa/wheezy")
+
+	repo.UpdateSnapshot("main", snapB)
+	repo.RecordHistory("alice")
+
+	_, err = repo.Rollback(2, s.factory)
+	c.Check(err, ErrorMatches, "invalid history step 2, should be between 1 and 1")
+
+	revision, err := repo.Rollback(1, s.factory)
+	c.Assert(err, IsNil)
+	c.Check(revision.Sources, DeepEquals, map[string]string{"main": "snap-a"})
+
+	result, err := repo.Update(s.factory, nil)
+	c.Assert(err, IsNil)
+	c.Check(result.UpdatedSources, DeepEquals, map[string]string{"main": "snap-a"})
+	c.Check(repo.Sources, DeepEquals, map[string]string{"main": snapA.UUID})
+	c.Check(repo.Revision, IsNil)
+
+	// rollback is recorded as well, so it could be undone
+	repo.RecordHistory("bob")
+	c.Assert(repo.History, HasLen, 2)
+	c.Check(repo.History[1].Sources, DeepEquals, map[string]string{"main": snapB.UUID})
+}
+
+func (s *PublishedRepoSuite) TestRollbackRemovedSource(c *C) {
+	snapA, snapB := s.historySnapshots(c)
+
+	repo, err := NewPublishedRepo("", "ppa", "wheezy", nil, []string{"main"}, []interface{}{snapA}, s.factory, false)
+	c.Assert(err, IsNil)
+
+	repo.UpdateSnapshot("main", snapB)
+	repo.RecordHistory("alice")
+
+	c.Assert(s.factory.SnapshotCollection().Drop(snapA), IsNil)
+
+	_, err = repo.Rollback(1, s.factory)
+	c.Check(err, ErrorMatches, "source of component main is not available anymore: .*")
+	c.Check(repo.Revision, IsNil)
+}
@@ -0,0 +1,192 @@
+package deb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/pkg/errors"
+)
+
+// Publish hook events
+const (
+	PublishHookPrePublish  = "pre-publish"
+	PublishHookPostPublish = "post-publish"
+	PublishHookPreRemove   = "pre-remove"
+	PublishHookPostRemove  = "post-remove"
+)
+
+// DefaultPublishHookTimeout is used for hooks which don't configure timeout
+const DefaultPublishHookTimeout = time.Minute
+
+// PublishHookEvent is a payload passed to publish hooks
+type PublishHookEvent struct {
+	// One of pre-publish, post-publish, pre-remove, post-remove
+	Event        string
+	Storage      string
+	Prefix       string
+	Distribution string
+	Components   []string
+	SourceKind   string
+	// Map of sources by each component: component name -> source name
+	Sources map[string]string
+	// Number of package files by each component
+	FileCounts map[string]int
+}
+
+// PublishHookRunner is implemented by PublishedStorageProvider which runs hooks around publishing
+//
+// Error returned from pre-* hook aborts the operation
+type PublishHookRunner interface {
+	RunPublishHook(event *PublishHookEvent) error
+}
+
+// PublishHooks runs commands and HTTP requests configured in PublishHooks
+type PublishHooks struct {
+	hooks []utils.PublishHook
+}
+
+// Check interface
+var (
+	_ PublishHookRunner = &PublishHooks{}
+)
+
+// NewPublishHooks creates hook runner from configuration
+func NewPublishHooks(hooks []utils.PublishHook) *PublishHooks {
+	return &PublishHooks{hooks: hooks}
+}
+
+// RunPublishHook runs all the hooks configured for the event, stopping at first failure
+func (h *PublishHooks) RunPublishHook(event *PublishHookEvent) error {
+	var payload []byte
+
+	for _, hook := range h.hooks {
+		if hook.Event != event.Event {
+			continue
+		}
+
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(event)
+			if err != nil {
+				return err
+			}
+		}
+
+		timeout := time.Duration(hook.Timeout) * time.Second
+		if timeout == 0 {
+			timeout = DefaultPublishHookTimeout
+		}
+
+		var err error
+		if len(hook.Command) > 0 {
+			err = runCommandHook(hook.Command, event.Event, payload, timeout)
+		} else if hook.URL != "" {
+			err = runHTTPHook(hook.URL, event.Event, payload, timeout)
+		} else {
+			err = fmt.Errorf("neither command nor url is configured")
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "%s hook failed", event.Event)
+		}
+	}
+
+	return nil
+}
+
+func runCommandHook(command []string, event string, payload []byte, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), "APTLY_HOOK_EVENT="+event)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func runHTTPHook(url string, event string, payload []byte, timeout time.Duration) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Aptly-Hook-Event", event)
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %s: %s", url, resp.Status, bytes.TrimSpace(message))
+	}
+
+	return nil
+}
+
+// hookEvent builds payload for publish hook, file counts are taken from package lists if available
+func (p *PublishedRepo) hookEvent(event string, lists map[string]*PackageList) *PublishHookEvent {
+	result := &PublishHookEvent{
+		Event:        event,
+		Storage:      p.Storage,
+		Prefix:       p.Prefix,
+		Distribution: p.Distribution,
+		Components:   p.Components(),
+		SourceKind:   p.SourceKind,
+		Sources:      make(map[string]string, len(p.Sources)),
+		FileCounts:   make(map[string]int, len(p.Sources)),
+	}
+
+	for _, component := range result.Components {
+		item := p.sourceItems[component]
+		if item.snapshot != nil {
+			result.Sources[component] = item.snapshot.Name
+		} else if item.localRepo != nil {
+			result.Sources[component] = item.localRepo.Name
+		} else {
+			result.Sources[component] = p.Sources[component]
+		}
+
+		if list, ok := lists[component]; ok {
+			result.FileCounts[component] = list.Len()
+		} else if item.snapshot != nil || item.localRepo != nil {
+			if refList := p.RefList(component); refList != nil {
+				result.FileCounts[component] = refList.Len()
+			}
+		}
+	}
+
+	return result
+}
+
+// runPublishHook runs hook if publishedStorageProvider supports them
+func (p *PublishedRepo) runPublishHook(publishedStorageProvider aptly.PublishedStorageProvider, event string,
+	lists map[string]*PackageList) error {
+	runner, ok := publishedStorageProvider.(PublishHookRunner)
+	if !ok {
+		return nil
+	}
+
+	return runner.RunPublishHook(p.hookEvent(event, lists))
+}
@@ -0,0 +1,179 @@
+package deb
+
+import (
+	"bytes"
+	gocontext "context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+type hookStorageProvider struct {
+	*FakeStorageProvider
+	events []*PublishHookEvent
+	fail   string
+}
+
+func (p *hookStorageProvider) RunPublishHook(event *PublishHookEvent) error {
+	p.events = append(p.events, event)
+	if event.Event == p.fail {
+		return errors.New("hook failed")
+	}
+	return nil
+}
+
+func (s *PublishedRepoSuite) TestPublishHooks(c *C) {
+	provider := &hookStorageProvider{FakeStorageProvider: s.provider}
+
+	err := s.repo.Publish(gocontext.Background(), s.packagePool, provider, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+
+	c.Assert(provider.events, HasLen, 2)
+	c.Check(provider.events[0].Event, Equals, PublishHookPrePublish)
+	c.Check(provider.events[1].Event, Equals, PublishHookPostPublish)
+	c.Check(provider.events[1], DeepEquals, &PublishHookEvent{
+		Event:        PublishHookPostPublish,
+		Storage:      "",
+		Prefix:       "ppa",
+		Distribution: "squeeze",
+		Components:   []string{"main"},
+		SourceKind:   SourceSnapshot,
+		Sources:      map[string]string{"main": "snap"},
+		FileCounts:   map[string]int{"main": 3},
+	})
+}
+
+func (s *PublishedRepoSuite) TestPublishPreHookFails(c *C) {
+	provider := &hookStorageProvider{FakeStorageProvider: s.provider, fail: PublishHookPrePublish}
+
+	err := s.repo.Publish(gocontext.Background(), s.packagePool, provider, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, ErrorMatches, "hook failed")
+
+	c.Check(provider.events, HasLen, 1)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"), Not(PathExists))
+}
+
+func (s *PublishedRepoSuite) TestPublishPostHookFails(c *C) {
+	provider := &hookStorageProvider{FakeStorageProvider: s.provider, fail: PublishHookPostPublish}
+
+	err := s.repo.Publish(gocontext.Background(), s.packagePool, provider, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+
+	c.Check(provider.events, HasLen, 2)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"), PathExists)
+}
+
+func (s *PublishedRepoRemoveSuite) TestRemoveFilesHooks(c *C) {
+	provider := &hookStorageProvider{FakeStorageProvider: s.provider, fail: PublishHookPreRemove}
+
+	err := s.repo1.RemoveFiles(provider, false, []string{}, nil)
+	c.Assert(err, ErrorMatches, "hook failed")
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/anaconda"), PathExists)
+
+	provider.fail = ""
+	provider.events = nil
+
+	err = s.repo1.RemoveFiles(provider, false, []string{}, nil)
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/anaconda"), Not(PathExists))
+
+	c.Assert(provider.events, HasLen, 2)
+	c.Check(provider.events[0].Event, Equals, PublishHookPreRemove)
+	c.Check(provider.events[1].Event, Equals, PublishHookPostRemove)
+	c.Check(provider.events[1].Prefix, Equals, "ppa")
+	c.Check(provider.events[1].Distribution, Equals, "anaconda")
+}
+
+type PublishHooksSuite struct {
+	event *PublishHookEvent
+}
+
+var _ = Suite(&PublishHooksSuite{})
+
+func (s *PublishHooksSuite) SetUpTest(c *C) {
+	s.event = &PublishHookEvent{
+		Event:        PublishHookPostPublish,
+		Storage:      "s3:test",
+		Prefix:       "ppa",
+		Distribution: "squeeze",
+		Components:   []string{"main"},
+		SourceKind:   SourceSnapshot,
+		Sources:      map[string]string{"main": "snap"},
+		FileCounts:   map[string]int{"main": 3},
+	}
+}
+
+func (s *PublishHooksSuite) TestCommand(c *C) {
+	output := filepath.Join(c.MkDir(), "payload")
+
+	hooks := NewPublishHooks([]utils.PublishHook{
+		{Event: PublishHookPrePublish, Command: []string{"false"}},
+		{Event: PublishHookPostPublish, Command: []string{"sh", "-c", "cat > " + output + " && echo $APTLY_HOOK_EVENT >> " + output}},
+	})
+
+	c.Assert(hooks.RunPublishHook(s.event), IsNil)
+
+	payload, err := os.ReadFile(output)
+	c.Assert(err, IsNil)
+
+	var decoded PublishHookEvent
+	c.Assert(json.NewDecoder(bytes.NewReader(payload)).Decode(&decoded), IsNil)
+	c.Check(&decoded, DeepEquals, s.event)
+	c.Check(string(payload), Matches, "(?s).*}post-publish\n")
+}
+
+func (s *PublishHooksSuite) TestCommandFails(c *C) {
+	hooks := NewPublishHooks([]utils.PublishHook{
+		{Event: PublishHookPostPublish, Command: []string{"sh", "-c", "echo purge failed; exit 1"}},
+	})
+
+	c.Check(hooks.RunPublishHook(s.event), ErrorMatches, "post-publish hook failed: exit status 1: purge failed")
+}
+
+func (s *PublishHooksSuite) TestHTTP(c *C) {
+	var received *PublishHookEvent
+	var eventHeader string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		eventHeader = r.Header.Get("X-Aptly-Hook-Event")
+		received = &PublishHookEvent{}
+		if err := json.NewDecoder(r.Body).Decode(received); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if received.Prefix == "fail" {
+			http.Error(w, "inventory unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	hooks := NewPublishHooks([]utils.PublishHook{
+		{Event: PublishHookPostPublish, URL: server.URL, Timeout: 5},
+	})
+
+	c.Assert(hooks.RunPublishHook(s.event), IsNil)
+	c.Check(received, DeepEquals, s.event)
+	c.Check(eventHeader, Equals, PublishHookPostPublish)
+
+	received = nil
+	s.event.Event = PublishHookPreRemove
+	c.Assert(hooks.RunPublishHook(s.event), IsNil)
+	c.Check(received, IsNil)
+
+	s.event.Event = PublishHookPostPublish
+	s.event.Prefix = "fail"
+	c.Check(hooks.RunPublishHook(s.event), ErrorMatches, "post-publish hook failed: .* returned 503 Service Unavailable: inventory unavailable")
+}
+
+func (s *PublishHooksSuite) TestNotConfigured(c *C) {
+	hooks := NewPublishHooks([]utils.PublishHook{{Event: PublishHookPostPublish}})
+
+	c.Check(hooks.RunPublishHook(s.event), ErrorMatches, "post-publish hook failed: neither command nor url is configured")
+}
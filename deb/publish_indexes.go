@@ -0,0 +1,256 @@
+package deb
+
+import (
+	gocontext "context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/database"
+)
+
+// indexGenerator generates index files of published repository
+//
+// Components are processed by parallel workers, each component has its own set of
+// Packages, Contents and Release files, so output doesn't depend on scheduling.
+type indexGenerator struct {
+	ctx              gocontext.Context
+	repo             *PublishedRepo
+	publishedStorage aptly.PublishedStorage
+	packagePool      aptly.PackagePool
+	tempDB           database.Storage
+	indexes          *indexFiles
+	progress         aptly.Progress
+	forceOverwrite   bool
+
+	// legacy contents indexes are shared by all the components
+	legacyContentIndexesLock sync.Mutex
+	legacyContentIndexes     map[string]*ContentsIndex
+}
+
+// legacyContentIndex returns legacy contents index for the key, creating it if missing
+func (g *indexGenerator) legacyContentIndex(key string) *ContentsIndex {
+	g.legacyContentIndexesLock.Lock()
+	defer g.legacyContentIndexesLock.Unlock()
+
+	contentIndex := g.legacyContentIndexes[key]
+	if contentIndex == nil {
+		contentIndex = NewContentsIndex(g.tempDB)
+		g.legacyContentIndexes[key] = contentIndex
+	}
+
+	return contentIndex
+}
+
+// generateComponent links package files of the component and generates its index files
+func (g *indexGenerator) generateComponent(component string, list *PackageList) error {
+	p := g.repo
+	hadUdebs := false
+
+	// For all architectures, pregenerate packages/sources files
+	for _, arch := range p.Architectures {
+		g.indexes.PackageIndex(component, arch, false, false, p.Distribution)
+	}
+
+	list.PrepareIndex()
+
+	contentIndexes := map[string]*ContentsIndex{}
+
+	err := list.ForEachIndexed(func(pkg *Package) error {
+		if err := g.ctx.Err(); err != nil {
+			return err
+		}
+
+		if g.progress != nil {
+			g.progress.AddBar(1)
+		}
+
+		for _, arch := range p.Architectures {
+			if pkg.MatchesArchitecture(arch) {
+				hadUdebs = hadUdebs || pkg.IsUdeb
+
+				var relPath string
+				if !pkg.IsInstaller {
+					poolDir, err := pkg.PoolDirectory()
+					if err != nil {
+						return err
+					}
+					if p.MultiDist {
+						relPath = filepath.Join("pool", p.Distribution, component, poolDir)
+					} else {
+						relPath = filepath.Join("pool", component, poolDir)
+					}
+
+				} else {
+					if p.Distribution == aptly.DistributionFocal {
+						relPath = filepath.Join("dists", p.Distribution, component, fmt.Sprintf("%s-%s", pkg.Name, arch), "current", "legacy-images")
+					} else {
+						relPath = filepath.Join("dists", p.Distribution, component, fmt.Sprintf("%s-%s", pkg.Name, arch), "current", "images")
+					}
+				}
+
+				err := pkg.LinkFromPool(g.publishedStorage, g.packagePool, p.Prefix, relPath, g.forceOverwrite)
+				if err != nil {
+					return err
+				}
+				break
+			}
+		}
+
+		// Start a db batch. If we fill contents data we'll need
+		// to push each path of the package into the database.
+		// We'll want this batched so as to avoid an excessive
+		// amount of write() calls.
+		batch := g.tempDB.CreateBatch()
+
+		for _, arch := range p.Architectures {
+			if pkg.MatchesArchitecture(arch) {
+				if !p.SkipContents && !pkg.IsInstaller {
+					key := fmt.Sprintf("%s-%v", arch, pkg.IsUdeb)
+					qualifiedName := []byte(pkg.QualifiedName())
+					contents := pkg.Contents(g.packagePool, g.progress)
+
+					contentIndex := contentIndexes[key]
+					if contentIndex == nil {
+						contentIndex = NewContentsIndex(g.tempDB)
+						contentIndexes[key] = contentIndex
+					}
+
+					_ = contentIndex.Push(qualifiedName, contents, batch)
+					_ = g.legacyContentIndex(key).Push(qualifiedName, contents, batch)
+				}
+
+				bufWriter, err := g.indexes.PackageIndex(component, arch, pkg.IsUdeb, pkg.IsInstaller, p.Distribution).BufWriter()
+				if err != nil {
+					return err
+				}
+
+				err = pkg.Stanza().WriteTo(bufWriter, pkg.IsSource, false, pkg.IsInstaller)
+				if err != nil {
+					return err
+				}
+				err = bufWriter.WriteByte('\n')
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		pkg.files = nil
+		pkg.deps = nil
+		pkg.extra = nil
+		pkg.contents = nil
+
+		return batch.Write()
+	})
+
+	if err != nil {
+		return fmt.Errorf("unable to process packages: %s", err)
+	}
+
+	// contents indexes of different architectures are written in parallel
+	err = runParallel(len(p.Architectures), func(i int) error {
+		arch := p.Architectures[i]
+
+		for _, udeb := range []bool{true, false} {
+			index := contentIndexes[fmt.Sprintf("%s-%v", arch, udeb)]
+			if index == nil || index.Empty() {
+				continue
+			}
+
+			bufWriter, err := g.indexes.ContentsIndex(component, arch, udeb).BufWriter()
+			if err != nil {
+				return fmt.Errorf("unable to generate contents index: %v", err)
+			}
+
+			_, err = index.WriteTo(bufWriter)
+			if err != nil {
+				return fmt.Errorf("unable to generate contents index: %v", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	udebs := []bool{false}
+	if hadUdebs {
+		udebs = append(udebs, true)
+
+		// For all architectures, pregenerate .udeb indexes
+		for _, arch := range p.Architectures {
+			g.indexes.PackageIndex(component, arch, true, false, p.Distribution)
+		}
+	}
+
+	// For all architectures, generate Release files
+	for _, arch := range p.Architectures {
+		for _, udeb := range udebs {
+			release := make(Stanza)
+			release["Archive"] = p.Distribution
+			release["Architecture"] = arch
+			release["Component"] = component
+			release["Origin"] = p.GetOrigin()
+			release["Label"] = p.GetLabel()
+			release["Suite"] = p.GetSuite()
+			release["Codename"] = p.GetCodename()
+			if p.AcquireByHash {
+				release["Acquire-By-Hash"] = "yes"
+			}
+
+			bufWriter, err := g.indexes.ReleaseIndex(component, arch, udeb).BufWriter()
+			if err != nil {
+				return fmt.Errorf("unable to get ReleaseIndex writer: %s", err)
+			}
+
+			err = release.WriteTo(bufWriter, false, true, false)
+			if err != nil {
+				return fmt.Errorf("unable to create Release file: %s", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// runParallel calls fn for 0..n-1 with at most GOMAXPROCS calls running at once
+//
+// All the calls are completed, error of the call with lowest index is returned.
+func runParallel(n int, fn func(i int) error) error {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > n {
+		workers = n
+	}
+
+	errs := make([]error, n)
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
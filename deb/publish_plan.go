@@ -0,0 +1,377 @@
+package deb
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// PublishPlanFile describes single file change in the publish plan
+type PublishPlanFile struct {
+	// Path relative to the root of published storage
+	Path string
+	// Size of the file to be uploaded (0 if unknown)
+	Size int64
+	// MD5 checksum of the file to be uploaded (empty if unknown)
+	MD5 string `json:",omitempty"`
+}
+
+// PublishPlanChanges is a summary of storage-level changes publishing would do
+type PublishPlanChanges struct {
+	// Storage name
+	Storage string
+	// Files which don't exist in published storage yet
+	Upload []PublishPlanFile
+	// Files which exist in published storage, but have different contents
+	Replace []PublishPlanFile
+	// Files which exist, have different contents and would fail publishing unless forced
+	Conflict []PublishPlanFile
+	// Files which would be removed from published storage
+	Delete []PublishPlanFile
+	// Number of files which are already up to date
+	Unchanged int
+	// Total size of uploaded files (new & replaced)
+	UploadBytes int64
+}
+
+// PublishPlan is a PublishedStorageProvider which records all the changes
+// instead of writing them to the published storage
+//
+// Publish & cleanup code paths are run against the plan, so that result
+// reflects exactly what would happen to the storage.
+type PublishPlan struct {
+	provider aptly.PublishedStorageProvider
+	storages map[string]*planStorage
+	names    []string
+}
+
+// Check interface
+var _ aptly.PublishedStorageProvider = (*PublishPlan)(nil)
+
+// NewPublishPlan creates new plan recording changes to storages of provider
+func NewPublishPlan(provider aptly.PublishedStorageProvider) *PublishPlan {
+	return &PublishPlan{
+		provider: provider,
+		storages: make(map[string]*planStorage),
+	}
+}
+
+// GetPublishedStorage returns recording wrapper of published storage by name
+func (plan *PublishPlan) GetPublishedStorage(name string) aptly.PublishedStorage {
+	storage, ok := plan.storages[name]
+	if !ok {
+		storage = &planStorage{
+			storage: plan.provider.GetPublishedStorage(name),
+			put:     make(map[string]*planTarget),
+			deleted: make(map[string]bool),
+		}
+		plan.storages[name] = storage
+		plan.names = append(plan.names, name)
+	}
+
+	return storage
+}
+
+// Changes compares recorded state with contents of the published storages
+// and returns list of changes per storage
+func (plan *PublishPlan) Changes() ([]*PublishPlanChanges, error) {
+	result := make([]*PublishPlanChanges, 0, len(plan.names))
+
+	for _, name := range plan.names {
+		changes, err := plan.storages[name].changes()
+		if err != nil {
+			return nil, err
+		}
+		changes.Storage = name
+		result = append(result, changes)
+	}
+
+	return result, nil
+}
+
+// planTarget is a file as it would appear in published storage
+type planTarget struct {
+	// checksums of the file contents
+	checksums *utils.ChecksumInfo
+	// true if file is linked from package pool
+	pooled bool
+	// path in the storage this file is copy of (for renames and links to existing files)
+	existing string
+	force    bool
+}
+
+// planStorage records operations on published storage
+type planStorage struct {
+	sync.Mutex
+
+	storage aptly.PublishedStorage
+	put     map[string]*planTarget
+	deleted map[string]bool
+}
+
+// Check interface
+var _ aptly.PublishedStorage = (*planStorage)(nil)
+
+func (storage *planStorage) MkDir(_ string) error {
+	return nil
+}
+
+func (storage *planStorage) PutFile(path string, sourceFilename string) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	// source files are temporary, so checksums are collected right away
+	checksums, err := utils.ChecksumsForFile(sourceFilename)
+	if err != nil {
+		return err
+	}
+
+	storage.put[path] = &planTarget{checksums: &checksums}
+	delete(storage.deleted, path)
+	return nil
+}
+
+func (storage *planStorage) RemoveDirs(path string, _ aptly.Progress) error {
+	list, err := storage.Filelist(path)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range list {
+		if err = storage.Remove(filepath.Join(path, file)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (storage *planStorage) Remove(path string) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	delete(storage.put, path)
+	storage.deleted[path] = true
+	return nil
+}
+
+func (storage *planStorage) LinkFromPool(publishedPrefix, publishedRelPath, fileName string, _ aptly.PackagePool,
+	_ string, sourceChecksums utils.ChecksumInfo, force bool) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	path := filepath.Join(publishedPrefix, publishedRelPath, fileName)
+	checksums := sourceChecksums
+	storage.put[path] = &planTarget{checksums: &checksums, pooled: true, force: force}
+	delete(storage.deleted, path)
+	return nil
+}
+
+func (storage *planStorage) Filelist(prefix string) ([]string, error) {
+	list, err := storage.storage.Filelist(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	result := make([]string, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	for _, file := range list {
+		if !storage.deleted[filepath.Join(prefix, file)] {
+			result = append(result, file)
+			seen[file] = true
+		}
+	}
+
+	root := filepath.Clean(prefix) + "/"
+	for path := range storage.put {
+		if strings.HasPrefix(path, root) {
+			file := path[len(root):]
+			if !seen[file] {
+				result = append(result, file)
+			}
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// copyTarget records dst as a copy of src (either planned or existing file)
+func (storage *planStorage) copyTarget(src, dst string) {
+	if target, ok := storage.put[src]; ok {
+		copied := *target
+		storage.put[dst] = &copied
+	} else {
+		storage.put[dst] = &planTarget{existing: src}
+	}
+	delete(storage.deleted, dst)
+}
+
+func (storage *planStorage) RenameFile(oldName, newName string) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.copyTarget(oldName, newName)
+	delete(storage.put, oldName)
+	storage.deleted[oldName] = true
+	return nil
+}
+
+func (storage *planStorage) SymLink(src string, dst string) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.copyTarget(src, dst)
+	return nil
+}
+
+func (storage *planStorage) HardLink(src string, dst string) error {
+	return storage.SymLink(src, dst)
+}
+
+func (storage *planStorage) FileExists(path string) (bool, error) {
+	storage.Lock()
+	_, planned := storage.put[path]
+	deleted := storage.deleted[path]
+	storage.Unlock()
+
+	if planned {
+		return true, nil
+	}
+	if deleted {
+		return false, nil
+	}
+
+	return storage.storage.FileExists(path)
+}
+
+func (storage *planStorage) ReadLink(path string) (string, error) {
+	return storage.storage.ReadLink(path)
+}
+
+// existingMD5 returns MD5 of the file in published storage, if storage supports that
+func (storage *planStorage) existingMD5(path string) (string, bool, error) {
+	checksumStorage, ok := storage.storage.(aptly.ChecksumPublishedStorage)
+	if !ok {
+		return "", false, nil
+	}
+
+	md5, err := checksumStorage.FileMD5(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	return md5, md5 != "", nil
+}
+
+func (storage *planStorage) changes() (*PublishPlanChanges, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	result := &PublishPlanChanges{
+		Upload:   []PublishPlanFile{},
+		Replace:  []PublishPlanFile{},
+		Conflict: []PublishPlanFile{},
+		Delete:   []PublishPlanFile{},
+	}
+
+	paths := make([]string, 0, len(storage.put))
+	for path := range storage.put {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	deleted := make([]string, 0, len(storage.deleted))
+	for path := range storage.deleted {
+		deleted = append(deleted, path)
+	}
+	sort.Strings(deleted)
+
+	// list published storage once instead of checking each file separately
+	root := commonDir(append(append([]string{}, paths...), deleted...))
+	list, err := storage.storage.Filelist(root)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list files under %s: %s", root, err)
+	}
+	existing := make(map[string]bool, len(list))
+	for _, file := range list {
+		existing[filepath.Join(root, file)] = true
+	}
+
+	for _, path := range paths {
+		target := storage.put[path]
+		file := PublishPlanFile{Path: path}
+
+		if target.existing != "" {
+			// copy of the file already in the storage, contents are known to be the same
+			if target.existing == path {
+				result.Unchanged++
+				continue
+			}
+			result.Upload = append(result.Upload, file)
+			continue
+		}
+
+		file.Size = target.checksums.Size
+		file.MD5 = target.checksums.MD5
+
+		if !existing[path] {
+			result.Upload = append(result.Upload, file)
+			result.UploadBytes += file.Size
+			continue
+		}
+
+		md5, known, err := storage.existingMD5(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get checksum of %s: %s", path, err)
+		}
+
+		if known && md5 == file.MD5 {
+			result.Unchanged++
+			continue
+		}
+
+		if target.pooled && known && !target.force {
+			result.Conflict = append(result.Conflict, file)
+			continue
+		}
+
+		result.Replace = append(result.Replace, file)
+		result.UploadBytes += file.Size
+	}
+
+	for _, path := range deleted {
+		if existing[path] {
+			result.Delete = append(result.Delete, PublishPlanFile{Path: path})
+		}
+	}
+
+	return result, nil
+}
+
+// commonDir returns longest common directory of all the paths
+func commonDir(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+
+	common := strings.Split(filepath.Dir(paths[0]), "/")
+	for _, path := range paths[1:] {
+		parts := strings.Split(filepath.Dir(path), "/")
+		i := 0
+		for i < len(common) && i < len(parts) && common[i] == parts[i] {
+			i++
+		}
+		common = common[:i]
+	}
+
+	return filepath.Join(common...)
+}
@@ -0,0 +1,137 @@
+package deb
+
+import (
+	gocontext "context"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func planPaths(files []PublishPlanFile) []string {
+	result := make([]string, 0, len(files))
+	for _, file := range files {
+		result = append(result, file.Path)
+	}
+	return result
+}
+
+func planHas(files []PublishPlanFile, path string) bool {
+	for _, file := range files {
+		if file.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PublishedRepoSuite) TestPublishPlanFresh(c *C) {
+	plan := NewPublishPlan(s.provider)
+
+	err := s.repo.Publish(gocontext.Background(), s.packagePool, plan, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"), Not(PathExists))
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb"), Not(PathExists))
+
+	changes, err := plan.Changes()
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 1)
+	c.Check(changes[0].Storage, Equals, "")
+
+	c.Check(planHas(changes[0].Upload, "ppa/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb"), Equals, true)
+	c.Check(planHas(changes[0].Upload, "ppa/dists/squeeze/Release"), Equals, true)
+	c.Check(planHas(changes[0].Upload, "ppa/dists/squeeze/InRelease"), Equals, true)
+	c.Check(planHas(changes[0].Upload, "ppa/dists/squeeze/main/binary-i386/Packages.gz"), Equals, true)
+	c.Check(changes[0].Replace, HasLen, 0)
+	c.Check(changes[0].Delete, HasLen, 0)
+	c.Check(changes[0].Unchanged, Equals, 0)
+	c.Check(changes[0].UploadBytes > 0, Equals, true)
+}
+
+func (s *PublishedRepoSuite) TestPublishPlanRepublish(c *C) {
+	err := s.repo.Publish(gocontext.Background(), s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+
+	plan := NewPublishPlan(s.provider)
+	err = s.repo.Publish(gocontext.Background(), s.packagePool, plan, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+
+	changes, err := plan.Changes()
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 1)
+
+	c.Check(changes[0].Upload, HasLen, 0)
+	c.Check(planHas(changes[0].Replace, "ppa/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb"), Equals, false)
+	c.Check(planHas(changes[0].Replace, "ppa/dists/squeeze/main/binary-i386/Packages"), Equals, false)
+	c.Check(changes[0].Unchanged > 0, Equals, true)
+}
+
+func (s *PublishedRepoSuite) TestPublishPlanConflict(c *C) {
+	err := s.repo.Publish(gocontext.Background(), s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+
+	poolFile := filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb")
+	c.Assert(os.Remove(poolFile), IsNil)
+	c.Assert(os.WriteFile(poolFile, []byte("other"), 0644), IsNil)
+
+	plan := NewPublishPlan(s.provider)
+	err = s.repo.Publish(gocontext.Background(), s.packagePool, plan, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+
+	changes, err := plan.Changes()
+	c.Assert(err, IsNil)
+	c.Check(planPaths(changes[0].Conflict), DeepEquals, []string{"ppa/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb"})
+
+	plan = NewPublishPlan(s.provider)
+	err = s.repo.Publish(gocontext.Background(), s.packagePool, plan, s.factory, &NullSigner{}, nil, true, "")
+	c.Assert(err, IsNil)
+
+	changes, err = plan.Changes()
+	c.Assert(err, IsNil)
+	c.Check(changes[0].Conflict, HasLen, 0)
+	c.Check(planHas(changes[0].Replace, "ppa/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb"), Equals, true)
+}
+
+func (s *PublishedRepoSuite) TestPublishPlanCleanup(c *C) {
+	err := s.repo.Publish(gocontext.Background(), s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+	c.Assert(s.factory.PublishedRepoCollection().Add(s.repo), IsNil)
+
+	orphan := filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool/main/o/orphan/orphan_1.0_i386.deb")
+	c.Assert(os.MkdirAll(filepath.Dir(orphan), 0755), IsNil)
+	c.Assert(os.WriteFile(orphan, []byte("orphan"), 0644), IsNil)
+
+	plan := NewPublishPlan(s.provider)
+	err = s.factory.PublishedRepoCollection().CleanupPrefixComponentFiles(plan, s.repo, []string{"main"}, s.factory, nil)
+	c.Assert(err, IsNil)
+
+	c.Check(orphan, PathExists)
+
+	changes, err := plan.Changes()
+	c.Assert(err, IsNil)
+	c.Check(planPaths(changes[0].Delete), DeepEquals, []string{"ppa/pool/main/o/orphan/orphan_1.0_i386.deb"})
+}
+
+func (s *PublishedRepoSuite) TestPublishPlanRename(c *C) {
+	plan := NewPublishPlan(s.provider)
+	storage := plan.GetPublishedStorage("")
+
+	tmpFile := filepath.Join(c.MkDir(), "Release")
+	c.Assert(os.WriteFile(tmpFile, []byte("Release"), 0644), IsNil)
+
+	c.Assert(storage.PutFile("ppa/dists/squeeze/Release.tmp", tmpFile), IsNil)
+	c.Assert(storage.RenameFile("ppa/dists/squeeze/Release.tmp", "ppa/dists/squeeze/Release"), IsNil)
+
+	exists, err := storage.FileExists("ppa/dists/squeeze/Release")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, true)
+
+	exists, err = storage.FileExists("ppa/dists/squeeze/Release.tmp")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, false)
+
+	changes, err := plan.Changes()
+	c.Assert(err, IsNil)
+	c.Check(changes[0].Upload, DeepEquals, []PublishPlanFile{{Path: "ppa/dists/squeeze/Release", Size: 7, MD5: "b8e7b465df7c5979dc731d06e84ce2cf"}})
+}
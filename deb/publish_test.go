@@ -2,12 +2,17 @@ package deb
 
 import (
 	"bytes"
+	"compress/gzip"
+	gocontext "context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync/atomic"
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/database"
@@ -40,6 +45,9 @@ func (n *NullSigner) Init() error {
 func (n *NullSigner) SetKey(keyRef string) {
 }
 
+func (n *NullSigner) SetKeys(keyRefs []string) {
+}
+
 func (n *NullSigner) SetBatch(batch bool) {
 }
 
@@ -196,7 +204,7 @@ func (s *PublishedRepoSuite) TestNewPublishedRepo(c *C) {
 func (s *PublishedRepoSuite) TestMultiDistPool(c *C) {
 	repo, err := NewPublishedRepo("", "ppa", "squeeze", nil, []string{"main"}, []interface{}{s.snapshot}, s.factory, true)
 	c.Assert(err, IsNil)
-	err = repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, "")
+	err = repo.Publish(gocontext.Background(), s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, "")
 	c.Assert(err, IsNil)
 
 	publishedStorage := files.NewPublishedStorage(s.root, "", "")
@@ -379,7 +387,7 @@ func (s *PublishedRepoSuite) TestUpdate(c *C) {
 }
 
 func (s *PublishedRepoSuite) TestPublish(c *C) {
-	err := s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, "")
+	err := s.repo.Publish(gocontext.Background(), s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, "")
 	c.Assert(err, IsNil)
 
 	c.Check(s.repo.Architectures, DeepEquals, []string{"i386"})
@@ -425,8 +433,108 @@ func (s *PublishedRepoSuite) TestPublish(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *PublishedRepoSuite) TestPublishCancelled(c *C) {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+
+	err := s.repo.Publish(ctx, s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, ErrorMatches, ".*context canceled")
+
+	_, err = os.Stat(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *PublishedRepoSuite) TestPublishComponentsInParallel(c *C) {
+	s.repo3.SkipContents = false
+
+	readRelease := func() Stanza {
+		rf, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "linux/dists/natty/Release"))
+		c.Assert(err, IsNil)
+		defer func() { _ = rf.Close() }()
+
+		st, err := NewControlFileReader(rf, true, false).ReadStanza()
+		c.Assert(err, IsNil)
+		return st
+	}
+
+	err := s.repo3.Publish(gocontext.Background(), s.packagePool, s.provider, s.factory, nil, nil, false, "")
+	c.Assert(err, IsNil)
+
+	st := readRelease()
+	c.Check(st["Components"], Equals, "contrib main")
+
+	for _, component := range []string{"contrib", "main"} {
+		c.Check(filepath.Join(s.publishedStorage.PublicPath(), "linux/dists/natty", component, "binary-i386/Packages"), PathExists)
+		c.Check(filepath.Join(s.publishedStorage.PublicPath(), "linux/dists/natty", component, "binary-i386/Release"), PathExists)
+		c.Check(st["SHA256"], Matches, "(?s).* "+component+"/binary-i386/Packages.gz\n.*")
+	}
+
+	// output doesn't depend on scheduling of the workers
+	err = s.repo3.Publish(gocontext.Background(), s.packagePool, s.provider, s.factory, nil, nil, false, "")
+	c.Assert(err, IsNil)
+
+	st2 := readRelease()
+	c.Check(st2["SHA256"], Equals, st["SHA256"])
+	c.Check(st2["MD5Sum"], Equals, st["MD5Sum"])
+}
+
+func (s *PublishedRepoSuite) TestPublishComponentsContentsInParallel(c *C) {
+	s.repo3.SkipContents = false
+
+	// contents are cached in the database, so packages don't need real files,
+	// short paths fit into spare capacity of the index prefix
+	for i, p := range []*Package{s.p1, s.p2, s.p3} {
+		contents := []string{}
+		for j := 0; j < 200; j++ {
+			contents = append(contents, fmt.Sprintf("p%d/%03d", i, j))
+		}
+
+		var buf bytes.Buffer
+		c.Assert(codec.NewEncoder(&buf, s.packageCollection.codecHandle).Encode(contents), IsNil)
+		c.Assert(s.db.Put(p.Key("xC"), buf.Bytes()), IsNil)
+	}
+
+	err := s.repo3.Publish(gocontext.Background(), s.packagePool, s.provider, s.factory, nil, nil, false, "")
+	c.Assert(err, IsNil)
+
+	readContents := func(path string) string {
+		f, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "linux/dists/natty", path))
+		c.Assert(err, IsNil)
+		defer func() { _ = f.Close() }()
+
+		r, err := gzip.NewReader(f)
+		c.Assert(err, IsNil)
+		contents, err := io.ReadAll(r)
+		c.Assert(err, IsNil)
+		return string(contents)
+	}
+
+	legacy := readContents("Contents-i386.gz")
+	c.Check(strings.Count(legacy, "\n"), Equals, 601)
+	c.Check(legacy, Matches, "(?s)FILE LOCATION\np0/000 +\\S+\n.*")
+
+	// both components have the same packages, so legacy index matches theirs
+	c.Check(readContents("main/Contents-i386.gz"), Equals, legacy)
+	c.Check(readContents("contrib/Contents-i386.gz"), Equals, legacy)
+}
+
+func (s *PublishedRepoSuite) TestRunParallel(c *C) {
+	var calls int32
+	err := runParallel(100, func(i int) error {
+		atomic.AddInt32(&calls, 1)
+		if i%10 == 5 {
+			return fmt.Errorf("failed %d", i)
+		}
+		return nil
+	})
+	c.Check(err, ErrorMatches, "failed 5")
+	c.Check(calls, Equals, int32(100))
+
+	c.Check(runParallel(0, func(_ int) error { return fmt.Errorf("never called") }), IsNil)
+}
+
 func (s *PublishedRepoSuite) TestPublishNoSigner(c *C) {
-	err := s.repo.Publish(s.packagePool, s.provider, s.factory, nil, nil, false, "")
+	err := s.repo.Publish(gocontext.Background(), s.packagePool, s.provider, s.factory, nil, nil, false, "")
 	c.Assert(err, IsNil)
 
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"), PathExists)
@@ -434,7 +542,7 @@ func (s *PublishedRepoSuite) TestPublishNoSigner(c *C) {
 }
 
 func (s *PublishedRepoSuite) TestPublishLocalRepo(c *C) {
-	err := s.repo2.Publish(s.packagePool, s.provider, s.factory, nil, nil, false, "")
+	err := s.repo2.Publish(gocontext.Background(), s.packagePool, s.provider, s.factory, nil, nil, false, "")
 	c.Assert(err, IsNil)
 
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/maverick/Release"), PathExists)
@@ -442,7 +550,7 @@ func (s *PublishedRepoSuite) TestPublishLocalRepo(c *C) {
 }
 
 func (s *PublishedRepoSuite) TestPublishLocalSourceRepo(c *C) {
-	err := s.repo4.Publish(s.packagePool, s.provider, s.factory, nil, nil, false, "")
+	err := s.repo4.Publish(gocontext.Background(), s.packagePool, s.provider, s.factory, nil, nil, false, "")
 	c.Assert(err, IsNil)
 
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/maverick/Release"), PathExists)
@@ -450,7 +558,7 @@ func (s *PublishedRepoSuite) TestPublishLocalSourceRepo(c *C) {
 }
 
 func (s *PublishedRepoSuite) TestPublishOtherStorage(c *C) {
-	err := s.repo5.Publish(s.packagePool, s.provider, s.factory, nil, nil, false, "")
+	err := s.repo5.Publish(gocontext.Background(), s.packagePool, s.provider, s.factory, nil, nil, false, "")
 	c.Assert(err, IsNil)
 
 	c.Check(filepath.Join(s.publishedStorage2.PublicPath(), "ppa/dists/maverick/Release"), PathExists)
@@ -508,6 +616,22 @@ func (s *PublishedRepoSuite) TestEncodeDecode(c *C) {
 	c.Assert(repo2, DeepEquals, s.repo2)
 }
 
+func (s *PublishedRepoSuite) TestSigningKeys(c *C) {
+	encoded, err := json.Marshal(s.repo)
+	c.Assert(err, IsNil)
+	c.Check(strings.Contains(string(encoded), "SigningKeys"), Equals, false)
+
+	s.repo.SigningKeys = []string{"21DBB89C16DB3E6D", "F30E8CB9CDDE2AF8"}
+
+	repo := &PublishedRepo{}
+	c.Assert(repo.Decode(s.repo.Encode()), IsNil)
+	c.Check(repo.SigningKeys, DeepEquals, []string{"21DBB89C16DB3E6D", "F30E8CB9CDDE2AF8"})
+
+	encoded, err = json.Marshal(s.repo)
+	c.Assert(err, IsNil)
+	c.Check(strings.Contains(string(encoded), `"SigningKeys":["21DBB89C16DB3E6D","F30E8CB9CDDE2AF8"]`), Equals, true)
+}
+
 func (s *PublishedRepoSuite) TestPublishedRepoRevision(c *C) {
 	revision := s.repo2.ObtainRevision()
 	c.Assert(revision, NotNil)
@@ -3,6 +3,7 @@ package deb
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"sort"
 
 	"github.com/AlekSi/pointer"
@@ -89,6 +90,39 @@ func (l *PackageRefList) ForEach(handler func([]byte) error) error {
 	return err
 }
 
+// ForEachPackage calls handler for each package of reflist, packages are loaded
+// from collection one by one, so whole list is never kept in memory
+func (l *PackageRefList) ForEachPackage(collection *PackageCollection, handler func(*Package) error) error {
+	if l == nil {
+		return nil
+	}
+
+	return l.ForEach(func(key []byte) error {
+		p, err := collection.ByKey(key)
+		if err != nil {
+			return fmt.Errorf("unable to load package with key %s: %s", key, err)
+		}
+
+		return handler(p)
+	})
+}
+
+// CheckPackages verifies that all the packages referenced by reflist are present in collection,
+// without loading them
+func (l *PackageRefList) CheckPackages(collection *PackageCollection) error {
+	if l == nil {
+		return nil
+	}
+
+	return l.ForEach(func(key []byte) error {
+		if _, err := collection.db.Get(key); err != nil {
+			return fmt.Errorf("unable to load package with key %s: %s", key, err)
+		}
+
+		return nil
+	})
+}
+
 // Has checks whether package is part of reflist
 func (l *PackageRefList) Has(p *Package) bool {
 	key := p.Key("")
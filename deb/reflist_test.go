@@ -130,6 +130,36 @@ func (s *PackageRefListSuite) TestPackageRefListForeach(c *C) {
 	c.Check(err, Equals, e)
 }
 
+func (s *PackageRefListSuite) TestPackageRefListForEachPackage(c *C) {
+	db, _ := goleveldb.NewOpenDB(c.MkDir())
+	coll := NewPackageCollection(db)
+	_ = coll.Update(s.p1)
+	_ = coll.Update(s.p3)
+
+	_ = s.list.Add(s.p1)
+	_ = s.list.Add(s.p3)
+
+	reflist := NewPackageRefListFromPackageList(s.list)
+
+	names := []string{}
+	err := reflist.ForEachPackage(coll, func(p *Package) error {
+		names = append(names, p.Name)
+		return nil
+	})
+	c.Check(err, IsNil)
+	c.Check(names, DeepEquals, []string{"alien-arena-common", "mars-invaders"})
+	c.Check(reflist.CheckPackages(coll), IsNil)
+
+	_ = s.list.Add(s.p5)
+	reflist = NewPackageRefListFromPackageList(s.list)
+	err = reflist.ForEachPackage(coll, func(*Package) error { return nil })
+	c.Check(err, ErrorMatches, "unable to load package with key.*")
+	c.Check(reflist.CheckPackages(coll), ErrorMatches, "unable to load package with key.*")
+
+	c.Check((*PackageRefList)(nil).ForEachPackage(coll, func(*Package) error { return nil }), IsNil)
+	c.Check((*PackageRefList)(nil).CheckPackages(coll), IsNil)
+}
+
 func (s *PackageRefListSuite) TestHas(c *C) {
 	_ = s.list.Add(s.p1)
 	_ = s.list.Add(s.p3)
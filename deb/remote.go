@@ -272,7 +272,7 @@ func (repo *RemoteRepo) PackageURL(filename string) *url.URL {
 }
 
 // Fetch updates information about repository
-func (repo *RemoteRepo) Fetch(d aptly.Downloader, verifier pgp.Verifier, ignoreSignatures bool) error {
+func (repo *RemoteRepo) Fetch(ctx gocontext.Context, d aptly.Downloader, verifier pgp.Verifier, ignoreSignatures bool) error {
 	var (
 		release, inrelease, releasesig *os.File
 		err                            error
@@ -280,10 +280,10 @@ func (repo *RemoteRepo) Fetch(d aptly.Downloader, verifier pgp.Verifier, ignoreS
 
 	if ignoreSignatures {
 		// 0. Just download release file to temporary URL
-		release, err = http.DownloadTemp(gocontext.TODO(), d, repo.ReleaseURL("Release").String())
+		release, err = http.DownloadTemp(ctx, d, repo.ReleaseURL("Release").String())
 		if err != nil {
 			// 0.1 try downloading InRelease, ignore and strip signature
-			inrelease, err = http.DownloadTemp(gocontext.TODO(), d, repo.ReleaseURL("InRelease").String())
+			inrelease, err = http.DownloadTemp(ctx, d, repo.ReleaseURL("InRelease").String())
 			if err != nil {
 				return err
 			}
@@ -298,7 +298,7 @@ func (repo *RemoteRepo) Fetch(d aptly.Downloader, verifier pgp.Verifier, ignoreS
 		}
 	} else {
 		// 1. try InRelease file
-		inrelease, err = http.DownloadTemp(gocontext.TODO(), d, repo.ReleaseURL("InRelease").String())
+		inrelease, err = http.DownloadTemp(ctx, d, repo.ReleaseURL("InRelease").String())
 		if err != nil {
 			goto splitsignature
 		}
@@ -320,12 +320,12 @@ func (repo *RemoteRepo) Fetch(d aptly.Downloader, verifier pgp.Verifier, ignoreS
 
 	splitsignature:
 		// 2. try Release + Release.gpg
-		release, err = http.DownloadTemp(gocontext.TODO(), d, repo.ReleaseURL("Release").String())
+		release, err = http.DownloadTemp(ctx, d, repo.ReleaseURL("Release").String())
 		if err != nil {
 			return err
 		}
 
-		releasesig, err = http.DownloadTemp(gocontext.TODO(), d, repo.ReleaseURL("Release.gpg").String())
+		releasesig, err = http.DownloadTemp(ctx, d, repo.ReleaseURL("Release.gpg").String())
 		if err != nil {
 			return err
 		}
@@ -448,7 +448,7 @@ ok:
 }
 
 // DownloadPackageIndexes downloads & parses package index files
-func (repo *RemoteRepo) DownloadPackageIndexes(progress aptly.Progress, d aptly.Downloader, verifier pgp.Verifier, _ *CollectionFactory, ignoreSignatures bool, ignoreChecksums bool) error {
+func (repo *RemoteRepo) DownloadPackageIndexes(ctx gocontext.Context, progress aptly.Progress, d aptly.Downloader, verifier pgp.Verifier, _ *CollectionFactory, ignoreSignatures bool, ignoreChecksums bool) error {
 	if repo.packageList != nil {
 		panic("packageList != nil")
 	}
@@ -481,7 +481,7 @@ func (repo *RemoteRepo) DownloadPackageIndexes(progress aptly.Progress, d aptly.
 
 	for _, info := range packagesPaths {
 		path, kind, component, architecture := info[0], info[1], info[2], info[3]
-		packagesReader, packagesFile, err := http.DownloadTryCompression(gocontext.TODO(), d, repo.IndexesRootURL(), path, repo.ReleaseFiles, ignoreChecksums)
+		packagesReader, packagesFile, err := http.DownloadTryCompression(ctx, d, repo.IndexesRootURL(), path, repo.ReleaseFiles, ignoreChecksums)
 
 		isInstaller := kind == PackageTypeInstaller
 		if err != nil {
@@ -494,7 +494,7 @@ func (repo *RemoteRepo) DownloadPackageIndexes(progress aptly.Progress, d aptly.
 
 				// some repos do not have installer hashsum file listed in release file but provide a separate gpg file
 				hashsumPath := repo.IndexesRootURL().ResolveReference(&url.URL{Path: path}).String()
-				packagesFile, err = http.DownloadTemp(gocontext.TODO(), d, hashsumPath)
+				packagesFile, err = http.DownloadTemp(ctx, d, hashsumPath)
 				if err != nil {
 					if herr, ok := err.(*http.Error); ok && (herr.Code == 404 || herr.Code == 403) {
 						// installer files are not available in all components and architectures
@@ -508,7 +508,7 @@ func (repo *RemoteRepo) DownloadPackageIndexes(progress aptly.Progress, d aptly.
 				if verifier != nil && !ignoreSignatures {
 					hashsumGpgPath := repo.IndexesRootURL().ResolveReference(&url.URL{Path: path + ".gpg"}).String()
 					var filesig *os.File
-					filesig, err = http.DownloadTemp(gocontext.TODO(), d, hashsumGpgPath)
+					filesig, err = http.DownloadTemp(ctx, d, hashsumGpgPath)
 					if err != nil {
 						return err
 					}
@@ -669,7 +669,7 @@ func (repo *RemoteRepo) FinalizeDownload(collectionFactory *CollectionFactory, p
 	repo.LastDownloadDate = time.Now()
 
 	if progress != nil {
-		progress.InitBar(int64(repo.packageList.Len()), true, aptly.BarMirrorUpdateFinalizeDownload)
+		progress.InitBar(int64(repo.packageList.Len()), false, aptly.BarMirrorUpdateFinalizeDownload)
 	}
 
 	var i int
@@ -0,0 +1,264 @@
+package deb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/google/uuid"
+	"github.com/ugorji/go/codec"
+)
+
+// MaxWebhookDeliveries is a number of deliveries kept in the log of each webhook
+const MaxWebhookDeliveries = 100
+
+// Webhook is a subscription to aptly events delivered with HTTP POST
+type Webhook struct {
+	// Permanent internal ID
+	UUID string `codec:"UUID" json:"-"`
+	// User-assigned name
+	Name string
+	// URL payloads are posted to
+	URL string
+	// Secret used to sign payloads with HMAC-SHA256
+	Secret string `codec:",omitempty" json:"-"`
+	// Events webhook is subscribed to, as "type.action" patterns, e.g. "mirror.updated", "publish.*", "task.failed"
+	Events []string
+	// Disabled webhooks don't receive events
+	Disabled bool `codec:",omitempty"`
+}
+
+// WebhookDelivery is an entry of webhook delivery log
+type WebhookDelivery struct {
+	// Delivery ID, sent with the payload
+	ID string
+	// Event name, "type.action"
+	Event string
+	// Event ID in the event stream
+	EventID int64
+	// Time when delivery was started
+	Time time.Time
+	// Number of attempts made
+	Attempts int
+	// HTTP status of last attempt, 0 if no response was received
+	StatusCode int `codec:",omitempty"`
+	// Error of last attempt, empty if payload was delivered
+	Error string `codec:",omitempty"`
+	// Whether payload was delivered
+	Delivered bool
+}
+
+// NewWebhook creates new webhook
+func NewWebhook(name, webhookURL, secret string, events []string) *Webhook {
+	return &Webhook{
+		UUID:   uuid.NewString(),
+		Name:   name,
+		URL:    webhookURL,
+		Secret: secret,
+		Events: events,
+	}
+}
+
+// String interface
+func (w *Webhook) String() string {
+	return fmt.Sprintf("[%s]: %s", w.Name, w.URL)
+}
+
+// Validate checks webhook URL and event patterns
+func (w *Webhook) Validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("webhook name is required")
+	}
+
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook URL should be http:// or https://, got %q", w.URL)
+	}
+
+	if len(w.Events) == 0 {
+		return fmt.Errorf("webhook should be subscribed to at least one event")
+	}
+
+	for _, pattern := range w.Events {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid event pattern %q: %s", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// Matches checks whether webhook is subscribed to the event
+func (w *Webhook) Matches(event string) bool {
+	if w.Disabled {
+		return false
+	}
+
+	for _, pattern := range w.Events {
+		if matched, _ := path.Match(pattern, event); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Encode does msgpack encoding of Webhook
+func (w *Webhook) Encode() []byte {
+	var buf bytes.Buffer
+
+	encoder := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	_ = encoder.Encode(w)
+
+	return buf.Bytes()
+}
+
+// Decode decodes msgpack representation into Webhook
+func (w *Webhook) Decode(input []byte) error {
+	decoder := codec.NewDecoderBytes(input, &codec.MsgpackHandle{})
+	return decoder.Decode(w)
+}
+
+// Key is a unique id in DB
+func (w *Webhook) Key() []byte {
+	return []byte("H" + w.UUID)
+}
+
+// DeliveriesKey is a unique id of webhook delivery log
+func (w *Webhook) DeliveriesKey() []byte {
+	return []byte("h" + w.UUID)
+}
+
+// WebhookCollection does listing, updating/adding/deleting of Webhooks
+type WebhookCollection struct {
+	db database.Storage
+}
+
+// NewWebhookCollection creates collection of webhooks stored in DB
+func NewWebhookCollection(db database.Storage) *WebhookCollection {
+	return &WebhookCollection{db: db}
+}
+
+// Add appends new webhook to collection and saves it
+func (collection *WebhookCollection) Add(webhook *Webhook) error {
+	if _, err := collection.ByName(webhook.Name); err == nil {
+		return fmt.Errorf("webhook with name %s already exists", webhook.Name)
+	}
+
+	return collection.Update(webhook)
+}
+
+// Update stores updated information about webhook in DB
+func (collection *WebhookCollection) Update(webhook *Webhook) error {
+	return collection.db.Put(webhook.Key(), webhook.Encode())
+}
+
+// ByName looks up webhook by name
+func (collection *WebhookCollection) ByName(name string) (*Webhook, error) {
+	var result *Webhook
+
+	_ = collection.ForEach(func(w *Webhook) error {
+		if w.Name == name {
+			result = w
+			return errors.New("abort")
+		}
+		return nil
+	})
+
+	if result == nil {
+		return nil, fmt.Errorf("webhook with name %s not found", name)
+	}
+
+	return result, nil
+}
+
+// ForEach runs method for each webhook
+func (collection *WebhookCollection) ForEach(handler func(*Webhook) error) error {
+	return collection.db.ProcessByPrefix([]byte("H"), func(_, blob []byte) error {
+		w := &Webhook{}
+		if err := w.Decode(blob); err != nil {
+			log.Printf("Error decoding webhook: %s\n", err)
+			return nil
+		}
+
+		return handler(w)
+	})
+}
+
+// Len returns number of webhooks
+func (collection *WebhookCollection) Len() int {
+	return len(collection.db.KeysByPrefix([]byte("H")))
+}
+
+// Drop removes webhook and its delivery log from collection
+func (collection *WebhookCollection) Drop(webhook *Webhook) error {
+	if _, err := collection.db.Get(webhook.Key()); err != nil {
+		if err == database.ErrNotFound {
+			return errors.New("webhook not found")
+		}
+
+		return err
+	}
+
+	batch := collection.db.CreateBatch()
+	_ = batch.Delete(webhook.Key())
+	_ = batch.Delete(webhook.DeliveriesKey())
+	return batch.Write()
+}
+
+// Deliveries returns delivery log of the webhook, most recent delivery first
+func (collection *WebhookCollection) Deliveries(webhook *Webhook) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+
+	encoded, err := collection.db.Get(webhook.DeliveriesKey())
+	if err == database.ErrNotFound {
+		return []WebhookDelivery{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := codec.NewDecoderBytes(encoded, &codec.MsgpackHandle{})
+	if err = decoder.Decode(&deliveries); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(deliveries, func(i, j int) bool { return deliveries[i].Time.After(deliveries[j].Time) })
+
+	return deliveries, nil
+}
+
+// AddDelivery records delivery in the webhook log, log is trimmed to MaxWebhookDeliveries entries
+func (collection *WebhookCollection) AddDelivery(webhook *Webhook, delivery WebhookDelivery) error {
+	if _, err := collection.db.Get(webhook.Key()); err != nil {
+		if err == database.ErrNotFound {
+			return errors.New("webhook not found")
+		}
+
+		return err
+	}
+
+	deliveries, err := collection.Deliveries(webhook)
+	if err != nil {
+		return err
+	}
+
+	deliveries = append([]WebhookDelivery{delivery}, deliveries...)
+	if len(deliveries) > MaxWebhookDeliveries {
+		deliveries = deliveries[:MaxWebhookDeliveries]
+	}
+
+	var buf bytes.Buffer
+	encoder := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	if err = encoder.Encode(deliveries); err != nil {
+		return err
+	}
+
+	return collection.db.Put(webhook.DeliveriesKey(), buf.Bytes())
+}
@@ -0,0 +1,105 @@
+package deb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+
+	. "gopkg.in/check.v1"
+)
+
+type WebhookSuite struct {
+	db         database.Storage
+	collection *WebhookCollection
+}
+
+var _ = Suite(&WebhookSuite{})
+
+func (s *WebhookSuite) SetUpTest(c *C) {
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+	s.collection = NewWebhookCollection(s.db)
+}
+
+func (s *WebhookSuite) TearDownTest(c *C) {
+	_ = s.db.Close()
+}
+
+func (s *WebhookSuite) TestValidate(c *C) {
+	c.Check(NewWebhook("ci", "https://ci.example.com/hook", "", []string{"mirror.updated"}).Validate(), IsNil)
+	c.Check(NewWebhook("", "https://ci.example.com/hook", "", []string{"mirror.updated"}).Validate(), ErrorMatches, "webhook name is required")
+	c.Check(NewWebhook("ci", "ftp://ci.example.com/hook", "", []string{"*"}).Validate(), ErrorMatches, "webhook URL should be .*")
+	c.Check(NewWebhook("ci", "http://", "", []string{"*"}).Validate(), ErrorMatches, "webhook URL should be .*")
+	c.Check(NewWebhook("ci", "http://ci", "", nil).Validate(), ErrorMatches, "webhook should be subscribed to at least one event")
+	c.Check(NewWebhook("ci", "http://ci", "", []string{"task.[failed"}).Validate(), ErrorMatches, "invalid event pattern .*")
+}
+
+func (s *WebhookSuite) TestMatches(c *C) {
+	webhook := NewWebhook("ci", "http://ci", "", []string{"mirror.updated", "publish.*", "task.failed"})
+
+	c.Check(webhook.Matches("mirror.updated"), Equals, true)
+	c.Check(webhook.Matches("mirror.dropped"), Equals, false)
+	c.Check(webhook.Matches("publish.created"), Equals, true)
+	c.Check(webhook.Matches("task.failed"), Equals, true)
+	c.Check(webhook.Matches("task.succeeded"), Equals, false)
+
+	webhook.Disabled = true
+	c.Check(webhook.Matches("mirror.updated"), Equals, false)
+}
+
+func (s *WebhookSuite) TestCollection(c *C) {
+	_, err := s.collection.ByName("ci")
+	c.Check(err, ErrorMatches, "webhook with name ci not found")
+
+	webhook := NewWebhook("ci", "http://ci", "secret", []string{"*"})
+	c.Assert(s.collection.Add(webhook), IsNil)
+	c.Check(s.collection.Add(NewWebhook("ci", "http://other", "", []string{"*"})), ErrorMatches, "webhook with name ci already exists")
+	c.Assert(s.collection.Add(NewWebhook("release", "http://release", "", []string{"publish.*"})), IsNil)
+	c.Check(s.collection.Len(), Equals, 2)
+
+	w, err := NewWebhookCollection(s.db).ByName("ci")
+	c.Assert(err, IsNil)
+	c.Check(w, DeepEquals, webhook)
+
+	w.Disabled = true
+	c.Assert(s.collection.Update(w), IsNil)
+	w, _ = s.collection.ByName("ci")
+	c.Check(w.Disabled, Equals, true)
+
+	c.Assert(s.collection.AddDelivery(w, WebhookDelivery{ID: "1", Event: "task.failed", Time: time.Now()}), IsNil)
+	c.Assert(s.collection.Drop(w), IsNil)
+	c.Check(s.collection.Drop(w), ErrorMatches, "webhook not found")
+	c.Check(s.collection.Len(), Equals, 1)
+
+	deliveries, err := s.collection.Deliveries(w)
+	c.Assert(err, IsNil)
+	c.Check(deliveries, HasLen, 0)
+
+	// log of dropped webhook is not recreated
+	c.Check(s.collection.AddDelivery(w, WebhookDelivery{ID: "2", Event: "task.failed", Time: time.Now()}), ErrorMatches, "webhook not found")
+}
+
+func (s *WebhookSuite) TestDeliveries(c *C) {
+	webhook := NewWebhook("ci", "http://ci", "", []string{"*"})
+	c.Assert(s.collection.Add(webhook), IsNil)
+
+	start := time.Now()
+	for i := 0; i < MaxWebhookDeliveries+5; i++ {
+		c.Assert(s.collection.AddDelivery(webhook, WebhookDelivery{
+			ID:        fmt.Sprintf("%d", i),
+			Event:     "mirror.updated",
+			EventID:   int64(i),
+			Time:      start.Add(time.Duration(i) * time.Second),
+			Attempts:  1,
+			Delivered: true,
+		}), IsNil)
+	}
+
+	deliveries, err := s.collection.Deliveries(webhook)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, MaxWebhookDeliveries)
+	c.Check(deliveries[0].ID, Equals, fmt.Sprintf("%d", MaxWebhookDeliveries+4))
+	c.Check(deliveries[MaxWebhookDeliveries-1].ID, Equals, "5")
+	c.Check(deliveries[0].Delivered, Equals, true)
+}
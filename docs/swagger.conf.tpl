@@ -24,5 +24,9 @@ package docs
 // @Tag.description.markdown
 // @Tag.name Tasks
 // @Tag.description.markdown
+// @Tag.name Events
+// @Tag.description.markdown
+// @Tag.name Webhooks
+// @Tag.description.markdown
 
 // version will be appended here:
@@ -43,6 +43,11 @@ func NewPackagePool(root string, supportLegacyPaths bool) *PackagePool {
 	}
 }
 
+// String returns the pool as string
+func (pool *PackagePool) String() string {
+	return pool.rootPath
+}
+
 // LegacyPath returns path relative to pool's root for pre-1.1 aptly (based on MD5)
 func (pool *PackagePool) LegacyPath(filename string, checksums *utils.ChecksumInfo) (string, error) {
 	filename = filepath.Base(filename)
@@ -0,0 +1,92 @@
+package files
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// Check interface
+var (
+	_ aptly.LegacyPackagePool = (*PackagePool)(nil)
+)
+
+// PlanRelocation verifies file stored at legacy path and returns its path in current pool layout
+//
+// File is re-hashed and compared with checksums (which are filled back with complete
+// checksums of the file). If the file is already present at new path, duplicate is set.
+func (pool *PackagePool) PlanRelocation(legacyPath, basename string, checksums *utils.ChecksumInfo) (string, bool, error) {
+	actual, err := utils.ChecksumsForFile(pool.FullPath(legacyPath))
+	if err != nil {
+		return "", false, err
+	}
+
+	if !checksums.Matches(&actual) {
+		return "", false, fmt.Errorf("file %s doesn't match package checksums", legacyPath)
+	}
+	*checksums = actual
+
+	newPath, err := pool.buildPoolPath(basename, checksums)
+	if err != nil {
+		return "", false, err
+	}
+
+	if _, err = os.Stat(pool.FullPath(newPath)); err != nil {
+		if os.IsNotExist(err) {
+			return newPath, false, nil
+		}
+		return "", false, err
+	}
+
+	existing, err := utils.ChecksumsForFile(pool.FullPath(newPath))
+	if err != nil {
+		return "", false, err
+	}
+
+	if existing != actual {
+		return "", false, fmt.Errorf("file %s already exists with different contents than %s", newPath, legacyPath)
+	}
+
+	return newPath, true, nil
+}
+
+// RelocateLegacy moves file from legacy path to new path returning number of bytes reclaimed
+//
+// If file is already present at new path, legacy copy is removed. Space is reclaimed only
+// if legacy copy is not a hardlink to the file at new path.
+func (pool *PackagePool) RelocateLegacy(legacyPath, newPath string, checksums *utils.ChecksumInfo, checksumStorage aptly.ChecksumStorage) (int64, error) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	legacyFullPath, newFullPath := pool.FullPath(legacyPath), pool.FullPath(newPath)
+
+	legacyInfo, err := os.Stat(legacyFullPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var reclaimed int64
+
+	newInfo, err := os.Stat(newFullPath)
+	if err == nil {
+		if !os.SameFile(legacyInfo, newInfo) {
+			reclaimed = legacyInfo.Size()
+		}
+
+		err = os.Remove(legacyFullPath)
+	} else if os.IsNotExist(err) {
+		err = os.MkdirAll(filepath.Dir(newFullPath), 0777)
+		if err == nil {
+			err = os.Rename(legacyFullPath, newFullPath)
+		}
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return reclaimed, checksumStorage.Update(newPath, checksums)
+}
@@ -0,0 +1,90 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+const (
+	legacyDebPath = "00/35/libboost-program-options-dev_1.49.0.1_i386.deb"
+	modernDebPath = "c7/6b/4bd12fd92e4dfe1b55b18a67a669_libboost-program-options-dev_1.49.0.1_i386.deb"
+)
+
+func (s *PackagePoolSuite) putLegacy(c *C) {
+	c.Assert(os.MkdirAll(filepath.Join(s.pool.rootPath, "00", "35"), 0755), IsNil)
+	c.Assert(utils.CopyFile(s.debFile, s.pool.FullPath(legacyDebPath)), IsNil)
+}
+
+func (s *PackagePoolSuite) TestRelocateLegacy(c *C) {
+	s.putLegacy(c)
+
+	newPath, duplicate, err := s.pool.PlanRelocation(legacyDebPath, filepath.Base(s.debFile), &s.checksum)
+	c.Assert(err, IsNil)
+	c.Check(newPath, Equals, modernDebPath)
+	c.Check(duplicate, Equals, false)
+	c.Check(s.checksum.SHA512, Equals, "d7302241373da972aa9b9e71d2fd769b31a38f71182aa71bc0d69d090d452c69bb74b8612c002ccf8a89c279ced84ac27177c8b92d20f00023b3d268e6cec69c")
+
+	reclaimed, err := s.pool.RelocateLegacy(legacyDebPath, newPath, &s.checksum, s.cs)
+	c.Assert(err, IsNil)
+	c.Check(reclaimed, Equals, int64(0))
+
+	list, err := s.pool.FilepathList(nil)
+	c.Assert(err, IsNil)
+	c.Check(list, DeepEquals, []string{modernDebPath})
+	c.Check(s.cs.(*MockChecksumStorage).Store[modernDebPath], DeepEquals, s.checksum)
+}
+
+func (s *PackagePoolSuite) TestRelocateLegacyDuplicate(c *C) {
+	s.putLegacy(c)
+
+	c.Assert(os.MkdirAll(filepath.Dir(s.pool.FullPath(modernDebPath)), 0755), IsNil)
+	c.Assert(utils.CopyFile(s.debFile, s.pool.FullPath(modernDebPath)), IsNil)
+
+	newPath, duplicate, err := s.pool.PlanRelocation(legacyDebPath, filepath.Base(s.debFile), &s.checksum)
+	c.Assert(err, IsNil)
+	c.Check(newPath, Equals, modernDebPath)
+	c.Check(duplicate, Equals, true)
+
+	reclaimed, err := s.pool.RelocateLegacy(legacyDebPath, newPath, &s.checksum, s.cs)
+	c.Assert(err, IsNil)
+	c.Check(reclaimed, Equals, int64(2738))
+
+	list, err := s.pool.FilepathList(nil)
+	c.Assert(err, IsNil)
+	c.Check(list, DeepEquals, []string{modernDebPath})
+}
+
+func (s *PackagePoolSuite) TestRelocateLegacyHardlink(c *C) {
+	s.putLegacy(c)
+	c.Assert(os.MkdirAll(filepath.Dir(s.pool.FullPath(modernDebPath)), 0755), IsNil)
+	c.Assert(os.Link(s.pool.FullPath(legacyDebPath), s.pool.FullPath(modernDebPath)), IsNil)
+
+	newPath, duplicate, err := s.pool.PlanRelocation(legacyDebPath, filepath.Base(s.debFile), &s.checksum)
+	c.Assert(err, IsNil)
+	c.Check(duplicate, Equals, true)
+
+	// hardlinks share the space
+	reclaimed, err := s.pool.RelocateLegacy(legacyDebPath, newPath, &s.checksum, s.cs)
+	c.Assert(err, IsNil)
+	c.Check(reclaimed, Equals, int64(0))
+}
+
+func (s *PackagePoolSuite) TestPlanRelocationErrors(c *C) {
+	_, _, err := s.pool.PlanRelocation(legacyDebPath, filepath.Base(s.debFile), &s.checksum)
+	c.Check(err, ErrorMatches, ".*no such file or directory")
+
+	s.putLegacy(c)
+
+	_, _, err = s.pool.PlanRelocation(legacyDebPath, filepath.Base(s.debFile), &utils.ChecksumInfo{MD5: "00350000000000000000000000000000"})
+	c.Check(err, ErrorMatches, "file 00/35/libboost-program-options-dev_1.49.0.1_i386.deb doesn't match package checksums")
+
+	c.Assert(os.MkdirAll(filepath.Dir(s.pool.FullPath(modernDebPath)), 0755), IsNil)
+	c.Assert(os.WriteFile(s.pool.FullPath(modernDebPath), []byte("garbage"), 0644), IsNil)
+
+	_, _, err = s.pool.PlanRelocation(legacyDebPath, filepath.Base(s.debFile), &s.checksum)
+	c.Check(err, ErrorMatches, "file c7/6b/.* already exists with different contents than 00/35/.*")
+}
@@ -0,0 +1,253 @@
+package files
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// PoolMigration copies package files from one package pool to another
+//
+// Every file is downloaded from the source pool, checksummed, imported into
+// the destination pool and read back to verify it. Migrated files are recorded
+// in the state file, so that interrupted migration could be resumed.
+type PoolMigration struct {
+	Source          aptly.PackagePool
+	Destination     aptly.PackagePool
+	ChecksumStorage aptly.ChecksumStorage
+	// StatePath is the location of the file which keeps the list of migrated files
+	StatePath string
+	Progress  aptly.Progress
+}
+
+// PoolMigrationResult summarizes pool migration
+type PoolMigrationResult struct {
+	// Migrated is number of files copied during this run
+	Migrated int
+	// Resumed is number of files migrated by previous (interrupted) runs
+	Resumed int
+	// Bytes is total size of files copied during this run
+	Bytes int64
+	// Failed lists files which haven't been migrated with the reason
+	Failed map[string]error
+}
+
+// importChecksums is a ChecksumStorage used while importing into destination pool
+//
+// Checksums in aptly's database describe source pool, destination pool shouldn't
+// assume that files are already present based on them.
+type importChecksums map[string]*utils.ChecksumInfo
+
+func (c importChecksums) Get(path string) (*utils.ChecksumInfo, error) {
+	return c[path], nil
+}
+
+func (c importChecksums) Update(path string, checksums *utils.ChecksumInfo) error {
+	c[path] = checksums
+	return nil
+}
+
+// Run performs the migration, migration is complete if no files failed
+func (m *PoolMigration) Run() (*PoolMigrationResult, error) {
+	paths, err := m.Source.FilepathList(m.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	done, state, err := m.openState()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = state.Close()
+	}()
+
+	result := &PoolMigrationResult{Failed: map[string]error{}}
+
+	if m.Progress != nil {
+		m.Progress.InitBar(int64(len(paths)), false, aptly.BarPoolMigrateFiles)
+		defer m.Progress.ShutdownBar()
+	}
+
+	for _, path := range paths {
+		if m.Progress != nil {
+			m.Progress.AddBar(1)
+		}
+
+		if done[path] {
+			result.Resumed++
+			continue
+		}
+
+		size, err := m.migrateFile(path)
+		if err != nil {
+			result.Failed[path] = err
+			continue
+		}
+
+		if _, err = fmt.Fprintln(state, path); err != nil {
+			return nil, fmt.Errorf("error updating migration state %s: %s", m.StatePath, err)
+		}
+
+		result.Migrated++
+		result.Bytes += size
+	}
+
+	return result, nil
+}
+
+// openState loads list of already migrated files and opens state file for appending
+//
+// State is discarded if it was recorded for another destination pool.
+func (m *PoolMigration) openState() (map[string]bool, *os.File, error) {
+	header := "# destination: " + m.Destination.String()
+	done := map[string]bool{}
+
+	f, err := os.Open(m.StatePath)
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		if scanner.Scan() && scanner.Text() == header {
+			for scanner.Scan() {
+				done[scanner.Text()] = true
+			}
+		}
+		err = scanner.Err()
+		_ = f.Close()
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading migration state %s: %s", m.StatePath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	if len(done) == 0 {
+		err = os.WriteFile(m.StatePath, []byte(header+"\n"), 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	f, err = os.OpenFile(m.StatePath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return done, f, nil
+}
+
+// poolBasename returns original file name of the file stored at pool path,
+// only paths built from SHA256 could be migrated as is
+func poolBasename(poolPath string, checksums *utils.ChecksumInfo) (string, bool) {
+	hash := checksums.SHA256
+	prefix := filepath.Join(hash[0:2], hash[2:4], hash[4:32]) + "_"
+
+	if !strings.HasPrefix(poolPath, prefix) || len(poolPath) == len(prefix) {
+		return "", false
+	}
+
+	return poolPath[len(prefix):], true
+}
+
+// migrateFile copies single file to destination pool returning its size
+func (m *PoolMigration) migrateFile(poolPath string) (int64, error) {
+	temp, err := os.CreateTemp("", "aptly-pool-migrate")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = os.Remove(temp.Name())
+	}()
+
+	source, err := m.Source.Open(poolPath)
+	if err != nil {
+		_ = temp.Close()
+		return 0, err
+	}
+
+	_, err = io.Copy(temp, source)
+	_ = source.Close()
+	if err == nil {
+		err = temp.Close()
+	} else {
+		_ = temp.Close()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s from %s: %s", poolPath, m.Source, err)
+	}
+
+	checksums, err := utils.ChecksumsForFile(temp.Name())
+	if err != nil {
+		return 0, err
+	}
+
+	stored, err := m.ChecksumStorage.Get(poolPath)
+	if err != nil {
+		return 0, err
+	}
+	if stored != nil && !stored.Matches(&checksums) {
+		return 0, fmt.Errorf("file %s in %s doesn't match checksums stored in the database", poolPath, m.Source)
+	}
+
+	basename, ok := poolBasename(poolPath, &checksums)
+	if !ok {
+		return 0, fmt.Errorf("file %s is stored at legacy location, it should be moved to current pool layout first", poolPath)
+	}
+
+	imported := checksums
+	targetPath, err := m.Destination.Import(temp.Name(), basename, &imported, false, importChecksums{})
+	if err != nil {
+		return 0, fmt.Errorf("error importing %s into %s: %s", poolPath, m.Destination, err)
+	}
+	if targetPath != poolPath {
+		return 0, fmt.Errorf("file %s was imported into %s at unexpected location %s", poolPath, m.Destination, targetPath)
+	}
+
+	err = m.verifyFile(poolPath, &checksums)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.ChecksumStorage.Update(poolPath, &checksums)
+	if err != nil {
+		return 0, err
+	}
+
+	return checksums.Size, nil
+}
+
+// verifyFile reads file back from the destination pool and compares checksums
+func (m *PoolMigration) verifyFile(poolPath string, checksums *utils.ChecksumInfo) error {
+	size, err := m.Destination.Size(poolPath)
+	if err != nil {
+		return err
+	}
+	if size != checksums.Size {
+		return fmt.Errorf("size mismatch for %s in %s: %d != %d", poolPath, m.Destination, size, checksums.Size)
+	}
+
+	target, err := m.Destination.Open(poolPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = target.Close()
+	}()
+
+	targetChecksums, err := utils.ChecksumsForReader(target)
+	if err != nil {
+		return fmt.Errorf("error reading %s from %s: %s", poolPath, m.Destination, err)
+	}
+
+	if !checksums.Matches(&targetChecksums) {
+		return fmt.Errorf("checksum mismatch for %s in %s", poolPath, m.Destination)
+	}
+
+	return nil
+}
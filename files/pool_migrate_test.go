@@ -0,0 +1,145 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+type PoolMigrationSuite struct {
+	source, destination *PackagePool
+	cs                  aptly.ChecksumStorage
+	debFile             string
+	migration           *PoolMigration
+}
+
+var _ = Suite(&PoolMigrationSuite{})
+
+func (s *PoolMigrationSuite) SetUpTest(c *C) {
+	s.source = NewPackagePool(c.MkDir(), true)
+	s.destination = NewPackagePool(c.MkDir(), false)
+	s.cs = NewMockChecksumStorage()
+
+	_, _File, _, _ := runtime.Caller(0)
+	s.debFile = filepath.Join(filepath.Dir(_File), "../system/files/libboost-program-options-dev_1.49.0.1_i386.deb")
+
+	s.migration = &PoolMigration{
+		Source:          s.source,
+		Destination:     s.destination,
+		ChecksumStorage: s.cs,
+		StatePath:       filepath.Join(c.MkDir(), "state"),
+	}
+}
+
+// brokenPool is a pool which reports wrong size of the files
+type brokenPool struct {
+	*PackagePool
+}
+
+func (p brokenPool) Size(path string) (int64, error) {
+	return 42, nil
+}
+
+func (s *PoolMigrationSuite) TestMigrate(c *C) {
+	path1, err := s.source.Import(s.debFile, "a.deb", &utils.ChecksumInfo{}, false, s.cs)
+	c.Assert(err, IsNil)
+	path2, err := s.source.Import(s.debFile, "b.deb", &utils.ChecksumInfo{}, false, s.cs)
+	c.Assert(err, IsNil)
+
+	// checksum storage lacks some checksums, they are filled in by migration
+	s.cs.(*MockChecksumStorage).Store[path2] = utils.ChecksumInfo{Size: 2738}
+
+	result, err := s.migration.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Migrated, Equals, 2)
+	c.Check(result.Resumed, Equals, 0)
+	c.Check(result.Bytes, Equals, int64(2738*2))
+	c.Check(result.Failed, HasLen, 0)
+
+	list, err := s.destination.FilepathList(nil)
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{path1, path2})
+	c.Check(s.cs.(*MockChecksumStorage).Store[path2].SHA512, Equals, "d7302241373da972aa9b9e71d2fd769b31a38f71182aa71bc0d69d090d452c69bb74b8612c002ccf8a89c279ced84ac27177c8b92d20f00023b3d268e6cec69c")
+
+	state, err := os.ReadFile(s.migration.StatePath)
+	c.Check(err, IsNil)
+	c.Check(string(state), Equals, "# destination: "+s.destination.String()+"\n"+path1+"\n"+path2+"\n")
+
+	// resume: nothing left to migrate
+	result, err = s.migration.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Migrated, Equals, 0)
+	c.Check(result.Resumed, Equals, 2)
+}
+
+func (s *PoolMigrationSuite) TestMigrateResume(c *C) {
+	path1, err := s.source.Import(s.debFile, "a.deb", &utils.ChecksumInfo{}, false, s.cs)
+	c.Assert(err, IsNil)
+	path2, err := s.source.Import(s.debFile, "b.deb", &utils.ChecksumInfo{}, false, s.cs)
+	c.Assert(err, IsNil)
+
+	// previous run was interrupted after the first file
+	err = os.WriteFile(s.migration.StatePath, []byte("# destination: "+s.destination.String()+"\n"+path1+"\n"), 0644)
+	c.Assert(err, IsNil)
+
+	result, err := s.migration.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Migrated, Equals, 1)
+	c.Check(result.Resumed, Equals, 1)
+
+	list, err := s.destination.FilepathList(nil)
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{path2})
+
+	// state recorded for other destination is discarded
+	err = os.WriteFile(s.migration.StatePath, []byte("# destination: /other\n"+path1+"\n"+path2+"\n"), 0644)
+	c.Assert(err, IsNil)
+
+	result, err = s.migration.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Migrated, Equals, 2)
+	c.Check(result.Resumed, Equals, 0)
+}
+
+func (s *PoolMigrationSuite) TestMigrateFailures(c *C) {
+	path1, err := s.source.Import(s.debFile, "a.deb", &utils.ChecksumInfo{}, false, s.cs)
+	c.Assert(err, IsNil)
+	path2, err := s.source.Import(s.debFile, "b.deb", &utils.ChecksumInfo{}, false, s.cs)
+	c.Assert(err, IsNil)
+
+	// file at legacy location
+	legacyPath := filepath.Join("00", "35", "c.deb")
+	c.Assert(os.MkdirAll(filepath.Dir(s.source.FullPath(legacyPath)), 0755), IsNil)
+	c.Assert(os.WriteFile(s.source.FullPath(legacyPath), []byte("legacy"), 0644), IsNil)
+
+	// checksums in the database don't match the file
+	s.cs.(*MockChecksumStorage).Store[path2] = utils.ChecksumInfo{MD5: "00000000000000000000000000000000"}
+
+	result, err := s.migration.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Migrated, Equals, 1)
+	c.Check(result.Failed, HasLen, 2)
+	c.Check(result.Failed[legacyPath], ErrorMatches, "file 00/35/c.deb is stored at legacy location.*")
+	c.Check(result.Failed[path2], ErrorMatches, ".* doesn't match checksums stored in the database")
+
+	state, err := os.ReadFile(s.migration.StatePath)
+	c.Check(err, IsNil)
+	c.Check(string(state), Equals, "# destination: "+s.destination.String()+"\n"+path1+"\n")
+}
+
+func (s *PoolMigrationSuite) TestMigrateVerify(c *C) {
+	path, err := s.source.Import(s.debFile, "a.deb", &utils.ChecksumInfo{}, false, s.cs)
+	c.Assert(err, IsNil)
+
+	s.migration.Destination = brokenPool{s.destination}
+
+	result, err := s.migration.Run()
+	c.Assert(err, IsNil)
+	c.Check(result.Migrated, Equals, 0)
+	c.Check(result.Failed[path], ErrorMatches, "size mismatch for .*: 42 != 2738")
+}
@@ -26,6 +26,7 @@ type PublishedStorage struct {
 var (
 	_ aptly.PublishedStorage           = (*PublishedStorage)(nil)
 	_ aptly.FileSystemPublishedStorage = (*PublishedStorage)(nil)
+	_ aptly.ChecksumPublishedStorage   = (*PublishedStorage)(nil)
 )
 
 // Constants defining the type of creating links
@@ -309,3 +310,8 @@ func (storage *PublishedStorage) ReadLink(path string) (string, error) {
 	}
 	return filepath.Rel(storage.rootPath, absPath)
 }
+
+// FileMD5 returns MD5 checksum of the file under public path
+func (storage *PublishedStorage) FileMD5(path string) (string, error) {
+	return utils.MD5ChecksumForFile(filepath.Join(storage.rootPath, path))
+}
@@ -0,0 +1,194 @@
+package gcs
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// object is a subset of GCS object resource
+type object struct {
+	Name     string            `json:"name,omitempty"`
+	MD5Hash  string            `json:"md5Hash,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// md5 returns hex-encoded MD5 of the object, if available
+func (o *object) md5() string {
+	raw, err := base64.StdEncoding.DecodeString(o.MD5Hash)
+	if err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(raw)
+}
+
+type objectList struct {
+	Items         []object `json:"items"`
+	NextPageToken string   `json:"nextPageToken"`
+}
+
+// apiError is an error returned by GCS JSON API
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("googleapi: error %d: %s", e.Code, e.Message)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// client is a minimal client of GCS JSON API
+type client struct {
+	http     *http.Client
+	endpoint string
+	bucket   string
+}
+
+func (c *client) objectURL(name string) string {
+	return fmt.Sprintf("%s/storage/v1/b/%s/o/%s", c.endpoint, url.PathEscape(c.bucket), url.PathEscape(name))
+}
+
+// do performs request and decodes JSON response into result (if not nil)
+func (c *client) do(req *http.Request, result interface{}) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var wrapper struct {
+			Error *apiError `json:"error"`
+		}
+
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &wrapper) != nil || wrapper.Error == nil {
+			wrapper.Error = &apiError{Message: strings.TrimSpace(string(body))}
+		}
+		wrapper.Error.Code = resp.StatusCode
+
+		return wrapper.Error
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// upload uploads object contents with simple (media) upload
+func (c *client) upload(name string, body io.Reader, predefinedACL string) error {
+	query := url.Values{}
+	query.Set("uploadType", "media")
+	query.Set("name", name)
+	if predefinedACL != "" {
+		query.Set("predefinedAcl", predefinedACL)
+	}
+
+	req, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", c.endpoint, url.PathEscape(c.bucket), query.Encode()), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	return c.do(req, nil)
+}
+
+// get fetches object metadata
+func (c *client) get(name string) (*object, error) {
+	req, err := http.NewRequest(http.MethodGet, c.objectURL(name), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &object{}
+	if err = c.do(req, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// remove deletes object
+func (c *client) remove(name string) error {
+	req, err := http.NewRequest(http.MethodDelete, c.objectURL(name), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.do(req, nil)
+}
+
+// copy copies object within the bucket, metadata replaces source metadata if not nil
+func (c *client) copy(src, dst string, metadata map[string]string, predefinedACL string) error {
+	query := url.Values{}
+	if predefinedACL != "" {
+		query.Set("destinationPredefinedAcl", predefinedACL)
+	}
+
+	body := "{}"
+	if metadata != nil {
+		encoded, err := json.Marshal(object{Metadata: metadata})
+		if err != nil {
+			return err
+		}
+		body = string(encoded)
+	}
+
+	req, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/copyTo/b/%s/o/%s?%s", c.objectURL(src), url.PathEscape(c.bucket), url.PathEscape(dst), query.Encode()),
+		strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(req, nil)
+}
+
+// list calls handler for every object with specified prefix
+func (c *client) list(prefix string, handler func(o *object)) error {
+	query := url.Values{}
+	query.Set("prefix", prefix)
+	query.Set("fields", "items(name,md5Hash,metadata),nextPageToken")
+
+	for {
+		req, err := http.NewRequest(http.MethodGet,
+			fmt.Sprintf("%s/storage/v1/b/%s/o?%s", c.endpoint, url.PathEscape(c.bucket), query.Encode()), nil)
+		if err != nil {
+			return err
+		}
+
+		var page objectList
+		if err = c.do(req, &page); err != nil {
+			return err
+		}
+
+		for i := range page.Items {
+			handler(&page.Items[i])
+		}
+
+		if page.NextPageToken == "" {
+			return nil
+		}
+
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
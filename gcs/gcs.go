@@ -0,0 +1,2 @@
+// Package gcs handles publishing to Google Cloud Storage
+package gcs
@@ -0,0 +1,348 @@
+package gcs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// DefaultEndpoint is Google Cloud Storage API endpoint
+const DefaultEndpoint = "https://storage.googleapis.com"
+
+const scopeReadWrite = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// PublishedStorage abstract file system with published files (actually hosted on GCS)
+type PublishedStorage struct {
+	gcs    *client
+	acl    string
+	prefix string
+
+	// files are linked from pool by several components in parallel
+	pathCache     map[string]string
+	pathCacheLock sync.Mutex
+}
+
+// Check interface
+var (
+	_ aptly.PublishedStorage         = (*PublishedStorage)(nil)
+	_ aptly.ChecksumPublishedStorage = (*PublishedStorage)(nil)
+)
+
+// NewPublishedStorageRaw creates published storage using HTTP client which handles authentication
+func NewPublishedStorageRaw(httpClient *http.Client, endpoint, bucket, defaultACL, prefix string) *PublishedStorage {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+
+	return &PublishedStorage{
+		gcs: &client{
+			http:     httpClient,
+			endpoint: strings.TrimSuffix(endpoint, "/"),
+			bucket:   bucket,
+		},
+		acl:    defaultACL,
+		prefix: prefix,
+	}
+}
+
+// NewPublishedStorage creates new instance of PublishedStorage with specified GCS bucket
+//
+// Credentials are loaded from credentialsFile (service account key) or found with
+// Application Default Credentials. If STORAGE_EMULATOR_HOST is set, requests go
+// to the emulator without authentication.
+func NewPublishedStorage(bucket, defaultACL, prefix, credentialsFile, endpoint string) (*PublishedStorage, error) {
+	if emulator := os.Getenv("STORAGE_EMULATOR_HOST"); emulator != "" {
+		if !strings.Contains(emulator, "://") {
+			emulator = "http://" + emulator
+		}
+
+		return NewPublishedStorageRaw(http.DefaultClient, emulator, bucket, defaultACL, prefix), nil
+	}
+
+	var httpClient *http.Client
+
+	if credentialsFile != "" {
+		data, err := os.ReadFile(credentialsFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading GCS credentials")
+		}
+
+		credentials, err := google.CredentialsFromJSON(context.Background(), data, scopeReadWrite)
+		if err != nil {
+			return nil, errors.Wrap(err, "error loading GCS credentials")
+		}
+
+		httpClient = oauth2.NewClient(context.Background(), credentials.TokenSource)
+	} else {
+		credentials, err := google.FindDefaultCredentials(context.Background(), scopeReadWrite)
+		if err != nil {
+			return nil, errors.Wrap(err, "error finding GCS credentials")
+		}
+
+		httpClient = oauth2.NewClient(context.Background(), credentials.TokenSource)
+	}
+
+	return NewPublishedStorageRaw(httpClient, endpoint, bucket, defaultACL, prefix), nil
+}
+
+// String returns the storage as string
+func (storage *PublishedStorage) String() string {
+	return fmt.Sprintf("GCS: %s/%s", storage.gcs.bucket, storage.prefix)
+}
+
+// MkDir creates directory recursively under public path
+func (storage *PublishedStorage) MkDir(_ string) error {
+	// no op for GCS
+	return nil
+}
+
+// PutFile puts file into published storage at specified path
+func (storage *PublishedStorage) PutFile(path string, sourceFilename string) error {
+	source, err := os.Open(sourceFilename)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = source.Close() }()
+
+	log.Debug().Msgf("GCS: PutFile '%s'", path)
+	err = storage.gcs.upload(filepath.Join(storage.prefix, path), source, storage.acl)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s", sourceFilename, storage))
+	}
+
+	return err
+}
+
+// Remove removes single file under public path
+func (storage *PublishedStorage) Remove(path string) error {
+	log.Debug().Msgf("GCS: Remove '%s'", path)
+	err := storage.gcs.remove(filepath.Join(storage.prefix, path))
+	if err != nil && !isNotFound(err) {
+		return errors.Wrap(err, fmt.Sprintf("error deleting %s from %s", path, storage))
+	}
+
+	storage.pathCacheLock.Lock()
+	delete(storage.pathCache, path)
+	storage.pathCacheLock.Unlock()
+
+	return nil
+}
+
+// RemoveDirs removes directory structure under public path
+func (storage *PublishedStorage) RemoveDirs(path string, _ aptly.Progress) error {
+	filelist, _, err := storage.internalFilelist(path)
+	if err != nil {
+		if isNotFound(err) {
+			// ignore 'no such bucket' errors on removal
+			return nil
+		}
+		return err
+	}
+
+	log.Debug().Msgf("GCS: RemoveDirs '%s'", path)
+	for i := range filelist {
+		err = storage.gcs.remove(filepath.Join(storage.prefix, path, filelist[i]))
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("error deleting path %s from %s: %s", filelist[i], storage, err)
+		}
+		storage.pathCacheLock.Lock()
+		delete(storage.pathCache, filepath.Join(path, filelist[i]))
+		storage.pathCacheLock.Unlock()
+	}
+
+	return nil
+}
+
+// LinkFromPool links package file from pool to dist's pool location
+//
+// publishedPrefix is desired prefix for the location in the pool.
+// publishedRelPath is desired location in pool (like pool/component/liba/libav/)
+// sourcePool is instance of aptly.PackagePool
+// sourcePath is filepath to package file in package pool
+//
+// LinkFromPool returns relative path for the published file to be included in package index
+func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath, fileName string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo, force bool) error {
+
+	publishedDirectory := filepath.Join(publishedPrefix, publishedRelPath)
+	relPath := filepath.Join(publishedDirectory, fileName)
+	poolPath := filepath.Join(storage.prefix, relPath)
+
+	destinationMD5, exists, err := storage.cachedMD5(publishedPrefix, relPath)
+	if err != nil {
+		return err
+	}
+	sourceMD5 := sourceChecksums.MD5
+
+	if !exists {
+		// files outside of pool (e.g. installer images) are not cached
+		obj, err := storage.gcs.get(poolPath)
+		if err == nil {
+			destinationMD5, exists = obj.md5(), true
+		} else if !isNotFound(err) {
+			return errors.Wrap(err, fmt.Sprintf("error verifying MD5 for %s: %s", storage, poolPath))
+		}
+	}
+
+	if exists {
+		if sourceMD5 == "" {
+			return fmt.Errorf("unable to compare object, MD5 checksum missing")
+		}
+
+		if destinationMD5 == sourceMD5 {
+			return nil
+		}
+
+		if !force {
+			return fmt.Errorf("error putting file to %s: file already exists and is different: %s", poolPath, storage)
+		}
+	}
+
+	source, err := sourcePool.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = source.Close() }()
+
+	log.Debug().Msgf("GCS: LinkFromPool '%s'", relPath)
+	err = storage.gcs.upload(poolPath, source, storage.acl)
+	if err == nil {
+		storage.setCachedMD5(relPath, sourceMD5)
+	} else {
+		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s: %s", sourcePath, storage, poolPath))
+	}
+
+	return err
+}
+
+// cachedMD5 looks up MD5 of the published file in the path cache, filling it
+// on the first call by listing pool under publishedPrefix
+func (storage *PublishedStorage) cachedMD5(publishedPrefix, relPath string) (string, bool, error) {
+	storage.pathCacheLock.Lock()
+	defer storage.pathCacheLock.Unlock()
+
+	if storage.pathCache == nil {
+		paths, md5s, err := storage.internalFilelist(filepath.Join(publishedPrefix, "pool"))
+		if err != nil {
+			return "", false, errors.Wrap(err, "error caching paths under prefix")
+		}
+
+		storage.pathCache = make(map[string]string, len(paths))
+
+		for i := range paths {
+			storage.pathCache[filepath.Join(publishedPrefix, "pool", paths[i])] = md5s[i]
+		}
+	}
+
+	md5, exists := storage.pathCache[relPath]
+	return md5, exists, nil
+}
+
+// setCachedMD5 updates MD5 of the published file in the path cache
+func (storage *PublishedStorage) setCachedMD5(relPath, md5 string) {
+	storage.pathCacheLock.Lock()
+	defer storage.pathCacheLock.Unlock()
+
+	if storage.pathCache != nil {
+		storage.pathCache[relPath] = md5
+	}
+}
+
+// Filelist returns list of files under prefix
+func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
+	paths, _, err := storage.internalFilelist(prefix)
+	return paths, err
+}
+
+func (storage *PublishedStorage) internalFilelist(prefix string) (paths []string, md5s []string, err error) {
+	paths = make([]string, 0, 1024)
+	md5s = make([]string, 0, 1024)
+	prefix = filepath.Join(storage.prefix, prefix)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	err = storage.gcs.list(prefix, func(o *object) {
+		paths = append(paths, o.Name[len(prefix):])
+		md5s = append(md5s, o.md5())
+	})
+	if err != nil {
+		return nil, nil, errors.WithMessagef(err, "error listing under prefix %s in %s", prefix, storage)
+	}
+
+	return paths, md5s, nil
+}
+
+// RenameFile renames (moves) file
+func (storage *PublishedStorage) RenameFile(oldName, newName string) error {
+	log.Debug().Msgf("GCS: RenameFile %s -> %s", oldName, newName)
+	err := storage.gcs.copy(filepath.Join(storage.prefix, oldName), filepath.Join(storage.prefix, newName), nil, storage.acl)
+	if err != nil {
+		return fmt.Errorf("error copying %s -> %s in %s: %s", oldName, newName, storage, err)
+	}
+
+	return storage.Remove(oldName)
+}
+
+// SymLink creates a copy of src file and adds link information as meta data
+func (storage *PublishedStorage) SymLink(src string, dst string) error {
+	log.Debug().Msgf("GCS: SymLink %s -> %s", src, dst)
+	err := storage.gcs.copy(filepath.Join(storage.prefix, src), filepath.Join(storage.prefix, dst),
+		map[string]string{"SymLink": src}, storage.acl)
+	if err != nil {
+		return fmt.Errorf("error symlinking %s -> %s in %s: %s", src, dst, storage, err)
+	}
+
+	return nil
+}
+
+// HardLink using symlink functionality as hard links do not exist
+func (storage *PublishedStorage) HardLink(src string, dst string) error {
+	log.Debug().Msgf("GCS: HardLink %s -> %s", src, dst)
+	return storage.SymLink(src, dst)
+}
+
+// FileExists returns true if path exists
+func (storage *PublishedStorage) FileExists(path string) (bool, error) {
+	_, err := storage.gcs.get(filepath.Join(storage.prefix, path))
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReadLink returns the symbolic link pointed to by path.
+// This simply reads metadata of the object created with SymLink
+func (storage *PublishedStorage) ReadLink(path string) (string, error) {
+	obj, err := storage.gcs.get(filepath.Join(storage.prefix, path))
+	if err != nil {
+		return "", err
+	}
+
+	return obj.Metadata["SymLink"], nil
+}
+
+// FileMD5 returns MD5 checksum of the published file
+func (storage *PublishedStorage) FileMD5(path string) (string, error) {
+	obj, err := storage.gcs.get(filepath.Join(storage.prefix, path))
+	if err != nil {
+		return "", err
+	}
+
+	return obj.md5(), nil
+}
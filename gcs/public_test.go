@@ -0,0 +1,396 @@
+package gcs
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+type PublishedStorageSuite struct {
+	srv                      *Server
+	storage, prefixedStorage *PublishedStorage
+	noSuchBucketStorage      *PublishedStorage
+}
+
+var _ = Suite(&PublishedStorageSuite{})
+
+func (s *PublishedStorageSuite) SetUpTest(c *C) {
+	s.srv = NewServer("test")
+
+	s.storage = NewPublishedStorageRaw(http.DefaultClient, s.srv.URL, "test", "", "")
+	s.prefixedStorage = NewPublishedStorageRaw(http.DefaultClient, s.srv.URL, "test", "", "lala")
+	s.noSuchBucketStorage = NewPublishedStorageRaw(http.DefaultClient, s.srv.URL, "no-bucket", "", "")
+}
+
+func (s *PublishedStorageSuite) TearDownTest(c *C) {
+	s.srv.Quit()
+}
+
+func (s *PublishedStorageSuite) GetFile(c *C, path string) []byte {
+	obj, ok := s.srv.Objects[path]
+	c.Assert(ok, Equals, true, Commentf("object %s is missing", path))
+
+	return obj.data
+}
+
+func (s *PublishedStorageSuite) AssertNoFile(c *C, path string) {
+	_, ok := s.srv.Objects[path]
+	c.Assert(ok, Equals, false, Commentf("object %s exists", path))
+}
+
+func (s *PublishedStorageSuite) PutFile(c *C, path string, data []byte) {
+	s.srv.Objects[path] = &serverObject{data: data}
+}
+
+func (s *PublishedStorageSuite) TestNewPublishedStorageEmulator(c *C) {
+	c.Assert(os.Setenv("STORAGE_EMULATOR_HOST", s.srv.Listener.Addr().String()), IsNil)
+	defer func() { _ = os.Unsetenv("STORAGE_EMULATOR_HOST") }()
+
+	storage, err := NewPublishedStorage("test", "", "", "", "")
+	c.Assert(err, IsNil)
+	c.Check(storage.String(), Equals, "GCS: test/")
+
+	s.PutFile(c, "a", []byte("test"))
+
+	exists, err := storage.FileExists("a")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, true)
+}
+
+func (s *PublishedStorageSuite) TestNewPublishedStorageBadCredentials(c *C) {
+	_, err := NewPublishedStorage("test", "", "", filepath.Join(c.MkDir(), "missing.json"), "")
+	c.Check(err, ErrorMatches, "error reading GCS credentials.*")
+
+	credentials := filepath.Join(c.MkDir(), "credentials.json")
+	c.Assert(os.WriteFile(credentials, []byte("{"), 0644), IsNil)
+
+	_, err = NewPublishedStorage("test", "", "", credentials, "")
+	c.Check(err, ErrorMatches, "error loading GCS credentials.*")
+}
+
+func (s *PublishedStorageSuite) TestPutFile(c *C) {
+	dir := c.MkDir()
+	err := os.WriteFile(filepath.Join(dir, "a"), []byte("welcome to gcs!"), 0644)
+	c.Assert(err, IsNil)
+
+	err = s.storage.PutFile("a/b.txt", filepath.Join(dir, "a"))
+	c.Check(err, IsNil)
+
+	c.Check(s.GetFile(c, "a/b.txt"), DeepEquals, []byte("welcome to gcs!"))
+
+	err = s.prefixedStorage.PutFile("a/b.txt", filepath.Join(dir, "a"))
+	c.Check(err, IsNil)
+
+	c.Check(s.GetFile(c, "lala/a/b.txt"), DeepEquals, []byte("welcome to gcs!"))
+
+	err = s.noSuchBucketStorage.PutFile("a/b.txt", filepath.Join(dir, "a"))
+	c.Check(err, ErrorMatches, "error uploading .* to GCS: no-bucket/: googleapi: error 404: .*")
+}
+
+func (s *PublishedStorageSuite) TestFilelist(c *C) {
+	paths := []string{"a", "b", "c", "testa", "test/a", "test/b", "lala/a", "lala/b", "lala/c"}
+	for _, path := range paths {
+		s.PutFile(c, path, []byte("test"))
+	}
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "lala/a", "lala/b", "lala/c", "test/a", "test/b", "testa"})
+
+	list, err = s.storage.Filelist("test")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b"})
+
+	list, err = s.storage.Filelist("test2")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{})
+
+	list, err = s.prefixedStorage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c"})
+}
+
+func (s *PublishedStorageSuite) TestFilelistPaged(c *C) {
+	s.srv.PageSize = 2
+
+	paths := []string{"a", "b", "c", "d", "e"}
+	for _, path := range paths {
+		s.PutFile(c, path, []byte("test"))
+	}
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, paths)
+	c.Check(s.srv.CountRequests("GET", "/storage/v1/b/test/o"), Equals, 3)
+}
+
+func (s *PublishedStorageSuite) TestRemove(c *C) {
+	s.PutFile(c, "a/b", []byte("test"))
+
+	err := s.storage.Remove("a/b")
+	c.Check(err, IsNil)
+
+	s.AssertNoFile(c, "a/b")
+
+	s.PutFile(c, "lala/xyz", []byte("test"))
+
+	err = s.prefixedStorage.Remove("xyz")
+	c.Check(err, IsNil)
+
+	s.AssertNoFile(c, "lala/xyz")
+
+	err = s.storage.Remove("a/missing")
+	c.Check(err, IsNil)
+}
+
+func (s *PublishedStorageSuite) TestRemoveNoSuchBucket(c *C) {
+	err := s.noSuchBucketStorage.Remove("a/b")
+	c.Check(err, IsNil)
+}
+
+func (s *PublishedStorageSuite) TestRemoveDirs(c *C) {
+	paths := []string{"a", "b", "c", "testa", "test/a", "test/b", "lala/a", "lala/b", "lala/c"}
+	for _, path := range paths {
+		s.PutFile(c, path, []byte("test"))
+	}
+
+	err := s.storage.RemoveDirs("test", nil)
+	c.Check(err, IsNil)
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "lala/a", "lala/b", "lala/c", "testa"})
+
+	err = s.prefixedStorage.RemoveDirs("", nil)
+	c.Check(err, IsNil)
+
+	list, err = s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "testa"})
+}
+
+func (s *PublishedStorageSuite) TestRemoveDirsNoSuchBucket(c *C) {
+	err := s.noSuchBucketStorage.RemoveDirs("a/b", nil)
+	c.Check(err, IsNil)
+}
+
+func (s *PublishedStorageSuite) TestRenameFile(c *C) {
+	s.PutFile(c, "lala/a/b", []byte("test"))
+
+	err := s.prefixedStorage.RenameFile("a/b", "a/c")
+	c.Check(err, IsNil)
+
+	s.AssertNoFile(c, "lala/a/b")
+	c.Check(s.GetFile(c, "lala/a/c"), DeepEquals, []byte("test"))
+
+	err = s.prefixedStorage.RenameFile("a/b", "a/d")
+	c.Check(err, ErrorMatches, "error copying a/b -> a/d in GCS: test/lala: googleapi: error 404: .*")
+}
+
+func (s *PublishedStorageSuite) TestLinkFromPool(c *C) {
+	root := c.MkDir()
+	pool := files.NewPackagePool(root, false)
+	cs := files.NewMockChecksumStorage()
+
+	tmpFile1 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err := os.WriteFile(tmpFile1, []byte("Contents"), 0644)
+	c.Assert(err, IsNil)
+	cksum1 := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	tmpFile2 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err = os.WriteFile(tmpFile2, []byte("Spam"), 0644)
+	c.Assert(err, IsNil)
+	cksum2 := utils.ChecksumInfo{MD5: "e9dfd31cc505d51fc26975250750deab"}
+
+	tmpFile3 := filepath.Join(c.MkDir(), "netboot/boot.img.gz")
+	_ = os.MkdirAll(filepath.Dir(tmpFile3), 0777)
+	err = os.WriteFile(tmpFile3, []byte("Contents"), 0644)
+	c.Assert(err, IsNil)
+	cksum3 := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	src1, err := pool.Import(tmpFile1, "mars-invaders_1.03.deb", &cksum1, true, cs)
+	c.Assert(err, IsNil)
+	src2, err := pool.Import(tmpFile2, "mars-invaders_1.03.deb", &cksum2, true, cs)
+	c.Assert(err, IsNil)
+	src3, err := pool.Import(tmpFile3, "netboot/boot.img.gz", &cksum3, true, cs)
+	c.Assert(err, IsNil)
+
+	// first link from pool
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+
+	c.Check(s.GetFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contents"))
+
+	// duplicate link from pool
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+	c.Check(s.srv.CountRequests("POST", "/upload/"), Equals, 1)
+
+	// link from pool with conflict
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, false)
+	c.Check(err, ErrorMatches, ".*file already exists and is different.*")
+
+	c.Check(s.GetFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contents"))
+
+	// link from pool with conflict and force
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, true)
+	c.Check(err, IsNil)
+
+	c.Check(s.GetFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Spam"))
+
+	// link from pool without MD5 to compare
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, utils.ChecksumInfo{}, false)
+	c.Check(err, ErrorMatches, "unable to compare object, MD5 checksum missing")
+
+	// for prefixed storage:
+	// first link from pool
+	err = s.prefixedStorage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+
+	// 2nd link from pool, providing wrong path for source file
+	//
+	// this test should check that file already exists in GCS and skip upload (which would fail if not skipped)
+	err = s.prefixedStorage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, "wrong-looks-like-pathcache-doesnt-work", cksum1, false)
+	c.Check(err, IsNil)
+
+	c.Check(s.GetFile(c, "lala/pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contents"))
+
+	// link from pool with nested file name
+	err = s.storage.LinkFromPool("", "dists/jessie/non-free/installer-i386/current/images", "netboot/boot.img.gz", pool, src3, cksum3, false)
+	c.Check(err, IsNil)
+
+	c.Check(s.GetFile(c, "dists/jessie/non-free/installer-i386/current/images/netboot/boot.img.gz"), DeepEquals, []byte("Contents"))
+
+	// file outside of the pool which already exists is not uploaded again
+	err = s.storage.LinkFromPool("", "dists/jessie/non-free/installer-i386/current/images", "netboot/boot.img.gz", pool, "non-existent-file", cksum3, false)
+	c.Check(err, IsNil)
+}
+
+func (s *PublishedStorageSuite) TestLinkFromPoolCache(c *C) {
+	root := c.MkDir()
+	pool := files.NewPackagePool(root, false)
+	cs := files.NewMockChecksumStorage()
+
+	tmpFile1 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err := os.WriteFile(tmpFile1, []byte("Contents"), 0644)
+	c.Assert(err, IsNil)
+	cksum1 := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	src1, err := pool.Import(tmpFile1, "mars-invaders_1.03.deb", &cksum1, true, cs)
+	c.Assert(err, IsNil)
+
+	// Publish two packages at the same publish prefix
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "a"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "b"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+
+	// Check only one listing request was done to the server
+	c.Check(s.srv.CountRequests("GET", "/storage/v1/b/test/o"), Equals, 3)
+	c.Check(s.srv.CountRequests("GET", "/storage/v1/b/test/o/"), Equals, 2)
+
+	s.srv.Requests = nil
+	// Publish the same packages again, pathCache is used
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "a"), "mars-invaders_1.03.deb", pool, "non-existent-file", cksum1, false)
+	c.Check(err, IsNil)
+
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "b"), "mars-invaders_1.03.deb", pool, "non-existent-file", cksum1, false)
+	c.Check(err, IsNil)
+
+	c.Check(s.srv.Requests, HasLen, 0)
+
+	// Fresh storage fills the cache with single listing request
+	storage := NewPublishedStorageRaw(http.DefaultClient, s.srv.URL, "test", "", "")
+	err = storage.LinkFromPool("", filepath.Join("pool", "a"), "mars-invaders_1.03.deb", pool, "non-existent-file", cksum1, false)
+	c.Check(err, IsNil)
+
+	c.Check(s.srv.Requests, DeepEquals, []serverRequest{{Method: "GET", Path: "/storage/v1/b/test/o"}})
+}
+
+func (s *PublishedStorageSuite) TestLinkFromPoolParallel(c *C) {
+	root := c.MkDir()
+	pool := files.NewPackagePool(root, false)
+	cs := files.NewMockChecksumStorage()
+
+	tmpFile1 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err := os.WriteFile(tmpFile1, []byte("Contents"), 0644)
+	c.Assert(err, IsNil)
+	cksum1 := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	src1, err := pool.Import(tmpFile1, "mars-invaders_1.03.deb", &cksum1, true, cs)
+	c.Assert(err, IsNil)
+
+	// components are published in parallel, all of them sharing the storage
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.storage.LinkFromPool("", filepath.Join("pool", fmt.Sprintf("c%d", i)), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range errs {
+		c.Check(errs[i], IsNil)
+		c.Check(s.GetFile(c, fmt.Sprintf("pool/c%d/mars-invaders_1.03.deb", i)), DeepEquals, []byte("Contents"))
+	}
+	c.Check(s.storage.pathCache, HasLen, len(errs))
+}
+
+func (s *PublishedStorageSuite) TestSymLink(c *C) {
+	s.PutFile(c, "a/b", []byte("test"))
+
+	err := s.storage.SymLink("a/b", "a/b.link")
+	c.Check(err, IsNil)
+
+	var link string
+	link, err = s.storage.ReadLink("a/b.link")
+	c.Check(err, IsNil)
+	c.Check(link, Equals, "a/b")
+
+	c.Check(s.GetFile(c, "a/b.link"), DeepEquals, []byte("test"))
+
+	err = s.storage.HardLink("a/b", "a/b.hard")
+	c.Check(err, IsNil)
+
+	link, err = s.storage.ReadLink("a/b.hard")
+	c.Check(err, IsNil)
+	c.Check(link, Equals, "a/b")
+
+	link, err = s.storage.ReadLink("a/b")
+	c.Check(err, IsNil)
+	c.Check(link, Equals, "")
+}
+
+func (s *PublishedStorageSuite) TestFileExists(c *C) {
+	s.PutFile(c, "a/b", []byte("test"))
+
+	exists, err := s.storage.FileExists("a/b")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, true)
+
+	exists, err = s.storage.FileExists("a/b.invalid")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, false)
+}
+
+func (s *PublishedStorageSuite) TestFileMD5(c *C) {
+	s.PutFile(c, "a/b", []byte("Contents"))
+
+	md5, err := s.storage.FileMD5("a/b")
+	c.Check(err, IsNil)
+	c.Check(md5, Equals, "c1df1da7a1ce305a3b60af9d5733ac1d")
+
+	_, err = s.storage.FileMD5("a/c")
+	c.Check(err, ErrorMatches, "googleapi: error 404: .*")
+}
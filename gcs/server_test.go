@@ -0,0 +1,194 @@
+package gcs
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type serverObject struct {
+	data     []byte
+	metadata map[string]string
+}
+
+type serverRequest struct {
+	Method string
+	Path   string
+}
+
+// Server is a fake GCS JSON API server used for testing
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	Bucket   string
+	PageSize int
+	Objects  map[string]*serverObject
+	Requests []serverRequest
+}
+
+// NewServer starts fake GCS server with single bucket
+func NewServer(bucket string) *Server {
+	srv := &Server{
+		Bucket:   bucket,
+		PageSize: 1000,
+		Objects:  map[string]*serverObject{},
+	}
+	srv.Server = httptest.NewServer(http.HandlerFunc(srv.serveHTTP))
+
+	return srv
+}
+
+// Quit stops the server
+func (srv *Server) Quit() {
+	srv.Close()
+}
+
+// CountRequests returns number of requests with method and path prefix
+func (srv *Server) CountRequests(method, prefix string) int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	count := 0
+	for _, r := range srv.Requests {
+		if r.Method == method && strings.HasPrefix(r.Path, prefix) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (srv *Server) error(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": message},
+	})
+}
+
+func (srv *Server) resource(name string, obj *serverObject) map[string]interface{} {
+	sum := md5.Sum(obj.data)
+	return map[string]interface{}{
+		"name":     name,
+		"bucket":   srv.Bucket,
+		"size":     strconv.Itoa(len(obj.data)),
+		"md5Hash":  base64.StdEncoding.EncodeToString(sum[:]),
+		"metadata": obj.metadata,
+	}
+}
+
+func (srv *Server) reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (srv *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	path := r.URL.EscapedPath()
+	srv.Requests = append(srv.Requests, serverRequest{Method: r.Method, Path: path})
+
+	var parts []string
+	upload := false
+	if strings.HasPrefix(path, "/upload/storage/v1/b/") {
+		upload = true
+		parts = strings.Split(strings.TrimPrefix(path, "/upload/storage/v1/b/"), "/")
+	} else if strings.HasPrefix(path, "/storage/v1/b/") {
+		parts = strings.Split(strings.TrimPrefix(path, "/storage/v1/b/"), "/")
+	} else {
+		srv.error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	for i := range parts {
+		parts[i], _ = url.PathUnescape(parts[i])
+	}
+
+	if parts[0] != srv.Bucket {
+		srv.error(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+
+	query := r.URL.Query()
+
+	switch {
+	case upload && r.Method == http.MethodPost && len(parts) == 2:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			srv.error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		name := query.Get("name")
+		srv.Objects[name] = &serverObject{data: data}
+		srv.reply(w, srv.resource(name, srv.Objects[name]))
+	case r.Method == http.MethodGet && len(parts) == 2:
+		names := []string{}
+		for name := range srv.Objects {
+			if strings.HasPrefix(name, query.Get("prefix")) && name > query.Get("pageToken") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		result := map[string]interface{}{}
+		if len(names) > srv.PageSize {
+			names = names[:srv.PageSize]
+			result["nextPageToken"] = names[len(names)-1]
+		}
+
+		items := []interface{}{}
+		for _, name := range names {
+			items = append(items, srv.resource(name, srv.Objects[name]))
+		}
+		result["items"] = items
+		srv.reply(w, result)
+	case r.Method == http.MethodGet && len(parts) == 3:
+		obj, ok := srv.Objects[parts[2]]
+		if !ok {
+			srv.error(w, http.StatusNotFound, "No such object: "+parts[2])
+			return
+		}
+		if query.Get("alt") == "media" {
+			_, _ = w.Write(obj.data)
+			return
+		}
+		srv.reply(w, srv.resource(parts[2], obj))
+	case r.Method == http.MethodDelete && len(parts) == 3:
+		if _, ok := srv.Objects[parts[2]]; !ok {
+			srv.error(w, http.StatusNotFound, "No such object: "+parts[2])
+			return
+		}
+		delete(srv.Objects, parts[2])
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && len(parts) == 8 && parts[3] == "copyTo":
+		obj, ok := srv.Objects[parts[2]]
+		if !ok {
+			srv.error(w, http.StatusNotFound, "No such object: "+parts[2])
+			return
+		}
+		var body struct {
+			Metadata map[string]string `json:"metadata"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		copied := &serverObject{data: obj.data, metadata: obj.metadata}
+		if body.Metadata != nil {
+			copied.metadata = body.Metadata
+		}
+		srv.Objects[parts[7]] = copied
+		srv.reply(w, srv.resource(parts[7], copied))
+	default:
+		srv.error(w, http.StatusBadRequest, fmt.Sprintf("unsupported request %s %s", r.Method, path))
+	}
+}
@@ -34,7 +34,7 @@ var _ = flag.Bool("dep-follow-all-variants", false, "when processing dependencie
 var _ = flag.Bool("dep-verbose-resolve", false, "when processing dependencies, print detailed logs")
 var _ = flag.String("architectures", "", "list of architectures to consider during (comma-separated), default to all available")
 var _ = flag.String("config", "", "location of configuration file (default locations are /etc/aptly.conf, ~/.aptly.conf)")
-var _ = flag.String("gpg-provider", "", "PGP implementation (\"gpg\", \"gpg1\", \"gpg2\" for external gpg or \"internal\" for Go internal implementation)")
+var _ = flag.String("gpg-provider", "", "PGP implementation (\"gpg\", \"gpg1\", \"gpg2\" for external gpg or \"internal\" for Go internal implementation, \"remote\" for external signing service)")
 
 var _ = flag.String("cpuprofile", "", "write cpu profile to file")
 var _ = flag.String("memprofile", "", "write memory profile to this file")
@@ -22,7 +22,7 @@ var (
 type GpgSigner struct {
 	gpg                        string
 	version                    GPGVersion
-	keyRef                     string
+	keyRefs                    []string
 	keyring, secretKeyring     string
 	passphrase, passphraseFile string
 	batch                      bool
@@ -35,7 +35,15 @@ func (g *GpgSigner) SetBatch(batch bool) {
 
 // SetKey sets key ID to use when signing files
 func (g *GpgSigner) SetKey(keyRef string) {
-	g.keyRef = keyRef
+	g.keyRefs = nil
+	if keyRef != "" {
+		g.keyRefs = []string{keyRef}
+	}
+}
+
+// SetKeys sets list of key IDs to use when signing files, each file gets signature from every key
+func (g *GpgSigner) SetKeys(keyRefs []string) {
+	g.keyRefs = append([]string(nil), keyRefs...)
 }
 
 // SetKeyRing allows to set custom keyring and secretkeyring
@@ -57,8 +65,8 @@ func (g *GpgSigner) gpgArgs() []string {
 		args = append(args, "--secret-keyring", g.secretKeyring)
 	}
 
-	if g.keyRef != "" {
-		args = append(args, "-u", g.keyRef)
+	for _, keyRef := range g.keyRefs {
+		args = append(args, "-u", keyRef)
 	}
 
 	if g.passphrase != "" || g.passphraseFile != "" {
@@ -114,6 +114,7 @@ func (s *Gnupg1SignerSuite) SetUpTest(c *C) {
 	s.keyringPassphrase = [2]string{"../system/files/aptly_passphrase.pub", "../system/files/aptly_passphrase.sec"}
 	s.passphraseKey = "F30E8CB9CDDE2AF8"
 	s.noPassphraseKey = "21DBB89C16DB3E6D"
+	s.keyringBoth = concatKeyrings(c, s.keyringNoPassphrase, s.keyringPassphrase)
 
 	s.signer = NewGpgSigner(finder)
 	s.signer.SetBatch(true)
@@ -199,8 +200,17 @@ func (s *Gnupg2SignerSuite) SetUpTest(c *C) {
 		c.Check(err, IsNil)
 	}
 
+	// keyring with both public keys for signing with multiple keys
+	for _, suffix := range []string{"", "_passphrase"} {
+		output, err := exec.Command(gpg, "--no-default-keyring", "--batch", "--keyring", "../system/files/aptly2_both.gpg",
+			"--import", "../system/files/aptly2"+suffix+".pub.armor").CombinedOutput()
+		c.Log(string(output))
+		c.Check(err, IsNil)
+	}
+
 	s.keyringNoPassphrase = [2]string{"../system/files/aptly2.gpg", ""}
 	s.keyringPassphrase = [2]string{"../system/files/aptly2_passphrase.gpg", ""}
+	s.keyringBoth = [2]string{"../system/files/aptly2_both.gpg", ""}
 	s.noPassphraseKey = "751DF85C2B220D45"
 	s.passphraseKey = "6656CD181E92D2D5"
 
@@ -222,4 +232,5 @@ func (s *Gnupg2SignerSuite) TearDownTest(c *C) {
 
 	_ = os.Remove("../system/files/aptly2.gpg")
 	_ = os.Remove("../system/files/aptly2_passphrase.gpg")
+	_ = os.Remove("../system/files/aptly2_both.gpg")
 }
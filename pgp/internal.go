@@ -14,6 +14,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
 	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
 	openpgp_errors "github.com/ProtonMail/go-crypto/openpgp/errors"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
@@ -33,14 +34,14 @@ var (
 
 // GoSigner is implementation of Signer interface using Go internal OpenPGP library
 type GoSigner struct {
-	keyRef                         string
+	keyRefs                        []string
 	keyringFile, secretKeyringFile string
 	passphrase, passphraseFile     string
 	batch                          bool
 
 	publicKeyring openpgp.EntityList
 	secretKeyring openpgp.EntityList
-	signer        *openpgp.Entity
+	signers       []*openpgp.Entity
 	signerConfig  *packet.Config
 }
 
@@ -52,7 +53,15 @@ func (g *GoSigner) SetBatch(batch bool) {
 
 // SetKey sets key ID to use when signing files
 func (g *GoSigner) SetKey(keyRef string) {
-	g.keyRef = keyRef
+	g.keyRefs = nil
+	if keyRef != "" {
+		g.keyRefs = []string{keyRef}
+	}
+}
+
+// SetKeys sets list of key IDs to use when signing files, each file gets signature from every key
+func (g *GoSigner) SetKeys(keyRefs []string) {
+	g.keyRefs = append([]string(nil), keyRefs...)
 }
 
 // SetKeyRing allows to set custom keyring and secretkeyring
@@ -111,99 +120,119 @@ func (g *GoSigner) Init() error {
 		return errors.Wrap(err, "error load secret keyring")
 	}
 
-	if g.keyRef == "" {
+	g.signers = nil
+
+	if len(g.keyRefs) == 0 {
 		// no key reference, pick the first key
 		for _, signer := range g.secretKeyring {
 			if !validEntity(signer) {
 				continue
 			}
 
-			g.signer = signer
+			g.signers = append(g.signers, signer)
 			break
 		}
 
-		if g.signer == nil {
+		if len(g.signers) == 0 {
 			return fmt.Errorf("looks like there are no keys in gpg, please create one (official manual: http://www.gnupg.org/gph/en/manual.html)")
 		}
 	} else {
-	pickKeyLoop:
-		for _, signer := range g.secretKeyring {
-			key := KeyFromUint64(signer.PrimaryKey.KeyId)
-			if key.Matches(Key(g.keyRef)) {
-				g.signer = signer
-				break
+		for _, keyRef := range g.keyRefs {
+			signer := g.findSigner(keyRef)
+			if signer == nil {
+				return errors.Errorf("couldn't find key for key reference %v", keyRef)
 			}
 
-			if !validEntity(signer) {
-				continue
-			}
-
-			for name := range signer.Identities {
-				if strings.Contains(name, g.keyRef) {
-					g.signer = signer
-					break pickKeyLoop
-				}
-			}
+			g.signers = append(g.signers, signer)
 		}
+	}
 
-		if g.signer == nil {
-			return errors.Errorf("couldn't find key for key reference %v", g.keyRef)
+	for _, signer := range g.signers {
+		if err = g.unlockSigner(signer); err != nil {
+			return err
 		}
 	}
 
-	if g.signer.PrivateKey.Encrypted {
-		i := 0
-		for name := range g.signer.Identities {
-			if i == 0 {
-				fmt.Printf("openpgp: Passphrase is required to unlock private key \"%s\"\n", name)
-			} else {
-				fmt.Printf("                         				          aka \"%s\"\n", name)
-			}
-			i++
+	return nil
+}
+
+// findSigner looks up secret key by key ID or identity
+func (g *GoSigner) findSigner(keyRef string) *openpgp.Entity {
+	for _, signer := range g.secretKeyring {
+		key := KeyFromUint64(signer.PrimaryKey.KeyId)
+		if key.Matches(Key(keyRef)) {
+			return signer
 		}
 
-		fmt.Printf("openpgp: %s-bit %s key, ID %s, created %s\n",
-			keyBits(g.signer.PrimaryKey.PublicKey),
-			pubkeyAlgorithmName(g.signer.PrimaryKey.PubKeyAlgo),
-			KeyFromUint64(g.signer.PrimaryKey.KeyId),
-			g.signer.PrimaryKey.CreationTime.Format("2006-01-02"))
+		if !validEntity(signer) {
+			continue
+		}
 
-		if g.passphrase == "" {
-			if g.batch {
-				return errors.New("key is locked with passphrase, but no passphrase was given in batch mode")
+		for name := range signer.Identities {
+			if strings.Contains(name, keyRef) {
+				return signer
 			}
+		}
+	}
 
-			for attempt := 0; attempt < 3; attempt++ {
-				fmt.Print("\nEnter passphrase: ")
-				var bytePassphrase []byte
-				bytePassphrase, err = term.ReadPassword(int(syscall.Stdin))
-				if err != nil {
-					return errors.Wrap(err, "error reading passphare")
-				}
-
-				g.passphrase = string(bytePassphrase)
+	return nil
+}
 
-				err = g.decryptKey()
-				if err == nil || err != errWrongPassphrase {
-					break
-				}
+// unlockSigner decrypts private key, asking for passphrase if required
+func (g *GoSigner) unlockSigner(signer *openpgp.Entity) error {
+	if !signer.PrivateKey.Encrypted {
+		return nil
+	}
 
-				fmt.Print("\nWrong passphrase, please try again.\n")
-			}
+	i := 0
+	for name := range signer.Identities {
+		if i == 0 {
+			fmt.Printf("openpgp: Passphrase is required to unlock private key \"%s\"\n", name)
 		} else {
-			err = g.decryptKey()
+			fmt.Printf("                         				          aka \"%s\"\n", name)
 		}
+		i++
+	}
 
-		if err != nil {
-			return err
+	fmt.Printf("openpgp: %s-bit %s key, ID %s, created %s\n",
+		keyBits(signer.PrimaryKey.PublicKey),
+		pubkeyAlgorithmName(signer.PrimaryKey.PubKeyAlgo),
+		KeyFromUint64(signer.PrimaryKey.KeyId),
+		signer.PrimaryKey.CreationTime.Format("2006-01-02"))
+
+	var err error
+
+	if g.passphrase == "" {
+		if g.batch {
+			return errors.New("key is locked with passphrase, but no passphrase was given in batch mode")
 		}
+
+		for attempt := 0; attempt < 3; attempt++ {
+			fmt.Print("\nEnter passphrase: ")
+			var bytePassphrase []byte
+			bytePassphrase, err = term.ReadPassword(int(syscall.Stdin))
+			if err != nil {
+				return errors.Wrap(err, "error reading passphare")
+			}
+
+			g.passphrase = string(bytePassphrase)
+
+			err = g.decryptKey(signer)
+			if err == nil || err != errWrongPassphrase {
+				break
+			}
+
+			fmt.Print("\nWrong passphrase, please try again.\n")
+		}
+	} else {
+		err = g.decryptKey(signer)
 	}
 
-	return nil
+	return err
 }
 
-func (g *GoSigner) decryptKey() error {
-	err := g.signer.PrivateKey.Decrypt([]byte(g.passphrase))
+func (g *GoSigner) decryptKey(signer *openpgp.Entity) error {
+	err := signer.PrivateKey.Decrypt([]byte(g.passphrase))
 
 	if err == nil {
 		return nil
@@ -238,7 +267,25 @@ func (g *GoSigner) DetachedSign(source string, destination string) error {
 		_ = signature.Close()
 	}()
 
-	err = openpgp.ArmoredDetachSign(signature, g.signer, message, g.signerConfig)
+	// signature packets from all the keys are concatenated in single armored block
+	armored, err := armor.Encode(signature, "PGP SIGNATURE", nil)
+	if err != nil {
+		return errors.Wrap(err, "error creating detached signature")
+	}
+
+	for _, signer := range g.signers {
+		_, err = message.Seek(0, io.SeekStart)
+		if err != nil {
+			return errors.Wrap(err, "error reading source file")
+		}
+
+		err = openpgp.DetachSign(armored, signer, message, g.signerConfig)
+		if err != nil {
+			return errors.Wrap(err, "error creating detached signature")
+		}
+	}
+
+	err = armored.Close()
 	if err != nil {
 		return errors.Wrap(err, "error creating detached signature")
 	}
@@ -266,7 +313,12 @@ func (g *GoSigner) ClearSign(source string, destination string) error {
 		_ = clearsigned.Close()
 	}()
 
-	stream, err := clearsign.Encode(clearsigned, g.signer.PrivateKey, g.signerConfig)
+	privateKeys := make([]*packet.PrivateKey, 0, len(g.signers))
+	for _, signer := range g.signers {
+		privateKeys = append(privateKeys, signer.PrivateKey)
+	}
+
+	stream, err := clearsign.EncodeMulti(clearsigned, privateKeys, g.signerConfig)
 	if err != nil {
 		return errors.Wrap(err, "error initializing clear signer")
 	}
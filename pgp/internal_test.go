@@ -28,6 +28,7 @@ func (s *GoSignerSuite) SetUpTest(c *C) {
 	s.keyringPassphrase = [2]string{"../system/files/aptly_passphrase.pub", "../system/files/aptly_passphrase.sec"}
 	s.passphraseKey = "F30E8CB9CDDE2AF8"
 	s.noPassphraseKey = "21DBB89C16DB3E6D"
+	s.keyringBoth = concatKeyrings(c, s.keyringNoPassphrase, s.keyringPassphrase)
 
 	s.signer = &GoSigner{}
 	s.signer.SetBatch(true)
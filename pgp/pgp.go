@@ -42,6 +42,7 @@ type KeyInfo struct {
 type Signer interface {
 	Init() error
 	SetKey(keyRef string)
+	SetKeys(keyRefs []string)
 	SetKeyRing(keyring, secretKeyring string)
 	SetPassphrase(passphrase, passphraseFile string)
 	SetBatch(batch bool)
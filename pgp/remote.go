@@ -0,0 +1,252 @@
+package pgp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/pkg/errors"
+)
+
+// Test interface
+var (
+	_ Signer = &RemoteSigner{}
+)
+
+// RemoteSignRequest is a request sent to remote signing service
+type RemoteSignRequest struct {
+	// Contents of the file to sign
+	Content string
+	// Keys to sign with, service default key if empty
+	Keys []string `json:",omitempty"`
+}
+
+// RemoteSignResponse is a response of remote signing service
+type RemoteSignResponse struct {
+	// Armored detached signature of the content
+	DetachedSignature string
+	// Clearsigned content
+	ClearSigned string
+}
+
+// RemoteSigner is implementation of Signer interface which sends files to
+// external signing service over HTTP
+//
+// Signatures returned by the service are verified against trusted keyring
+// before they are written to the destination.
+type RemoteSigner struct {
+	url         string
+	token       string
+	keyringFile string
+	keyRefs     []string
+	client      *http.Client
+
+	trustedKeyring openpgp.EntityList
+	// signatures by SHA256 of the content, each file is usually signed twice
+	signatures map[[sha256.Size]byte]*RemoteSignResponse
+}
+
+// NewRemoteSigner creates new signer for service at url
+//
+// token (if set) is sent as bearer token, keyring contains public keys to verify signatures
+func NewRemoteSigner(url, token, keyring string, timeout time.Duration) *RemoteSigner {
+	return &RemoteSigner{
+		url:         url,
+		token:       token,
+		keyringFile: keyring,
+		client:      &http.Client{Timeout: timeout},
+		signatures:  make(map[[sha256.Size]byte]*RemoteSignResponse),
+	}
+}
+
+// SetBatch is no-op, remote signer never interacts with user
+func (r *RemoteSigner) SetBatch(_ bool) {
+}
+
+// SetKey sets key ID to use when signing files
+func (r *RemoteSigner) SetKey(keyRef string) {
+	r.keyRefs = nil
+	if keyRef != "" {
+		r.keyRefs = []string{keyRef}
+	}
+}
+
+// SetKeys sets list of key IDs to use when signing files
+func (r *RemoteSigner) SetKeys(keyRefs []string) {
+	r.keyRefs = append([]string(nil), keyRefs...)
+}
+
+// SetKeyRing overrides keyring with public keys used to verify signatures,
+// secret keyring is not used as keys are held by signing service
+func (r *RemoteSigner) SetKeyRing(keyring, _ string) {
+	if keyring != "" {
+		r.keyringFile = keyring
+	}
+}
+
+// SetPassphrase is no-op, keys are unlocked by signing service
+func (r *RemoteSigner) SetPassphrase(_, _ string) {
+}
+
+// Init loads keyring to verify signatures
+func (r *RemoteSigner) Init() error {
+	if r.url == "" {
+		return errors.New("remote signing service URL is not configured")
+	}
+
+	if r.keyringFile == "" {
+		return errors.New("keyring to verify remote signatures is not configured")
+	}
+
+	var err error
+	r.trustedKeyring, err = loadKeyRing(r.keyringFile, false)
+	if err != nil {
+		return errors.Wrap(err, "error loading keyring to verify remote signatures")
+	}
+
+	if len(r.trustedKeyring) == 0 {
+		return errors.Errorf("keyring %s to verify remote signatures is empty", r.keyringFile)
+	}
+
+	return nil
+}
+
+// sign requests (or reuses) signatures of the content from remote service and verifies them
+func (r *RemoteSigner) sign(source string) (*RemoteSignResponse, error) {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading source file")
+	}
+
+	hash := sha256.Sum256(content)
+	if signatures, ok := r.signatures[hash]; ok {
+		return signatures, nil
+	}
+
+	body, err := json.Marshal(RemoteSignRequest{Content: string(content), Keys: r.keyRefs})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating signing request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending signing request")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, errors.Errorf("signing service returned %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+
+	signatures := &RemoteSignResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(signatures); err != nil {
+		return nil, errors.Wrap(err, "error decoding signing service response")
+	}
+
+	if err = r.verify(content, signatures); err != nil {
+		return nil, err
+	}
+
+	r.signatures[hash] = signatures
+	return signatures, nil
+}
+
+// verify checks that both signatures are valid, made by trusted keys and cover the content
+func (r *RemoteSigner) verify(content []byte, signatures *RemoteSignResponse) error {
+	signers, _, err := checkArmoredDetachedSignature(r.trustedKeyring, bytes.NewReader(content), bytes.NewBufferString(signatures.DetachedSignature))
+	if err != nil {
+		return errors.Wrap(err, "remote detached signature verification failed")
+	}
+
+	if err = r.checkKeys(signers); err != nil {
+		return errors.Wrap(err, "remote detached signature verification failed")
+	}
+
+	block, _ := clearsign.Decode([]byte(signatures.ClearSigned))
+	if block == nil {
+		return errors.New("remote clearsigned signature verification failed: no clearsigned data found")
+	}
+
+	if !bytes.Equal(bytes.TrimRight(block.Plaintext, "\n"), bytes.TrimRight(content, "\n")) {
+		return errors.New("remote clearsigned signature verification failed: signed text doesn't match the content")
+	}
+
+	signers, _, err = checkDetachedSignature(r.trustedKeyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body)
+	if err != nil {
+		return errors.Wrap(err, "remote clearsigned signature verification failed")
+	}
+
+	if err = r.checkKeys(signers); err != nil {
+		return errors.Wrap(err, "remote clearsigned signature verification failed")
+	}
+
+	return nil
+}
+
+// checkKeys verifies that every requested key has signed the content
+func (r *RemoteSigner) checkKeys(signers []signatureResult) error {
+	for _, keyRef := range r.keyRefs {
+		found := false
+
+		for _, signer := range signers {
+			if signer.Entity == nil {
+				continue
+			}
+
+			if KeyFromUint64(signer.IssuerKeyID).Matches(Key(keyRef)) || KeyFromUint64(signer.Entity.PrimaryKey.KeyId).Matches(Key(keyRef)) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("no signature by key %s", keyRef)
+		}
+	}
+
+	return nil
+}
+
+// DetachedSign signs file with detached signature in ASCII format
+func (r *RemoteSigner) DetachedSign(source string, destination string) error {
+	fmt.Printf("remote: signing file '%s'...\n", filepath.Base(source))
+
+	signatures, err := r.sign(source)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(destination, []byte(signatures.DetachedSignature), 0644)
+}
+
+// ClearSign clear-signs the file
+func (r *RemoteSigner) ClearSign(source string, destination string) error {
+	fmt.Printf("remote: clearsigning file '%s'...\n", filepath.Base(source))
+
+	signatures, err := r.sign(source)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(destination, []byte(signatures.ClearSigned), 0644)
+}
@@ -0,0 +1,195 @@
+package pgp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type RemoteSignerSuite struct {
+	server   *httptest.Server
+	signer   *RemoteSigner
+	verifier Verifier
+
+	tempDir  string
+	source   string
+	requests []RemoteSignRequest
+	auth     string
+
+	// signing key used by stand-in service
+	keyring    [2]string
+	passphrase string
+	// content actually signed by stand-in service (if set)
+	tamper string
+	// error to return instead of signatures (if set)
+	fail int
+}
+
+var _ = Suite(&RemoteSignerSuite{})
+
+func (s *RemoteSignerSuite) SetUpTest(c *C) {
+	s.tempDir = c.MkDir()
+	s.requests = nil
+	s.auth = ""
+	s.keyring = [2]string{"../system/files/aptly.pub", "../system/files/aptly.sec"}
+	s.passphrase = ""
+	s.tamper = ""
+	s.fail = 0
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	s.source = filepath.Join(s.tempDir, "Release")
+	c.Assert(os.WriteFile(s.source, []byte("Origin: aptly\nLabel: test\n"), 0644), IsNil)
+
+	s.signer = NewRemoteSigner(s.server.URL, "", "../system/files/aptly.pub", time.Minute)
+
+	s.verifier = &GoVerifier{}
+	s.verifier.AddKeyring("../system/files/aptly.pub")
+	c.Assert(s.verifier.InitKeyring(false), IsNil)
+}
+
+func (s *RemoteSignerSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+// serve is a stand-in for remote signing service which signs with GoSigner
+func (s *RemoteSignerSuite) serve(w http.ResponseWriter, r *http.Request) {
+	s.auth = r.Header.Get("Authorization")
+
+	var request RemoteSignRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.requests = append(s.requests, request)
+
+	if s.fail != 0 {
+		http.Error(w, "key is not available", s.fail)
+		return
+	}
+
+	content := request.Content
+	if s.tamper != "" {
+		content = s.tamper
+	}
+
+	dir, err := os.MkdirTemp(s.tempDir, "service")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	source := filepath.Join(dir, "content")
+	if err = os.WriteFile(source, []byte(content), 0644); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	signer := &GoSigner{}
+	signer.SetBatch(true)
+	signer.SetKeyRing(s.keyring[0], s.keyring[1])
+	signer.SetPassphrase(s.passphrase, "")
+	if err = signer.Init(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err = signer.DetachedSign(source, filepath.Join(dir, "detached")); err == nil {
+		err = signer.ClearSign(source, filepath.Join(dir, "clearsigned"))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	detached, _ := os.ReadFile(filepath.Join(dir, "detached"))
+	clearsigned, _ := os.ReadFile(filepath.Join(dir, "clearsigned"))
+
+	_ = json.NewEncoder(w).Encode(RemoteSignResponse{
+		DetachedSignature: string(detached),
+		ClearSigned:       string(clearsigned),
+	})
+}
+
+func (s *RemoteSignerSuite) TestInit(c *C) {
+	c.Check(NewRemoteSigner("", "", "../system/files/aptly.pub", time.Minute).Init(), ErrorMatches, ".*URL is not configured")
+	c.Check(NewRemoteSigner(s.server.URL, "", "", time.Minute).Init(), ErrorMatches, "keyring to verify remote signatures is not configured")
+
+	signer := NewRemoteSigner(s.server.URL, "", "", time.Minute)
+	signer.SetKeyRing("../system/files/aptly.pub", "../system/files/aptly.sec")
+	c.Check(signer.Init(), IsNil)
+}
+
+func (s *RemoteSignerSuite) TestSign(c *C) {
+	s.signer.SetKey("21DBB89C16DB3E6D")
+	c.Assert(s.signer.Init(), IsNil)
+
+	c.Assert(s.signer.DetachedSign(s.source, s.source+".gpg"), IsNil)
+	c.Assert(s.signer.ClearSign(s.source, filepath.Join(s.tempDir, "InRelease")), IsNil)
+
+	// both signatures are fetched with single request
+	c.Assert(s.requests, HasLen, 1)
+	c.Check(s.requests[0].Content, Equals, "Origin: aptly\nLabel: test\n")
+	c.Check(s.requests[0].Keys, DeepEquals, []string{"21DBB89C16DB3E6D"})
+	c.Check(s.auth, Equals, "")
+
+	source, _ := os.Open(s.source)
+	defer func() { _ = source.Close() }()
+	signature, _ := os.Open(s.source + ".gpg")
+	defer func() { _ = signature.Close() }()
+	c.Check(s.verifier.VerifyDetachedSignature(signature, source, false), IsNil)
+
+	clearsigned, _ := os.Open(filepath.Join(s.tempDir, "InRelease"))
+	defer func() { _ = clearsigned.Close() }()
+	_, err := s.verifier.VerifyClearsigned(clearsigned, false)
+	c.Check(err, IsNil)
+}
+
+func (s *RemoteSignerSuite) TestToken(c *C) {
+	s.signer = NewRemoteSigner(s.server.URL, "secret", "../system/files/aptly.pub", time.Minute)
+	c.Assert(s.signer.Init(), IsNil)
+
+	c.Assert(s.signer.DetachedSign(s.source, s.source+".gpg"), IsNil)
+	c.Check(s.auth, Equals, "Bearer secret")
+	c.Check(s.requests[0].Keys, IsNil)
+}
+
+func (s *RemoteSignerSuite) TestServiceError(c *C) {
+	s.fail = http.StatusForbidden
+	c.Assert(s.signer.Init(), IsNil)
+
+	c.Check(s.signer.DetachedSign(s.source, s.source+".gpg"), ErrorMatches, "signing service returned 403 Forbidden: key is not available")
+
+	_, err := os.Stat(s.source + ".gpg")
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *RemoteSignerSuite) TestUntrustedKey(c *C) {
+	s.keyring = [2]string{"../system/files/aptly_passphrase.pub", "../system/files/aptly_passphrase.sec"}
+	s.passphrase = "verysecret"
+	c.Assert(s.signer.Init(), IsNil)
+
+	c.Check(s.signer.ClearSign(s.source, filepath.Join(s.tempDir, "InRelease")), ErrorMatches, "remote detached signature verification failed.*")
+
+	_, err := os.Stat(filepath.Join(s.tempDir, "InRelease"))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *RemoteSignerSuite) TestWrongContent(c *C) {
+	s.tamper = "Origin: evil\n"
+	c.Assert(s.signer.Init(), IsNil)
+
+	c.Check(s.signer.DetachedSign(s.source, s.source+".gpg"), ErrorMatches, "remote detached signature verification failed.*")
+}
+
+func (s *RemoteSignerSuite) TestMissingKey(c *C) {
+	s.signer.SetKeys([]string{"21DBB89C16DB3E6D", "F30E8CB9CDDE2AF8"})
+	c.Assert(s.signer.Init(), IsNil)
+
+	c.Check(s.signer.DetachedSign(s.source, s.source+".gpg"), ErrorMatches, "remote detached signature verification failed: no signature by key F30E8CB9CDDE2AF8")
+}
@@ -5,7 +5,10 @@ import (
 	"io"
 	"os"
 	"path"
+	"sort"
 
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	. "gopkg.in/check.v1"
 )
 
@@ -24,6 +27,7 @@ type SignerSuite struct {
 
 	keyringNoPassphrase [2]string
 	keyringPassphrase   [2]string
+	keyringBoth         [2]string
 
 	noPassphraseKey Key
 	passphraseKey   Key
@@ -120,7 +124,72 @@ func (s *SignerSuite) TestSignDetachedPassphraseFile(c *C) {
 	s.testSignDetached(c)
 }
 
-func (s *SignerSuite) testClearSign(c *C, expectedKey Key) {
+// concatKeyrings builds keyring pair containing keys from both keyring pairs
+func concatKeyrings(c *C, first, second [2]string) [2]string {
+	var result [2]string
+
+	tempDir := c.MkDir()
+	for i, name := range []string{"pubring.gpg", "secring.gpg"} {
+		result[i] = path.Join(tempDir, name)
+
+		var contents []byte
+		for _, keyring := range []string{first[i], second[i]} {
+			data, err := os.ReadFile(keyring)
+			c.Assert(err, IsNil)
+			contents = append(contents, data...)
+		}
+
+		c.Assert(os.WriteFile(result[i], contents, 0600), IsNil)
+	}
+
+	return result
+}
+
+func sortedKeys(keys []Key) []Key {
+	result := append([]Key(nil), keys...)
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// detachedSignatureKeys lists issuers of all signatures in armored detached signature
+func detachedSignatureKeys(c *C, signature string) []Key {
+	f, err := os.Open(signature)
+	c.Assert(err, IsNil)
+	defer func() {
+		_ = f.Close()
+	}()
+
+	block, err := armor.Decode(f)
+	c.Assert(err, IsNil)
+
+	keys := []Key{}
+	packets := packet.NewReader(block.Body)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+
+		sig, ok := p.(*packet.Signature)
+		c.Assert(ok, Equals, true)
+		keys = append(keys, KeyFromUint64(*sig.IssuerKeyId))
+	}
+
+	return keys
+}
+
+func (s *SignerSuite) TestSignDetachedMultipleKeys(c *C) {
+	s.signer.SetKeys([]string{string(s.noPassphraseKey), string(s.passphraseKey)})
+	s.signer.SetKeyRing(s.keyringBoth[0], s.keyringBoth[1])
+	s.signer.SetPassphrase("verysecret", "")
+
+	s.testSignDetached(c)
+
+	c.Check(sortedKeys(detachedSignatureKeys(c, s.signedF.Name())), DeepEquals, sortedKeys([]Key{s.noPassphraseKey, s.passphraseKey}))
+}
+
+func (s *SignerSuite) testClearSign(c *C, expectedKeys ...Key) {
 	c.Assert(s.signer.Init(), IsNil)
 
 	err := s.signer.ClearSign(s.clearF.Name(), s.signedF.Name())
@@ -129,7 +198,7 @@ func (s *SignerSuite) testClearSign(c *C, expectedKey Key) {
 	keyInfo, err := s.verifier.VerifyClearsigned(s.signedF, false)
 	c.Assert(err, IsNil)
 
-	c.Assert(keyInfo.GoodKeys, DeepEquals, []Key{expectedKey})
+	c.Assert(sortedKeys(keyInfo.GoodKeys), DeepEquals, sortedKeys(expectedKeys))
 	c.Assert(keyInfo.MissingKeys, DeepEquals, []Key(nil))
 
 	_, err = s.signedF.Seek(0, io.SeekStart)
@@ -189,3 +258,11 @@ func (s *SignerSuite) TestClearSignPassphraseFile(c *C) {
 
 	s.testClearSign(c, s.passphraseKey)
 }
+
+func (s *SignerSuite) TestClearSignMultipleKeys(c *C) {
+	s.signer.SetKeys([]string{string(s.noPassphraseKey), string(s.passphraseKey)})
+	s.signer.SetKeyRing(s.keyringBoth[0], s.keyringBoth[1])
+	s.signer.SetPassphrase("verysecret", "")
+
+	s.testClearSign(c, s.noPassphraseKey, s.passphraseKey)
+}
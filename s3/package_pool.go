@@ -0,0 +1,290 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithy "github.com/aws/smithy-go"
+	"github.com/pkg/errors"
+)
+
+// PackagePool is deduplicated storage of package files hosted on S3
+type PackagePool struct {
+	storage *PublishedStorage
+}
+
+// Check interface
+var (
+	_ aptly.PackagePool = (*PackagePool)(nil)
+)
+
+// NewPackagePool creates package pool with specified S3 access keys, region and bucket name
+func NewPackagePool(
+	accessKey, secretKey, sessionToken, region, endpoint, bucket, prefix, storageClass, encryptionMethod string,
+	forceVirtualHostedStyle, debug bool) (*PackagePool, error) {
+
+	storage, err := NewPublishedStorage(accessKey, secretKey, sessionToken, region, endpoint, bucket, "private",
+		prefix, storageClass, encryptionMethod, false, false, false, forceVirtualHostedStyle, debug)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PackagePool{storage: storage}, nil
+}
+
+// String returns the storage as string
+func (pool *PackagePool) String() string {
+	return pool.storage.String()
+}
+
+// isNotFound checks whether error is missing object (or bucket) error
+func isNotFound(err error) bool {
+	var notFoundErr *types.NotFound
+	var noSuchKeyErr *types.NoSuchKey
+	if errors.As(err, &notFoundErr) || errors.As(err, &noSuchKeyErr) {
+		return true
+	}
+
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		switch ae.ErrorCode() {
+		case "NotFound", "NoSuchKey", "NoSuchBucket":
+			return true
+		}
+	}
+
+	return false
+}
+
+func (pool *PackagePool) key(path string) *string {
+	return aws.String(filepath.Join(pool.storage.prefix, path))
+}
+
+func (pool *PackagePool) buildPoolPath(filename string, checksums *utils.ChecksumInfo) string {
+	hash := checksums.SHA256
+	// Use the same path as the file pool, for compat reasons.
+	return filepath.Join(hash[0:2], hash[2:4], hash[4:32]+"_"+filename)
+}
+
+func (pool *PackagePool) ensureChecksums(poolPath string, checksumStorage aptly.ChecksumStorage) (*utils.ChecksumInfo, error) {
+	targetChecksums, err := checksumStorage.Get(poolPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if targetChecksums == nil {
+		// we don't have checksums stored yet for this file
+		output, err := pool.storage.s3.GetObject(context.TODO(), &s3.GetObjectInput{
+			Bucket: aws.String(pool.storage.bucket),
+			Key:    pool.key(poolPath),
+		})
+		if err != nil {
+			if isNotFound(err) {
+				return nil, nil
+			}
+
+			return nil, errors.Wrapf(err, "error downloading object at %s", poolPath)
+		}
+		defer func() { _ = output.Body.Close() }()
+
+		targetChecksums = &utils.ChecksumInfo{}
+		*targetChecksums, err = utils.ChecksumsForReader(output.Body)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error checksumming object at %s", poolPath)
+		}
+
+		err = checksumStorage.Update(poolPath, targetChecksums)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return targetChecksums, nil
+}
+
+// FilepathList returns file paths of all the files in the pool
+func (pool *PackagePool) FilepathList(progress aptly.Progress) ([]string, error) {
+	if progress != nil {
+		progress.InitBar(0, false, aptly.BarGeneralBuildFileList)
+		defer progress.ShutdownBar()
+	}
+
+	paths, _, err := pool.storage.internalFilelist("", false)
+	return paths, err
+}
+
+// LegacyPath returns legacy (pre 1.1) path to package file (relative to root)
+func (pool *PackagePool) LegacyPath(_ string, _ *utils.ChecksumInfo) (string, error) {
+	return "", errors.New("S3 package pool does not support legacy paths")
+}
+
+// Size returns the size of the given file in bytes.
+func (pool *PackagePool) Size(path string) (int64, error) {
+	output, err := pool.storage.s3.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(pool.storage.bucket),
+		Key:    pool.key(path),
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "error examining %s from %s", path, pool)
+	}
+
+	return aws.ToInt64(output.ContentLength), nil
+}
+
+// Open returns ReadSeekerCloser to access the file
+//
+// File is downloaded into temporary file, as S3 objects are not seekable
+func (pool *PackagePool) Open(path string) (aptly.ReadSeekerCloser, error) {
+	output, err := pool.storage.s3.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(pool.storage.bucket),
+		Key:    pool.key(path),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading object %s", path)
+	}
+	defer func() { _ = output.Body.Close() }()
+
+	temp, err := os.CreateTemp("", "s3-download")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating tempfile for %s", path)
+	}
+	defer func() { _ = os.Remove(temp.Name()) }()
+
+	_, err = io.Copy(temp, output.Body)
+	if err == nil {
+		_, err = temp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = temp.Close()
+		return nil, errors.Wrapf(err, "error downloading object %s", path)
+	}
+
+	return temp, nil
+}
+
+// Remove deletes file from package pool returning its size
+func (pool *PackagePool) Remove(path string) (int64, error) {
+	size, err := pool.Size(path)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = pool.storage.s3.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(pool.storage.bucket),
+		Key:    pool.key(path),
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "error deleting %s from %s", path, pool)
+	}
+
+	return size, nil
+}
+
+// Import copies file into package pool
+//
+// Object is uploaded with MD5 stored in the metadata, so that it is preserved
+// on server-side copies while publishing
+func (pool *PackagePool) Import(srcPath, basename string, checksums *utils.ChecksumInfo, _ bool, checksumStorage aptly.ChecksumStorage) (string, error) {
+	if checksums.MD5 == "" || checksums.SHA256 == "" || checksums.SHA512 == "" {
+		// need to update checksums, MD5 and SHA256 should be always defined
+		var err error
+		*checksums, err = utils.ChecksumsForFile(srcPath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	path := pool.buildPoolPath(basename, checksums)
+	targetChecksums, err := pool.ensureChecksums(path, checksumStorage)
+	if err != nil {
+		return "", err
+	} else if targetChecksums != nil {
+		// target already exists
+		*checksums = *targetChecksums
+		return path, nil
+	}
+
+	source, err := os.Open(srcPath)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = source.Close() }()
+
+	err = pool.storage.putFile(path, source, checksums.MD5, checksums.Size)
+	if err != nil {
+		return "", errors.Wrapf(err, "error uploading %s to %s", srcPath, pool)
+	}
+
+	if !checksums.Complete() {
+		// need full checksums here
+		*checksums, err = utils.ChecksumsForFile(srcPath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = checksumStorage.Update(path, checksums)
+	if err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// Verify checks whether file exists in the pool and fills back checksum info
+func (pool *PackagePool) Verify(poolPath, basename string, checksums *utils.ChecksumInfo, checksumStorage aptly.ChecksumStorage) (string, bool, error) {
+	if poolPath == "" {
+		if checksums.SHA256 != "" {
+			poolPath = pool.buildPoolPath(basename, checksums)
+		} else {
+			// No checksums or pool path, so no idea what file to look for.
+			return "", false, nil
+		}
+	}
+
+	size, err := pool.Size(poolPath)
+	if err != nil {
+		if isNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	} else if size != checksums.Size {
+		return "", false, nil
+	}
+
+	targetChecksums, err := pool.ensureChecksums(poolPath, checksumStorage)
+	if err != nil {
+		return "", false, err
+	} else if targetChecksums == nil {
+		return "", false, nil
+	}
+
+	if checksums.MD5 != "" && targetChecksums.MD5 != checksums.MD5 ||
+		checksums.SHA256 != "" && targetChecksums.SHA256 != checksums.SHA256 {
+		// wrong file?
+		return "", false, nil
+	}
+
+	// fill back checksums
+	*checksums = *targetChecksums
+	return poolPath, true, nil
+}
+
+// copySource returns URL-encoded CopySource value referencing the file in the pool
+func (pool *PackagePool) copySource(path string) string {
+	parts := strings.Split(filepath.Join(pool.storage.bucket, pool.storage.prefix, path), "/")
+	for i := range parts {
+		parts[i] = url.PathEscape(parts[i])
+	}
+
+	return strings.Join(parts, "/")
+}
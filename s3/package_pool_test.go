@@ -0,0 +1,283 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	. "gopkg.in/check.v1"
+)
+
+type PackagePoolSuite struct {
+	srv                *Server
+	pool, prefixedPool *PackagePool
+	debFile            string
+	cs                 aptly.ChecksumStorage
+}
+
+var _ = Suite(&PackagePoolSuite{})
+
+func (s *PackagePoolSuite) SetUpTest(c *C) {
+	var err error
+	s.srv, err = NewServer(&Config{})
+	c.Assert(err, IsNil)
+
+	s.pool, err = NewPackagePool("aa", "bb", "", "test-1", s.srv.URL(), "pool", "", "", "", false, false)
+	c.Assert(err, IsNil)
+	s.prefixedPool, err = NewPackagePool("aa", "bb", "", "test-1", s.srv.URL(), "pool", "lala", "", "", false, false)
+	c.Assert(err, IsNil)
+
+	for _, bucket := range []string{"pool", "test"} {
+		_, err = s.pool.storage.s3.CreateBucket(context.TODO(), &s3.CreateBucketInput{
+			Bucket: aws.String(bucket),
+			CreateBucketConfiguration: &types.CreateBucketConfiguration{
+				LocationConstraint: "test-1",
+			}})
+		c.Assert(err, IsNil)
+	}
+
+	_, _File, _, _ := runtime.Caller(0)
+	s.debFile = filepath.Join(filepath.Dir(_File), "../system/files/libboost-program-options-dev_1.49.0.1_i386.deb")
+	s.cs = files.NewMockChecksumStorage()
+}
+
+func (s *PackagePoolSuite) TearDownTest(c *C) {
+	s.srv.Quit()
+}
+
+func (s *PackagePoolSuite) TestFilepathList(c *C) {
+	list, err := s.pool.FilepathList(nil)
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{})
+
+	_, _ = s.pool.Import(s.debFile, "a.deb", &utils.ChecksumInfo{}, false, s.cs)
+	_, _ = s.pool.Import(s.debFile, "b.deb", &utils.ChecksumInfo{}, false, s.cs)
+	_, _ = s.prefixedPool.Import(s.debFile, "c.deb", &utils.ChecksumInfo{}, false, s.cs)
+
+	list, err = s.prefixedPool.FilepathList(nil)
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{
+		"c7/6b/4bd12fd92e4dfe1b55b18a67a669_c.deb",
+	})
+
+	list, err = s.pool.FilepathList(nil)
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{
+		"c7/6b/4bd12fd92e4dfe1b55b18a67a669_a.deb",
+		"c7/6b/4bd12fd92e4dfe1b55b18a67a669_b.deb",
+		"lala/c7/6b/4bd12fd92e4dfe1b55b18a67a669_c.deb",
+	})
+}
+
+func (s *PackagePoolSuite) TestRemove(c *C) {
+	_, _ = s.pool.Import(s.debFile, "a.deb", &utils.ChecksumInfo{}, false, s.cs)
+	_, _ = s.pool.Import(s.debFile, "b.deb", &utils.ChecksumInfo{}, false, s.cs)
+
+	size, err := s.pool.Remove("c7/6b/4bd12fd92e4dfe1b55b18a67a669_a.deb")
+	c.Check(err, IsNil)
+	c.Check(size, Equals, int64(2738))
+
+	_, err = s.pool.Remove("c7/6b/4bd12fd92e4dfe1b55b18a67a669_a.deb")
+	c.Check(err, ErrorMatches, "error examining .*StatusCode: 404.*")
+
+	list, err := s.pool.FilepathList(nil)
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"c7/6b/4bd12fd92e4dfe1b55b18a67a669_b.deb"})
+}
+
+func (s *PackagePoolSuite) TestImportOk(c *C) {
+	var checksum utils.ChecksumInfo
+	path, err := s.pool.Import(s.debFile, filepath.Base(s.debFile), &checksum, false, s.cs)
+	c.Check(err, IsNil)
+	c.Check(path, Equals, "c7/6b/4bd12fd92e4dfe1b55b18a67a669_libboost-program-options-dev_1.49.0.1_i386.deb")
+	// SHA256 should be automatically calculated
+	c.Check(checksum.SHA256, Equals, "c76b4bd12fd92e4dfe1b55b18a67a669d92f62985d6a96c8a21d96120982cf12")
+	// checksum storage is filled with new checksum
+	c.Check(s.cs.(*files.MockChecksumStorage).Store[path].SHA256, Equals, "c76b4bd12fd92e4dfe1b55b18a67a669d92f62985d6a96c8a21d96120982cf12")
+
+	size, err := s.pool.Size(path)
+	c.Assert(err, IsNil)
+	c.Check(size, Equals, int64(2738))
+
+	// MD5 is stored in the metadata
+	md5, err := s.pool.storage.getMD5(path)
+	c.Check(err, IsNil)
+	c.Check(md5, Equals, checksum.MD5)
+
+	// import as different name
+	checksum = utils.ChecksumInfo{}
+	path, err = s.pool.Import(s.debFile, "some.deb", &checksum, false, s.cs)
+	c.Check(err, IsNil)
+	c.Check(path, Equals, "c7/6b/4bd12fd92e4dfe1b55b18a67a669_some.deb")
+
+	// double import, should be ok
+	checksum = utils.ChecksumInfo{}
+	path, err = s.pool.Import(s.debFile, filepath.Base(s.debFile), &checksum, false, s.cs)
+	c.Check(err, IsNil)
+	c.Check(path, Equals, "c7/6b/4bd12fd92e4dfe1b55b18a67a669_libboost-program-options-dev_1.49.0.1_i386.deb")
+	// checksum is filled back based on checksum storage
+	c.Check(checksum.SHA512, Equals, "d7302241373da972aa9b9e71d2fd769b31a38f71182aa71bc0d69d090d452c69bb74b8612c002ccf8a89c279ced84ac27177c8b92d20f00023b3d268e6cec69c")
+
+	// clear checksum storage, and do double-import
+	delete(s.cs.(*files.MockChecksumStorage).Store, path)
+	puts := len(s.srv.Requests)
+	checksum = utils.ChecksumInfo{}
+	path, err = s.pool.Import(s.debFile, filepath.Base(s.debFile), &checksum, false, s.cs)
+	c.Check(err, IsNil)
+	c.Check(path, Equals, "c7/6b/4bd12fd92e4dfe1b55b18a67a669_libboost-program-options-dev_1.49.0.1_i386.deb")
+	// checksum is filled back based on re-calculation of file in the pool
+	c.Check(checksum.SHA512, Equals, "d7302241373da972aa9b9e71d2fd769b31a38f71182aa71bc0d69d090d452c69bb74b8612c002ccf8a89c279ced84ac27177c8b92d20f00023b3d268e6cec69c")
+	// no upload happened
+	for _, r := range s.srv.Requests[puts:] {
+		c.Check(r.Method, Not(Equals), "PUT")
+	}
+}
+
+func (s *PackagePoolSuite) TestVerify(c *C) {
+	// file doesn't exist yet
+	ppath, exists, err := s.pool.Verify("", filepath.Base(s.debFile), &utils.ChecksumInfo{}, s.cs)
+	c.Check(ppath, Equals, "")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, false)
+
+	// file doesn't exist yet, but checksums are known
+	ppath, exists, err = s.pool.Verify("", filepath.Base(s.debFile), &utils.ChecksumInfo{
+		SHA256: "c76b4bd12fd92e4dfe1b55b18a67a669d92f62985d6a96c8a21d96120982cf12",
+		Size:   2738,
+	}, s.cs)
+	c.Check(ppath, Equals, "")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, false)
+
+	// import file
+	checksum := utils.ChecksumInfo{}
+	path, err := s.pool.Import(s.debFile, filepath.Base(s.debFile), &checksum, false, s.cs)
+	c.Check(err, IsNil)
+
+	// check existence
+	ppath, exists, err = s.pool.Verify("", filepath.Base(s.debFile), &checksum, s.cs)
+	c.Check(ppath, Equals, path)
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, true)
+
+	// check existence with fixed path, checksums are filled back
+	checksum = utils.ChecksumInfo{Size: checksum.Size}
+	ppath, exists, err = s.pool.Verify(path, filepath.Base(s.debFile), &checksum, s.cs)
+	c.Check(ppath, Equals, path)
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, true)
+	c.Check(checksum.SHA512, Equals, "d7302241373da972aa9b9e71d2fd769b31a38f71182aa71bc0d69d090d452c69bb74b8612c002ccf8a89c279ced84ac27177c8b92d20f00023b3d268e6cec69c")
+
+	// check existence, with missing checksums and no info in checksum storage
+	delete(s.cs.(*files.MockChecksumStorage).Store, path)
+	checksum.SHA512 = ""
+	ppath, exists, err = s.pool.Verify("", filepath.Base(s.debFile), &checksum, s.cs)
+	c.Check(ppath, Equals, path)
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, true)
+	// checksum is filled back based on re-calculation
+	c.Check(checksum.SHA512, Equals, "d7302241373da972aa9b9e71d2fd769b31a38f71182aa71bc0d69d090d452c69bb74b8612c002ccf8a89c279ced84ac27177c8b92d20f00023b3d268e6cec69c")
+
+	// check existence, with wrong checksum info but correct path and size available
+	ppath, exists, err = s.pool.Verify(path, filepath.Base(s.debFile), &utils.ChecksumInfo{
+		SHA256: "abc",
+		Size:   checksum.Size,
+	}, s.cs)
+	c.Check(ppath, Equals, "")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, false)
+
+	// check existence, with wrong size
+	ppath, exists, err = s.pool.Verify(path, filepath.Base(s.debFile), &utils.ChecksumInfo{Size: 13455}, s.cs)
+	c.Check(ppath, Equals, "")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, false)
+}
+
+func (s *PackagePoolSuite) TestImportNotExist(c *C) {
+	_, err := s.pool.Import("no-such-file", "a.deb", &utils.ChecksumInfo{}, false, s.cs)
+	c.Check(err, ErrorMatches, ".*no such file or directory")
+}
+
+func (s *PackagePoolSuite) TestSize(c *C) {
+	path, err := s.pool.Import(s.debFile, filepath.Base(s.debFile), &utils.ChecksumInfo{}, false, s.cs)
+	c.Check(err, IsNil)
+
+	size, err := s.pool.Size(path)
+	c.Assert(err, IsNil)
+	c.Check(size, Equals, int64(2738))
+
+	_, err = s.pool.Size("do/es/ntexist")
+	c.Check(err, ErrorMatches, ".*StatusCode: 404.*")
+}
+
+func (s *PackagePoolSuite) TestOpen(c *C) {
+	path, err := s.prefixedPool.Import(s.debFile, filepath.Base(s.debFile), &utils.ChecksumInfo{}, false, s.cs)
+	c.Check(err, IsNil)
+
+	f, err := s.prefixedPool.Open(path)
+	c.Assert(err, IsNil)
+	contents, err := io.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Check(len(contents), Equals, 2738)
+	c.Check(f.Close(), IsNil)
+
+	_, err = s.prefixedPool.Open("do/es/ntexist")
+	c.Check(err, ErrorMatches, ".*StatusCode: 404.*")
+}
+
+func (s *PackagePoolSuite) TestLinkFromPool(c *C) {
+	storage, err := NewPublishedStorage("aa", "bb", "", "test-1", s.srv.URL(), "test", "", "", "", "", false, true, false, false, false)
+	c.Assert(err, IsNil)
+
+	checksum := utils.ChecksumInfo{}
+	path, err := s.prefixedPool.Import(s.debFile, filepath.Base(s.debFile), &checksum, false, s.cs)
+	c.Assert(err, IsNil)
+
+	gets := len(s.srv.Requests)
+	err = storage.LinkFromPool("", filepath.Join("pool", "main", "b/boost"), filepath.Base(s.debFile), s.prefixedPool, path, checksum, false)
+	c.Check(err, IsNil)
+
+	// file was copied on the server side, without downloading it from the pool
+	for _, r := range s.srv.Requests[gets:] {
+		c.Check(r.Method == "GET" && strings.HasPrefix(r.RequestURI, "/pool/"), Equals, false)
+	}
+
+	md5, err := storage.FileMD5("pool/main/b/boost/" + filepath.Base(s.debFile))
+	c.Check(err, IsNil)
+	c.Check(md5, Equals, checksum.MD5)
+
+	// duplicate link is skipped
+	err = storage.LinkFromPool("", filepath.Join("pool", "main", "b/boost"), filepath.Base(s.debFile), s.prefixedPool, path, checksum, false)
+	c.Check(err, IsNil)
+
+	// missing source file, copy fails and so does download
+	err = storage.LinkFromPool("", filepath.Join("pool", "main", "b/boost"), "other.deb", s.prefixedPool, "do/es/ntexist", checksum, false)
+	c.Check(err, ErrorMatches, "error downloading object do/es/ntexist: .*StatusCode: 404.*")
+	c.Check(s.srv.Requests[len(s.srv.Requests)-2].RequestURI, Matches, "/test/pool/main/b/boost/other.deb\\?x-id=CopyObject")
+
+	// pool accessed with other credentials, or file too large for CopyObject
+	c.Check(storage.canCopyFrom(s.prefixedPool, checksum.Size), Equals, true)
+	c.Check(storage.canCopyFrom(s.prefixedPool, maxCopyObjectSize+1), Equals, false)
+
+	other, err := NewPublishedStorage("cc", "dd", "", "test-1", s.srv.URL(), "test", "", "", "", "", false, true, false, false, false)
+	c.Assert(err, IsNil)
+	c.Check(other.canCopyFrom(s.prefixedPool, checksum.Size), Equals, false)
+
+	// pool on other endpoint falls back to download & upload
+	storage.endpoint = "http://other.example.com"
+	storage.pathCache = nil
+	err = storage.LinkFromPool("", filepath.Join("pool", "main", "b/boost"), "copy.deb", s.prefixedPool, path, checksum, false)
+	c.Check(err, IsNil)
+	c.Check(s.srv.Requests[len(s.srv.Requests)-2].Method, Equals, "GET")
+	c.Check(s.srv.Requests[len(s.srv.Requests)-2].RequestURI, Matches, "/pool/lala/c7/6b/.*")
+}
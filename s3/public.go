@@ -1,12 +1,14 @@
 package s3
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/utils"
@@ -39,10 +41,22 @@ func (l *logger) Logf(classification logging.Classification, format string, v ..
 	e.Msgf(format, v...)
 }
 
+const (
+	// DefaultUploadConcurrency is number of files uploaded in parallel by LinkFromPoolAsync
+	DefaultUploadConcurrency = 8
+	// DefaultMultipartThreshold is file size starting from which multipart upload is used
+	DefaultMultipartThreshold = 64 * 1024 * 1024
+
+	// part size for multipart uploads, it limits memory used by each upload,
+	// S3 requires at least 5 MiB for all the parts except for the last one
+	defaultPartSize = 16 * 1024 * 1024
+)
+
 // PublishedStorage abstract file system with published files (actually hosted on S3)
 type PublishedStorage struct {
 	s3               *s3.Client
 	config           *aws.Config
+	endpoint         string
 	bucket           string
 	acl              types.ObjectCannedACL
 	prefix           string
@@ -51,14 +65,26 @@ type PublishedStorage struct {
 	plusWorkaround   bool
 	disableMultiDel  bool
 	pathCache        map[string]string
+	pathCacheLock    sync.Mutex
 
 	// True if the bucket encrypts objects by default.
 	encryptByDefault bool
+
+	// files larger than multipartThreshold are uploaded in parts of partSize
+	multipartThreshold int64
+	partSize           int64
+	// background uploads, number of slots limits concurrency
+	uploadSlots   chan struct{}
+	uploads       sync.WaitGroup
+	uploadErrLock sync.Mutex
+	uploadErr     error
 }
 
 // Check interface
 var (
-	_ aptly.PublishedStorage = (*PublishedStorage)(nil)
+	_ aptly.PublishedStorage         = (*PublishedStorage)(nil)
+	_ aptly.ChecksumPublishedStorage = (*PublishedStorage)(nil)
+	_ aptly.ParallelPublishedStorage = (*PublishedStorage)(nil)
 )
 
 // NewPublishedStorageRaw creates published storage from raw aws credentials
@@ -93,12 +119,17 @@ func NewPublishedStorageRaw(
 		}),
 		bucket:           bucket,
 		config:           config,
+		endpoint:         endpoint,
 		acl:              acl,
 		prefix:           prefix,
 		storageClass:     types.StorageClass(storageClass),
 		encryptionMethod: types.ServerSideEncryption(encryptionMethod),
 		plusWorkaround:   plusWorkaround,
 		disableMultiDel:  disabledMultiDel,
+
+		multipartThreshold: DefaultMultipartThreshold,
+		partSize:           defaultPartSize,
+		uploadSlots:        make(chan struct{}, DefaultUploadConcurrency),
 	}
 
 	result.setKMSFlag()
@@ -147,6 +178,20 @@ func NewPublishedStorage(
 	return result, err
 }
 
+// SetUploadLimits configures number of parallel uploads and size of the file starting
+// from which multipart upload is used, zero values keep defaults
+//
+// It should be called before any uploads are started.
+func (storage *PublishedStorage) SetUploadLimits(concurrency int, multipartThreshold int64) {
+	if concurrency > 0 {
+		storage.uploadSlots = make(chan struct{}, concurrency)
+	}
+
+	if multipartThreshold > 0 {
+		storage.multipartThreshold = multipartThreshold
+	}
+}
+
 // String returns the storage as string
 func (storage *PublishedStorage) String() string {
 	return fmt.Sprintf("S3: %s:%s/%s", storage.config.Region, storage.bucket, storage.prefix)
@@ -170,8 +215,13 @@ func (storage *PublishedStorage) PutFile(path string, sourceFilename string) err
 	}
 	defer func() { _ = source.Close() }()
 
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
 	log.Debug().Msgf("S3: PutFile '%s'", path)
-	err = storage.putFile(path, source, "")
+	err = storage.putFile(path, source, "", info.Size())
 	if err != nil {
 		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s", sourceFilename, storage))
 	}
@@ -190,11 +240,21 @@ func (storage *PublishedStorage) getMD5(path string) (string, error) {
 		return "", err
 	}
 
-	return output.Metadata["Md5"], nil
+	return output.Metadata["md5"], nil
 }
 
-// putFile uploads file-like object to
-func (storage *PublishedStorage) putFile(path string, source io.ReadSeeker, sourceMD5 string) error {
+// putFile uploads file-like object to path, size is used to choose multipart
+// upload for large files (zero if unknown)
+func (storage *PublishedStorage) putFile(path string, source io.ReadSeeker, sourceMD5 string, size int64) error {
+	if size > storage.multipartThreshold {
+		err := storage.putMultipart(path, source, sourceMD5)
+		if err != nil {
+			return err
+		}
+
+		return storage.putPlusWorkaround(path, source, sourceMD5, size)
+	}
+
 	params := &s3.PutObjectInput{
 		Bucket: aws.String(storage.bucket),
 		Key:    aws.String(filepath.Join(storage.prefix, path)),
@@ -218,17 +278,101 @@ func (storage *PublishedStorage) putFile(path string, source io.ReadSeeker, sour
 		return err
 	}
 
+	return storage.putPlusWorkaround(path, source, sourceMD5, size)
+}
+
+// putPlusWorkaround uploads copy of the file with '+' replaced by ' ', if enabled
+func (storage *PublishedStorage) putPlusWorkaround(path string, source io.ReadSeeker, sourceMD5 string, size int64) error {
 	if storage.plusWorkaround && strings.Contains(path, "+") {
-		_, err = source.Seek(0, 0)
+		_, err := source.Seek(0, 0)
 		if err != nil {
 			return err
 		}
 
-		return storage.putFile(strings.Replace(path, "+", " ", -1), source, sourceMD5)
+		return storage.putFile(strings.Replace(path, "+", " ", -1), source, sourceMD5, size)
 	}
 	return nil
 }
 
+// putMultipart uploads file-like object in parts of partSize
+//
+// ETag of such object is not MD5 of the contents, so MD5 is always stored in the metadata.
+func (storage *PublishedStorage) putMultipart(path string, source io.Reader, sourceMD5 string) error {
+	key := aws.String(filepath.Join(storage.prefix, path))
+
+	params := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(storage.bucket),
+		Key:    key,
+		ACL:    storage.acl,
+	}
+	if storage.storageClass != "" {
+		params.StorageClass = storage.storageClass
+	}
+	if storage.encryptionMethod != "" {
+		params.ServerSideEncryption = storage.encryptionMethod
+	}
+	if sourceMD5 != "" {
+		params.Metadata = map[string]string{
+			"Md5": sourceMD5,
+		}
+	}
+
+	upload, err := storage.s3.CreateMultipartUpload(context.TODO(), params)
+	if err != nil {
+		return err
+	}
+
+	abort := func(err error) error {
+		_, _ = storage.s3.AbortMultipartUpload(context.TODO(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(storage.bucket),
+			Key:      key,
+			UploadId: upload.UploadId,
+		})
+		return err
+	}
+
+	var parts []types.CompletedPart
+	buf := make([]byte, storage.partSize)
+
+	for partNumber := int32(1); ; partNumber++ {
+		n, err := io.ReadFull(source, buf)
+		if err == io.EOF && partNumber > 1 {
+			break
+		} else if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(err)
+		}
+
+		part, err := storage.s3.UploadPart(context.TODO(), &s3.UploadPartInput{
+			Bucket:     aws.String(storage.bucket),
+			Key:        key,
+			UploadId:   upload.UploadId,
+			PartNumber: aws.Int32(partNumber),
+			Body:       bytes.NewReader(buf[:n]),
+		})
+		if err != nil {
+			return abort(err)
+		}
+
+		parts = append(parts, types.CompletedPart{ETag: part.ETag, PartNumber: aws.Int32(partNumber)})
+
+		if n < len(buf) {
+			break
+		}
+	}
+
+	_, err = storage.s3.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(storage.bucket),
+		Key:             key,
+		UploadId:        upload.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return abort(err)
+	}
+
+	return nil
+}
+
 // Remove removes single file under public path
 func (storage *PublishedStorage) Remove(path string) error {
 	params := &s3.DeleteObjectInput{
@@ -251,7 +395,9 @@ func (storage *PublishedStorage) Remove(path string) error {
 		_ = storage.Remove(strings.Replace(path, "+", " ", -1))
 	}
 
+	storage.pathCacheLock.Lock()
 	delete(storage.pathCache, path)
+	storage.pathCacheLock.Unlock()
 
 	return nil
 }
@@ -280,7 +426,9 @@ func (storage *PublishedStorage) RemoveDirs(path string, _ aptly.Progress) error
 			if err != nil {
 				return fmt.Errorf("error deleting path %s from %s: %s", filelist[i], storage, err)
 			}
+			storage.pathCacheLock.Lock()
 			delete(storage.pathCache, filepath.Join(path, filelist[i]))
+			storage.pathCacheLock.Unlock()
 		}
 	} else {
 		numParts := (len(filelist) + page - 1) / page
@@ -313,9 +461,11 @@ func (storage *PublishedStorage) RemoveDirs(path string, _ aptly.Progress) error
 			if err != nil {
 				return fmt.Errorf("error deleting multiple paths from %s: %s", storage, err)
 			}
+			storage.pathCacheLock.Lock()
 			for i := range part {
 				delete(storage.pathCache, filepath.Join(path, part[i]))
 			}
+			storage.pathCacheLock.Unlock()
 		}
 	}
 
@@ -337,20 +487,10 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 	relPath := filepath.Join(publishedDirectory, fileName)
 	poolPath := filepath.Join(storage.prefix, relPath)
 
-	if storage.pathCache == nil {
-		paths, md5s, err := storage.internalFilelist(filepath.Join(publishedPrefix, "pool"), true)
-		if err != nil {
-			return errors.Wrap(err, "error caching paths under prefix")
-		}
-
-		storage.pathCache = make(map[string]string, len(paths))
-
-		for i := range paths {
-			storage.pathCache[filepath.Join("pool", paths[i])] = md5s[i]
-		}
+	destinationMD5, exists, err := storage.cachedMD5(publishedPrefix, relPath)
+	if err != nil {
+		return err
 	}
-
-	destinationMD5, exists := storage.pathCache[relPath]
 	sourceMD5 := sourceChecksums.MD5
 
 	if exists {
@@ -361,13 +501,12 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 		if len(destinationMD5) != 32 || storage.encryptByDefault {
 			// doesn’t look like a valid MD5,
 			// attempt to fetch one from the metadata
-			var err error
 			destinationMD5, err = storage.getMD5(relPath)
 			if err != nil {
 				err = errors.Wrap(err, fmt.Sprintf("error verifying MD5 for %s: %s", storage, poolPath))
 				return err
 			}
-			storage.pathCache[relPath] = destinationMD5
+			storage.setCachedMD5(relPath, destinationMD5)
 		}
 
 		if destinationMD5 == sourceMD5 {
@@ -379,6 +518,19 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 		}
 	}
 
+	if pool, ok := sourcePool.(*PackagePool); ok && storage.canCopyFrom(pool, sourceChecksums.Size) {
+		log.Debug().Msgf("S3: LinkFromPool (copy) '%s'", relPath)
+		err = storage.copyFromPool(relPath, pool, sourcePath, sourceMD5)
+		if err == nil {
+			storage.setCachedMD5(relPath, sourceMD5)
+			return nil
+		}
+
+		// e.g. access to the pool is denied with credentials of published storage,
+		// fall back to download & upload
+		log.Warn().Msgf("S3: error copying %s from %s to %s, uploading instead: %s", sourcePath, pool, storage, err)
+	}
+
 	source, err := sourcePool.Open(sourcePath)
 	if err != nil {
 		return err
@@ -386,9 +538,9 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 	defer func() { _ = source.Close() }()
 
 	log.Debug().Msgf("S3: LinkFromPool '%s'", relPath)
-	err = storage.putFile(relPath, source, sourceMD5)
+	err = storage.putFile(relPath, source, sourceMD5, sourceChecksums.Size)
 	if err == nil {
-		storage.pathCache[relPath] = sourceMD5
+		storage.setCachedMD5(relPath, sourceMD5)
 	} else {
 		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s: %s", sourcePath, storage, poolPath))
 	}
@@ -396,6 +548,158 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 	return err
 }
 
+// LinkFromPoolAsync schedules LinkFromPool to be performed in the background
+//
+// It blocks while all upload slots are busy. Errors are reported by Flush, after
+// the first error remaining scheduled files are skipped.
+func (storage *PublishedStorage) LinkFromPoolAsync(publishedPrefix, publishedRelPath, fileName string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo, force bool) {
+	storage.uploads.Add(1)
+	slots := storage.uploadSlots
+	slots <- struct{}{}
+
+	go func() {
+		defer func() {
+			<-slots
+			storage.uploads.Done()
+		}()
+
+		storage.uploadErrLock.Lock()
+		failed := storage.uploadErr != nil
+		storage.uploadErrLock.Unlock()
+
+		if failed {
+			return
+		}
+
+		err := storage.LinkFromPool(publishedPrefix, publishedRelPath, fileName, sourcePool, sourcePath, sourceChecksums, force)
+		if err != nil {
+			storage.uploadErrLock.Lock()
+			if storage.uploadErr == nil {
+				storage.uploadErr = err
+			}
+			storage.uploadErrLock.Unlock()
+		}
+	}()
+}
+
+// Flush waits for files scheduled with LinkFromPoolAsync and returns first error
+func (storage *PublishedStorage) Flush() error {
+	storage.uploads.Wait()
+
+	storage.uploadErrLock.Lock()
+	defer storage.uploadErrLock.Unlock()
+
+	err := storage.uploadErr
+	storage.uploadErr = nil
+
+	return err
+}
+
+// cachedMD5 looks up MD5 of the published file in the path cache
+//
+// Cache is filled on the first call by listing pool under publishedPrefix, it is
+// shared by all the components and background uploads.
+func (storage *PublishedStorage) cachedMD5(publishedPrefix, relPath string) (string, bool, error) {
+	storage.pathCacheLock.Lock()
+	defer storage.pathCacheLock.Unlock()
+
+	if storage.pathCache == nil {
+		paths, md5s, err := storage.internalFilelist(filepath.Join(publishedPrefix, "pool"), true)
+		if err != nil {
+			return "", false, errors.Wrap(err, "error caching paths under prefix")
+		}
+
+		storage.pathCache = make(map[string]string, len(paths))
+
+		for i := range paths {
+			storage.pathCache[filepath.Join("pool", paths[i])] = md5s[i]
+		}
+	}
+
+	md5, exists := storage.pathCache[relPath]
+	return md5, exists, nil
+}
+
+// setCachedMD5 updates MD5 of the published file in the path cache
+func (storage *PublishedStorage) setCachedMD5(relPath, md5 string) {
+	storage.pathCacheLock.Lock()
+	defer storage.pathCacheLock.Unlock()
+
+	if storage.pathCache != nil {
+		storage.pathCache[relPath] = md5
+	}
+}
+
+// maxCopyObjectSize is the largest object which could be copied with single CopyObject request
+const maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+
+// canCopyFrom checks whether files could be copied from the pool on the server side,
+// which requires pool to be hosted on the same endpoint and accessed with the same credentials
+func (storage *PublishedStorage) canCopyFrom(pool *PackagePool, size int64) bool {
+	if pool.storage.endpoint != storage.endpoint || pool.storage.config.Region != storage.config.Region {
+		return false
+	}
+
+	if size > maxCopyObjectSize {
+		return false
+	}
+
+	return sameCredentials(pool.storage.config, storage.config)
+}
+
+// sameCredentials checks whether both configurations resolve to the same access key
+func sameCredentials(a, b *aws.Config) bool {
+	if a.Credentials == nil || b.Credentials == nil {
+		return a.Credentials == b.Credentials
+	}
+
+	credsA, err := a.Credentials.Retrieve(context.TODO())
+	if err != nil {
+		return false
+	}
+
+	credsB, err := b.Credentials.Retrieve(context.TODO())
+	if err != nil {
+		return false
+	}
+
+	return credsA.AccessKeyID == credsB.AccessKeyID
+}
+
+// copyFromPool copies file from S3 package pool with CopyObject, so that
+// package contents don't pass through aptly
+func (storage *PublishedStorage) copyFromPool(path string, pool *PackagePool, sourcePath, sourceMD5 string) error {
+	params := &s3.CopyObjectInput{
+		Bucket:            aws.String(storage.bucket),
+		CopySource:        aws.String(pool.copySource(sourcePath)),
+		Key:               aws.String(filepath.Join(storage.prefix, path)),
+		ACL:               storage.acl,
+		MetadataDirective: types.MetadataDirectiveReplace,
+	}
+	if storage.storageClass != "" {
+		params.StorageClass = storage.storageClass
+	}
+	if storage.encryptionMethod != "" {
+		params.ServerSideEncryption = storage.encryptionMethod
+	}
+	if sourceMD5 != "" {
+		params.Metadata = map[string]string{
+			"Md5": sourceMD5,
+		}
+	}
+
+	_, err := storage.s3.CopyObject(context.TODO(), params)
+	if err != nil {
+		return err
+	}
+
+	if storage.plusWorkaround && strings.Contains(path, "+") {
+		return storage.copyFromPool(strings.Replace(path, "+", " ", -1), pool, sourcePath, sourceMD5)
+	}
+	return nil
+}
+
 // Filelist returns list of files under prefix
 func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
 	paths, _, err := storage.internalFilelist(prefix, true)
@@ -553,5 +857,36 @@ func (storage *PublishedStorage) ReadLink(path string) (string, error) {
 		return "", err
 	}
 
-	return output.Metadata["SymLink"], nil
+	// metadata keys are lowercased by the SDK
+	return output.Metadata["symlink"], nil
+}
+
+// FileMD5 returns MD5 checksum of the published file
+//
+// MD5 stored in the metadata is preferred, as ETag is not MD5 for encrypted
+// or multipart objects.
+func (storage *PublishedStorage) FileMD5(path string) (string, error) {
+	params := &s3.HeadObjectInput{
+		Bucket: aws.String(storage.bucket),
+		Key:    aws.String(filepath.Join(storage.prefix, path)),
+	}
+	output, err := storage.s3.HeadObject(context.TODO(), params)
+	if err != nil {
+		return "", err
+	}
+
+	if md5, ok := output.Metadata["md5"]; ok && md5 != "" {
+		return md5, nil
+	}
+
+	if output.ETag == nil || storage.encryptByDefault {
+		return "", nil
+	}
+
+	md5 := strings.Replace(*output.ETag, "\"", "", -1)
+	if len(md5) != 32 {
+		return "", nil
+	}
+
+	return md5, nil
 }
@@ -81,6 +81,14 @@ type bucket struct {
 	name    string
 	acl     string
 	objects map[string]*object
+	uploads map[string]*multipartUpload
+}
+
+// multipartUpload is multipart upload in progress
+type multipartUpload struct {
+	name  string
+	meta  http.Header
+	parts map[int][]byte
 }
 
 type object struct {
@@ -88,9 +96,18 @@ type object struct {
 	mtime    time.Time
 	meta     http.Header // metadata to return with requests.
 	checksum []byte      // also held as Content-MD5 in meta.
+	etag     string      // set for multipart objects, ETag is not MD5 then.
 	data     []byte
 }
 
+// eTag returns ETag of the object without quotes
+func (obj *object) eTag() string {
+	if obj.etag != "" {
+		return obj.etag
+	}
+	return hex.EncodeToString(obj.checksum)
+}
+
 // A resource encapsulates the subject of an HTTP request.
 // The resource referred to may or may not exist
 // when the request is made.
@@ -223,10 +240,8 @@ var unimplementedBucketResourceNames = map[string]bool{
 }
 
 var unimplementedObjectResourceNames = map[string]bool{
-	"uploadId": true,
-	"acl":      true,
-	"torrent":  true,
-	"uploads":  true,
+	"acl":     true,
+	"torrent": true,
 }
 
 var pathRegexp = regexp.MustCompile("/(([^/]+)(/(.*))?)?")
@@ -468,7 +483,7 @@ func (obj *object) s3Key() Key {
 		Key:          obj.name,
 		LastModified: obj.mtime.Format(timeFormat),
 		Size:         int64(len(obj.data)),
-		ETag:         fmt.Sprintf(`"%x"`, obj.checksum),
+		ETag:         `"` + obj.eTag() + `"`,
 		// TODO StorageClass
 		// TODO Owner
 	}
@@ -503,6 +518,7 @@ func (r bucketResource) put(a *action) interface{} {
 			name: r.name,
 			// TODO default acl
 			objects: make(map[string]*object),
+			uploads: make(map[string]*multipartUpload),
 		}
 		a.srv.buckets[r.name] = r.bucket
 		created = true
@@ -605,7 +621,7 @@ func (objr objectResource) get(a *action) interface{} {
 	// TODO Connection: close ??
 	// TODO x-amz-request-id
 	h.Set("Content-Length", fmt.Sprint(len(obj.data)))
-	h.Set("ETag", hex.EncodeToString(obj.checksum))
+	h.Set("ETag", obj.eTag())
 	h.Set("Last-Modified", obj.mtime.UTC().Format(http.TimeFormat))
 	if a.req.Method == "HEAD" {
 		return nil
@@ -634,6 +650,14 @@ func (objr objectResource) put(a *action) interface{} {
 	// TODO x-amz-server-side-encryption
 	// TODO x-amz-storage-class
 
+	if source := a.req.Header.Get("X-Amz-Copy-Source"); source != "" {
+		return objr.copy(a, source)
+	}
+
+	if uploadID := a.req.URL.Query().Get("uploadId"); uploadID != "" {
+		return objr.uploadPart(a, uploadID)
+	}
+
 	// TODO is this correct, or should we erase all previous metadata?
 	obj := objr.object
 	if obj == nil {
@@ -679,16 +703,198 @@ func (objr objectResource) put(a *action) interface{} {
 	return nil
 }
 
+type CopyObjectResult struct {
+	ETag         string
+	LastModified string
+}
+
+// copy handles PUT with x-amz-copy-source header (CopyObject).
+// http://docs.aws.amazon.com/AmazonS3/latest/API/RESTObjectCOPY.html
+func (objr objectResource) copy(a *action, source string) interface{} {
+	source, err := url.PathUnescape(source)
+	if err != nil {
+		fatalError(400, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey")
+	}
+	bucketName, objectName, ok := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	if !ok {
+		fatalError(400, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey")
+	}
+	srcBucket := a.srv.buckets[bucketName]
+	if srcBucket == nil {
+		fatalError(404, "NoSuchBucket", "The specified bucket does not exist")
+	}
+	src := srcBucket.objects[objectName]
+	if src == nil {
+		fatalError(404, "NoSuchKey", "The specified key does not exist.")
+	}
+
+	obj := &object{
+		name:     objr.name,
+		meta:     make(http.Header),
+		checksum: src.checksum,
+		etag:     src.etag,
+		data:     src.data,
+		mtime:    time.Now(),
+	}
+	if a.req.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		for key, values := range a.req.Header {
+			key = http.CanonicalHeaderKey(key)
+			if strings.HasPrefix(key, "X-Amz-Meta-") {
+				obj.meta[key] = values
+			}
+		}
+	} else {
+		for key, values := range src.meta {
+			obj.meta[key] = values
+		}
+	}
+	objr.bucket.objects[objr.name] = obj
+
+	return &CopyObjectResult{
+		ETag:         `"` + obj.eTag() + `"`,
+		LastModified: obj.mtime.UTC().Format(timeFormat),
+	}
+}
+
 func (objr objectResource) delete(a *action) interface{} {
+	if uploadID := a.req.URL.Query().Get("uploadId"); uploadID != "" {
+		objr.multipartUpload(uploadID)
+		delete(objr.bucket.uploads, uploadID)
+		return nil
+	}
 	delete(objr.bucket.objects, objr.name)
 	return nil
 }
 
 func (objr objectResource) post(a *action) interface{} {
+	q := a.req.URL.Query()
+	if _, ok := q["uploads"]; ok {
+		return objr.createMultipartUpload(a)
+	}
+	if uploadID := q.Get("uploadId"); uploadID != "" {
+		return objr.completeMultipartUpload(a, uploadID)
+	}
 	fatalError(400, "MethodNotAllowed", "The specified method is not allowed against this resource")
 	return nil
 }
 
+type InitiateMultipartUploadResult struct {
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+type CompleteMultipartUpload struct {
+	Part []struct {
+		PartNumber int
+		ETag       string
+	}
+}
+
+type CompleteMultipartUploadResult struct {
+	Bucket string
+	Key    string
+	ETag   string
+}
+
+// multipartUpload returns upload in progress for the object
+func (objr objectResource) multipartUpload(uploadID string) *multipartUpload {
+	upload := objr.bucket.uploads[uploadID]
+	if upload == nil || upload.name != objr.name {
+		fatalError(404, "NoSuchUpload", "The specified upload does not exist.")
+	}
+	return upload
+}
+
+// createMultipartUpload handles POST with uploads parameter (CreateMultipartUpload).
+func (objr objectResource) createMultipartUpload(a *action) interface{} {
+	upload := &multipartUpload{
+		name:  objr.name,
+		meta:  make(http.Header),
+		parts: make(map[int][]byte),
+	}
+	for key, values := range a.req.Header {
+		key = http.CanonicalHeaderKey(key)
+		if metaHeaders[key] || strings.HasPrefix(key, "X-Amz-Meta-") {
+			upload.meta[key] = values
+		}
+	}
+
+	uploadID := fmt.Sprintf("upload-%s", a.reqID)
+	objr.bucket.uploads[uploadID] = upload
+
+	return &InitiateMultipartUploadResult{
+		Bucket:   objr.bucket.name,
+		Key:      objr.name,
+		UploadId: uploadID,
+	}
+}
+
+// uploadPart handles PUT with uploadId parameter (UploadPart).
+func (objr objectResource) uploadPart(a *action, uploadID string) interface{} {
+	upload := objr.multipartUpload(uploadID)
+
+	partNumber, err := strconv.Atoi(a.req.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 {
+		fatalError(400, "InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive")
+	}
+
+	data, err := io.ReadAll(a.req.Body)
+	if err != nil {
+		fatalError(400, "TODO", "read error")
+	}
+	upload.parts[partNumber] = data
+
+	sum := md5.Sum(data)
+	a.w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	return nil
+}
+
+// completeMultipartUpload handles POST with uploadId parameter (CompleteMultipartUpload).
+func (objr objectResource) completeMultipartUpload(a *action, uploadID string) interface{} {
+	upload := objr.multipartUpload(uploadID)
+
+	var complete CompleteMultipartUpload
+	if err := xml.NewDecoder(a.req.Body).Decode(&complete); err != nil {
+		fatalError(400, "MalformedXML", "%v", err.Error())
+	}
+
+	var data, sums []byte
+	for i, part := range complete.Part {
+		partData, ok := upload.parts[part.PartNumber]
+		if !ok || part.PartNumber != i+1 {
+			fatalError(400, "InvalidPart", "One or more of the specified parts could not be found.")
+		}
+		sum := md5.Sum(partData)
+		if strings.Trim(part.ETag, `"`) != hex.EncodeToString(sum[:]) {
+			fatalError(400, "InvalidPart", "One or more of the specified parts could not be found.")
+		}
+		data = append(data, partData...)
+		sums = append(sums, sum[:]...)
+	}
+
+	// ETag of multipart objects is MD5 of part MD5s with number of parts
+	sum := md5.Sum(sums)
+	checksum := md5.Sum(data)
+	etag := fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(complete.Part))
+
+	objr.bucket.objects[objr.name] = &object{
+		name:     objr.name,
+		meta:     upload.meta,
+		checksum: checksum[:],
+		etag:     etag,
+		data:     data,
+		mtime:    time.Now(),
+	}
+	delete(objr.bucket.uploads, uploadID)
+
+	return &CompleteMultipartUploadResult{
+		Bucket: objr.bucket.name,
+		Key:    objr.name,
+		ETag:   `"` + etag + `"`,
+	}
+}
+
 type CreateBucketConfiguration struct {
 	LocationConstraint string
 }
@@ -0,0 +1,375 @@
+package sftp
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// PublishedStorage abstract file system with published files (actually hosted on remote server accessed over SFTP)
+type PublishedStorage struct {
+	client     *sftp.Client
+	address    string
+	root       string
+	verifySize bool
+}
+
+// Check interface
+var (
+	_ aptly.PublishedStorage         = (*PublishedStorage)(nil)
+	_ aptly.ChecksumPublishedStorage = (*PublishedStorage)(nil)
+)
+
+// NewPublishedStorage connects to SSH server and creates published storage rooted at rootDir
+//
+// Either password or path to privateKey should be set, server host key is verified against
+// knownHosts file (~/.ssh/known_hosts by default)
+func NewPublishedStorage(host string, port int, user, password, privateKey, knownHosts, rootDir, verifyMethod string) (*PublishedStorage, error) {
+	if port == 0 {
+		port = 22
+	}
+
+	var auth []ssh.AuthMethod
+	if privateKey != "" {
+		key, err := os.ReadFile(privateKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading SSH private key")
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing SSH private key")
+		}
+
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("neither password nor private key is configured for %s", host)
+	}
+
+	if knownHosts == "" {
+		knownHosts = filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+	}
+
+	hostKeyCallback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading known hosts")
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+
+	conn, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error connecting to %s", address)
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrapf(err, "error starting SFTP session with %s", address)
+	}
+
+	storage, err := NewPublishedStorageRaw(client, rootDir, verifyMethod)
+	if err != nil {
+		_ = client.Close()
+		_ = conn.Close()
+		return nil, err
+	}
+
+	storage.address = user + "@" + address
+	return storage, nil
+}
+
+// NewPublishedStorageRaw creates published storage on top of established SFTP session
+//
+// rootDir is resolved on the server, empty rootDir is the login directory. verifyMethod
+// is either "md5" (default) or "size", it is used to compare files already present on the server
+func NewPublishedStorageRaw(client *sftp.Client, rootDir, verifyMethod string) (*PublishedStorage, error) {
+	if rootDir == "" {
+		rootDir = "."
+	}
+
+	root, err := client.RealPath(rootDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error resolving root directory %s", rootDir)
+	}
+
+	return &PublishedStorage{
+		client:     client,
+		root:       root,
+		verifySize: strings.EqualFold(verifyMethod, "size"),
+	}, nil
+}
+
+// String returns the storage as string
+func (storage *PublishedStorage) String() string {
+	return fmt.Sprintf("SFTP: %s:%s", storage.address, storage.root)
+}
+
+// remotePath returns full path on the server
+func (storage *PublishedStorage) remotePath(parts ...string) string {
+	return path.Join(append([]string{storage.root}, parts...)...)
+}
+
+// MkDir creates directory recursively under public path
+func (storage *PublishedStorage) MkDir(path string) error {
+	return storage.client.MkdirAll(storage.remotePath(path))
+}
+
+// PutFile puts file into published storage at specified path
+func (storage *PublishedStorage) PutFile(path string, sourceFilename string) error {
+	source, err := os.Open(sourceFilename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+
+	err = storage.putFile(storage.remotePath(path), source)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s", sourceFilename, storage))
+	}
+
+	return err
+}
+
+// putFile uploads file contents to full remote path
+func (storage *PublishedStorage) putFile(remotePath string, source io.Reader) error {
+	f, err := storage.client.Create(remotePath)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.ReadFrom(source)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Remove removes single file under public path
+func (storage *PublishedStorage) Remove(path string) error {
+	if len(path) <= 0 {
+		panic("trying to remove empty path")
+	}
+
+	err := storage.client.Remove(storage.remotePath(path))
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("error deleting %s from %s", path, storage))
+	}
+	return err
+}
+
+// RemoveDirs removes directory structure under public path
+func (storage *PublishedStorage) RemoveDirs(path string, progress aptly.Progress) error {
+	if len(path) <= 0 {
+		panic("trying to remove the root directory")
+	}
+
+	remotePath := storage.remotePath(path)
+	if progress != nil {
+		progress.Printf("Removing %s...\n", remotePath)
+	}
+
+	err := storage.client.RemoveAll(remotePath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, fmt.Sprintf("error deleting %s from %s", path, storage))
+	}
+
+	return nil
+}
+
+// fileMD5 calculates MD5 checksum of the file by reading it from the server
+func (storage *PublishedStorage) fileMD5(remotePath string) (string, error) {
+	f, err := storage.client.Open(remotePath)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	hash := md5.New()
+	if _, err = f.WriteTo(hash); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// LinkFromPool links package file from pool to dist's pool location
+//
+// publishedPrefix is desired prefix for the location in the pool.
+// publishedRelPath is desired location in pool (like pool/component/liba/libav/)
+// sourcePool is instance of aptly.PackagePool
+// sourcePath is filepath to package file in package pool
+//
+// LinkFromPool returns relative path for the published file to be included in package index
+func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath, fileName string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo, force bool) error {
+
+	poolPath := storage.remotePath(publishedPrefix, publishedRelPath, fileName)
+
+	dstStat, err := storage.client.Stat(poolPath)
+	if err == nil {
+		// already exists, check source file
+		var same bool
+
+		if storage.verifySize {
+			srcSize, e := sourcePool.Size(sourcePath)
+			if e != nil {
+				// source file doesn't exist? problem!
+				return e
+			}
+
+			same = srcSize == dstStat.Size()
+		} else {
+			dstMD5, e := storage.fileMD5(poolPath)
+			if e != nil {
+				return e
+			}
+
+			same = dstMD5 == sourceChecksums.MD5
+		}
+
+		if same {
+			return nil
+		}
+
+		if !force {
+			return fmt.Errorf("error putting file to %s: file already exists and is different: %s", poolPath, storage)
+		}
+	} else if !os.IsNotExist(err) {
+		return errors.Wrap(err, fmt.Sprintf("error checking %s in %s", poolPath, storage))
+	}
+
+	err = storage.client.MkdirAll(path.Dir(poolPath))
+	if err != nil {
+		return err
+	}
+
+	source, err := sourcePool.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+
+	err = storage.putFile(poolPath, source)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s", sourcePath, storage))
+	}
+
+	return err
+}
+
+// Filelist returns list of files under prefix
+func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
+	root := storage.remotePath(prefix)
+	result := []string{}
+
+	walker := storage.client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if os.IsNotExist(err) && walker.Path() == root {
+				// file path doesn't exist, consider it empty
+				return []string{}, nil
+			}
+			return nil, err
+		}
+
+		if !walker.Stat().IsDir() {
+			// root might be "/" itself, so it's not always followed by separator
+			result = append(result, strings.TrimPrefix(strings.TrimPrefix(walker.Path(), root), "/"))
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// RenameFile renames (moves) file
+func (storage *PublishedStorage) RenameFile(oldName, newName string) error {
+	oldPath, newPath := storage.remotePath(oldName), storage.remotePath(newName)
+
+	if _, ok := storage.client.HasExtension("posix-rename@openssh.com"); ok {
+		return storage.client.PosixRename(oldPath, newPath)
+	}
+
+	// plain SFTP rename fails if destination exists
+	err := storage.client.Remove(newPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return storage.client.Rename(oldPath, newPath)
+}
+
+// SymLink creates a symbolic link, which can be read with ReadLink
+func (storage *PublishedStorage) SymLink(src string, dst string) error {
+	return storage.client.Symlink(storage.remotePath(src), storage.remotePath(dst))
+}
+
+// HardLink creates a hardlink of a file
+func (storage *PublishedStorage) HardLink(src string, dst string) error {
+	if _, ok := storage.client.HasExtension("hardlink@openssh.com"); !ok {
+		return fmt.Errorf("unable to create hardlink %s: server doesn't support hardlink@openssh.com extension", dst)
+	}
+
+	return storage.client.Link(storage.remotePath(src), storage.remotePath(dst))
+}
+
+// FileExists returns true if path exists
+func (storage *PublishedStorage) FileExists(path string) (bool, error) {
+	_, err := storage.client.Lstat(storage.remotePath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReadLink returns the symbolic link pointed to by path (relative to storage
+// root)
+func (storage *PublishedStorage) ReadLink(path string) (string, error) {
+	target, err := storage.client.ReadLink(storage.remotePath(path))
+	if err != nil {
+		return target, err
+	}
+	return filepath.Rel(storage.root, target)
+}
+
+// FileMD5 returns MD5 checksum of the file under public path
+func (storage *PublishedStorage) FileMD5(path string) (string, error) {
+	return storage.fileMD5(storage.remotePath(path))
+}
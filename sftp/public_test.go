@@ -0,0 +1,289 @@
+package sftp
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type PublishedStorageSuite struct {
+	srv        *Server
+	knownHosts string
+	root       string
+	storage    *PublishedStorage
+}
+
+var _ = Suite(&PublishedStorageSuite{})
+
+func (s *PublishedStorageSuite) SetUpSuite(c *C) {
+	var err error
+	s.srv, err = NewServer()
+	c.Assert(err, IsNil)
+
+	s.knownHosts = filepath.Join(c.MkDir(), "known_hosts")
+	line := knownhosts.Line([]string{s.srv.listener.Addr().String()}, s.srv.hostKey.PublicKey())
+	c.Assert(os.WriteFile(s.knownHosts, []byte(line+"\n"), 0644), IsNil)
+}
+
+func (s *PublishedStorageSuite) TearDownSuite(c *C) {
+	s.srv.Quit()
+}
+
+func (s *PublishedStorageSuite) SetUpTest(c *C) {
+	s.root = c.MkDir()
+
+	var err error
+	s.storage, err = NewPublishedStorage(s.srv.Host(), s.srv.Port(), s.srv.User, s.srv.Password, "", s.knownHosts, s.root, "")
+	c.Assert(err, IsNil)
+}
+
+func (s *PublishedStorageSuite) TearDownTest(c *C) {
+	_ = s.storage.client.Close()
+}
+
+func (s *PublishedStorageSuite) GetFile(c *C, path string) []byte {
+	data, err := os.ReadFile(filepath.Join(s.root, path))
+	c.Assert(err, IsNil)
+
+	return data
+}
+
+func (s *PublishedStorageSuite) AssertNoFile(c *C, path string) {
+	_, err := os.Lstat(filepath.Join(s.root, path))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *PublishedStorageSuite) PutFile(c *C, path string, data []byte) {
+	c.Assert(os.MkdirAll(filepath.Dir(filepath.Join(s.root, path)), 0777), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(s.root, path), data, 0644), IsNil)
+}
+
+func (s *PublishedStorageSuite) TestConnect(c *C) {
+	c.Check(s.storage.String(), Matches, "SFTP: aptly@127.0.0.1:[0-9]+:"+s.root)
+
+	_, err := NewPublishedStorage(s.srv.Host(), s.srv.Port(), s.srv.User, "wrong", "", s.knownHosts, s.root, "")
+	c.Check(err, ErrorMatches, "error connecting to .*unable to authenticate.*")
+
+	_, err = NewPublishedStorage(s.srv.Host(), s.srv.Port(), s.srv.User, "", "", s.knownHosts, s.root, "")
+	c.Check(err, ErrorMatches, "neither password nor private key is configured for 127.0.0.1")
+
+	emptyKnownHosts := filepath.Join(c.MkDir(), "known_hosts")
+	c.Assert(os.WriteFile(emptyKnownHosts, nil, 0644), IsNil)
+	_, err = NewPublishedStorage(s.srv.Host(), s.srv.Port(), s.srv.User, s.srv.Password, "", emptyKnownHosts, s.root, "")
+	c.Check(err, ErrorMatches, "error connecting to .*knownhosts: key is unknown")
+}
+
+func (s *PublishedStorageSuite) TestConnectPrivateKey(c *C) {
+	block, err := ssh.MarshalPrivateKey(s.srv.clientKeyPriv, "")
+	c.Assert(err, IsNil)
+
+	privateKey := filepath.Join(c.MkDir(), "id_ed25519")
+	c.Assert(os.WriteFile(privateKey, pem.EncodeToMemory(block), 0600), IsNil)
+
+	storage, err := NewPublishedStorage(s.srv.Host(), s.srv.Port(), s.srv.User, "", privateKey, s.knownHosts, s.root, "")
+	c.Assert(err, IsNil)
+	defer func() { _ = storage.client.Close() }()
+
+	c.Check(storage.PutFile("a/b.txt", s.localFile(c, "test")), ErrorMatches, ".*(not exist|no such file).*")
+	c.Assert(storage.MkDir("a"), IsNil)
+	c.Check(storage.PutFile("a/b.txt", s.localFile(c, "test")), IsNil)
+	c.Check(s.GetFile(c, "a/b.txt"), DeepEquals, []byte("test"))
+}
+
+func (s *PublishedStorageSuite) localFile(c *C, contents string) string {
+	path := filepath.Join(c.MkDir(), "file")
+	c.Assert(os.WriteFile(path, []byte(contents), 0644), IsNil)
+	return path
+}
+
+func (s *PublishedStorageSuite) TestMkDirPutFile(c *C) {
+	c.Assert(s.storage.MkDir("ppa/dists/squeeze"), IsNil)
+	c.Assert(s.storage.PutFile("ppa/dists/squeeze/Release", s.localFile(c, "Origin: aptly\n")), IsNil)
+
+	c.Check(s.GetFile(c, "ppa/dists/squeeze/Release"), DeepEquals, []byte("Origin: aptly\n"))
+
+	md5, err := s.storage.FileMD5("ppa/dists/squeeze/Release")
+	c.Check(err, IsNil)
+	c.Check(md5, Equals, "7f9c5b8df62b933d72ba8bd4246b87ba")
+
+	c.Assert(s.storage.PutFile("ppa/dists/squeeze/Release", s.localFile(c, "Origin: other\n")), IsNil)
+	c.Check(s.GetFile(c, "ppa/dists/squeeze/Release"), DeepEquals, []byte("Origin: other\n"))
+}
+
+func (s *PublishedStorageSuite) TestFilelist(c *C) {
+	paths := []string{"a", "b", "c", "testa", "test/a", "test/b", "lala/a", "lala/b", "lala/c"}
+	for _, path := range paths {
+		s.PutFile(c, path, []byte("test"))
+	}
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "lala/a", "lala/b", "lala/c", "test/a", "test/b", "testa"})
+
+	list, err = s.storage.Filelist("test")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b"})
+
+	list, err = s.storage.Filelist("test2")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{})
+}
+
+func (s *PublishedStorageSuite) TestRemove(c *C) {
+	s.PutFile(c, "a/b", []byte("test"))
+
+	c.Check(s.storage.Remove("a/b"), IsNil)
+	s.AssertNoFile(c, "a/b")
+
+	c.Check(s.storage.Remove("a/b"), ErrorMatches, "error deleting a/b from SFTP.*")
+}
+
+func (s *PublishedStorageSuite) TestRemoveDirs(c *C) {
+	paths := []string{"a", "b", "c", "testa", "test/a", "test/b", "lala/a", "lala/b", "lala/c"}
+	for _, path := range paths {
+		s.PutFile(c, path, []byte("test"))
+	}
+
+	c.Check(s.storage.RemoveDirs("test", nil), IsNil)
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "lala/a", "lala/b", "lala/c", "testa"})
+
+	c.Check(s.storage.RemoveDirs("test", nil), IsNil)
+}
+
+func (s *PublishedStorageSuite) TestRenameFile(c *C) {
+	s.PutFile(c, "dists/squeeze/Release.tmp", []byte("new"))
+	s.PutFile(c, "dists/squeeze/Release", []byte("old"))
+
+	c.Check(s.storage.RenameFile("dists/squeeze/Release.tmp", "dists/squeeze/Release"), IsNil)
+	c.Check(s.GetFile(c, "dists/squeeze/Release"), DeepEquals, []byte("new"))
+	s.AssertNoFile(c, "dists/squeeze/Release.tmp")
+}
+
+func (s *PublishedStorageSuite) TestLinks(c *C) {
+	s.PutFile(c, "a/b", []byte("test"))
+
+	c.Assert(s.storage.SymLink("a/b", "a/b.link"), IsNil)
+
+	link, err := s.storage.ReadLink("a/b.link")
+	c.Check(err, IsNil)
+	c.Check(link, Equals, "a/b")
+	c.Check(s.GetFile(c, "a/b.link"), DeepEquals, []byte("test"))
+
+	c.Assert(s.storage.HardLink("a/b", "a/b.hard"), IsNil)
+
+	info1, err := os.Stat(filepath.Join(s.root, "a/b"))
+	c.Assert(err, IsNil)
+	info2, err := os.Lstat(filepath.Join(s.root, "a/b.hard"))
+	c.Assert(err, IsNil)
+	c.Check(os.SameFile(info1, info2), Equals, true)
+}
+
+func (s *PublishedStorageSuite) TestFileExists(c *C) {
+	s.PutFile(c, "a/b", []byte("test"))
+
+	exists, err := s.storage.FileExists("a/b")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, true)
+
+	exists, err = s.storage.FileExists("a/c")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, false)
+}
+
+func (s *PublishedStorageSuite) TestLinkFromPool(c *C) {
+	root := c.MkDir()
+	pool := files.NewPackagePool(root, false)
+	cs := files.NewMockChecksumStorage()
+
+	tmpFile1 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err := os.WriteFile(tmpFile1, []byte("Contents"), 0644)
+	c.Assert(err, IsNil)
+	cksum1 := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	tmpFile2 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err = os.WriteFile(tmpFile2, []byte("Spam"), 0644)
+	c.Assert(err, IsNil)
+	cksum2 := utils.ChecksumInfo{MD5: "e9dfd31cc505d51fc26975250750deab"}
+
+	tmpFile3 := filepath.Join(c.MkDir(), "netboot/boot.img.gz")
+	_ = os.MkdirAll(filepath.Dir(tmpFile3), 0777)
+	err = os.WriteFile(tmpFile3, []byte("Contents"), 0644)
+	c.Assert(err, IsNil)
+	cksum3 := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	src1, err := pool.Import(tmpFile1, "mars-invaders_1.03.deb", &cksum1, true, cs)
+	c.Assert(err, IsNil)
+	src2, err := pool.Import(tmpFile2, "mars-invaders_1.03.deb", &cksum2, true, cs)
+	c.Assert(err, IsNil)
+	src3, err := pool.Import(tmpFile3, "netboot/boot.img.gz", &cksum3, true, cs)
+	c.Assert(err, IsNil)
+
+	// first link from pool
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+
+	c.Check(s.GetFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contents"))
+
+	// duplicate link from pool, providing wrong path for source file
+	//
+	// file already exists on the server with the same checksum, so it is not uploaded again
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, "wrong-path", cksum1, false)
+	c.Check(err, IsNil)
+
+	// link from pool with conflict
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, false)
+	c.Check(err, ErrorMatches, ".*file already exists and is different.*")
+
+	c.Check(s.GetFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contents"))
+
+	// link from pool with conflict and force
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, true)
+	c.Check(err, IsNil)
+
+	c.Check(s.GetFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Spam"))
+
+	// link from pool with prefix and nested file name
+	err = s.storage.LinkFromPool("ppa", "dists/jessie/non-free/installer-i386/current/images", "netboot/boot.img.gz", pool, src3, cksum3, false)
+	c.Check(err, IsNil)
+
+	c.Check(s.GetFile(c, "ppa/dists/jessie/non-free/installer-i386/current/images/netboot/boot.img.gz"), DeepEquals, []byte("Contents"))
+}
+
+func (s *PublishedStorageSuite) TestLinkFromPoolVerifySize(c *C) {
+	storage, err := NewPublishedStorageRaw(s.storage.client, s.root, "size")
+	c.Assert(err, IsNil)
+
+	root := c.MkDir()
+	pool := files.NewPackagePool(root, false)
+	cs := files.NewMockChecksumStorage()
+
+	tmpFile := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	c.Assert(os.WriteFile(tmpFile, []byte("Contents"), 0644), IsNil)
+	cksum := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	src, err := pool.Import(tmpFile, "mars-invaders_1.03.deb", &cksum, true, cs)
+	c.Assert(err, IsNil)
+
+	// same size, different contents: considered the same
+	s.PutFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb", []byte("Contentz"))
+
+	err = storage.LinkFromPool("", "pool/main/m/mars-invaders", "mars-invaders_1.03.deb", pool, src, cksum, false)
+	c.Check(err, IsNil)
+	c.Check(s.GetFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contentz"))
+
+	// different size
+	s.PutFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb", []byte("Spam"))
+
+	err = storage.LinkFromPool("", "pool/main/m/mars-invaders", "mars-invaders_1.03.deb", pool, src, cksum, false)
+	c.Check(err, ErrorMatches, ".*file already exists and is different.*")
+}
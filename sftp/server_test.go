@@ -0,0 +1,138 @@
+package sftp
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Server is in-process SSH server which serves SFTP subsystem over local filesystem
+type Server struct {
+	listener  net.Listener
+	hostKey   ssh.Signer
+	clientKey ssh.Signer
+	// private key matching clientKey
+	clientKeyPriv ed25519.PrivateKey
+	User          string
+	Password      string
+}
+
+// NewServer starts SSH server on random local port
+func NewServer() (*Server, error) {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &Server{User: "aptly", Password: "secret", clientKeyPriv: clientPriv}
+
+	if srv.hostKey, err = ssh.NewSignerFromKey(hostPriv); err != nil {
+		return nil, err
+	}
+	if srv.clientKey, err = ssh.NewSignerFromKey(clientPriv); err != nil {
+		return nil, err
+	}
+
+	srv.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == srv.User && string(password) == srv.Password {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == srv.User && bytes.Equal(key.Marshal(), srv.clientKey.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(srv.hostKey)
+
+	go srv.serve(config)
+
+	return srv, nil
+}
+
+// Host returns host of the server
+func (srv *Server) Host() string {
+	return srv.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns port of the server
+func (srv *Server) Port() int {
+	return srv.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Quit stops the server
+func (srv *Server) Quit() {
+	_ = srv.listener.Close()
+}
+
+func (srv *Server) serve(config *ssh.ServerConfig) {
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go srv.handle(conn, config)
+	}
+}
+
+func (srv *Server) handle(conn net.Conn, config *ssh.ServerConfig) {
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	defer func() {
+		_ = sshConn.Close()
+	}()
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 &&
+					string(req.Payload[4:4+binary.BigEndian.Uint32(req.Payload)]) == "sftp"
+				_ = req.Reply(ok, nil)
+
+				if ok {
+					server, err := sftp.NewServer(channel)
+					if err == nil {
+						_ = server.Serve()
+					}
+					_ = channel.Close()
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,2 @@
+// Package sftp handles publishing to remote servers over SSH (SFTP)
+package sftp
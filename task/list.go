@@ -1,10 +1,15 @@
 package task
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/aptly-dev/aptly/aptly"
+	"github.com/rs/zerolog/log"
 )
 
 // List is handling list of processes and makes sure
@@ -18,9 +23,27 @@ type List struct {
 	usedResources *ResourcesSet
 	idCounter     int
 
-	queue     chan *Task
-	queueWg   *sync.WaitGroup
-	queueDone chan bool
+	// limits caps number of running tasks per kind (unlimited if missing or 0)
+	limits map[string]int
+	// stopped list doesn't start queued tasks anymore
+	stopped bool
+
+	// observer is notified about task state changes
+	observer func(task Task)
+
+	// store persists tasks, finished tasks are removed after retention (kept until deleted if 0)
+	store     Store
+	retention time.Duration
+}
+
+// Options are scheduling options of the task
+type Options struct {
+	// Kind of the task, number of running tasks of the same kind could be limited
+	Kind string
+	// Priority of the task, queued tasks with higher priority are started first
+	Priority int
+	// Timeout of the task process, task fails once it runs longer (no timeout if 0)
+	Timeout time.Duration
 }
 
 // NewList creates empty task list
@@ -31,78 +54,266 @@ func NewList() *List {
 		wgTasks:       make(map[int]*sync.WaitGroup),
 		wg:            &sync.WaitGroup{},
 		usedResources: NewResourcesSet(),
-		queue:         make(chan *Task),
-		queueWg:       &sync.WaitGroup{},
-		queueDone:     make(chan bool),
+		limits:        make(map[string]int),
 	}
-	go list.consumer()
 	return list
 }
 
-// consumer is processing the queue
-func (list *List) consumer() {
-	for {
-		select {
-		case task := <-list.queue:
-			list.Lock()
-			{
-				task.State = RUNNING
+// queued returns tasks waiting to be started, in the order they would be started:
+// by priority, then by ID. List should be locked
+func (list *List) queued() []*Task {
+	var queued []*Task
+	for _, task := range list.tasks {
+		if task.State == IDLE {
+			queued = append(queued, task)
+		}
+	}
+
+	sort.SliceStable(queued, func(i, j int) bool {
+		return queued[i].Priority > queued[j].Priority
+	})
+
+	return queued
+}
+
+// blockedBy returns IDs of running tasks which prevent queued task from being started:
+// tasks using its resources and, if kind limit is reached, running tasks of the same kind.
+// List should be locked
+func (list *List) blockedBy(task *Task) []int {
+	var ids []int
+	for _, t := range list.usedResources.UsedBy(task.resources) {
+		ids = append(ids, t.ID)
+	}
+
+	if limit := list.limits[task.Kind]; task.Kind != "" && limit > 0 {
+		var running []int
+		for _, t := range list.tasks {
+			if t.State == RUNNING && t.Kind == task.Kind {
+				running = append(running, t.ID)
 			}
-			list.Unlock()
-
-			go func() {
-				retValue, err := task.process(aptly.Progress(task.output), task.detail)
-
-				list.Lock()
-				{
-					task.processReturnValue = retValue
-					task.err = err
-					if err != nil {
-						task.output.Printf("Task failed with error: %v", err)
-						task.State = FAILED
-					} else {
-						task.output.Print("Task succeeded")
-						task.State = SUCCEEDED
-					}
-
-					list.usedResources.Free(task.resources)
-
-					task.wgTask.Done()
-					list.wg.Done()
-
-					for _, t := range list.tasks {
-						if t.State == IDLE {
-							// check resources
-							blockingTasks := list.usedResources.UsedBy(t.resources)
-							if len(blockingTasks) == 0 {
-								list.usedResources.MarkInUse(task.resources, task)
-								list.queue <- t
-								break
-							}
-						}
-					}
-				}
-				list.Unlock()
-			}()
-
-		case <-list.queueDone:
-			return
-		}
-	}
-}
-
-// Stop signals the consumer to stop processing tasks and waits for it to finish
+		}
+
+		if len(running) >= limit {
+			ids = append(ids, running...)
+		}
+	}
+
+	sort.Ints(ids)
+
+	// task could be blocked by the same task for both reasons
+	var result []int
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			result = append(result, id)
+		}
+	}
+
+	return result
+}
+
+// schedule starts all the queued tasks which are not blocked, list should be locked
+func (list *List) schedule() {
+	if list.stopped {
+		return
+	}
+
+	for _, task := range list.queued() {
+		if len(list.blockedBy(task)) == 0 {
+			list.usedResources.MarkInUse(task.resources, task)
+
+			task.State = RUNNING
+			task.StartedAt = time.Now()
+			list.notify(task)
+
+			go list.run(task)
+		}
+	}
+}
+
+// run executes process of the task, finishes the task and starts next queued tasks
+func (list *List) run(task *Task) {
+	ctx := task.ctx
+	if task.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, task.timeout)
+		defer cancel()
+	}
+
+	retValue, err := task.process(ctx, aptly.Progress(task.output), task.detail)
+
+	list.Lock()
+	defer list.Unlock()
+
+	task.processReturnValue = retValue
+	task.err = err
+	if err != nil && task.ctx.Err() != nil {
+		task.output.Printf("Task cancelled: %v", err)
+		task.State = CANCELLED
+	} else if err != nil && ctx.Err() != nil {
+		task.output.Printf("Task timed out after %s: %v", task.timeout, err)
+		task.State = FAILED
+	} else if err != nil {
+		task.output.Printf("Task failed with error: %v", err)
+		task.State = FAILED
+	} else {
+		task.output.Print("Task succeeded")
+		task.State = SUCCEEDED
+	}
+	task.cancel()
+	task.FinishedAt = time.Now()
+	list.notify(task)
+	list.prune()
+
+	task.wgTask.Done()
+	list.wg.Done()
+
+	list.usedResources.Free(task.resources)
+	list.schedule()
+}
+
+// view returns copy of the task, queued task gets its queue position and
+// blocking tasks filled in. List should be locked
+func (list *List) view(task *Task, queued []*Task) Task {
+	result := *task
+	if task.State == IDLE {
+		for i, t := range queued {
+			if t == task {
+				result.QueuePosition = i + 1
+				break
+			}
+		}
+		result.BlockedBy = list.blockedBy(task)
+	}
+
+	return result
+}
+
+// SetConcurrencyLimits sets maximum number of running tasks per kind, 0 means unlimited
+func (list *List) SetConcurrencyLimits(limits map[string]int) {
+	list.Lock()
+	defer list.Unlock()
+
+	list.limits = make(map[string]int)
+	for kind, limit := range limits {
+		list.limits[kind] = limit
+	}
+
+	list.schedule()
+}
+
+// SetObserver sets function called on every change of task state, observer
+// is called with the list locked, so it should never block
+func (list *List) SetObserver(observer func(task Task)) {
+	list.Lock()
+	defer list.Unlock()
+
+	list.observer = observer
+}
+
+// notify reports task state to the observer and saves it to the store, list should be locked
+func (list *List) notify(task *Task) {
+	if list.store != nil {
+		if err := list.store.SaveTask(task.record()); err != nil {
+			log.Warn().Msgf("Unable to save task %d: %s", task.ID, err)
+		}
+	}
+
+	if list.observer != nil {
+		list.observer(*task)
+	}
+}
+
+// forget removes finished task from the store, list should be locked
+func (list *List) forget(task *Task) {
+	if list.store != nil {
+		if err := list.store.DeleteTask(task.ID); err != nil {
+			log.Warn().Msgf("Unable to delete task %d: %s", task.ID, err)
+		}
+	}
+}
+
+// prune removes finished tasks older than retention, list should be locked
+func (list *List) prune() {
+	if list.retention <= 0 {
+		return
+	}
+
+	threshold := time.Now().Add(-list.retention)
+
+	var tasks []*Task
+	for _, task := range list.tasks {
+		if task.State.finished() && task.FinishedAt.Before(threshold) {
+			list.forget(task)
+			delete(list.wgTasks, task.ID)
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	list.tasks = tasks
+}
+
+// Restore loads tasks saved to the store by previous run and starts saving tasks to it
+//
+// Tasks which were queued or running are marked as INTERRUPTED, as their processes
+// can't be restored. Finished tasks older than retention are removed (0 keeps them
+// until deleted).
+func (list *List) Restore(store Store, retention time.Duration) error {
+	records, err := store.LoadTasks()
+	if err != nil {
+		return err
+	}
+
+	list.Lock()
+	defer list.Unlock()
+
+	list.store = store
+	list.retention = retention
+
+	var restored []*Task
+	for _, record := range records {
+		if _, exists := list.wgTasks[record.ID]; exists {
+			continue
+		}
+
+		task := restoreTask(record)
+		if !task.State.finished() {
+			if output := task.output.String(); output != "" && !strings.HasSuffix(output, "\n") {
+				task.output.Print("\n")
+			}
+			task.output.Print("Task interrupted by restart of API server")
+			task.State = INTERRUPTED
+			task.FinishedAt = time.Now()
+			list.notify(task)
+		}
+
+		restored = append(restored, task)
+		list.wgTasks[task.ID] = task.wgTask
+		if task.ID > list.idCounter {
+			list.idCounter = task.ID
+		}
+	}
+
+	list.tasks = append(restored, list.tasks...)
+	list.prune()
+
+	return nil
+}
+
+// Stop stops starting queued tasks, running tasks are not affected
 func (list *List) Stop() {
-	close(list.queueDone)
-	list.queueWg.Wait()
+	list.Lock()
+	defer list.Unlock()
+
+	list.stopped = true
 }
 
 // GetTasks gets complete list of tasks
 func (list *List) GetTasks() []Task {
 	tasks := []Task{}
 	list.Lock()
+	queued := list.queued()
 	for _, task := range list.tasks {
-		tasks = append(tasks, *task)
+		tasks = append(tasks, list.view(task, queued))
 	}
 
 	list.Unlock()
@@ -118,8 +329,9 @@ func (list *List) DeleteTaskByID(ID int) (Task, error) {
 	tasks := list.tasks
 	for i, task := range tasks {
 		if task.ID == ID {
-			if task.State == SUCCEEDED || task.State == FAILED {
+			if task.State.finished() {
 				list.tasks = append(tasks[:i], tasks[i+1:]...)
+				list.forget(task)
 				return *task, nil
 			}
 
@@ -133,12 +345,11 @@ func (list *List) DeleteTaskByID(ID int) (Task, error) {
 // GetTaskByID returns task with given id
 func (list *List) GetTaskByID(ID int) (Task, error) {
 	list.Lock()
-	tasks := list.tasks
-	list.Unlock()
+	defer list.Unlock()
 
-	for _, task := range tasks {
+	for _, task := range list.tasks {
 		if task.ID == ID {
-			return *task, nil
+			return list.view(task, list.queued()), nil
 		}
 	}
 
@@ -183,31 +394,72 @@ func (list *List) GetTaskReturnValueByID(ID int) (*ProcessReturnValue, error) {
 	return task.processReturnValue, nil
 }
 
-// RunTaskInBackground creates task and runs it in background. This will block until the necessary resources
-// become available.
+// RunTaskInBackground creates task and runs it in background. Task is queued until
+// the necessary resources become available.
 func (list *List) RunTaskInBackground(name string, resources []string, process Process) (Task, *ResourceConflictError) {
+	return list.RunTaskInBackgroundWithOptions(name, resources, process, Options{})
+}
+
+// RunTaskInBackgroundWithOptions creates task of given kind, priority and timeout and runs it in background
+func (list *List) RunTaskInBackgroundWithOptions(name string, resources []string, process Process, options Options) (Task, *ResourceConflictError) {
 	list.Lock()
 	defer list.Unlock()
 
 	list.idCounter++
 	wgTask := &sync.WaitGroup{}
 	task := NewTask(process, name, list.idCounter, resources, wgTask)
+	task.Kind = options.Kind
+	task.Priority = options.Priority
+	task.timeout = options.Timeout
+	if options.Timeout > 0 {
+		task.Timeout = options.Timeout.String()
+	}
 
 	list.tasks = append(list.tasks, task)
 	list.wgTasks[task.ID] = wgTask
+	list.notify(task)
 
 	list.wg.Add(1)
 	task.wgTask.Add(1)
 
-	// add task to queue for processing if resources are available
-	// if not, task will be queued by the consumer once resources are available
-	tasks := list.usedResources.UsedBy(resources)
-	if len(tasks) == 0 {
-		list.usedResources.MarkInUse(task.resources, task)
-		list.queue <- task
+	// start task if it is not blocked, otherwise it stays queued
+	// until running tasks finish
+	list.schedule()
+
+	return list.view(task, list.queued()), nil
+}
+
+// CancelTaskByID cancels given task. Queued task is cancelled immediately, running
+// task is asked to stop and becomes CANCELLED once its process returns.
+func (list *List) CancelTaskByID(ID int) (Task, error) {
+	list.Lock()
+	defer list.Unlock()
+
+	for _, task := range list.tasks {
+		if task.ID != ID {
+			continue
+		}
+
+		if task.State.finished() {
+			return *task, fmt.Errorf("task with id %v is already finished", ID)
+		}
+
+		task.cancel()
+
+		if task.State == IDLE {
+			task.output.Print("Task cancelled")
+			task.State = CANCELLED
+			task.FinishedAt = time.Now()
+			list.notify(task)
+
+			task.wgTask.Done()
+			list.wg.Done()
+		}
+
+		return *task, nil
 	}
 
-	return *task, nil
+	return Task{}, fmt.Errorf("could not find task with id %v", ID)
 }
 
 // Clear removes finished tasks from list
@@ -216,7 +468,9 @@ func (list *List) Clear() {
 
 	var tasks []*Task
 	for _, task := range list.tasks {
-		if task.State == IDLE || task.State == RUNNING {
+		if task.State.finished() {
+			list.forget(task)
+		} else {
 			tasks = append(tasks, task)
 		}
 	}
@@ -1,7 +1,9 @@
 package task
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/aptly-dev/aptly/aptly"
 
@@ -17,7 +19,7 @@ func (s *ListSuite) TestList(c *check.C) {
 	list := NewList()
 	c.Assert(len(list.GetTasks()), check.Equals, 0)
 
-	task, err := list.RunTaskInBackground("Successful task", nil, func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+	task, err := list.RunTaskInBackground("Successful task", nil, func(_ context.Context, out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
 		return nil, nil
 	})
 	c.Assert(err, check.IsNil)
@@ -32,7 +34,7 @@ func (s *ListSuite) TestList(c *check.C) {
 	detail, _ := list.GetTaskDetailByID(task.ID)
 	c.Check(detail, check.Equals, struct{}{})
 
-	task, err = list.RunTaskInBackground("Faulty task", nil, func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+	task, err = list.RunTaskInBackground("Faulty task", nil, func(_ context.Context, out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
 		detail.Store("Details")
 		out.Printf("Test Progress\n")
 		return nil, errors.New("Task failed")
@@ -52,3 +54,145 @@ func (s *ListSuite) TestList(c *check.C) {
 	c.Check(deleteErr, check.IsNil)
         list.Stop()
 }
+
+func (s *ListSuite) TestObserver(c *check.C) {
+	list := NewList()
+	defer list.Stop()
+
+	var states []string
+	list.SetObserver(func(task Task) {
+		states = append(states, task.Name+" "+task.State.String())
+	})
+
+	task, err := list.RunTaskInBackground("Observed task", nil, func(_ context.Context, out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+		c.Check(detail.TaskID(), check.Equals, 1)
+		return nil, nil
+	})
+	c.Assert(err, check.IsNil)
+	_, _ = list.WaitForTaskByID(task.ID)
+
+	list.Lock()
+	c.Check(states, check.DeepEquals, []string{"Observed task IDLE", "Observed task RUNNING", "Observed task SUCCEEDED"})
+	list.Unlock()
+
+	c.Check(State(42).String(), check.Equals, "State(42)")
+}
+
+func (s *ListSuite) TestCancel(c *check.C) {
+	list := NewList()
+	defer list.Stop()
+
+	started := make(chan struct{})
+	running, _ := list.RunTaskInBackground("Long task", []string{"Rdebian"}, func(ctx context.Context, out aptly.Progress, _ *Detail) (*ProcessReturnValue, error) {
+		out.Printf("Downloading\n")
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	queued, _ := list.RunTaskInBackground("Queued task", []string{"Rdebian"}, func(_ context.Context, _ aptly.Progress, _ *Detail) (*ProcessReturnValue, error) {
+		c.Error("cancelled task should not run")
+		return nil, nil
+	})
+	next, _ := list.RunTaskInBackground("Next task", []string{"Rdebian"}, func(_ context.Context, _ aptly.Progress, _ *Detail) (*ProcessReturnValue, error) {
+		return nil, nil
+	})
+	<-started
+
+	task, err := list.CancelTaskByID(queued.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(task.State, check.Equals, CANCELLED)
+	output, _ := list.GetTaskOutputByID(queued.ID)
+	c.Check(output, check.Equals, "Task cancelled")
+
+	task, err = list.CancelTaskByID(running.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(task.State, check.Equals, RUNNING)
+
+	task, _ = list.WaitForTaskByID(running.ID)
+	c.Check(task.State, check.Equals, CANCELLED)
+	output, _ = list.GetTaskOutputByID(running.ID)
+	c.Check(output, check.Equals, "Downloading\nTask cancelled: context canceled")
+
+	// resources are released, next task runs
+	task, _ = list.WaitForTaskByID(next.ID)
+	c.Check(task.State, check.Equals, SUCCEEDED)
+
+	_, err = list.CancelTaskByID(next.ID)
+	c.Check(err, check.ErrorMatches, "task with id 3 is already finished")
+	_, err = list.CancelTaskByID(42)
+	c.Check(err, check.ErrorMatches, "could not find task with id 42")
+
+	_, err = list.DeleteTaskByID(queued.ID)
+	c.Check(err, check.IsNil)
+	list.Wait()
+}
+
+func (s *ListSuite) TestScheduling(c *check.C) {
+	list := NewList()
+	defer list.Stop()
+	list.SetConcurrencyLimits(map[string]int{"mirror-update": 1})
+
+	var started []string
+	list.SetObserver(func(task Task) {
+		if task.State == RUNNING {
+			started = append(started, task.Name)
+		}
+	})
+
+	release := make(chan struct{})
+	blocking := func(_ context.Context, _ aptly.Progress, _ *Detail) (*ProcessReturnValue, error) {
+		<-release
+		return nil, nil
+	}
+	quick := func(_ context.Context, _ aptly.Progress, _ *Detail) (*ProcessReturnValue, error) {
+		return nil, nil
+	}
+
+	a, _ := list.RunTaskInBackgroundWithOptions("A", []string{"Ra"}, blocking, Options{Kind: "mirror-update"})
+	c.Check(a.State, check.Equals, RUNNING)
+	b, _ := list.RunTaskInBackgroundWithOptions("B", []string{"Rb"}, quick, Options{Kind: "mirror-update"})
+	cc, _ := list.RunTaskInBackgroundWithOptions("C", []string{"Ra"}, blocking, Options{})
+	d, _ := list.RunTaskInBackgroundWithOptions("D", []string{"Ra"}, quick, Options{Priority: 10})
+
+	tasks := list.GetTasks()
+	c.Assert(tasks, check.HasLen, 4)
+	c.Check(tasks[0].QueuePosition, check.Equals, 0)
+	c.Check(tasks[0].BlockedBy, check.IsNil)
+	c.Check(tasks[1].Kind, check.Equals, "mirror-update")
+	c.Check(tasks[1].QueuePosition, check.Equals, 2)
+	c.Check(tasks[1].BlockedBy, check.DeepEquals, []int{a.ID})
+	c.Check(tasks[2].QueuePosition, check.Equals, 3)
+	c.Check(tasks[2].BlockedBy, check.DeepEquals, []int{a.ID})
+	c.Check(tasks[3].Priority, check.Equals, 10)
+	c.Check(tasks[3].QueuePosition, check.Equals, 1)
+
+	release <- struct{}{}
+	_, _ = list.WaitForTaskByID(b.ID)
+	_, _ = list.WaitForTaskByID(d.ID)
+
+	// higher priority task goes first, limit of the kind is not reached anymore
+	list.Lock()
+	c.Check(started, check.DeepEquals, []string{"A", "D", "B", "C"})
+	list.Unlock()
+
+	close(release)
+	task, _ := list.WaitForTaskByID(cc.ID)
+	c.Check(task.State, check.Equals, SUCCEEDED)
+	c.Check(task.QueuePosition, check.Equals, 0)
+}
+
+func (s *ListSuite) TestTimeout(c *check.C) {
+	list := NewList()
+	defer list.Stop()
+
+	task, _ := list.RunTaskInBackgroundWithOptions("Slow task", nil, func(ctx context.Context, _ aptly.Progress, _ *Detail) (*ProcessReturnValue, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, Options{Timeout: 10 * time.Millisecond})
+	c.Check(task.Timeout, check.Equals, "10ms")
+
+	task, _ = list.WaitForTaskByID(task.ID)
+	c.Check(task.State, check.Equals, FAILED)
+	output, _ := list.GetTaskOutputByID(task.ID)
+	c.Check(output, check.Equals, "Task timed out after 10ms: context deadline exceeded")
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/aptly-dev/aptly/aptly"
 )
@@ -19,14 +20,48 @@ type Output struct {
 type PublishOutput struct {
 	aptly.Progress
 	PublishDetail
+	// packages are processed in parallel, so bar updates are protected
+	mu      sync.Mutex
 	barType *aptly.BarType
 }
 
+// ProgressOutput specific output for tasks reporting ProgressDetail
+//
+// Progress bars listed in phases update the detail of the task, other
+// bars are passed through.
+type ProgressOutput struct {
+	aptly.Progress
+	// Extend builds task specific detail out of progress, called with output locked
+	Extend func(progress ProgressDetail) interface{}
+
+	detail *Detail
+	phases map[aptly.BarType]string
+	now    func() time.Time
+
+	// files are downloaded in parallel, so updates are protected
+	mu       sync.Mutex
+	progress ProgressDetail
+	bar      bool
+	barBytes bool
+
+	rate         float64
+	rateTime     time.Time
+	ratePosition int64
+}
+
+// progressRateInterval is the window transfer rate is measured over
+const progressRateInterval = time.Second
+
 // NewOutput creates new output
 func NewOutput() *Output {
 	return &Output{mu: &sync.Mutex{}, output: &bytes.Buffer{}}
 }
 
+// NewProgressOutput creates new output storing progress of phases into detail
+func NewProgressOutput(progress aptly.Progress, detail *Detail, phases map[aptly.BarType]string) *ProgressOutput {
+	return &ProgressOutput{Progress: progress, detail: detail, phases: phases, now: time.Now}
+}
+
 func (t *Output) String() string {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -69,6 +104,9 @@ func (t *Output) InitBar(_ int64, _ bool, _ aptly.BarType) {
 
 // InitBar publish output specific
 func (t *PublishOutput) InitBar(count int64, _ bool, barType aptly.BarType) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	t.barType = &barType
 	if barType == aptly.BarPublishGeneratePackageFiles {
 		t.TotalNumberOfPackages = count
@@ -77,6 +115,60 @@ func (t *PublishOutput) InitBar(count int64, _ bool, barType aptly.BarType) {
 	}
 }
 
+// InitBar progress output specific
+func (t *ProgressOutput) InitBar(count int64, isBytes bool, barType aptly.BarType) {
+	t.Progress.InitBar(count, isBytes, barType)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	phase, ok := t.phases[barType]
+	t.bar = ok
+	if !ok {
+		return
+	}
+
+	if phase != t.progress.Phase {
+		t.progress = ProgressDetail{Phase: phase}
+	}
+	t.barBytes = isBytes
+	if isBytes {
+		t.progress.TotalBytes, t.progress.DoneBytes = count, 0
+	} else {
+		t.progress.TotalFiles, t.progress.DoneFiles = count, 0
+	}
+	t.resetRate()
+	t.store()
+}
+
+// SetPhase starts next phase of the task with given amount of files and bytes to process
+func (t *ProgressOutput) SetPhase(phase string, totalFiles, totalBytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.progress = ProgressDetail{Phase: phase, TotalFiles: totalFiles, TotalBytes: totalBytes}
+	t.bar, t.barBytes = false, false
+	t.resetRate()
+	t.store()
+}
+
+// AddFiles marks files of current phase as processed
+func (t *ProgressOutput) AddFiles(count int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.progress.DoneFiles += int64(count)
+	t.update()
+}
+
+// Detail returns current progress
+func (t *ProgressOutput) Detail() ProgressDetail {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.progress
+}
+
 // ShutdownBar is needed for progress compatibility
 func (t *Output) ShutdownBar() {
 	// Not implemented
@@ -84,9 +176,26 @@ func (t *Output) ShutdownBar() {
 
 // ShutdownBar publish output specific
 func (t *PublishOutput) ShutdownBar() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	t.barType = nil
 }
 
+// ShutdownBar progress output specific
+func (t *ProgressOutput) ShutdownBar() {
+	t.Progress.ShutdownBar()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.bar {
+		t.bar, t.barBytes = false, false
+		t.resetRate()
+		t.store()
+	}
+}
+
 // AddBar is needed for progress compatibility
 func (t *Output) AddBar(_ int) {
 	// Not implemented
@@ -94,17 +203,120 @@ func (t *Output) AddBar(_ int) {
 
 // AddBar publish output specific
 func (t *PublishOutput) AddBar(_ int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	if t.barType != nil && *t.barType == aptly.BarPublishGeneratePackageFiles {
 		t.RemainingNumberOfPackages--
 		t.Store(t)
 	}
 }
 
+// AddBar progress output specific
+func (t *ProgressOutput) AddBar(count int) {
+	t.Progress.AddBar(count)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.bar {
+		*t.position() += int64(count)
+		t.update()
+	}
+}
+
 // SetBar sets current position for progress bar
 func (t *Output) SetBar(_ int) {
 	// Not implemented
 }
 
+// SetBar progress output specific
+func (t *ProgressOutput) SetBar(count int) {
+	t.Progress.SetBar(count)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.bar {
+		*t.position() = int64(count)
+		t.update()
+	}
+}
+
+// Write counts downloaded bytes if current bar is in bytes
+func (t *ProgressOutput) Write(p []byte) (n int, err error) {
+	n, err = t.Progress.Write(p)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.bar && t.barBytes {
+		t.progress.DoneBytes += int64(n)
+		t.update()
+	}
+	return
+}
+
+// position returns counter the rate is measured on
+func (t *ProgressOutput) position() *int64 {
+	if t.barBytes {
+		return &t.progress.DoneBytes
+	}
+	return &t.progress.DoneFiles
+}
+
+func (t *ProgressOutput) total() int64 {
+	if t.barBytes {
+		return t.progress.TotalBytes
+	}
+	return t.progress.TotalFiles
+}
+
+func (t *ProgressOutput) resetRate() {
+	t.rate = 0
+	t.rateTime = t.now()
+	t.ratePosition = *t.position()
+	t.progress.BytesPerSecond = 0
+	t.progress.ETA = ""
+}
+
+// update recalculates rate and ETA once per interval and stores the detail
+func (t *ProgressOutput) update() {
+	now := t.now()
+	position := *t.position()
+
+	if elapsed := now.Sub(t.rateTime); elapsed >= progressRateInterval {
+		t.rate = float64(position-t.ratePosition) / elapsed.Seconds()
+		t.rateTime = now
+		t.ratePosition = position
+
+		t.progress.BytesPerSecond = 0
+		if t.barBytes {
+			t.progress.BytesPerSecond = int64(t.rate)
+		}
+		t.progress.ETA = ""
+		if remaining := t.total() - position; t.rate > 0 && remaining > 0 {
+			eta := time.Duration(float64(remaining) / t.rate * float64(time.Second))
+			t.progress.ETA = eta.Round(time.Second).String()
+		}
+	}
+
+	t.store()
+}
+
+// store saves copy of the progress, so detail can be read while output is updated
+func (t *ProgressOutput) store() {
+	if t.detail == nil {
+		return
+	}
+
+	if t.Extend != nil {
+		t.detail.Store(t.Extend(t.progress))
+	} else {
+		t.detail.Store(t.progress)
+	}
+}
+
 // Printf does printf in a safe manner
 func (t *Output) Printf(msg string, a ...interface{}) {
 	_, _ = t.WriteString(fmt.Sprintf(msg, a...))
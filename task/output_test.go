@@ -0,0 +1,123 @@
+package task
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+
+	check "gopkg.in/check.v1"
+)
+
+type OutputSuite struct{}
+
+var _ = check.Suite(&OutputSuite{})
+
+func (s *OutputSuite) TestPublishOutputParallel(c *check.C) {
+	output := &PublishOutput{
+		Progress:      NewOutput(),
+		PublishDetail: PublishDetail{Detail: &Detail{}},
+	}
+
+	output.InitBar(100, false, aptly.BarPublishGeneratePackageFiles)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				output.AddBar(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	output.ShutdownBar()
+	output.AddBar(1)
+
+	c.Check(output.TotalNumberOfPackages, check.Equals, int64(100))
+	c.Check(output.RemainingNumberOfPackages, check.Equals, int64(0))
+	c.Check(output.Load().(*PublishOutput), check.Equals, output)
+}
+
+func (s *OutputSuite) TestProgressOutput(c *check.C) {
+	detail := &Detail{}
+	output := NewProgressOutput(NewOutput(), detail, map[aptly.BarType]string{
+		aptly.BarMirrorUpdateDownloadPackages: "downloading",
+		aptly.BarMirrorUpdateFinalizeDownload: "importing",
+	})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	output.now = func() time.Time { return now }
+
+	output.SetPhase("downloading", 2, 3000)
+	output.InitBar(3000, true, aptly.BarMirrorUpdateDownloadPackages)
+	c.Check(detail.Load(), check.DeepEquals, ProgressDetail{Phase: "downloading", TotalFiles: 2, TotalBytes: 3000})
+
+	// bars not mapped to phases are passed through
+	output.InitBar(10, false, aptly.BarGeneralBuildPackageList)
+	output.AddBar(5)
+	output.ShutdownBar()
+	c.Check(output.Detail().DoneFiles, check.Equals, int64(0))
+
+	output.InitBar(3000, true, aptly.BarMirrorUpdateDownloadPackages)
+	now = now.Add(2 * time.Second)
+	_, _ = output.Write(make([]byte, 1000))
+	output.AddFiles(1)
+	c.Check(detail.Load(), check.DeepEquals, ProgressDetail{Phase: "downloading", TotalFiles: 2, DoneFiles: 1,
+		TotalBytes: 3000, DoneBytes: 1000, BytesPerSecond: 500, ETA: "4s"})
+
+	// rate is kept until interval passes
+	now = now.Add(100 * time.Millisecond)
+	_, _ = output.Write(make([]byte, 1000))
+	c.Check(output.Detail().BytesPerSecond, check.Equals, int64(500))
+	c.Check(output.Detail().DoneBytes, check.Equals, int64(2000))
+	output.ShutdownBar()
+
+	output.InitBar(4, false, aptly.BarMirrorUpdateFinalizeDownload)
+	output.SetBar(3)
+	c.Check(detail.Load(), check.DeepEquals, ProgressDetail{Phase: "importing", TotalFiles: 4, DoneFiles: 3})
+}
+
+func (s *OutputSuite) TestProgressOutputExtend(c *check.C) {
+	type legacyDetail struct {
+		ProgressDetail
+		Remaining int64
+	}
+
+	detail := &Detail{}
+	output := NewProgressOutput(NewOutput(), detail, nil)
+	output.Extend = func(progress ProgressDetail) interface{} {
+		return legacyDetail{progress, progress.TotalFiles - progress.DoneFiles}
+	}
+
+	output.SetPhase("deleting", 4, 0)
+	output.AddFiles(3)
+	c.Check(detail.Load(), check.DeepEquals, legacyDetail{ProgressDetail{Phase: "deleting", TotalFiles: 4, DoneFiles: 3}, 1})
+}
+
+func (s *OutputSuite) TestProgressOutputParallel(c *check.C) {
+	output := NewProgressOutput(NewOutput(), &Detail{}, map[aptly.BarType]string{
+		aptly.BarMirrorUpdateDownloadPackages: "downloading",
+	})
+
+	output.SetPhase("downloading", 100, 100*1024)
+	output.InitBar(100*1024, true, aptly.BarMirrorUpdateDownloadPackages)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				_, _ = output.Write(make([]byte, 1024))
+				output.AddFiles(1)
+			}
+		}()
+	}
+	wg.Wait()
+	output.ShutdownBar()
+
+	c.Check(output.Detail().DoneFiles, check.Equals, int64(100))
+	c.Check(output.Detail().DoneBytes, check.Equals, int64(100*1024))
+}
@@ -0,0 +1,154 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/rs/zerolog/log"
+)
+
+// Record is persisted state of the task
+type Record struct {
+	ID          int
+	Name        string
+	State       State
+	Kind        string   `json:",omitempty"`
+	Priority    int      `json:",omitempty"`
+	Resources   []string `json:",omitempty"`
+	Output      string
+	ReturnValue *RecordReturnValue `json:",omitempty"`
+	Error       string             `json:",omitempty"`
+	CreatedAt   time.Time
+	StartedAt   time.Time
+	FinishedAt  time.Time
+}
+
+// RecordReturnValue is persisted process return value, value is kept as JSON
+type RecordReturnValue struct {
+	Code  int
+	Value json.RawMessage `json:",omitempty"`
+}
+
+// Store persists task records
+type Store interface {
+	// SaveTask creates or replaces task record
+	SaveTask(record *Record) error
+	// DeleteTask removes task record, missing record is not an error
+	DeleteTask(ID int) error
+	// LoadTasks returns all the task records ordered by ID
+	LoadTasks() ([]*Record, error)
+}
+
+// record builds persisted state of the task
+func (task *Task) record() *Record {
+	record := &Record{
+		ID:         task.ID,
+		Name:       task.Name,
+		State:      task.State,
+		Kind:       task.Kind,
+		Priority:   task.Priority,
+		Resources:  task.resources,
+		Output:     task.output.String(),
+		CreatedAt:  task.CreatedAt,
+		StartedAt:  task.StartedAt,
+		FinishedAt: task.FinishedAt,
+	}
+
+	if task.err != nil {
+		record.Error = task.err.Error()
+	}
+
+	if task.processReturnValue != nil {
+		record.ReturnValue = &RecordReturnValue{Code: task.processReturnValue.Code}
+		if value, err := json.Marshal(task.processReturnValue.Value); err == nil {
+			record.ReturnValue.Value = value
+		}
+	}
+
+	return record
+}
+
+// restoreTask creates finished task from the record, process can't be restored
+func restoreTask(record *Record) *Task {
+	task := &Task{
+		output:     NewOutput(),
+		detail:     &Detail{taskID: record.ID},
+		Name:       record.Name,
+		ID:         record.ID,
+		State:      record.State,
+		Kind:       record.Kind,
+		Priority:   record.Priority,
+		CreatedAt:  record.CreatedAt,
+		StartedAt:  record.StartedAt,
+		FinishedAt: record.FinishedAt,
+		resources:  record.Resources,
+		wgTask:     &sync.WaitGroup{},
+	}
+
+	_, _ = task.output.WriteString(record.Output)
+
+	if record.Error != "" {
+		task.err = errors.New(record.Error)
+	}
+
+	if record.ReturnValue != nil {
+		task.processReturnValue = &ProcessReturnValue{Code: record.ReturnValue.Code}
+		if record.ReturnValue.Value != nil {
+			task.processReturnValue.Value = record.ReturnValue.Value
+		}
+	}
+
+	return task
+}
+
+// DatabaseStore keeps task records in aptly database
+type DatabaseStore struct {
+	db database.Storage
+}
+
+// NewDatabaseStore creates task store backed by database
+func NewDatabaseStore(db database.Storage) *DatabaseStore {
+	return &DatabaseStore{db: db}
+}
+
+func taskKey(ID int) []byte {
+	// zero-padded, so that records are ordered by ID
+	return []byte(fmt.Sprintf("T%010d", ID))
+}
+
+// SaveTask creates or replaces task record
+func (store *DatabaseStore) SaveTask(record *Record) error {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Put(taskKey(record.ID), encoded)
+}
+
+// DeleteTask removes task record
+func (store *DatabaseStore) DeleteTask(ID int) error {
+	return store.db.Delete(taskKey(ID))
+}
+
+// LoadTasks returns all the task records ordered by ID, broken records are skipped
+func (store *DatabaseStore) LoadTasks() ([]*Record, error) {
+	var records []*Record
+
+	err := store.db.ProcessByPrefix([]byte("T"), func(key, blob []byte) error {
+		record := &Record{}
+		if err := json.Unmarshal(blob, record); err != nil {
+			log.Warn().Msgf("Error decoding task record %s: %s", key, err)
+			return nil
+		}
+
+		records = append(records, record)
+		return nil
+	})
+
+	return records, err
+}
@@ -0,0 +1,187 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+
+	check "gopkg.in/check.v1"
+)
+
+type StoreSuite struct {
+	db    database.Storage
+	store *DatabaseStore
+}
+
+var _ = check.Suite(&StoreSuite{})
+
+func (s *StoreSuite) SetUpTest(c *check.C) {
+	var err error
+	s.db, err = goleveldb.NewOpenDB(c.MkDir())
+	c.Assert(err, check.IsNil)
+	s.store = NewDatabaseStore(s.db)
+}
+
+func (s *StoreSuite) TearDownTest(c *check.C) {
+	_ = s.db.Close()
+}
+
+func (s *StoreSuite) TestDatabaseStore(c *check.C) {
+	records, err := s.store.LoadTasks()
+	c.Assert(err, check.IsNil)
+	c.Check(records, check.HasLen, 0)
+
+	c.Assert(s.store.SaveTask(&Record{ID: 10, Name: "Publish", State: SUCCEEDED}), check.IsNil)
+	c.Assert(s.store.SaveTask(&Record{ID: 2, Name: "Update mirror", State: RUNNING, Resources: []string{"Rdebian"}}), check.IsNil)
+	c.Assert(s.store.SaveTask(&Record{ID: 2, Name: "Update mirror", State: FAILED, Error: "unable to download"}), check.IsNil)
+	c.Assert(s.db.Put([]byte("T0000000005"), []byte("garbage")), check.IsNil)
+
+	records, err = s.store.LoadTasks()
+	c.Assert(err, check.IsNil)
+	c.Assert(records, check.HasLen, 2)
+	c.Check(records[0].ID, check.Equals, 2)
+	c.Check(records[0].State, check.Equals, FAILED)
+	c.Check(records[0].Error, check.Equals, "unable to download")
+	c.Check(records[1].ID, check.Equals, 10)
+
+	c.Assert(s.store.DeleteTask(10), check.IsNil)
+	c.Assert(s.store.DeleteTask(10), check.IsNil)
+	records, _ = s.store.LoadTasks()
+	c.Check(records, check.HasLen, 1)
+}
+
+func (s *StoreSuite) TestPersist(c *check.C) {
+	list := NewList()
+	defer list.Stop()
+	c.Assert(list.Restore(s.store, 0), check.IsNil)
+
+	task, _ := list.RunTaskInBackground("Successful task", []string{"Lrepo"}, func(_ context.Context, out aptly.Progress, _ *Detail) (*ProcessReturnValue, error) {
+		out.Printf("Working\n")
+		return &ProcessReturnValue{Code: 201, Value: map[string]string{"Name": "repo"}}, nil
+	})
+	_, _ = list.WaitForTaskByID(task.ID)
+	failed, _ := list.RunTaskInBackground("Faulty task", nil, func(_ context.Context, _ aptly.Progress, _ *Detail) (*ProcessReturnValue, error) {
+		return nil, errors.New("broken")
+	})
+	_, _ = list.WaitForTaskByID(failed.ID)
+
+	records, err := s.store.LoadTasks()
+	c.Assert(err, check.IsNil)
+	c.Assert(records, check.HasLen, 2)
+
+	record := records[0]
+	c.Check(record.Name, check.Equals, "Successful task")
+	c.Check(record.State, check.Equals, SUCCEEDED)
+	c.Check(record.Resources, check.DeepEquals, []string{"Lrepo"})
+	c.Check(record.Output, check.Equals, "Working\nTask succeeded")
+	c.Check(record.ReturnValue.Code, check.Equals, 201)
+	c.Check(string(record.ReturnValue.Value), check.Equals, `{"Name":"repo"}`)
+	c.Check(record.CreatedAt.IsZero(), check.Equals, false)
+	c.Check(record.StartedAt.Before(record.CreatedAt), check.Equals, false)
+	c.Check(record.FinishedAt.Before(record.StartedAt), check.Equals, false)
+
+	c.Check(records[1].State, check.Equals, FAILED)
+	c.Check(records[1].Error, check.Equals, "broken")
+
+	_, err = list.DeleteTaskByID(task.ID)
+	c.Assert(err, check.IsNil)
+	records, _ = s.store.LoadTasks()
+	c.Check(records, check.HasLen, 1)
+
+	list.Clear()
+	records, _ = s.store.LoadTasks()
+	c.Check(records, check.HasLen, 0)
+}
+
+func (s *StoreSuite) TestRestore(c *check.C) {
+	now := time.Now()
+	value, _ := json.Marshal(map[string]string{"Name": "snap"})
+
+	c.Assert(s.store.SaveTask(&Record{ID: 3, Name: "Old task", State: SUCCEEDED, CreatedAt: now.Add(-3 * time.Hour), FinishedAt: now.Add(-2 * time.Hour)}), check.IsNil)
+	c.Assert(s.store.SaveTask(&Record{ID: 4, Name: "Create snapshot", State: SUCCEEDED, Output: "Task succeeded",
+		ReturnValue: &RecordReturnValue{Code: 201, Value: value}, CreatedAt: now.Add(-time.Minute), FinishedAt: now}), check.IsNil)
+	c.Assert(s.store.SaveTask(&Record{ID: 5, Name: "Failed task", State: FAILED, Error: "broken", FinishedAt: now}), check.IsNil)
+	c.Assert(s.store.SaveTask(&Record{ID: 6, Name: "Update mirror", State: RUNNING, Output: "Downloading"}), check.IsNil)
+	c.Assert(s.store.SaveTask(&Record{ID: 7, Name: "Publish", State: IDLE}), check.IsNil)
+
+	list := NewList()
+	defer list.Stop()
+
+	var states []string
+	list.SetObserver(func(task Task) {
+		states = append(states, task.Name+" "+task.State.String())
+	})
+
+	c.Assert(list.Restore(s.store, time.Hour), check.IsNil)
+	c.Check(states, check.DeepEquals, []string{"Update mirror INTERRUPTED", "Publish INTERRUPTED"})
+
+	tasks := list.GetTasks()
+	c.Assert(tasks, check.HasLen, 4)
+	c.Check(tasks[0].ID, check.Equals, 4)
+	c.Check(tasks[2].State, check.Equals, INTERRUPTED)
+	c.Check(tasks[2].FinishedAt.IsZero(), check.Equals, false)
+	c.Check(tasks[3].State, check.Equals, INTERRUPTED)
+
+	output, _ := list.GetTaskOutputByID(6)
+	c.Check(output, check.Equals, "Downloading\nTask interrupted by restart of API server")
+	output, _ = list.GetTaskOutputByID(7)
+	c.Check(output, check.Equals, "Task interrupted by restart of API server")
+
+	retValue, _ := list.GetTaskReturnValueByID(4)
+	c.Assert(retValue, check.NotNil)
+	c.Check(retValue.Code, check.Equals, 201)
+	encoded, _ := json.Marshal(retValue.Value)
+	c.Check(string(encoded), check.Equals, `{"Name":"snap"}`)
+
+	taskErr, _ := list.GetTaskErrorByID(5)
+	c.Check(taskErr, check.ErrorMatches, "broken")
+
+	// restored tasks are finished
+	task, err := list.WaitForTaskByID(6)
+	c.Assert(err, check.IsNil)
+	c.Check(task.State, check.Equals, INTERRUPTED)
+	_, err = list.DeleteTaskByID(7)
+	c.Check(err, check.IsNil)
+
+	// expired task is removed from the store
+	records, _ := s.store.LoadTasks()
+	c.Assert(records, check.HasLen, 3)
+	c.Check(records[0].ID, check.Equals, 4)
+	c.Check(records[2].State, check.Equals, INTERRUPTED)
+
+	// new tasks continue numbering
+	task, _ = list.RunTaskInBackground("New task", nil, func(_ context.Context, _ aptly.Progress, _ *Detail) (*ProcessReturnValue, error) {
+		return nil, nil
+	})
+	c.Check(task.ID, check.Equals, 8)
+	_, _ = list.WaitForTaskByID(task.ID)
+}
+
+func (s *StoreSuite) TestRetention(c *check.C) {
+	list := NewList()
+	defer list.Stop()
+	c.Assert(list.Restore(s.store, 50*time.Millisecond), check.IsNil)
+
+	first, _ := list.RunTaskInBackground("First", nil, func(_ context.Context, _ aptly.Progress, _ *Detail) (*ProcessReturnValue, error) {
+		return nil, nil
+	})
+	_, _ = list.WaitForTaskByID(first.ID)
+	time.Sleep(100 * time.Millisecond)
+
+	second, _ := list.RunTaskInBackground("Second", nil, func(_ context.Context, _ aptly.Progress, _ *Detail) (*ProcessReturnValue, error) {
+		return nil, nil
+	})
+	_, _ = list.WaitForTaskByID(second.ID)
+
+	// finishing second task prunes the first one
+	_, err := list.GetTaskByID(first.ID)
+	c.Check(err, check.ErrorMatches, "could not find task with id 1")
+	records, _ := s.store.LoadTasks()
+	c.Assert(records, check.HasLen, 1)
+	c.Check(records[0].ID, check.Equals, second.ID)
+}
@@ -1,8 +1,11 @@
 package task
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/aptly-dev/aptly/aptly"
 )
@@ -13,6 +16,12 @@ type State int
 // Detail represents custom task details
 type Detail struct {
 	atomic.Value
+	taskID int
+}
+
+// TaskID returns ID of the task detail belongs to
+func (d *Detail) TaskID() int {
+	return d.taskID
 }
 
 // PublishDetail represents publish task details
@@ -22,13 +31,31 @@ type PublishDetail struct {
 	RemainingNumberOfPackages int64
 }
 
+// ProgressDetail represents progress of the current phase of the task
+type ProgressDetail struct {
+	// Phase the task is in
+	Phase string
+	// Files, or other items like packages, processed in the phase
+	TotalFiles int64
+	DoneFiles  int64
+	// Bytes processed in the phase
+	TotalBytes int64
+	DoneBytes  int64
+	// Current transfer rate, in bytes per second
+	BytesPerSecond int64 `json:",omitempty"`
+	// Estimated time until the phase is finished
+	ETA string `json:",omitempty"`
+}
+
 type ProcessReturnValue struct {
 	Code  int
 	Value interface{}
 }
 
 // Process is a function implementing the actual task logic
-type Process func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error)
+//
+// ctx is cancelled when task is cancelled, process should stop and return error then
+type Process func(ctx context.Context, out aptly.Progress, detail *Detail) (*ProcessReturnValue, error)
 
 const (
 	// IDLE when task is waiting
@@ -39,18 +66,55 @@ const (
 	SUCCEEDED
 	// FAILED when task failed
 	FAILED
+	// INTERRUPTED when task was queued or running while API server was stopped
+	INTERRUPTED
+	// CANCELLED when task was cancelled before it has finished
+	CANCELLED
 )
 
+var stateNames = map[State]string{
+	IDLE:        "IDLE",
+	RUNNING:     "RUNNING",
+	SUCCEEDED:   "SUCCEEDED",
+	FAILED:      "FAILED",
+	INTERRUPTED: "INTERRUPTED",
+	CANCELLED:   "CANCELLED",
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// finished checks whether task in this state is done
+func (s State) finished() bool {
+	return s == SUCCEEDED || s == FAILED || s == INTERRUPTED || s == CANCELLED
+}
+
 // Task represents as task in a queue encapsulates process code
 type Task struct {
 	output             *Output
 	detail             *Detail
 	process            Process
+	ctx                context.Context
+	cancel             context.CancelFunc
 	processReturnValue *ProcessReturnValue
 	err                error
 	Name               string
 	ID                 int
 	State              State
+	Kind               string `json:",omitempty"`
+	Priority           int
+	Timeout            string    `json:",omitempty"`
+	QueuePosition      int       `json:",omitempty"`
+	BlockedBy          []int     `json:",omitempty"`
+	CreatedAt          time.Time `json:",omitzero"`
+	StartedAt          time.Time `json:",omitzero"`
+	FinishedAt         time.Time `json:",omitzero"`
+	timeout            time.Duration
 	resources          []string
 	wgTask             *sync.WaitGroup
 }
@@ -59,13 +123,15 @@ type Task struct {
 func NewTask(process Process, name string, ID int, resources []string, wgTask *sync.WaitGroup) *Task {
 	task := &Task{
 		output:    NewOutput(),
-		detail:    &Detail{},
+		detail:    &Detail{taskID: ID},
 		process:   process,
 		Name:      name,
 		ID:        ID,
 		State:     IDLE,
+		CreatedAt: time.Now(),
 		resources: resources,
 		wgTask:    wgTask,
 	}
+	task.ctx, task.cancel = context.WithCancel(context.Background())
 	return task
 }
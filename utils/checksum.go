@@ -44,6 +44,16 @@ func (cksum *ChecksumInfo) Complete() bool {
 	return cksum.MD5 != "" && cksum.SHA1 != "" && cksum.SHA256 != "" && cksum.SHA512 != ""
 }
 
+// Matches checks that checksums defined in cksum are the same in actual,
+// checksums missing in cksum are not compared
+func (cksum *ChecksumInfo) Matches(actual *ChecksumInfo) bool {
+	return (cksum.Size == 0 || cksum.Size == actual.Size) &&
+		(cksum.MD5 == "" || cksum.MD5 == actual.MD5) &&
+		(cksum.SHA1 == "" || cksum.SHA1 == actual.SHA1) &&
+		(cksum.SHA256 == "" || cksum.SHA256 == actual.SHA256) &&
+		(cksum.SHA512 == "" || cksum.SHA512 == actual.SHA512)
+}
+
 // ChecksumsForReader generates size, MD5, SHA1 & SHA256 checksums for the given
 // io.Reader
 func ChecksumsForReader(rd io.Reader) (ChecksumInfo, error) {
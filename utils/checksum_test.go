@@ -37,3 +37,13 @@ func (s *ChecksumSuite) TestMD5ChecksumForFile(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(md5sum, Equals, "43470766afbfdca292440eecdceb80fb")
 }
+
+func (s *ChecksumSuite) TestMatches(c *C) {
+	actual := &ChecksumInfo{Size: 83, MD5: "43470766afbfdca292440eecdceb80fb", SHA1: "1743f8408261b4f1eff88e0fca15a7077223fa79"}
+
+	c.Check((&ChecksumInfo{}).Matches(actual), Equals, true)
+	c.Check((&ChecksumInfo{Size: 83, MD5: "43470766afbfdca292440eecdceb80fb"}).Matches(actual), Equals, true)
+	c.Check((&ChecksumInfo{Size: 84}).Matches(actual), Equals, false)
+	c.Check((&ChecksumInfo{MD5: "00000000000000000000000000000000"}).Matches(actual), Equals, false)
+	c.Check((&ChecksumInfo{SHA256: "f2775692fd3b70bd0faa4054b7afa92d427bf994cd8629741710c4864ee4dc95"}).Matches(actual), Equals, false)
+}
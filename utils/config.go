@@ -49,20 +49,41 @@ type ConfigStructure struct { // nolint: maligned
 	DownloadSourcePackages bool   `json:"downloadSourcePackages"        yaml:"download_sourcepackages"`
 
 	// Signing
-	GpgProvider      string `json:"gpgProvider"                   yaml:"gpg_provider"`
-	GpgDisableSign   bool   `json:"gpgDisableSign"                yaml:"gpg_disable_sign"`
-	GpgDisableVerify bool   `json:"gpgDisableVerify"              yaml:"gpg_disable_verify"`
+	GpgProvider      string             `json:"gpgProvider"                   yaml:"gpg_provider"`
+	GpgDisableSign   bool               `json:"gpgDisableSign"                yaml:"gpg_disable_sign"`
+	GpgDisableVerify bool               `json:"gpgDisableVerify"              yaml:"gpg_disable_verify"`
+	GpgRemoteSigner  RemoteSignerConfig `json:"gpgRemoteSigner"               yaml:"gpg_remote_signer"`
 
 	// Publishing
-	SkipContentsPublishing bool `json:"skipContentsPublishing"        yaml:"skip_contents_publishing"`
-	SkipBz2Publishing      bool `json:"skipBz2Publishing"             yaml:"skip_bz2_publishing"`
+	SkipContentsPublishing bool          `json:"skipContentsPublishing"        yaml:"skip_contents_publishing"`
+	SkipBz2Publishing      bool          `json:"skipBz2Publishing"             yaml:"skip_bz2_publishing"`
+	PublishHooks           []PublishHook `json:"publishHooks"                  yaml:"publish_hooks"`
 
 	// Storage
 	FileSystemPublishRoots map[string]FileSystemPublishRoot `json:"FileSystemPublishEndpoints"    yaml:"filesystem_publish_endpoints"`
 	S3PublishRoots         map[string]S3PublishRoot         `json:"S3PublishEndpoints"            yaml:"s3_publish_endpoints"`
 	SwiftPublishRoots      map[string]SwiftPublishRoot      `json:"SwiftPublishEndpoints"         yaml:"swift_publish_endpoints"`
 	AzurePublishRoots      map[string]AzureEndpoint         `json:"AzurePublishEndpoints"         yaml:"azure_publish_endpoints"`
+	SFTPPublishRoots       map[string]SFTPPublishRoot       `json:"SFTPPublishEndpoints"          yaml:"sftp_publish_endpoints"`
+	GCSPublishRoots        map[string]GCSPublishRoot        `json:"GCSPublishEndpoints"           yaml:"gcs_publish_endpoints"`
+	WebDAVPublishRoots     map[string]WebDAVPublishRoot     `json:"WebDAVPublishEndpoints"        yaml:"webdav_publish_endpoints"`
+	CompositePublishRoots  map[string]CompositePublishRoot  `json:"CompositePublishEndpoints"     yaml:"composite_publish_endpoints"`
 	PackagePoolStorage     PackagePoolStorage               `json:"packagePoolStorage"            yaml:"packagepool_storage"`
+
+	// Pool scrubbing
+	PoolScrub PoolScrubConfig `json:"poolScrub"                     yaml:"pool_scrub"`
+
+	// API authentication
+	APIAuth APIAuthConfig `json:"apiAuth"                       yaml:"api_auth"`
+
+	// TLS for api serve and serve
+	TLS TLSConfig `json:"tls"                           yaml:"tls"`
+
+	// Task persistence, how long finished tasks are kept by api serve
+	TaskRetention string `json:"taskRetention"                 yaml:"task_retention"`
+
+	// Task scheduling, maximum number of running tasks per kind
+	TaskConcurrency TaskConcurrencyConfig `json:"taskConcurrency"               yaml:"task_concurrency"`
 }
 
 // DBConfig structure
@@ -79,10 +100,12 @@ type LocalPoolStorage struct {
 type PackagePoolStorage struct {
 	Local *LocalPoolStorage
 	Azure *AzureEndpoint
+	S3    *S3PoolStorage
 }
 
 var AZURE = "azure"
 var LOCAL = "local"
+var S3 = "s3"
 
 func (pool *PackagePoolStorage) UnmarshalJSON(data []byte) error {
 	var discriminator struct {
@@ -97,6 +120,9 @@ func (pool *PackagePoolStorage) UnmarshalJSON(data []byte) error {
 	case AZURE:
 		pool.Azure = &AzureEndpoint{}
 		return json.Unmarshal(data, &pool.Azure)
+	case S3:
+		pool.S3 = &S3PoolStorage{}
+		return json.Unmarshal(data, &pool.S3)
 	case LOCAL, "":
 		pool.Local = &LocalPoolStorage{}
 		return json.Unmarshal(data, &pool.Local)
@@ -117,6 +143,9 @@ func (pool *PackagePoolStorage) UnmarshalYAML(unmarshal func(interface{}) error)
 	case AZURE:
 		pool.Azure = &AzureEndpoint{}
 		return unmarshal(&pool.Azure)
+	case S3:
+		pool.S3 = &S3PoolStorage{}
+		return unmarshal(&pool.S3)
 	case LOCAL, "":
 		pool.Local = &LocalPoolStorage{}
 		return unmarshal(&pool.Local)
@@ -125,40 +154,50 @@ func (pool *PackagePoolStorage) UnmarshalYAML(unmarshal func(interface{}) error)
 	}
 }
 
+// Pool storage types share field names (prefix, endpoint), so each one
+// is marshalled with its own wrapper
 func (pool *PackagePoolStorage) MarshalJSON() ([]byte, error) {
-	var wrapper struct {
-		Type string `json:"type,omitempty"`
-		*LocalPoolStorage
-		*AzureEndpoint
-	}
-
-	if pool.Azure != nil {
-		wrapper.Type = "azure"
-		wrapper.AzureEndpoint = pool.Azure
-	} else if pool.Local.Path != "" {
-		wrapper.Type = "local"
-		wrapper.LocalPoolStorage = pool.Local
+	switch {
+	case pool.Azure != nil:
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			*AzureEndpoint
+		}{AZURE, pool.Azure})
+	case pool.S3 != nil:
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			*S3PoolStorage
+		}{S3, pool.S3})
+	case pool.Local != nil && pool.Local.Path != "":
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			*LocalPoolStorage
+		}{LOCAL, pool.Local})
 	}
 
-	return json.Marshal(wrapper)
+	return json.Marshal(struct{}{})
 }
 
 func (pool PackagePoolStorage) MarshalYAML() (interface{}, error) {
-	var wrapper struct {
-		Type              string `yaml:"type,omitempty"`
-		*LocalPoolStorage `yaml:",inline"`
-		*AzureEndpoint    `yaml:",inline"`
+	switch {
+	case pool.Azure != nil:
+		return struct {
+			Type           string `yaml:"type"`
+			*AzureEndpoint `yaml:",inline"`
+		}{AZURE, pool.Azure}, nil
+	case pool.S3 != nil:
+		return struct {
+			Type           string `yaml:"type"`
+			*S3PoolStorage `yaml:",inline"`
+		}{S3, pool.S3}, nil
+	case pool.Local != nil && pool.Local.Path != "":
+		return struct {
+			Type              string `yaml:"type"`
+			*LocalPoolStorage `yaml:",inline"`
+		}{LOCAL, pool.Local}, nil
 	}
 
-	if pool.Azure != nil {
-		wrapper.Type = "azure"
-		wrapper.AzureEndpoint = pool.Azure
-	} else if pool.Local.Path != "" {
-		wrapper.Type = "local"
-		wrapper.LocalPoolStorage = pool.Local
-	}
-
-	return wrapper, nil
+	return struct{}{}, nil
 }
 
 // FileSystemPublishRoot describes single filesystem publishing entry point
@@ -184,6 +223,23 @@ type S3PublishRoot struct {
 	DisableMultiDel         bool   `json:"disableMultiDel"            yaml:"disable_multidel"`
 	ForceSigV2              bool   `json:"forceSigV2"                 yaml:"force_sigv2"`
 	ForceVirtualHostedStyle bool   `json:"forceVirtualHostedStyle"    yaml:"force_virtualhosted_style"`
+	UploadConcurrency       int    `json:"uploadConcurrency"          yaml:"upload_concurrency"`
+	MultipartThreshold      int64  `json:"multipartThreshold"         yaml:"multipart_threshold"`
+	Debug                   bool   `json:"debug"                      yaml:"debug"`
+}
+
+// S3PoolStorage describes package pool hosted on S3 compatible storage
+type S3PoolStorage struct {
+	Region                  string `json:"region"                     yaml:"region"`
+	Bucket                  string `json:"bucket"                     yaml:"bucket"`
+	Prefix                  string `json:"prefix"                     yaml:"prefix"`
+	AccessKeyID             string `json:"awsAccessKeyID"             yaml:"access_key_id"`
+	SecretAccessKey         string `json:"awsSecretAccessKey"         yaml:"secret_access_key"`
+	SessionToken            string `json:"awsSessionToken"            yaml:"session_token"`
+	Endpoint                string `json:"endpoint"                   yaml:"endpoint"`
+	StorageClass            string `json:"storageClass"               yaml:"storage_class"`
+	EncryptionMethod        string `json:"encryptionMethod"           yaml:"encryption_method"`
+	ForceVirtualHostedStyle bool   `json:"forceVirtualHostedStyle"    yaml:"force_virtualhosted_style"`
 	Debug                   bool   `json:"debug"                      yaml:"debug"`
 }
 
@@ -202,6 +258,135 @@ type SwiftPublishRoot struct {
 	AuthURL        string `json:"authurl"         yaml:"auth_url"`
 }
 
+// SFTPPublishRoot describes single SFTP publishing entry point
+type SFTPPublishRoot struct {
+	Host         string `json:"host"          yaml:"host"`
+	Port         int    `json:"port"          yaml:"port"`
+	User         string `json:"user"          yaml:"user"`
+	Password     string `json:"password"      yaml:"password"`
+	PrivateKey   string `json:"privateKey"    yaml:"private_key"`
+	KnownHosts   string `json:"knownHosts"    yaml:"known_hosts"`
+	RootDir      string `json:"rootDir"       yaml:"root_dir"`
+	VerifyMethod string `json:"verifyMethod"  yaml:"verify_method"`
+}
+
+// GCSPublishRoot describes single Google Cloud Storage publishing entry point
+type GCSPublishRoot struct {
+	Bucket          string `json:"bucket"           yaml:"bucket"`
+	Prefix          string `json:"prefix"           yaml:"prefix"`
+	CredentialsFile string `json:"credentialsFile"  yaml:"credentials_file"`
+	ACL             string `json:"acl"              yaml:"acl"`
+	Endpoint        string `json:"endpoint"         yaml:"endpoint"`
+}
+
+// WebDAVPublishRoot describes single WebDAV publishing entry point
+type WebDAVPublishRoot struct {
+	URL          string `json:"url"           yaml:"url"`
+	User         string `json:"user"          yaml:"user"`
+	Password     string `json:"password"      yaml:"password"`
+	VerifyMethod string `json:"verifyMethod"  yaml:"verify_method"`
+}
+
+// CompositePublishRoot describes group of published storages updated together
+//
+// Members are storage names, e.g. "filesystem:local" or "s3:eu"
+type CompositePublishRoot struct {
+	Members []string `json:"members"  yaml:"members"`
+}
+
+// RemoteSignerConfig describes external signing service used with "remote" gpg provider
+type RemoteSignerConfig struct {
+	URL     string `json:"url"      yaml:"url"`
+	Token   string `json:"token"    yaml:"token"`
+	Keyring string `json:"keyring"  yaml:"keyring"`
+	Timeout int    `json:"timeout"  yaml:"timeout"`
+}
+
+// PoolScrubConfig configures periodic verification of package pool by API server
+type PoolScrubConfig struct {
+	Interval   string `json:"interval"    yaml:"interval"`
+	RateLimit  int64  `json:"rateLimit"   yaml:"rate_limit"`
+	Redownload bool   `json:"redownload"  yaml:"redownload"`
+}
+
+// APIAuthConfig configures authentication and authorization of API requests
+//
+// Authentication is enforced once any token or JWKS is configured.
+type APIAuthConfig struct {
+	Tokens       []APITokenConfig       `json:"tokens"        yaml:"tokens"`
+	JWT          APIJWTConfig           `json:"jwt"           yaml:"jwt"`
+	Certificates []APICertificateConfig `json:"certificates"  yaml:"certificates"`
+}
+
+// APICertificateConfig maps subject of TLS client certificate to API identity
+//
+// Subject is either common name or full distinguished name in RFC 2253 format (e.g.
+// "CN=ci,O=Example"), shell patterns are supported. Name defaults to common name,
+// Role and Scopes are the same as for static tokens.
+type APICertificateConfig struct {
+	Subject string   `json:"subject"  yaml:"subject"`
+	Name    string   `json:"name"     yaml:"name"`
+	Role    string   `json:"role"     yaml:"role"`
+	Scopes  []string `json:"scopes"   yaml:"scopes"`
+}
+
+// TLSConfig configures HTTPS listener
+//
+// When ClientCAFile is set, client certificates are verified against it, ClientAuth
+// is either "optional" or "require".
+type TLSConfig struct {
+	CertFile     string `json:"certFile"      yaml:"cert_file"`
+	KeyFile      string `json:"keyFile"       yaml:"key_file"`
+	ClientCAFile string `json:"clientCAFile"  yaml:"client_ca_file"`
+	ClientAuth   string `json:"clientAuth"    yaml:"client_auth"`
+}
+
+// TaskConcurrencyConfig limits number of running API tasks per kind, 0 means unlimited
+type TaskConcurrencyConfig struct {
+	MirrorUpdate int `json:"mirrorUpdate"  yaml:"mirror_update"`
+	Publish      int `json:"publish"       yaml:"publish"`
+	DBCleanup    int `json:"dbCleanup"     yaml:"db_cleanup"`
+}
+
+// APIJWTConfig configures validation of JWT bearer tokens issued by SSO
+//
+// JWKS is path to JWKS file or http(s) URL to fetch it from. Role of the client is
+// taken from RoleClaim (string or list of strings), values are translated via
+// RoleMapping if it's not empty, the highest role wins. ScopesClaim lists resource
+// scopes in the same format as for static tokens.
+type APIJWTConfig struct {
+	JWKS          string            `json:"jwks"           yaml:"jwks"`
+	Issuer        string            `json:"issuer"         yaml:"issuer"`
+	Audience      string            `json:"audience"       yaml:"audience"`
+	UsernameClaim string            `json:"usernameClaim"  yaml:"username_claim"`
+	RoleClaim     string            `json:"roleClaim"      yaml:"role_claim"`
+	RoleMapping   map[string]string `json:"roleMapping"    yaml:"role_mapping"`
+	ScopesClaim   string            `json:"scopesClaim"    yaml:"scopes_claim"`
+}
+
+// APITokenConfig describes static API token
+//
+// Hash is "sha256:" followed by hex encoded SHA-256 of the token, Role is one of
+// read-only, uploader, publisher or admin. Scopes limit access to local repos,
+// mirrors and publish prefixes, e.g. "repo:stable-*", "mirror:debian" or "publish:s3:eu:ppa".
+type APITokenConfig struct {
+	Name   string   `json:"name"    yaml:"name"`
+	Hash   string   `json:"hash"    yaml:"hash"`
+	Role   string   `json:"role"    yaml:"role"`
+	Scopes []string `json:"scopes"  yaml:"scopes"`
+}
+
+// PublishHook describes command or HTTP endpoint invoked around publishing
+//
+// Event is one of pre-publish, post-publish, pre-remove, post-remove. Command
+// receives JSON payload on stdin, otherwise payload is POSTed to URL.
+type PublishHook struct {
+	Event   string   `json:"event"    yaml:"event"`
+	Command []string `json:"command"  yaml:"command"`
+	URL     string   `json:"url"      yaml:"url"`
+	Timeout int      `json:"timeout"  yaml:"timeout"`
+}
+
 // AzureEndpoint describes single Azure publishing entry point
 type AzureEndpoint struct {
 	Container   string `json:"container"    yaml:"container"`
@@ -237,12 +422,30 @@ var Config = ConfigStructure{
 	S3PublishRoots:         map[string]S3PublishRoot{},
 	SwiftPublishRoots:      map[string]SwiftPublishRoot{},
 	AzurePublishRoots:      map[string]AzureEndpoint{},
+	SFTPPublishRoots:       map[string]SFTPPublishRoot{},
+	GCSPublishRoots:        map[string]GCSPublishRoot{},
+	WebDAVPublishRoots:     map[string]WebDAVPublishRoot{},
+	CompositePublishRoots:  map[string]CompositePublishRoot{},
+	PublishHooks:           []PublishHook{},
 	AsyncAPI:               false,
 	EnableMetricsEndpoint:  false,
 	LogLevel:               "info",
 	LogFormat:              "default",
 	ServeInAPIMode:         false,
 	EnableSwaggerEndpoint:  false,
+	APIAuth: APIAuthConfig{
+		Tokens: []APITokenConfig{},
+		JWT: APIJWTConfig{
+			UsernameClaim: "sub",
+			RoleClaim:     "aptly_role",
+			RoleMapping:   map[string]string{},
+			ScopesClaim:   "aptly_scopes",
+		},
+		Certificates: []APICertificateConfig{},
+	},
+	TLS: TLSConfig{
+		ClientAuth: "optional",
+	},
 }
 
 // LoadConfig loads configuration from json file
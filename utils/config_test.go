@@ -1,10 +1,12 @@
 package utils
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 
 	. "gopkg.in/check.v1"
+	yaml "gopkg.in/yaml.v3"
 )
 
 type ConfigSuite struct {
@@ -55,6 +57,18 @@ func (s *ConfigSuite) TestSaveConfig(c *C) {
 	s.config.AzurePublishRoots = map[string]AzureEndpoint{"test": {
 		Container: "repo"}}
 
+	s.config.SFTPPublishRoots = map[string]SFTPPublishRoot{"test": {
+		Host: "mirror.example.com", User: "aptly", RootDir: "/srv/debian"}}
+
+	s.config.GCSPublishRoots = map[string]GCSPublishRoot{"test": {
+		Bucket: "repo"}}
+
+	s.config.WebDAVPublishRoots = map[string]WebDAVPublishRoot{"test": {
+		URL: "https://dav.example.com/debian"}}
+
+	s.config.CompositePublishRoots = map[string]CompositePublishRoot{"test": {
+		Members: []string{"filesystem:test", "s3:test"}}}
+
 	s.config.LogLevel = "info"
 	s.config.LogFormat = "json"
 
@@ -102,8 +116,15 @@ func (s *ConfigSuite) TestSaveConfig(c *C) {
 		"  \"gpgProvider\": \"gpg\",\n" +
 		"  \"gpgDisableSign\": false,\n" +
 		"  \"gpgDisableVerify\": false,\n" +
+		"  \"gpgRemoteSigner\": {\n" +
+		"    \"url\": \"\",\n" +
+		"    \"token\": \"\",\n" +
+		"    \"keyring\": \"\",\n" +
+		"    \"timeout\": 0\n" +
+		"  },\n" +
 		"  \"skipContentsPublishing\": false,\n" +
 		"  \"skipBz2Publishing\": false,\n" +
+		"  \"publishHooks\": null,\n" +
 		"  \"FileSystemPublishEndpoints\": {\n" +
 		"    \"test\": {\n" +
 		"      \"rootDir\": \"/opt/aptly-publish\",\n" +
@@ -127,6 +148,8 @@ func (s *ConfigSuite) TestSaveConfig(c *C) {
 		"      \"disableMultiDel\": false,\n" +
 		"      \"forceSigV2\": false,\n" +
 		"      \"forceVirtualHostedStyle\": false,\n" +
+		"      \"uploadConcurrency\": 0,\n" +
+		"      \"multipartThreshold\": 0,\n" +
 		"      \"debug\": false\n" +
 		"    }\n" +
 		"  },\n" +
@@ -154,9 +177,76 @@ func (s *ConfigSuite) TestSaveConfig(c *C) {
 		"      \"endpoint\": \"\"\n" +
 		"    }\n" +
 		"  },\n" +
+		"  \"SFTPPublishEndpoints\": {\n" +
+		"    \"test\": {\n" +
+		"      \"host\": \"mirror.example.com\",\n" +
+		"      \"port\": 0,\n" +
+		"      \"user\": \"aptly\",\n" +
+		"      \"password\": \"\",\n" +
+		"      \"privateKey\": \"\",\n" +
+		"      \"knownHosts\": \"\",\n" +
+		"      \"rootDir\": \"/srv/debian\",\n" +
+		"      \"verifyMethod\": \"\"\n" +
+		"    }\n" +
+		"  },\n" +
+		"  \"GCSPublishEndpoints\": {\n" +
+		"    \"test\": {\n" +
+		"      \"bucket\": \"repo\",\n" +
+		"      \"prefix\": \"\",\n" +
+		"      \"credentialsFile\": \"\",\n" +
+		"      \"acl\": \"\",\n" +
+		"      \"endpoint\": \"\"\n" +
+		"    }\n" +
+		"  },\n" +
+		"  \"WebDAVPublishEndpoints\": {\n" +
+		"    \"test\": {\n" +
+		"      \"url\": \"https://dav.example.com/debian\",\n" +
+		"      \"user\": \"\",\n" +
+		"      \"password\": \"\",\n" +
+		"      \"verifyMethod\": \"\"\n" +
+		"    }\n" +
+		"  },\n" +
+		"  \"CompositePublishEndpoints\": {\n" +
+		"    \"test\": {\n" +
+		"      \"members\": [\n" +
+		"        \"filesystem:test\",\n" +
+		"        \"s3:test\"\n" +
+		"      ]\n" +
+		"    }\n" +
+		"  },\n" +
 		"  \"packagePoolStorage\": {\n" +
 		"    \"type\": \"local\",\n" +
 		"    \"path\": \"/tmp/aptly-pool\"\n" +
+		"  },\n" +
+		"  \"poolScrub\": {\n" +
+		"    \"interval\": \"\",\n" +
+		"    \"rateLimit\": 0,\n" +
+		"    \"redownload\": false\n" +
+		"  },\n" +
+		"  \"apiAuth\": {\n" +
+		"    \"tokens\": null,\n" +
+		"    \"jwt\": {\n" +
+		"      \"jwks\": \"\",\n" +
+		"      \"issuer\": \"\",\n" +
+		"      \"audience\": \"\",\n" +
+		"      \"usernameClaim\": \"\",\n" +
+		"      \"roleClaim\": \"\",\n" +
+		"      \"roleMapping\": null,\n" +
+		"      \"scopesClaim\": \"\"\n" +
+		"    },\n" +
+		"    \"certificates\": null\n" +
+		"  },\n" +
+		"  \"tls\": {\n" +
+		"    \"certFile\": \"\",\n" +
+		"    \"keyFile\": \"\",\n" +
+		"    \"clientCAFile\": \"\",\n" +
+		"    \"clientAuth\": \"\"\n" +
+		"  },\n" +
+		"  \"taskRetention\": \"\",\n" +
+		"  \"taskConcurrency\": {\n" +
+		"    \"mirrorUpdate\": 0,\n" +
+		"    \"publish\": 0,\n" +
+		"    \"dbCleanup\": 0\n" +
 		"  }\n" +
 		"}")
 }
@@ -190,6 +280,28 @@ func (s *ConfigSuite) TestLoadYAMLErrorConfig(c *C) {
 	c.Assert(err.Error(), Equals, "invalid yaml (unknown pool storage type: invalid) or json (invalid character 'p' looking for beginning of value)")
 }
 
+func (s *ConfigSuite) TestS3PoolConfig(c *C) {
+	pool := PackagePoolStorage{S3: &S3PoolStorage{Region: "eu-west-1", Bucket: "pool", Prefix: "pre", Endpoint: "http://localhost:9000"}}
+
+	encoded, err := json.Marshal(&pool)
+	c.Assert(err, IsNil)
+	c.Check(string(encoded), Matches, `\{"type":"s3","region":"eu-west-1","bucket":"pool","prefix":"pre",.*"endpoint":"http://localhost:9000".*\}`)
+
+	var decoded PackagePoolStorage
+	c.Assert(json.Unmarshal(encoded, &decoded), IsNil)
+	c.Check(decoded.S3, DeepEquals, pool.S3)
+	c.Check(decoded.Azure, IsNil)
+	c.Check(decoded.Local, IsNil)
+
+	encoded, err = yaml.Marshal(&pool)
+	c.Assert(err, IsNil)
+	c.Check(string(encoded), Matches, "(?s)type: s3\nregion: eu-west-1\nbucket: pool\nprefix: pre\n.*")
+
+	decoded = PackagePoolStorage{}
+	c.Assert(yaml.Unmarshal(encoded, &decoded), IsNil)
+	c.Check(decoded.S3, DeepEquals, pool.S3)
+}
+
 func (s *ConfigSuite) TestSaveYAMLConfig(c *C) {
 	configname := filepath.Join(c.MkDir(), "aptly.yaml3")
 	f, _ := os.Create(configname)
@@ -267,15 +379,50 @@ func (s *ConfigSuite) TestSaveYAML2Config(c *C) {
 		"gpg_provider: \"\"\n" +
 		"gpg_disable_sign: false\n" +
 		"gpg_disable_verify: false\n" +
+		"gpg_remote_signer:\n" +
+		"    url: \"\"\n" +
+		"    token: \"\"\n" +
+		"    keyring: \"\"\n" +
+		"    timeout: 0\n" +
 		"skip_contents_publishing: false\n" +
 		"skip_bz2_publishing: false\n" +
+		"publish_hooks: []\n" +
 		"filesystem_publish_endpoints: {}\n" +
 		"s3_publish_endpoints: {}\n" +
 		"swift_publish_endpoints: {}\n" +
 		"azure_publish_endpoints: {}\n" +
+		"sftp_publish_endpoints: {}\n" +
+		"gcs_publish_endpoints: {}\n" +
+		"webdav_publish_endpoints: {}\n" +
+		"composite_publish_endpoints: {}\n" +
 		"packagepool_storage:\n" +
 		"    type: local\n" +
-		"    path: /tmp/aptly-pool\n")
+		"    path: /tmp/aptly-pool\n" +
+		"pool_scrub:\n" +
+		"    interval: \"\"\n" +
+		"    rate_limit: 0\n" +
+		"    redownload: false\n" +
+		"api_auth:\n" +
+		"    tokens: []\n" +
+		"    jwt:\n" +
+		"        jwks: \"\"\n" +
+		"        issuer: \"\"\n" +
+		"        audience: \"\"\n" +
+		"        username_claim: \"\"\n" +
+		"        role_claim: \"\"\n" +
+		"        role_mapping: {}\n" +
+		"        scopes_claim: \"\"\n" +
+		"    certificates: []\n" +
+		"tls:\n" +
+		"    cert_file: \"\"\n" +
+		"    key_file: \"\"\n" +
+		"    client_ca_file: \"\"\n" +
+		"    client_auth: \"\"\n" +
+		"task_retention: \"\"\n" +
+		"task_concurrency:\n" +
+		"    mirror_update: 0\n" +
+		"    publish: 0\n" +
+		"    db_cleanup: 0\n")
 }
 
 func (s *ConfigSuite) TestLoadEmptyConfig(c *C) {
@@ -322,8 +469,24 @@ download_sourcepackages: true
 gpg_provider: gpg
 gpg_disable_sign: true
 gpg_disable_verify: true
+gpg_remote_signer:
+    url: https://sign.example.com/sign
+    token: secret-token
+    keyring: /etc/aptly/signer.gpg
+    timeout: 30
 skip_contents_publishing: true
 skip_bz2_publishing: true
+publish_hooks:
+    - event: post-publish
+      command:
+        - /usr/local/bin/purge-cdn
+        - --all
+      url: ""
+      timeout: 0
+    - event: pre-publish
+      command: []
+      url: http://inventory.example.com/hook
+      timeout: 10
 filesystem_publish_endpoints:
     test1:
         root_dir: /opt/srv/aptly_public
@@ -345,6 +508,8 @@ s3_publish_endpoints:
         disable_multidel: true
         force_sigv2: true
         force_virtualhosted_style: true
+        upload_concurrency: 16
+        multipart_threshold: 104857600
         debug: true
 swift_publish_endpoints:
     test:
@@ -366,6 +531,34 @@ azure_publish_endpoints:
         account_name: aname
         account_key: akey
         endpoint: https://end.point
+sftp_publish_endpoints:
+    test:
+        host: mirror.example.com
+        port: 2222
+        user: aptly
+        password: ""
+        private_key: /etc/aptly/id_ed25519
+        known_hosts: /etc/aptly/known_hosts
+        root_dir: /srv/debian
+        verify_method: size
+gcs_publish_endpoints:
+    test:
+        bucket: bucket-gcs
+        prefix: pre4
+        credentials_file: /etc/aptly/gcs.json
+        acl: publicRead
+        endpoint: http://localhost:4443
+webdav_publish_endpoints:
+    test:
+        url: https://dav.example.com/debian
+        user: aptly
+        password: secret
+        verify_method: size
+composite_publish_endpoints:
+    test:
+        members:
+            - filesystem:test1
+            - s3:test
 packagepool_storage:
     type: azure
     container: test-pool1
@@ -373,6 +566,42 @@ packagepool_storage:
     account_name: a name
     account_key: a key
     endpoint: ep
+pool_scrub:
+    interval: 24h
+    rate_limit: 10240
+    redownload: true
+api_auth:
+    tokens:
+        - name: ci
+          hash: sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+          role: uploader
+          scopes:
+            - repo:stable-*
+    jwt:
+        jwks: https://sso.example.com/.well-known/jwks.json
+        issuer: https://sso.example.com
+        audience: aptly
+        username_claim: preferred_username
+        role_claim: groups
+        role_mapping:
+            aptly-admins: admin
+            developers: uploader
+        scopes_claim: aptly_scopes
+    certificates:
+        - subject: CN=deploy,O=Example
+          name: deploy
+          role: publisher
+          scopes: []
+tls:
+    cert_file: /etc/aptly/tls/server.crt
+    key_file: /etc/aptly/tls/server.key
+    client_ca_file: /etc/aptly/tls/ca.crt
+    client_auth: require
+task_retention: 168h
+task_concurrency:
+    mirror_update: 2
+    publish: 0
+    db_cleanup: 1
 `
 const configFileYAMLError = `packagepool_storage:
     type: invalid
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// TLSReloader keeps TLS certificate and client CA pool which could be reloaded
+// from disk while server is running
+type TLSReloader struct {
+	certFile, keyFile, clientCAFile string
+	clientAuth                      tls.ClientAuthType
+
+	lock     sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+}
+
+// NewTLSReloader loads certificate, key and (optional) client CA
+//
+// ClientAuth is "optional" (client certificate is verified if presented) or "require",
+// it is ignored if ClientCAFile is empty.
+func NewTLSReloader(config TLSConfig) (*TLSReloader, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, fmt.Errorf("both TLS certificate and key should be specified")
+	}
+
+	reloader := &TLSReloader{
+		certFile:     config.CertFile,
+		keyFile:      config.KeyFile,
+		clientCAFile: config.ClientCAFile,
+		clientAuth:   tls.NoClientCert,
+	}
+
+	if config.ClientCAFile != "" {
+		switch config.ClientAuth {
+		case "", "optional":
+			reloader.clientAuth = tls.VerifyClientCertIfGiven
+		case "require":
+			reloader.clientAuth = tls.RequireAndVerifyClientCert
+		default:
+			return nil, fmt.Errorf("invalid TLS client auth %q, should be optional or require", config.ClientAuth)
+		}
+	}
+
+	return reloader, reloader.Reload()
+}
+
+// Reload re-reads certificate files, previous certificates are kept on error
+func (r *TLSReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load TLS certificate: %s", err)
+	}
+
+	var clientCA *x509.CertPool
+	if r.clientCAFile != "" {
+		data, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("unable to load TLS client CA: %s", err)
+		}
+
+		clientCA = x509.NewCertPool()
+		if !clientCA.AppendCertsFromPEM(data) {
+			return fmt.Errorf("unable to load TLS client CA: no certificates found in %s", r.clientCAFile)
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.cert = &cert
+	r.clientCA = clientCA
+
+	return nil
+}
+
+// Config returns TLS config for the server which always uses latest loaded certificates
+func (r *TLSReloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.lock.RLock()
+			defer r.lock.RUnlock()
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.clientCA,
+				ClientAuth:   r.clientAuth,
+				NextProtos:   []string{"http/1.1"},
+			}, nil
+		},
+	}
+}
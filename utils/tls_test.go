@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type TLSSuite struct {
+	dir      string
+	caCert   *x509.Certificate
+	caKey    *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+	caFile   string
+}
+
+var _ = Suite(&TLSSuite{})
+
+var tlsSerial int64
+
+// issueCert creates certificate signed by CA (self-signed if CA is not set yet)
+func (s *TLSSuite) issueCert(c *C, cn string, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	tlsSerial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(tlsSerial),
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"Example"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+
+	parent, parentKey := template, key
+	if s.caCert != nil {
+		parent, parentKey = s.caCert, s.caKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	c.Assert(err, IsNil)
+	cert, err := x509.ParseCertificate(der)
+	c.Assert(err, IsNil)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, IsNil)
+
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (s *TLSSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	s.caCert, s.caKey = nil, nil
+
+	var caPEM []byte
+	s.caCert, s.caKey, caPEM, _ = s.issueCert(c, "Test CA", true)
+	s.caFile = filepath.Join(s.dir, "ca.crt")
+	c.Assert(os.WriteFile(s.caFile, caPEM, 0644), IsNil)
+
+	s.certFile = filepath.Join(s.dir, "server.crt")
+	s.keyFile = filepath.Join(s.dir, "server.key")
+	s.writeServerCert(c, "server-1")
+}
+
+func (s *TLSSuite) writeServerCert(c *C, cn string) {
+	_, _, certPEM, keyPEM := s.issueCert(c, cn, false)
+	c.Assert(os.WriteFile(s.certFile, certPEM, 0644), IsNil)
+	c.Assert(os.WriteFile(s.keyFile, keyPEM, 0600), IsNil)
+}
+
+// handshake connects to TLS server and returns common name of its certificate
+func (s *TLSSuite) handshake(c *C, config *tls.Config, clientCert *tls.Certificate) (string, error) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	c.Assert(err, IsNil)
+	defer func() { _ = listener.Close() }()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		_ = conn.(*tls.Conn).Handshake()
+		_, _ = conn.Read(make([]byte, 1))
+		_ = conn.Close()
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(s.caCert)
+
+	clientConfig := &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+	if clientCert != nil {
+		clientConfig.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = conn.Close() }()
+
+	// TLS 1.3 reports client certificate rejection on first read
+	_, _ = conn.Write([]byte("x"))
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = conn.Read(make([]byte, 1)); err != nil && !isTimeoutOrEOF(err) {
+		return "", err
+	}
+
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func isTimeoutOrEOF(err error) bool {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return err.Error() == "EOF"
+}
+
+func (s *TLSSuite) TestNewTLSReloader(c *C) {
+	_, err := NewTLSReloader(TLSConfig{CertFile: s.certFile})
+	c.Check(err, ErrorMatches, "both TLS certificate and key should be specified")
+
+	_, err = NewTLSReloader(TLSConfig{CertFile: s.certFile, KeyFile: s.keyFile, ClientCAFile: s.caFile, ClientAuth: "maybe"})
+	c.Check(err, ErrorMatches, "invalid TLS client auth \"maybe\", should be optional or require")
+
+	_, err = NewTLSReloader(TLSConfig{CertFile: s.certFile, KeyFile: s.caFile})
+	c.Check(err, ErrorMatches, "unable to load TLS certificate: .*")
+
+	_, err = NewTLSReloader(TLSConfig{CertFile: s.certFile, KeyFile: s.keyFile, ClientCAFile: s.keyFile})
+	c.Check(err, ErrorMatches, "unable to load TLS client CA: no certificates found in .*")
+
+	reloader, err := NewTLSReloader(TLSConfig{CertFile: s.certFile, KeyFile: s.keyFile})
+	c.Assert(err, IsNil)
+
+	cn, err := s.handshake(c, reloader.Config(), nil)
+	c.Assert(err, IsNil)
+	c.Check(cn, Equals, "server-1")
+}
+
+func (s *TLSSuite) TestReload(c *C) {
+	reloader, err := NewTLSReloader(TLSConfig{CertFile: s.certFile, KeyFile: s.keyFile})
+	c.Assert(err, IsNil)
+	config := reloader.Config()
+
+	s.writeServerCert(c, "server-2")
+	c.Assert(reloader.Reload(), IsNil)
+
+	cn, err := s.handshake(c, config, nil)
+	c.Assert(err, IsNil)
+	c.Check(cn, Equals, "server-2")
+
+	// broken files don't replace working certificate
+	c.Assert(os.WriteFile(s.keyFile, []byte("garbage"), 0600), IsNil)
+	c.Check(reloader.Reload(), ErrorMatches, "unable to load TLS certificate: .*")
+
+	cn, err = s.handshake(c, config, nil)
+	c.Assert(err, IsNil)
+	c.Check(cn, Equals, "server-2")
+}
+
+func (s *TLSSuite) TestClientAuth(c *C) {
+	_, _, certPEM, keyPEM := s.issueCert(c, "client", false)
+	clientCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	c.Assert(err, IsNil)
+
+	reloader, err := NewTLSReloader(TLSConfig{CertFile: s.certFile, KeyFile: s.keyFile, ClientCAFile: s.caFile, ClientAuth: "optional"})
+	c.Assert(err, IsNil)
+
+	_, err = s.handshake(c, reloader.Config(), nil)
+	c.Check(err, IsNil)
+	_, err = s.handshake(c, reloader.Config(), &clientCert)
+	c.Check(err, IsNil)
+
+	reloader, err = NewTLSReloader(TLSConfig{CertFile: s.certFile, KeyFile: s.keyFile, ClientCAFile: s.caFile, ClientAuth: "require"})
+	c.Assert(err, IsNil)
+
+	_, err = s.handshake(c, reloader.Config(), nil)
+	c.Check(err, NotNil)
+	_, err = s.handshake(c, reloader.Config(), &clientCert)
+	c.Check(err, IsNil)
+
+	// certificate issued by another CA is not accepted
+	caCert, caKey := s.caCert, s.caKey
+	s.caCert, s.caKey = nil, nil
+	_, _, certPEM, keyPEM = s.issueCert(c, "intruder", false)
+	s.caCert, s.caKey = caCert, caKey
+	intruderCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	c.Assert(err, IsNil)
+
+	_, err = s.handshake(c, reloader.Config(), &intruderCert)
+	c.Check(err, NotNil)
+}
@@ -0,0 +1,227 @@
+package webdav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// statusError is an unexpected HTTP response from the server
+type statusError struct {
+	Method string
+	Path   string
+	Code   int
+	Status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Method, e.Path, e.Status)
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*statusError)
+	return ok && e.Code == http.StatusNotFound
+}
+
+// resource is a single entry of PROPFIND response
+type resource struct {
+	Path       string
+	Collection bool
+	Size       int64
+	SymLink    string
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				SymLink       string `xml:"http://www.aptly.info/ns/ symlink"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// propfindBody requests properties used by storage, symlink is a dead property
+// set on copies which emulate symbolic links
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:A="http://www.aptly.info/ns/">
+<D:prop><D:resourcetype/><D:getcontentlength/><A:symlink/></D:prop>
+</D:propfind>`
+
+// client performs WebDAV requests relative to base URL
+type client struct {
+	http     *http.Client
+	base     *url.URL
+	user     string
+	password string
+}
+
+// url returns full URL of the path relative to base URL
+func (c *client) url(p string) string {
+	u := *c.base
+	u.Path = path.Join("/", c.base.Path, p)
+	if strings.HasSuffix(p, "/") && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	u.RawPath = ""
+	return u.String()
+}
+
+// request performs request and checks response status against expected ones
+//
+// Response body is closed unless handler is passed
+func (c *client) request(method, p string, body io.Reader, headers map[string]string, handler func(resp *http.Response) error,
+	expected ...int) error {
+	req, err := http.NewRequest(method, c.url(p), body)
+	if err != nil {
+		return err
+	}
+
+	if c.user != "" || c.password != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			if handler != nil {
+				return handler(resp)
+			}
+			return nil
+		}
+	}
+
+	return &statusError{Method: method, Path: p, Code: resp.StatusCode, Status: resp.Status}
+}
+
+// put uploads file contents
+func (c *client) put(p string, body io.Reader) error {
+	return c.request(http.MethodPut, p, body, map[string]string{"Content-Type": "application/octet-stream"}, nil,
+		http.StatusOK, http.StatusCreated, http.StatusNoContent)
+}
+
+// get downloads file contents passing them to handler
+func (c *client) get(p string, handler func(body io.Reader) error) error {
+	return c.request(http.MethodGet, p, nil, nil, func(resp *http.Response) error {
+		return handler(resp.Body)
+	}, http.StatusOK)
+}
+
+// mkcol creates collection, existing collection is not an error
+func (c *client) mkcol(p string) error {
+	return c.request("MKCOL", p+"/", nil, nil, nil, http.StatusCreated, http.StatusMethodNotAllowed)
+}
+
+// remove deletes file or collection (recursively)
+func (c *client) remove(p string) error {
+	return c.request(http.MethodDelete, p, nil, nil, nil, http.StatusOK, http.StatusNoContent)
+}
+
+// move moves src to dst overwriting dst
+func (c *client) move(src, dst string) error {
+	return c.request("MOVE", src, nil, map[string]string{"Destination": c.url(dst), "Overwrite": "T"}, nil,
+		http.StatusCreated, http.StatusNoContent)
+}
+
+// copy copies src to dst overwriting dst
+func (c *client) copy(src, dst string) error {
+	return c.request("COPY", src, nil, map[string]string{"Destination": c.url(dst), "Overwrite": "T"}, nil,
+		http.StatusCreated, http.StatusNoContent)
+}
+
+// setSymLink stores symlink target as a property of the resource
+func (c *client) setSymLink(p, target string) error {
+	var buf strings.Builder
+	buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>` +
+		`<D:propertyupdate xmlns:D="DAV:" xmlns:A="http://www.aptly.info/ns/"><D:set><D:prop><A:symlink>`)
+	_ = xml.EscapeText(&buf, []byte(target))
+	buf.WriteString(`</A:symlink></D:prop></D:set></D:propertyupdate>`)
+
+	var failed error
+
+	err := c.request("PROPPATCH", p, strings.NewReader(buf.String()), map[string]string{"Content-Type": "application/xml"},
+		func(resp *http.Response) error {
+			var result multistatus
+			if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+				return err
+			}
+			for _, r := range result.Responses {
+				for _, ps := range r.Propstat {
+					if !strings.Contains(ps.Status, " 200 ") {
+						failed = fmt.Errorf("PROPPATCH %s: %s", p, ps.Status)
+					}
+				}
+			}
+			return nil
+		}, http.StatusMultiStatus)
+	if err != nil {
+		return err
+	}
+
+	return failed
+}
+
+// propfind lists resource p (depth 0) or its direct members as well (depth 1)
+func (c *client) propfind(p string, depth int) ([]resource, error) {
+	var result []resource
+
+	err := c.request("PROPFIND", p, strings.NewReader(propfindBody),
+		map[string]string{"Depth": strconv.Itoa(depth), "Content-Type": "application/xml"},
+		func(resp *http.Response) error {
+			var ms multistatus
+			if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+				return err
+			}
+
+			for _, r := range ms.Responses {
+				href, err := url.Parse(r.Href)
+				if err != nil {
+					return err
+				}
+
+				relPath := strings.TrimPrefix(href.Path, c.base.Path)
+				res := resource{Path: strings.Trim(relPath, "/")}
+
+				for _, ps := range r.Propstat {
+					if !strings.Contains(ps.Status, " 200 ") {
+						continue
+					}
+					res.Collection = res.Collection || ps.Prop.ResourceType.Collection != nil
+					if ps.Prop.ContentLength != "" {
+						res.Size, _ = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+					}
+					if ps.Prop.SymLink != "" {
+						res.SymLink = ps.Prop.SymLink
+					}
+				}
+
+				result = append(result, res)
+			}
+
+			return nil
+		}, http.StatusMultiStatus)
+
+	return result, err
+}
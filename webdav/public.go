@@ -0,0 +1,344 @@
+package webdav
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// PublishedStorage abstract file system with published files (actually hosted on WebDAV server)
+type PublishedStorage struct {
+	dav        *client
+	verifySize bool
+
+	// directories are created by several components linking from pool in parallel
+	dirCache     map[string]bool
+	dirCacheLock sync.Mutex
+}
+
+// Check interface
+var (
+	_ aptly.PublishedStorage         = (*PublishedStorage)(nil)
+	_ aptly.ChecksumPublishedStorage = (*PublishedStorage)(nil)
+)
+
+// NewPublishedStorage creates published storage rooted at WebDAV collection baseURL
+//
+// verifyMethod is either "md5" (default) or "size", it is used to compare files already
+// present on the server
+func NewPublishedStorage(baseURL, user, password, verifyMethod string) (*PublishedStorage, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing WebDAV URL %s", baseURL)
+	}
+
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported WebDAV URL %s: scheme should be http or https", baseURL)
+	}
+
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	base.RawPath = ""
+
+	return &PublishedStorage{
+		dav: &client{
+			http:     http.DefaultClient,
+			base:     base,
+			user:     user,
+			password: password,
+		},
+		verifySize: strings.EqualFold(verifyMethod, "size"),
+		dirCache:   map[string]bool{},
+	}, nil
+}
+
+// String returns the storage as string
+func (storage *PublishedStorage) String() string {
+	return fmt.Sprintf("WebDAV: %s", storage.dav.base)
+}
+
+// MkDir creates directory recursively under public path
+func (storage *PublishedStorage) MkDir(dir string) error {
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	if dir == "" {
+		return nil
+	}
+
+	storage.dirCacheLock.Lock()
+	cached := storage.dirCache[dir]
+	storage.dirCacheLock.Unlock()
+	if cached {
+		return nil
+	}
+
+	if err := storage.MkDir(path.Dir(dir)); err != nil {
+		return err
+	}
+
+	log.Debug().Msgf("WebDAV: MkDir '%s'", dir)
+	if err := storage.dav.mkcol(dir); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("error creating directory %s in %s", dir, storage))
+	}
+
+	storage.dirCacheLock.Lock()
+	storage.dirCache[dir] = true
+	storage.dirCacheLock.Unlock()
+	return nil
+}
+
+// PutFile puts file into published storage at specified path
+func (storage *PublishedStorage) PutFile(path string, sourceFilename string) error {
+	source, err := os.Open(sourceFilename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+
+	log.Debug().Msgf("WebDAV: PutFile '%s'", path)
+	err = storage.dav.put(path, source)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s", sourceFilename, storage))
+	}
+
+	return err
+}
+
+// Remove removes single file under public path
+func (storage *PublishedStorage) Remove(path string) error {
+	if len(path) <= 0 {
+		panic("trying to remove empty path")
+	}
+
+	log.Debug().Msgf("WebDAV: Remove '%s'", path)
+	err := storage.dav.remove(path)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("error deleting %s from %s", path, storage))
+	}
+	return err
+}
+
+// RemoveDirs removes directory structure under public path
+func (storage *PublishedStorage) RemoveDirs(dir string, progress aptly.Progress) error {
+	if len(dir) <= 0 {
+		panic("trying to remove the root directory")
+	}
+
+	if progress != nil {
+		progress.Printf("Removing %s...\n", storage.dav.url(dir))
+	}
+
+	log.Debug().Msgf("WebDAV: RemoveDirs '%s'", dir)
+	err := storage.dav.remove(dir + "/")
+	if err != nil && !isNotFound(err) {
+		return errors.Wrap(err, fmt.Sprintf("error deleting %s from %s", dir, storage))
+	}
+
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	storage.dirCacheLock.Lock()
+	defer storage.dirCacheLock.Unlock()
+	for cached := range storage.dirCache {
+		if cached == dir || strings.HasPrefix(cached, dir+"/") {
+			delete(storage.dirCache, cached)
+		}
+	}
+
+	return nil
+}
+
+// LinkFromPool links package file from pool to dist's pool location
+//
+// publishedPrefix is desired prefix for the location in the pool.
+// publishedRelPath is desired location in pool (like pool/component/liba/libav/)
+// sourcePool is instance of aptly.PackagePool
+// sourcePath is filepath to package file in package pool
+//
+// LinkFromPool returns relative path for the published file to be included in package index
+func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath, fileName string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo, force bool) error {
+
+	poolPath := path.Join(publishedPrefix, publishedRelPath, fileName)
+
+	dst, err := storage.dav.propfind(poolPath, 0)
+	if err == nil && len(dst) > 0 {
+		// already exists, check source file
+		var same bool
+
+		if storage.verifySize {
+			srcSize, e := sourcePool.Size(sourcePath)
+			if e != nil {
+				// source file doesn't exist? problem!
+				return e
+			}
+
+			same = srcSize == dst[0].Size
+		} else {
+			dstMD5, e := storage.FileMD5(poolPath)
+			if e != nil {
+				return e
+			}
+
+			same = dstMD5 == sourceChecksums.MD5
+		}
+
+		if same {
+			return nil
+		}
+
+		if !force {
+			return fmt.Errorf("error putting file to %s: file already exists and is different: %s", poolPath, storage)
+		}
+	} else if err != nil && !isNotFound(err) {
+		return errors.Wrap(err, fmt.Sprintf("error checking %s in %s", poolPath, storage))
+	}
+
+	err = storage.MkDir(path.Dir(poolPath))
+	if err != nil {
+		return err
+	}
+
+	source, err := sourcePool.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+
+	log.Debug().Msgf("WebDAV: LinkFromPool '%s'", poolPath)
+	err = storage.dav.put(poolPath, source)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s", sourcePath, storage))
+	}
+
+	return err
+}
+
+// Filelist returns list of files under prefix
+func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
+	root := strings.Trim(path.Clean("/"+prefix), "/")
+	result := []string{}
+
+	queue := []string{root}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+
+		entries, err := storage.dav.propfind(dir+"/", 1)
+		if err != nil {
+			if isNotFound(err) && dir == root {
+				// file path doesn't exist, consider it empty
+				return []string{}, nil
+			}
+			return nil, errors.Wrap(err, fmt.Sprintf("error listing %s in %s", dir, storage))
+		}
+
+		for _, entry := range entries {
+			if entry.Path == dir {
+				continue
+			}
+
+			if entry.Collection {
+				queue = append(queue, entry.Path)
+			} else if root == "" {
+				result = append(result, entry.Path)
+			} else {
+				result = append(result, strings.TrimPrefix(entry.Path, root+"/"))
+			}
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// RenameFile renames (moves) file
+func (storage *PublishedStorage) RenameFile(oldName, newName string) error {
+	log.Debug().Msgf("WebDAV: RenameFile %s -> %s", oldName, newName)
+	err := storage.dav.move(oldName, newName)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("error renaming %s -> %s in %s", oldName, newName, storage))
+	}
+
+	return nil
+}
+
+// SymLink creates a copy of src file and stores link target as a property of the copy
+func (storage *PublishedStorage) SymLink(src string, dst string) error {
+	log.Debug().Msgf("WebDAV: SymLink %s -> %s", src, dst)
+	err := storage.dav.copy(src, dst)
+	if err == nil {
+		err = storage.dav.setSymLink(dst, src)
+	}
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("error symlinking %s -> %s in %s", src, dst, storage))
+	}
+
+	return nil
+}
+
+// HardLink creates a copy of src file as hard links do not exist
+func (storage *PublishedStorage) HardLink(src string, dst string) error {
+	log.Debug().Msgf("WebDAV: HardLink %s -> %s", src, dst)
+	err := storage.dav.copy(src, dst)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("error linking %s -> %s in %s", src, dst, storage))
+	}
+
+	return nil
+}
+
+// FileExists returns true if path exists
+func (storage *PublishedStorage) FileExists(path string) (bool, error) {
+	_, err := storage.dav.propfind(path, 0)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReadLink returns the symbolic link pointed to by path.
+// This simply reads the property of the resource created with SymLink
+func (storage *PublishedStorage) ReadLink(path string) (string, error) {
+	resources, err := storage.dav.propfind(path, 0)
+	if err != nil {
+		return "", err
+	}
+
+	if len(resources) == 0 {
+		return "", fmt.Errorf("no properties returned for %s", path)
+	}
+
+	return resources[0].SymLink, nil
+}
+
+// FileMD5 returns MD5 checksum of the file under public path, file is read from the server
+func (storage *PublishedStorage) FileMD5(path string) (string, error) {
+	hash := md5.New()
+
+	err := storage.dav.get(path, func(body io.Reader) error {
+		_, err := io.Copy(hash, body)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
@@ -0,0 +1,305 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+type PublishedStorageSuite struct {
+	srv     *Server
+	storage *PublishedStorage
+}
+
+var _ = Suite(&PublishedStorageSuite{})
+
+func (s *PublishedStorageSuite) SetUpTest(c *C) {
+	s.srv = NewServer()
+	c.Assert(s.srv.WriteDir("/repo"), IsNil)
+
+	var err error
+	s.storage, err = NewPublishedStorage(s.srv.URL+"/dav/repo/", s.srv.User, s.srv.Password, "")
+	c.Assert(err, IsNil)
+}
+
+func (s *PublishedStorageSuite) TearDownTest(c *C) {
+	s.srv.Quit()
+}
+
+func (s *PublishedStorageSuite) GetFile(c *C, path string) []byte {
+	data, err := s.srv.ReadFile(filepath.Join("/repo", path))
+	c.Assert(err, IsNil)
+
+	return data
+}
+
+func (s *PublishedStorageSuite) AssertNoFile(c *C, path string) {
+	_, err := s.srv.FS.Stat(context.Background(), filepath.Join("/repo", path))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *PublishedStorageSuite) PutFile(c *C, path string, data []byte) {
+	c.Assert(s.srv.WriteFile(filepath.Join("/repo", path), data), IsNil)
+}
+
+func (s *PublishedStorageSuite) localFile(c *C, contents string) string {
+	path := filepath.Join(c.MkDir(), "file")
+	c.Assert(os.WriteFile(path, []byte(contents), 0644), IsNil)
+	return path
+}
+
+func (s *PublishedStorageSuite) TestNewPublishedStorage(c *C) {
+	c.Check(s.storage.String(), Equals, "WebDAV: "+s.srv.URL+"/dav/repo")
+
+	_, err := NewPublishedStorage("ftp://example.com/repo", "", "", "")
+	c.Check(err, ErrorMatches, "unsupported WebDAV URL ftp://example.com/repo: scheme should be http or https")
+
+	storage, err := NewPublishedStorage(s.srv.URL+"/dav/repo", s.srv.User, "wrong", "")
+	c.Assert(err, IsNil)
+
+	_, err = storage.FileExists("a")
+	c.Check(err, ErrorMatches, "PROPFIND a: 401 Unauthorized")
+}
+
+func (s *PublishedStorageSuite) TestMkDirPutFile(c *C) {
+	c.Check(s.storage.PutFile("ppa/dists/squeeze/Release", s.localFile(c, "Origin: aptly\n")), ErrorMatches,
+		"error uploading .* to WebDAV: .*: PUT ppa/dists/squeeze/Release: 409 Conflict")
+
+	c.Assert(s.storage.MkDir("ppa/dists/squeeze"), IsNil)
+	c.Assert(s.storage.PutFile("ppa/dists/squeeze/Release", s.localFile(c, "Origin: aptly\n")), IsNil)
+
+	c.Check(s.GetFile(c, "ppa/dists/squeeze/Release"), DeepEquals, []byte("Origin: aptly\n"))
+
+	md5, err := s.storage.FileMD5("ppa/dists/squeeze/Release")
+	c.Check(err, IsNil)
+	c.Check(md5, Equals, "7f9c5b8df62b933d72ba8bd4246b87ba")
+
+	c.Assert(s.storage.PutFile("ppa/dists/squeeze/Release", s.localFile(c, "Origin: other\n")), IsNil)
+	c.Check(s.GetFile(c, "ppa/dists/squeeze/Release"), DeepEquals, []byte("Origin: other\n"))
+
+	// directories are cached
+	mkcols := s.srv.CountRequests("MKCOL")
+	c.Assert(s.storage.MkDir("ppa/dists/squeeze"), IsNil)
+	c.Assert(s.storage.MkDir("ppa/dists"), IsNil)
+	c.Check(s.srv.CountRequests("MKCOL"), Equals, mkcols)
+
+	// existing directories are not an error
+	s.storage.dirCache = map[string]bool{}
+	c.Assert(s.storage.MkDir("ppa/dists/squeeze"), IsNil)
+}
+
+func (s *PublishedStorageSuite) TestMkDirParallel(c *C) {
+	// components are published in parallel, all of them sharing the storage
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.storage.MkDir(fmt.Sprintf("ppa/pool/c%d/m/mars-invaders", i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range errs {
+		c.Check(errs[i], IsNil)
+		c.Assert(s.storage.PutFile(fmt.Sprintf("ppa/pool/c%d/m/mars-invaders/Release", i), s.localFile(c, "Origin: aptly\n")), IsNil)
+	}
+
+	c.Assert(s.storage.RemoveDirs("ppa/pool", nil), IsNil)
+	c.Check(s.storage.dirCache, DeepEquals, map[string]bool{"ppa": true})
+}
+
+func (s *PublishedStorageSuite) TestFilelist(c *C) {
+	paths := []string{"a", "b", "c", "testa", "test/a", "test/b", "lala/a", "lala/b", "lala/c", "lala/d/e"}
+	for _, path := range paths {
+		s.PutFile(c, path, []byte("test"))
+	}
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "lala/a", "lala/b", "lala/c", "lala/d/e", "test/a", "test/b", "testa"})
+
+	list, err = s.storage.Filelist("test")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b"})
+
+	list, err = s.storage.Filelist("lala/")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "d/e"})
+
+	list, err = s.storage.Filelist("test2")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{})
+}
+
+func (s *PublishedStorageSuite) TestRemove(c *C) {
+	s.PutFile(c, "a/b", []byte("test"))
+
+	c.Check(s.storage.Remove("a/b"), IsNil)
+	s.AssertNoFile(c, "a/b")
+
+	c.Check(s.storage.Remove("a/b"), ErrorMatches, "error deleting a/b from WebDAV.*404 Not Found")
+}
+
+func (s *PublishedStorageSuite) TestRemoveDirs(c *C) {
+	paths := []string{"a", "b", "c", "testa", "test/a", "test/b", "lala/a", "lala/b", "lala/c"}
+	for _, path := range paths {
+		s.PutFile(c, path, []byte("test"))
+	}
+
+	c.Assert(s.storage.MkDir("test/x"), IsNil)
+	c.Check(s.storage.RemoveDirs("test", nil), IsNil)
+	c.Check(s.storage.dirCache, DeepEquals, map[string]bool{})
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "lala/a", "lala/b", "lala/c", "testa"})
+
+	c.Check(s.storage.RemoveDirs("test", nil), IsNil)
+}
+
+func (s *PublishedStorageSuite) TestRenameFile(c *C) {
+	s.PutFile(c, "dists/squeeze/Release.tmp", []byte("new"))
+	s.PutFile(c, "dists/squeeze/Release", []byte("old"))
+
+	c.Check(s.storage.RenameFile("dists/squeeze/Release.tmp", "dists/squeeze/Release"), IsNil)
+	c.Check(s.GetFile(c, "dists/squeeze/Release"), DeepEquals, []byte("new"))
+	s.AssertNoFile(c, "dists/squeeze/Release.tmp")
+
+	c.Check(s.storage.RenameFile("dists/squeeze/Release.tmp", "dists/squeeze/Release"), ErrorMatches,
+		"error renaming .*: MOVE dists/squeeze/Release.tmp: 40[34] .*")
+}
+
+func (s *PublishedStorageSuite) TestLinks(c *C) {
+	s.PutFile(c, "a/b", []byte("test"))
+
+	c.Assert(s.storage.SymLink("a/b", "a/b.link"), IsNil)
+
+	link, err := s.storage.ReadLink("a/b.link")
+	c.Check(err, IsNil)
+	c.Check(link, Equals, "a/b")
+	c.Check(s.GetFile(c, "a/b.link"), DeepEquals, []byte("test"))
+
+	c.Assert(s.storage.HardLink("a/b", "a/b.hard"), IsNil)
+	c.Check(s.GetFile(c, "a/b.hard"), DeepEquals, []byte("test"))
+
+	link, err = s.storage.ReadLink("a/b")
+	c.Check(err, IsNil)
+	c.Check(link, Equals, "")
+
+	_, err = s.storage.ReadLink("a/c")
+	c.Check(err, ErrorMatches, "PROPFIND a/c: 404 Not Found")
+
+	c.Check(s.storage.SymLink("a/c", "a/c.link"), ErrorMatches, "error symlinking a/c -> a/c.link .*404 Not Found")
+}
+
+func (s *PublishedStorageSuite) TestFileExists(c *C) {
+	s.PutFile(c, "a/b", []byte("test"))
+
+	exists, err := s.storage.FileExists("a/b")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, true)
+
+	exists, err = s.storage.FileExists("a/c")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, false)
+}
+
+func (s *PublishedStorageSuite) TestLinkFromPool(c *C) {
+	root := c.MkDir()
+	pool := files.NewPackagePool(root, false)
+	cs := files.NewMockChecksumStorage()
+
+	tmpFile1 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err := os.WriteFile(tmpFile1, []byte("Contents"), 0644)
+	c.Assert(err, IsNil)
+	cksum1 := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	tmpFile2 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err = os.WriteFile(tmpFile2, []byte("Spam"), 0644)
+	c.Assert(err, IsNil)
+	cksum2 := utils.ChecksumInfo{MD5: "e9dfd31cc505d51fc26975250750deab"}
+
+	tmpFile3 := filepath.Join(c.MkDir(), "netboot/boot.img.gz")
+	_ = os.MkdirAll(filepath.Dir(tmpFile3), 0777)
+	err = os.WriteFile(tmpFile3, []byte("Contents"), 0644)
+	c.Assert(err, IsNil)
+	cksum3 := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	src1, err := pool.Import(tmpFile1, "mars-invaders_1.03.deb", &cksum1, true, cs)
+	c.Assert(err, IsNil)
+	src2, err := pool.Import(tmpFile2, "mars-invaders_1.03.deb", &cksum2, true, cs)
+	c.Assert(err, IsNil)
+	src3, err := pool.Import(tmpFile3, "netboot/boot.img.gz", &cksum3, true, cs)
+	c.Assert(err, IsNil)
+
+	// first link from pool
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+
+	c.Check(s.GetFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contents"))
+
+	// duplicate link from pool, providing wrong path for source file
+	//
+	// file already exists on the server with the same checksum, so it is not uploaded again
+	puts := s.srv.CountRequests("PUT")
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, "wrong-path", cksum1, false)
+	c.Check(err, IsNil)
+	c.Check(s.srv.CountRequests("PUT"), Equals, puts)
+
+	// link from pool with conflict
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, false)
+	c.Check(err, ErrorMatches, ".*file already exists and is different.*")
+
+	c.Check(s.GetFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contents"))
+
+	// link from pool with conflict and force
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, true)
+	c.Check(err, IsNil)
+
+	c.Check(s.GetFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Spam"))
+
+	// link from pool with prefix and nested file name
+	err = s.storage.LinkFromPool("ppa", "dists/jessie/non-free/installer-i386/current/images", "netboot/boot.img.gz", pool, src3, cksum3, false)
+	c.Check(err, IsNil)
+
+	c.Check(s.GetFile(c, "ppa/dists/jessie/non-free/installer-i386/current/images/netboot/boot.img.gz"), DeepEquals, []byte("Contents"))
+}
+
+func (s *PublishedStorageSuite) TestLinkFromPoolVerifySize(c *C) {
+	storage, err := NewPublishedStorage(s.srv.URL+"/dav/repo", s.srv.User, s.srv.Password, "size")
+	c.Assert(err, IsNil)
+
+	root := c.MkDir()
+	pool := files.NewPackagePool(root, false)
+	cs := files.NewMockChecksumStorage()
+
+	tmpFile := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	c.Assert(os.WriteFile(tmpFile, []byte("Contents"), 0644), IsNil)
+	cksum := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	src, err := pool.Import(tmpFile, "mars-invaders_1.03.deb", &cksum, true, cs)
+	c.Assert(err, IsNil)
+
+	// same size, different contents: considered the same
+	s.PutFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb", []byte("Contentz"))
+
+	err = storage.LinkFromPool("", "pool/main/m/mars-invaders", "mars-invaders_1.03.deb", pool, src, cksum, false)
+	c.Check(err, IsNil)
+	c.Check(s.GetFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contentz"))
+	c.Check(s.srv.CountRequests("GET"), Equals, 0)
+
+	// different size
+	s.PutFile(c, "pool/main/m/mars-invaders/mars-invaders_1.03.deb", []byte("Spam"))
+
+	err = storage.LinkFromPool("", "pool/main/m/mars-invaders", "mars-invaders_1.03.deb", pool, src, cksum, false)
+	c.Check(err, ErrorMatches, ".*file already exists and is different.*")
+}
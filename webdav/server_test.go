@@ -0,0 +1,133 @@
+package webdav
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+
+	"golang.org/x/net/webdav"
+)
+
+// Server is WebDAV server used for testing, files are kept in memory
+type Server struct {
+	*httptest.Server
+
+	FS       webdav.FileSystem
+	User     string
+	Password string
+
+	mu       sync.Mutex
+	Requests []string
+}
+
+// NewServer starts WebDAV server serving under /dav/ with basic auth
+func NewServer() *Server {
+	srv := &Server{
+		FS:       webdav.NewMemFS(),
+		User:     "aptly",
+		Password: "secret",
+	}
+
+	handler := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: srv.FS,
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.mu.Lock()
+		srv.Requests = append(srv.Requests, r.Method+" "+r.URL.Path)
+		srv.mu.Unlock()
+
+		user, password, ok := r.BasicAuth()
+		if !ok || user != srv.User || password != srv.Password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="aptly"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+
+	return srv
+}
+
+// Quit stops the server
+func (srv *Server) Quit() {
+	srv.Close()
+}
+
+// ReadFile returns contents of the file on the server
+func (srv *Server) ReadFile(name string) ([]byte, error) {
+	f, err := srv.FS.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	return io.ReadAll(f)
+}
+
+// WriteFile creates file on the server with all parent directories
+func (srv *Server) WriteFile(name string, data []byte) error {
+	ctx := context.Background()
+
+	dir := path.Dir(path.Clean("/" + name))
+	if dir != "/" {
+		if err := srv.WriteDir(dir); err != nil {
+			return err
+		}
+	}
+
+	f, err := srv.FS.OpenFile(ctx, name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// WriteDir creates directory on the server with all parent directories
+func (srv *Server) WriteDir(name string) error {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return nil
+	}
+
+	if err := srv.WriteDir(path.Dir(name)); err != nil {
+		return err
+	}
+
+	err := srv.FS.Mkdir(context.Background(), name, 0755)
+	if os.IsExist(err) {
+		return nil
+	}
+	return err
+}
+
+// CountRequests returns number of requests with specified method
+func (srv *Server) CountRequests(method string) int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	count := 0
+	for _, r := range srv.Requests {
+		if len(r) > len(method) && r[:len(method)+1] == method+" " {
+			count++
+		}
+	}
+
+	return count
+}
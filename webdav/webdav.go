@@ -0,0 +1,2 @@
+// Package webdav handles publishing to WebDAV servers
+package webdav